@@ -0,0 +1,261 @@
+package alarm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tryffel/fusio/err"
+	"github.com/tryffel/fusio/storage"
+	"github.com/tryffel/fusio/storage/Influxdb"
+	"github.com/tryffel/fusio/storage/models"
+	"math"
+	"time"
+)
+
+// Maximum number of intervals to read when rebuilding baseline from history
+const maxBaselineHistory = 300
+
+// movingStats is exponentially weighted mean and variance
+type movingStats struct {
+	Count    int64   `json:"count"`
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+}
+
+func (m *movingStats) update(value float64, alpha float64) {
+	m.Count += 1
+	if m.Count == 1 {
+		m.Mean = value
+		m.Variance = 0
+		return
+	}
+	diff := value - m.Mean
+	increment := alpha * diff
+	m.Mean += increment
+	m.Variance = (1 - alpha) * (m.Variance + diff*increment)
+}
+
+// baseline learns normal behaviour of single measurement series
+type baseline struct {
+	config   models.AnomalyConfig
+	location *time.Location
+	// Values of rolling window
+	Values []float64 `json:"values,omitempty"`
+	// Buckets has single item for ewma and one per hour for seasonal baseline
+	Buckets []movingStats `json:"buckets,omitempty"`
+}
+
+func newBaseline(config models.AnomalyConfig) (*baseline, error) {
+	b := &baseline{
+		config:   config.WithDefaults(),
+		location: time.UTC,
+	}
+	switch b.config.Method {
+	case models.BaselineRolling:
+		b.Values = []float64{}
+	case models.BaselineEwma:
+		b.Buckets = make([]movingStats, 1)
+	case models.BaselineSeasonal:
+		b.Buckets = make([]movingStats, 24)
+	default:
+		return b, fmt.Errorf("unknown baseline method '%s'", b.config.Method)
+	}
+
+	if b.config.Zone != "" {
+		location, err := time.LoadLocation(b.config.Zone)
+		if err != nil {
+			return b, fmt.Errorf("invalid time zone '%s'", b.config.Zone)
+		}
+		b.location = location
+	}
+	return b, nil
+}
+
+// loadBaseline restores baseline from serialized state
+func loadBaseline(config models.AnomalyConfig, state string) (*baseline, error) {
+	b, err := newBaseline(config)
+	if err != nil || state == "" {
+		return b, err
+	}
+	err = json.Unmarshal([]byte(state), b)
+	return b, err
+}
+
+func (b *baseline) String() string {
+	j, _ := json.Marshal(b)
+	return string(j)
+}
+
+func (b *baseline) bucket(t time.Time) *movingStats {
+	if b.config.Method == models.BaselineSeasonal {
+		return &b.Buckets[t.In(b.location).Hour()]
+	}
+	return &b.Buckets[0]
+}
+
+// score returns z-score of value at time t. If baseline doesn't have enough samples yet, ok is false
+func (b *baseline) score(value float64, t time.Time) (z float64, ok bool) {
+	var mean, variance float64
+	if b.config.Method == models.BaselineRolling {
+		n := len(b.Values)
+		if int64(n) < b.config.MinSamples {
+			return 0, false
+		}
+		for _, v := range b.Values {
+			mean += v
+		}
+		mean /= float64(n)
+		for _, v := range b.Values {
+			variance += (v - mean) * (v - mean)
+		}
+		variance /= float64(n)
+	} else {
+		stats := b.bucket(t)
+		if stats.Count < b.config.MinSamples {
+			return 0, false
+		}
+		mean = stats.Mean
+		variance = stats.Variance
+	}
+
+	std := math.Sqrt(variance)
+	if std == 0 {
+		if value == mean {
+			return 0, true
+		}
+		return math.Copysign(math.Inf(1), value-mean), true
+	}
+	return (value - mean) / std, true
+}
+
+func (b *baseline) update(value float64, t time.Time) {
+	if b.config.Method == models.BaselineRolling {
+		b.Values = append(b.Values, value)
+		if int64(len(b.Values)) > b.config.Window {
+			b.Values = b.Values[int64(len(b.Values))-b.config.Window:]
+		}
+		return
+	}
+	b.bucket(t).update(value, b.config.Alpha)
+}
+
+// feed scores each point against baseline and then adds it to baseline. Streak counts consecutive points
+// that exceed threshold.
+func (b *baseline) feed(state *models.AlarmBaseline, points []Influxdb.Point) {
+	for _, p := range points {
+		if p.Missing || !p.Timestamp.After(state.LastTimestamp) {
+			continue
+		}
+		value := float64(p.Value)
+		z, ok := b.score(value, p.Timestamp)
+		if ok && math.Abs(z) > b.config.Threshold {
+			state.Streak += 1
+		} else {
+			state.Streak = 0
+		}
+		state.LastZ = z
+		state.LastValue = value
+		state.LastTimestamp = p.Timestamp
+		b.update(value, p.Timestamp)
+	}
+	state.State = b.String()
+}
+
+// ValuateAnomaly evaluates anomaly alarm. Baseline is maintained separately for each device in group
+// and each filter. Alarm fires when any of them has exceeded threshold for alarm limit consecutive intervals.
+func ValuateAnomaly(ctx context.Context, alarm *models.Alarm, store storage.Store) (bool, error, *map[string]float64) {
+	out := make(map[string]float64)
+	if alarm.Filter.Anomaly == nil {
+		return false, &Err.Error{Code: Err.Einvalid, Err: errors.New("anomaly alarm has no configuration")}, &out
+	}
+	config := alarm.Filter.Anomaly.WithDefaults()
+	if alarm.RunInterval <= 0 {
+		return false, &Err.Error{Code: Err.Einvalid, Err: errors.New("anomaly alarm has no interval")}, &out
+	}
+	limit := alarm.Filter.Limit
+	if limit < 1 {
+		limit = 1
+	}
+
+	devices, err := alarmDevices(alarm, store)
+	if err != nil {
+		return false, err, &out
+	}
+	stored, err := store.Alarm.GetBaselines(alarm)
+	if err != nil {
+		return false, err, &out
+	}
+	baselines := make(map[string]*models.AlarmBaseline, len(*stored))
+	for i, v := range *stored {
+		baselines[v.DeviceId+"/"+v.Key] = &(*stored)[i]
+	}
+
+	// Only full intervals are evaluated
+	interval := alarm.RunInterval
+	to := time.Now().Truncate(interval)
+	fired := false
+
+	for _, device := range *devices {
+		states := make(map[string]*models.AlarmBaseline, len(alarm.Filter.Filters))
+		from := to
+		for _, filter := range alarm.Filter.Filters {
+			key := filter.StringSimplified()
+			state := baselines[device+"/"+key]
+			if state == nil || state.Config != config.String() {
+				// Config has changed or baseline is new, rebuild it from history
+				id := uint(0)
+				if state != nil {
+					id = state.ID
+				}
+				state = &models.AlarmBaseline{ID: id, AlarmId: alarm.ID, DeviceId: device, Key: key,
+					Config: config.String()}
+			}
+			states[key] = state
+
+			start := state.LastTimestamp.Add(interval)
+			if state.LastTimestamp.IsZero() || to.Sub(start) > maxBaselineHistory*interval {
+				start = to.Add(-maxBaselineHistory * interval)
+			}
+			if start.Before(from) {
+				from = start
+			}
+		}
+
+		if from.Before(to) {
+			batch, err := store.Measurement.Read(ctx, device, alarm.Group, alarm.Filter.Filters, from, to,
+				int64(to.Sub(from)/interval), Influxdb.DefaultReadOpts())
+			if err != nil {
+				return false, err, &out
+			}
+
+			for key, state := range states {
+				b, err := loadBaseline(config, state.State)
+				if err != nil {
+					return false, &Err.Error{Code: Err.Einvalid, Err: err}, &out
+				}
+				points := make([]Influxdb.Point, 0, len(batch[key]))
+				for _, p := range batch[key] {
+					// Skip interval that is still in progress
+					if p.Timestamp.Before(to) {
+						points = append(points, p)
+					}
+				}
+				b.feed(state, points)
+				err = store.Alarm.SaveBaseline(state)
+				if err != nil {
+					return false, err, &out
+				}
+			}
+		}
+
+		for key, state := range states {
+			if state.Streak >= limit {
+				fired = true
+				out[fmt.Sprintf("%s.%s", device, key)] = state.LastValue
+				out[fmt.Sprintf("%s.%s_zscore", device, key)] = state.LastZ
+			}
+		}
+	}
+	return fired, nil, &out
+}
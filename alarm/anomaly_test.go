@@ -0,0 +1,87 @@
+package alarm
+
+import (
+	"github.com/tryffel/fusio/storage/Influxdb"
+	"github.com/tryffel/fusio/storage/models"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBaselineFeed(t *testing.T) {
+	start := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	series := func(values ...float32) []Influxdb.Point {
+		points := make([]Influxdb.Point, len(values))
+		for i, v := range values {
+			points[i] = Influxdb.Point{Value: v, Timestamp: start.Add(time.Duration(i) * time.Hour)}
+		}
+		return points
+	}
+
+	cases := []struct {
+		name   string
+		config models.AnomalyConfig
+		values []float32
+		streak int64
+	}{
+		{"rolling normal", models.AnomalyConfig{Method: models.BaselineRolling, MinSamples: 4},
+			[]float32{10, 11, 9, 10, 11, 10}, 0},
+		{"rolling spike", models.AnomalyConfig{Method: models.BaselineRolling, MinSamples: 4},
+			[]float32{10, 11, 9, 10, 11, 30}, 1},
+		{"not enough samples", models.AnomalyConfig{Method: models.BaselineRolling, MinSamples: 10},
+			[]float32{10, 11, 9, 10, 11, 30}, 0},
+		{"ewma spike", models.AnomalyConfig{Method: models.BaselineEwma, MinSamples: 4, Alpha: 0.1},
+			[]float32{10, 11, 9, 10, 11, 10, 30, 40}, 2},
+	}
+
+	for _, c := range cases {
+		b, err := newBaseline(c.config)
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+		state := &models.AlarmBaseline{}
+		b.feed(state, series(c.values...))
+		if state.Streak != c.streak {
+			t.Errorf("%s: expected streak %d, got %d (z %f)", c.name, c.streak, state.Streak, state.LastZ)
+		}
+
+		// Restored baseline must continue from same state
+		restored, err := loadBaseline(c.config, state.State)
+		if err != nil {
+			t.Errorf("%s: failed to restore baseline: %s", c.name, err)
+			continue
+		}
+		next := start.Add(time.Duration(len(c.values)) * time.Hour)
+		z1, ok1 := b.score(10, next)
+		z2, ok2 := restored.score(10, next)
+		if ok1 != ok2 || math.Abs(z1-z2) > 1e-9 {
+			t.Errorf("%s: restored baseline differs: %f, %f", c.name, z1, z2)
+		}
+	}
+}
+
+func TestSeasonalBaseline(t *testing.T) {
+	b, err := newBaseline(models.AnomalyConfig{Method: models.BaselineSeasonal, MinSamples: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Daily cycle: 20 at noon, 0 at midnight
+	start := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	for day := 0; day < 5; day++ {
+		b.update(float64(day%2), start.AddDate(0, 0, day))
+		b.update(float64(20+day%2), start.AddDate(0, 0, day).Add(12*time.Hour))
+	}
+
+	noon := start.AddDate(0, 0, 5).Add(12 * time.Hour)
+	if z, ok := b.score(20.5, noon); !ok || math.Abs(z) > 3 {
+		t.Errorf("normal value at noon should not be anomaly, z: %f", z)
+	}
+	if z, ok := b.score(20.5, noon.Add(-12*time.Hour)); !ok || math.Abs(z) < 3 {
+		t.Errorf("noon value at midnight should be anomaly, z: %f", z)
+	}
+	if _, ok := b.score(10, noon.Add(time.Hour)); ok {
+		t.Error("hour without samples should not be scored")
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"github.com/tryffel/fusio/err"
 	"github.com/tryffel/fusio/metrics"
 	"github.com/tryffel/fusio/storage"
+	"github.com/tryffel/fusio/storage/models"
+	"os"
 	"runtime/debug"
 	"sync"
 	"time"
@@ -15,6 +17,8 @@ import (
 
 const (
 	MinTimeInterval = time.Second * 5
+	// DefaultLeaseTimeout is time after which other instance takes over alarms from failed instance
+	DefaultLeaseTimeout = time.Second * 30
 )
 
 // Background task to run periodically and valuate alarms
@@ -26,6 +30,14 @@ type BackgroundTask struct {
 	lastRun     time.Time
 	store       *storage.Store
 	metrics     metrics.Metrics
+	pool        *Pool
+	// instance holds alarm lease when running alongside other instances
+	instance     string
+	leaseTimeout time.Duration
+	leader       bool
+	// leaderUntil is time lease taken at last successful acquire expires at the latest. Instance that
+	// fails to renew lease in time stops evaluating even if it hasn't noticed losing lease
+	leaderUntil time.Time
 }
 
 // NewBackgrounTask Create new alarming background task
@@ -38,6 +50,21 @@ func NewBackgroundTask(config config.Config, store *storage.Store, metric metric
 	bt.interval = interval
 	bt.store = store
 	bt.metrics = metric
+	bt.pool = NewPool(config.Alarms.Workers, time.Duration(config.Alarms.Timeout), store, metric)
+	bt.pool.active = bt.IsLeader
+
+	bt.instance = config.Alarms.Instance
+	if bt.instance == "" {
+		bt.instance, _ = os.Hostname()
+		bt.instance = fmt.Sprintf("%s-%d", bt.instance, os.Getpid())
+	}
+	bt.leaseTimeout = time.Duration(config.Alarms.LeaseTimeout)
+	if bt.leaseTimeout == 0 {
+		bt.leaseTimeout = DefaultLeaseTimeout
+	}
+	if bt.leaseTimeout < MinTimeInterval {
+		return bt, errors.New(fmt.Sprintf("Minimum lease timeout for alarms is %s", MinTimeInterval.String()))
+	}
 	bt.initialized = true
 	return bt, nil
 }
@@ -67,13 +94,20 @@ func (b *BackgroundTask) Stop() {
 	}
 }
 
-// Alarming loop
+// Alarming loop. Only instance holding alarm lease evaluates alarms
 func (b *BackgroundTask) loop() {
 	logrus.Info("Running alarms every ", b.interval.String())
+	b.renewLease()
+	go b.leaseLoop()
 	for b.IsRunning() {
-		b.runAlarms()
+		if b.IsLeader() {
+			b.runAlarms()
+			b.runEscalations()
+		}
 		time.Sleep(b.interval)
 	}
+	err := b.store.Lease.Release(models.LeaseAlarms, b.instance)
+	Err.Log(err)
 	logrus.Info("Alarm task stopped")
 }
 
@@ -84,6 +118,72 @@ func (b *BackgroundTask) IsRunning() bool {
 	return b.running
 }
 
+// IsLeader returns true if instance holds alarm lease and lease hasn't expired since it was last renewed
+func (b *BackgroundTask) IsLeader() bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.leader && time.Now().Before(b.leaderUntil)
+}
+
+// leaseLoop renews alarm lease while task is running, so that lease doesn't expire during long evaluations
+func (b *BackgroundTask) leaseLoop() {
+	for {
+		time.Sleep(b.leaseTimeout / 3)
+		if !b.IsRunning() {
+			return
+		}
+		b.renewLease()
+	}
+}
+
+// renewLease takes or renews alarm lease. Lease is valid for lease timeout counted from start of acquire,
+// since database sets expiry after that
+func (b *BackgroundTask) renewLease() {
+	start := time.Now()
+	leader, err := b.acquireLease()
+	if err != nil {
+		Err.Log(err)
+		leader = false
+	}
+
+	b.lock.Lock()
+	changed := leader != b.leader
+	b.leader = leader
+	if leader {
+		b.leaderUntil = start.Add(b.leaseTimeout)
+	}
+	b.lock.Unlock()
+
+	if changed && leader {
+		logrus.Info("Instance ", b.instance, " took over alarm evaluation")
+		b.metrics.GaugeIncrease("alarm_leader", 1)
+	} else if changed {
+		logrus.Warning("Instance ", b.instance, " lost alarm lease, other instance evaluates alarms")
+		b.metrics.GaugeDecrease("alarm_leader", 1)
+	}
+}
+
+// acquireLease acquires lease, giving up once renewal would no longer leave time before lease expires.
+// Acquire that outlives timeout is abandoned and its result ignored
+func (b *BackgroundTask) acquireLease() (bool, error) {
+	type result struct {
+		acquired bool
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		acquired, err := b.store.Lease.Acquire(models.LeaseAlarms, b.instance, b.leaseTimeout)
+		done <- result{acquired: acquired, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.acquired, r.err
+	case <-time.After(b.leaseTimeout / 4):
+		return false, &Err.Error{Code: Err.Einternal, Err: errors.New("timeout acquiring alarm lease")}
+	}
+}
+
 // Run alarms evaluation
 func (b *BackgroundTask) runAlarms() {
 	start := time.Now()
@@ -114,8 +214,19 @@ func (b *BackgroundTask) runAlarms() {
 	if len(*alarms) == 0 {
 		return
 	} else {
-		RunAlarms(*alarms, *b.store, b.metrics)
+		b.pool.Run(*alarms)
 	}
 	duration := time.Since(start)
 	b.metrics.CounterIncrease("alarm_evaluation_time_us", float64(duration.Nanoseconds()/1000))
 }
+
+// Run escalation steps that are due. Escalations are persisted, so they continue where they were after restart
+func (b *BackgroundTask) runEscalations() {
+	defer func() {
+		if err := recover(); err != nil {
+			logrus.Error("Panic in escalation task: ", err)
+			debug.PrintStack()
+		}
+	}()
+	RunEscalations(*b.store, b.metrics, time.Now())
+}
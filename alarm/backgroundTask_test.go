@@ -0,0 +1,47 @@
+package alarm
+
+import (
+	"github.com/tryffel/fusio/metrics"
+	"github.com/tryffel/fusio/storage"
+	"github.com/tryffel/fusio/storage/repository_mock"
+	"testing"
+	"time"
+)
+
+// stalledLease never returns from Acquire until released
+type stalledLease struct {
+	repository_mock.MockLeaseRepository
+	release chan bool
+}
+
+func (s *stalledLease) Acquire(name string, holder string, ttl time.Duration) (bool, error) {
+	<-s.release
+	return true, nil
+}
+
+func TestLeaderExpires(t *testing.T) {
+	store, _ := storage.NewMockStore()
+	b := &BackgroundTask{store: store, metrics: &metrics.MockTask{}, instance: "a", leaseTimeout: time.Millisecond * 80}
+
+	b.renewLease()
+	if !b.IsLeader() {
+		t.Fatal("expected instance to take lease")
+	}
+	time.Sleep(b.leaseTimeout)
+	if b.IsLeader() {
+		t.Error("expected leadership to end once lease expired without renewal")
+	}
+
+	b.renewLease()
+	lease := &stalledLease{release: make(chan bool)}
+	defer close(lease.release)
+	store.Lease = lease
+	start := time.Now()
+	b.renewLease()
+	if took := time.Since(start); took >= b.leaseTimeout/3 {
+		t.Errorf("expected stalled acquire to time out before next renewal, took %s", took)
+	}
+	if b.IsLeader() {
+		t.Error("expected instance to lose lease when acquire stalls")
+	}
+}
@@ -0,0 +1,252 @@
+package alarm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tryffel/fusio/err"
+	"github.com/tryffel/fusio/storage"
+	"github.com/tryffel/fusio/storage/Influxdb"
+	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/storage/repository"
+	"sort"
+	"time"
+)
+
+const (
+	// Maximum number of intervals to replay in single backtest
+	maxBacktestWindows = 5000
+	// Number of intervals to read from influxdb at once
+	backtestChunk = 250
+)
+
+// BacktestEvent is change of alarm state during backtest. Severity change while fired is reported as fire
+// with new severity
+type BacktestEvent struct {
+	Timestamp time.Time
+	Type      OutputType
+	Severity  models.Severity
+	// Device is set for per-device alarms
+	Device string
+	Values map[string]float64
+	// Suppressed is set if alarm was flapping, in which case no outputs would have been pushed
+	Suppressed bool
+}
+
+// Backtest replays threshold alarm over measurements between from and to. Each interval is evaluated
+// as if alarm was run at end of it, with same pending and flapping rules as running alarm.
+// Nothing is persisted and no outputs are pushed.
+func Backtest(ctx context.Context, alarm *models.Alarm, store storage.Store, from time.Time, to time.Time) ([]BacktestEvent, error) {
+	events := []BacktestEvent{}
+	if alarm.Filter.GetType() != models.AlarmThreshold {
+		return events, &Err.Error{Code: Err.Einvalid, Err: errors.New("only threshold alarms can be backtested")}
+	}
+	interval := alarm.RunInterval
+	if interval <= 0 {
+		return events, &Err.Error{Code: Err.Einvalid, Err: errors.New("alarm has no interval")}
+	}
+	windows := int64(to.Sub(from) / interval)
+	if windows < 1 {
+		return events, &Err.Error{Code: Err.Einvalid, Err: errors.New("time range is shorter than alarm interval")}
+	}
+	if windows > maxBacktestWindows {
+		return events, &Err.Error{Code: Err.Einvalid,
+			Err: fmt.Errorf("time range has %d intervals, maximum is %d", windows, maxBacktestWindows)}
+	}
+
+	devices := []string{""}
+	if alarm.GetScope() == models.ScopePerDevice {
+		groupDevices, err := alarmDevices(alarm, store)
+		if err != nil {
+			return events, err
+		}
+		devices = *groupDevices
+	}
+
+	for _, device := range devices {
+		query := alarm.ToAlarmQuery()
+		query.Fired = false
+		if device != "" {
+			query.Device = device
+		}
+		batch, err := readHistory(ctx, store.Measurement, query, from, to)
+		if err != nil {
+			return events, err
+		}
+		deviceEvents, err := replay(alarm, query, batch, from, device)
+		if err != nil {
+			return events, err
+		}
+		events = append(events, deviceEvents...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+	return events, nil
+}
+
+// lookback returns number of intervals needed to evaluate query
+func lookback(query *models.AlarmQuery) int64 {
+	n := query.Limit
+	if query.ClearLimit > n {
+		n = query.ClearLimit
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// readHistory reads measurements of query with one point per interval, in chunks that fit in single read.
+// History needed to evaluate first interval is included.
+func readHistory(ctx context.Context, i repository.Measurement, query *models.AlarmQuery, from time.Time, to time.Time) (Influxdb.Batch,
+	error) {
+	opts := Influxdb.DefaultReadOpts()
+	opts.Fill = Influxdb.FillNull
+	start := from.Add(-time.Duration(lookback(query)) * query.Interval)
+	chunk := time.Duration(backtestChunk) * query.Interval
+
+	batch := Influxdb.Batch{}
+	for chunkStart := start; chunkStart.Before(to); chunkStart = chunkStart.Add(chunk) {
+		chunkEnd := chunkStart.Add(chunk)
+		if chunkEnd.After(to) {
+			chunkEnd = to
+		}
+		n := int64(chunkEnd.Sub(chunkStart) / query.Interval)
+		if n < 1 {
+			n = 1
+		}
+		meas, err := i.Read(ctx, query.Device, query.Group, query.Filters, chunkStart, chunkEnd, n, opts)
+		if err != nil {
+			return batch, err
+		}
+		// Chunks overlap at boundaries
+		for key, points := range meas {
+			series := batch[key]
+			for _, p := range points {
+				if len(series) > 0 && !p.Timestamp.After(series[len(series)-1].Timestamp) {
+					continue
+				}
+				series = append(series, p)
+			}
+			batch[key] = series
+		}
+	}
+	return batch, nil
+}
+
+// commonTimestamps returns timestamps that every series of batch has a point at, in ascending order
+func commonTimestamps(batch Influxdb.Batch) []time.Time {
+	counts := make(map[int64]int)
+	points := make(map[int64]time.Time)
+	for _, v := range batch {
+		for _, p := range v {
+			counts[p.Timestamp.UnixNano()] += 1
+			points[p.Timestamp.UnixNano()] = p.Timestamp
+		}
+	}
+	timestamps := make([]time.Time, 0)
+	for ts, count := range counts {
+		if count == len(batch) {
+			timestamps = append(timestamps, points[ts])
+		}
+	}
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i].Before(timestamps[j])
+	})
+	return timestamps
+}
+
+// replayTarget is state of alarm or device during replay
+type replayTarget struct {
+	state        models.AlarmState
+	pendingSince time.Time
+	fired        models.Severity
+	flapping     bool
+	// changes holds fires and resolves within flap window
+	changes []time.Time
+}
+
+// updateFlapping checks whether target is flapping at given time, like updateFlapping does for running alarm
+func (r *replayTarget) updateFlapping(alarm *models.Alarm, now time.Time) {
+	if alarm.FlapWindow <= 0 || alarm.FlapThreshold <= 0 {
+		return
+	}
+	since := now.Add(-alarm.FlapWindow)
+	for len(r.changes) > 0 && r.changes[0].Before(since) {
+		r.changes = r.changes[1:]
+	}
+	r.flapping = isFlapping(r.flapping, len(r.changes), alarm.FlapThreshold)
+}
+
+// replay evaluates query at each point of batch starting from given time and returns state changes.
+// Point timestamps are used as evaluation time, so that alarms for duration and flap window apply as they
+// would have at that time
+func replay(alarm *models.Alarm, query *models.AlarmQuery, batch Influxdb.Batch, from time.Time,
+	device string) ([]BacktestEvent, error) {
+	events := []BacktestEvent{}
+	n := int(lookback(query))
+	// Series may have gaps that others don't have, each key is windowed up to same timestamp
+	next := make(map[string]int, len(batch))
+	t := &replayTarget{state: models.StateInactive}
+	for _, ts := range commonTimestamps(batch) {
+		window := make(Influxdb.Batch, len(batch))
+		enough := true
+		for key, v := range batch {
+			i := next[key]
+			for i < len(v) && !v[i].Timestamp.After(ts) {
+				i++
+			}
+			next[key] = i
+			window[key] = v[:i]
+			enough = enough && i >= n
+		}
+		if !enough || ts.Before(from) {
+			continue
+		}
+
+		query.Fired = t.state == models.StateFiring
+		severity, err, values := ValuateSeverity(query, window)
+		if err != nil {
+			return events, err
+		}
+
+		event := BacktestEvent{Timestamp: ts, Severity: severity, Device: device, Values: *values}
+		switch nextAction(t.state, severity != "", t.pendingSince, alarm.ForDuration, ts) {
+		case actionPending:
+			t.state = models.StatePending
+			t.pendingSince = ts
+		case actionInactive:
+			t.state = models.StateInactive
+		case actionFire:
+			t.state = models.StateFiring
+			t.fired = severity
+			t.changes = append(t.changes, ts)
+			t.updateFlapping(alarm, ts)
+			event.Type = Fire
+			event.Suppressed = t.flapping
+			events = append(events, event)
+		case actionClear:
+			event.Type = Clear
+			event.Severity = t.fired
+			t.state = models.StateResolved
+			t.fired = ""
+			t.changes = append(t.changes, ts)
+			t.updateFlapping(alarm, ts)
+			event.Suppressed = t.flapping
+			events = append(events, event)
+		case actionNone:
+			if t.state == models.StateFiring && severity != "" && severity != t.fired {
+				t.fired = severity
+				event.Type = Fire
+				event.Suppressed = t.flapping
+				events = append(events, event)
+			}
+			if t.flapping {
+				t.updateFlapping(alarm, ts)
+			}
+		}
+	}
+	return events, nil
+}
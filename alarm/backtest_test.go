@@ -0,0 +1,136 @@
+package alarm
+
+import (
+	"github.com/tryffel/fusio/storage/Influxdb"
+	"github.com/tryffel/fusio/storage/models"
+	"testing"
+	"time"
+)
+
+func TestReplay(T *testing.T) {
+	filters, err := Influxdb.FilterFromString("mean(temperature) > 30")
+	if err != nil {
+		T.Errorf("Failed to create influxdb filters from string: %s", err)
+	}
+
+	query := &models.AlarmQuery{
+		Filters:    *filters,
+		Interval:   time.Minute,
+		Expression: "mean_temperature>30",
+		Limit:      2,
+		Severity:   models.SeverityWarning,
+	}
+
+	start := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	values := []float32{35, 20, 35, 35, 35, 20, 20}
+	points := make([]Influxdb.Point, len(values))
+	for i, v := range values {
+		points[i] = Influxdb.Point{Timestamp: start.Add(time.Duration(i) * time.Minute), Value: v}
+	}
+
+	// First point is history before range
+	events, err := replay(&models.Alarm{}, query, Influxdb.Batch{"mean_temperature": points}, start.Add(time.Minute), "")
+	if err != nil {
+		T.Error(err)
+	}
+	if len(events) != 2 {
+		T.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	if events[0].Type != Fire || !events[0].Timestamp.Equal(start.Add(3*time.Minute)) {
+		T.Errorf("Expected fire at 3rd minute, got %s at %s", events[0].Type, events[0].Timestamp)
+	}
+	if events[1].Type != Clear || !events[1].Timestamp.Equal(start.Add(5*time.Minute)) {
+		T.Errorf("Expected clear at 5th minute, got %s at %s", events[1].Type, events[1].Timestamp)
+	}
+}
+
+func replayPoints(t *testing.T, start time.Time, values []float32) (*models.AlarmQuery, Influxdb.Batch) {
+	filters, err := Influxdb.FilterFromString("mean(temperature) > 30")
+	if err != nil {
+		t.Fatalf("Failed to create influxdb filters from string: %s", err)
+	}
+	query := &models.AlarmQuery{
+		Filters:    *filters,
+		Interval:   time.Minute,
+		Expression: "mean_temperature>30",
+		Limit:      1,
+		Severity:   models.SeverityWarning,
+	}
+	points := make([]Influxdb.Point, len(values))
+	for i, v := range values {
+		points[i] = Influxdb.Point{Timestamp: start.Add(time.Duration(i) * time.Minute), Value: v}
+	}
+	return query, Influxdb.Batch{"mean_temperature": points}
+}
+
+func TestReplayForDuration(t *testing.T) {
+	start := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	// Short spike is cancelled while pending, longer one fires after duration
+	query, batch := replayPoints(t, start, []float32{35, 20, 35, 35, 35, 20})
+	alarm := &models.Alarm{ForDuration: time.Minute * 2}
+
+	events, err := replay(alarm, query, batch, start, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	if events[0].Type != Fire || !events[0].Timestamp.Equal(start.Add(4*time.Minute)) {
+		t.Errorf("Expected fire at 4th minute, got %s at %s", events[0].Type, events[0].Timestamp)
+	}
+	if events[1].Type != Clear || !events[1].Timestamp.Equal(start.Add(5*time.Minute)) {
+		t.Errorf("Expected clear at 5th minute, got %s at %s", events[1].Type, events[1].Timestamp)
+	}
+}
+
+func TestReplayFlapping(t *testing.T) {
+	start := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	query, batch := replayPoints(t, start, []float32{35, 20, 35, 20, 20, 20, 20, 20, 35})
+	alarm := &models.Alarm{FlapWindow: time.Minute * 3, FlapThreshold: 3}
+
+	events, err := replay(alarm, query, batch, start, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	suppressed := []bool{false, false, true, true, false}
+	if len(events) != len(suppressed) {
+		t.Fatalf("Expected %d events, got %d", len(suppressed), len(events))
+	}
+	for i, v := range events {
+		if v.Suppressed != suppressed[i] {
+			t.Errorf("Event %d %s at %s: expected suppressed %t", i, v.Type, v.Timestamp, suppressed[i])
+		}
+	}
+}
+
+func TestReplayAlignsSeries(t *testing.T) {
+	filters, err := Influxdb.FilterFromString("mean(temperature) > 30 && mean(humidity) > 50")
+	if err != nil {
+		t.Fatalf("Failed to create influxdb filters from string: %s", err)
+	}
+	query := &models.AlarmQuery{
+		Filters:    *filters,
+		Interval:   time.Minute,
+		Expression: "mean_temperature>30&&mean_humidity>50",
+		Limit:      1,
+		Severity:   models.SeverityWarning,
+	}
+	start := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minute int, value float32) Influxdb.Point {
+		return Influxdb.Point{Timestamp: start.Add(time.Duration(minute) * time.Minute), Value: value}
+	}
+	// Humidity is missing second minute, so later humidity points must not be shifted against temperature
+	batch := Influxdb.Batch{
+		"mean_temperature": {at(0, 20), at(1, 20), at(2, 35), at(3, 20)},
+		"mean_humidity":    {at(0, 60), at(1, 60), at(3, 60)},
+	}
+
+	events, err := replay(&models.Alarm{}, query, batch, start, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected no events, got %d: first %s at %s", len(events), events[0].Type, events[0].Timestamp)
+	}
+}
@@ -0,0 +1,159 @@
+package alarm
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"github.com/tryffel/fusio/err"
+	"github.com/tryffel/fusio/metrics"
+	"github.com/tryffel/fusio/notifications"
+	"github.com/tryffel/fusio/storage"
+	"github.com/tryffel/fusio/storage/models"
+	"time"
+)
+
+// startEscalation starts escalation of fired alarm if it has escalation policy. First step is run on next
+// escalation run. Escalation is started even if alarm is silenced, so that it continues once silence ends
+func startEscalation(store storage.Store, alarm *models.Alarm, device string) {
+	if alarm.EscalationPolicyId == "" {
+		return
+	}
+	err := store.Escalation.Start(alarm, device, time.Now())
+	Err.Log(err)
+}
+
+// stopEscalation stops escalation of cleared alarm or device
+func stopEscalation(store storage.Store, alarm *models.Alarm, device string) {
+	if alarm.EscalationPolicyId == "" {
+		return
+	}
+	err := store.Escalation.Stop(alarm.ID, device)
+	Err.Log(err)
+}
+
+// RunEscalations runs escalation steps that are due. Escalations are stopped when alarm is acknowledged,
+// cleared or inhibited. Silenced alarms keep their escalation waiting until silence ends
+func RunEscalations(store storage.Store, metrics metrics.Metrics, now time.Time) {
+	escalations, err := store.Escalation.GetDue(now)
+	if err != nil {
+		Err.Log(err)
+		return
+	}
+	for i := range *escalations {
+		e := &(*escalations)[i]
+		err = runEscalation(store, metrics, e, now)
+		if err != nil {
+			logrus.Errorf("Failed to run escalation of alarm %s: %s", e.AlarmId, err.Error())
+		}
+	}
+}
+
+func runEscalation(store storage.Store, metrics metrics.Metrics, e *models.Escalation, now time.Time) error {
+	alarm, err := store.Alarm.FindById(e.AlarmId)
+	if err != nil {
+		return err
+	}
+	severity, active, err := escalationActive(store, alarm, e, now)
+	if err != nil {
+		return err
+	}
+	if !active {
+		logrus.Debug("Alarm ", alarm.ID, " acknowledged or cleared, stopping escalation")
+		return store.Escalation.Stop(e.AlarmId, e.DeviceId)
+	}
+
+	policy, err := store.Escalation.FindPolicyById(e.PolicyId)
+	if err != nil {
+		return err
+	}
+	if e.Step >= len(policy.Steps) {
+		if !policy.Repeat || len(policy.Steps) == 0 {
+			return store.Escalation.Stop(e.AlarmId, e.DeviceId)
+		}
+		e.Step = 0
+	}
+
+	silenced, err := store.Silence.IsSilenced(alarm, e.DeviceId, now)
+	if err != nil {
+		return err
+	}
+	if silenced {
+		// Try again on next run
+		return nil
+	}
+
+	inhibited, err := store.Inhibit.IsInhibited(alarm, e.DeviceId)
+	if err != nil {
+		return err
+	}
+	if inhibited {
+		logrus.Debug("Alarm ", alarm.ID, " inhibited, stopping escalation")
+		return store.Escalation.Stop(e.AlarmId, e.DeviceId)
+	}
+
+	step := policy.Steps[e.Step]
+	notifyEscalation(store, alarm, e.DeviceId, severity, &step)
+	metrics.CounterIncrease("alarm_escalation", 1)
+	metrics.CounterIncrease("alarm_notification", 1)
+
+	e.Step += 1
+	e.NextAt = now.Add(step.Delay)
+	if e.Step >= len(policy.Steps) && !policy.Repeat {
+		return store.Escalation.Stop(e.AlarmId, e.DeviceId)
+	}
+	return store.Escalation.Update(e)
+}
+
+// escalationActive returns severity of fired alarm or device, and whether it is still fired and unacknowledged.
+// Acknowledgement is read from open history item of device, since other devices of per-device alarm
+// may have been acknowledged before device fired
+func escalationActive(store storage.Store, alarm *models.Alarm, e *models.Escalation, now time.Time) (models.Severity, bool, error) {
+	if !alarm.Fired || alarm.EscalationPolicyId != e.PolicyId {
+		return "", false, nil
+	}
+	history, err := store.Alarm.GetHistory([]string{alarm.ID}, now, now)
+	if err != nil {
+		return "", false, err
+	}
+	for _, v := range *history {
+		if !v.Cleared && v.DeviceId == e.DeviceId {
+			return v.Severity, !v.Acknowledged, nil
+		}
+	}
+	return "", false, nil
+}
+
+// notifyEscalation pushes step notification to each of its output channels
+func notifyEscalation(store storage.Store, alarm *models.Alarm, device string, severity models.Severity,
+	step *models.EscalationStep) {
+	n := newNotification(store, alarm, device, &map[string]float64{}, severity)
+	template := step.Template
+	if template == "" {
+		template = models.DefaultEscalationTemplate
+	}
+	text, err := n.Parse(template)
+	if err != nil {
+		Err.Log(err)
+		return
+	}
+
+	for _, id := range step.OutputChannels {
+		channel, err := store.OutputChannel.FindbyId(id)
+		if err != nil {
+			Err.Log(err)
+			continue
+		}
+		notifier, err := notifications.GetNotifier(channel.OutputType, channel.Data)
+		if err != nil {
+			e := Err.Wrap(&err, "Failed to get output implementation")
+			Err.Log(e)
+			continue
+		}
+		id := id
+		outputs.push(func(ctx context.Context) {
+			err := notifier.Notify(ctx, text)
+			if err != nil {
+				logrus.Errorf("Failed to push escalation of alarm %s to channel %s: %s", alarm.ID, id, err.Error())
+			}
+		})
+	}
+}
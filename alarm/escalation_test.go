@@ -0,0 +1,90 @@
+package alarm
+
+import (
+	"github.com/tryffel/fusio/metrics"
+	"github.com/tryffel/fusio/storage"
+	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/storage/repository_mock"
+	"testing"
+	"time"
+)
+
+func TestRunEscalations(t *testing.T) {
+	store, _ := storage.NewMockStore()
+	escalations := store.Escalation.(*repository_mock.MockEscalationRepository)
+
+	policy := &models.EscalationPolicy{
+		Name: "on-call",
+		Steps: models.EscalationSteps{
+			{Delay: 10 * time.Minute},
+			{Delay: 30 * time.Minute},
+		},
+	}
+	escalations.CreatePolicy(policy)
+	alarm := &models.Alarm{Name: "test", EscalationPolicyId: policy.ID}
+	store.Alarm.Create(alarm)
+	alarm, _ = store.Alarm.FindById(alarm.ID)
+	store.Alarm.Fire(alarm, 1, models.SeverityWarning, time.Now())
+
+	startEscalation(*store, alarm, "")
+	now := time.Now()
+	m := &metrics.MockTask{}
+
+	RunEscalations(*store, m, now)
+	if len(escalations.Escalations) != 1 || escalations.Escalations[0].Step != 1 {
+		t.Fatalf("first step not run: %v", escalations.Escalations)
+	}
+	if !escalations.Escalations[0].NextAt.Equal(now.Add(10 * time.Minute)) {
+		t.Errorf("next step not delayed, due at %s", escalations.Escalations[0].NextAt)
+	}
+
+	// Not due yet
+	RunEscalations(*store, m, now.Add(5*time.Minute))
+	if escalations.Escalations[0].Step != 1 {
+		t.Error("step run before delay")
+	}
+
+	store.Alarm.Acknowledge(alarm, 1, "", now)
+	RunEscalations(*store, m, now.Add(10*time.Minute))
+	if len(escalations.Escalations) != 0 {
+		t.Error("escalation not stopped after acknowledgement")
+	}
+
+	// Last step without repeat ends escalation
+	store.Alarm.Unacknowledge(alarm)
+	startEscalation(*store, alarm, "")
+	now = time.Now()
+	RunEscalations(*store, m, now)
+	RunEscalations(*store, m, now.Add(10*time.Minute))
+	if len(escalations.Escalations) != 0 {
+		t.Error("escalation not stopped after last step")
+	}
+}
+
+func TestRunEscalationsDeviceAcknowledged(t *testing.T) {
+	store, _ := storage.NewMockStore()
+	escalations := store.Escalation.(*repository_mock.MockEscalationRepository)
+	alarms := store.Alarm.(*repository_mock.MockAlarmRepository)
+
+	policy := &models.EscalationPolicy{Name: "on-call", Steps: models.EscalationSteps{{Delay: 10 * time.Minute}, {Delay: 10 * time.Minute}}}
+	escalations.CreatePolicy(policy)
+	alarm := &models.Alarm{Name: "test", EscalationPolicyId: policy.ID}
+	store.Alarm.Create(alarm)
+	alarm, _ = store.Alarm.FindById(alarm.ID)
+
+	// Device a was acknowledged before device b fired
+	now := time.Now()
+	alarm.Fired = true
+	alarm.Acknowledged = true
+	alarms.History = []models.AlarmHistory{
+		{AlarmId: alarm.ID, DeviceId: "a", Severity: models.SeverityWarning, FiredAt: now.Add(-time.Hour),
+			Acknowledged: true},
+		{AlarmId: alarm.ID, DeviceId: "b", Severity: models.SeverityCritical, FiredAt: now.Add(-time.Minute)},
+	}
+	startEscalation(*store, alarm, "b")
+
+	RunEscalations(*store, &metrics.MockTask{}, time.Now())
+	if len(escalations.Escalations) != 1 || escalations.Escalations[0].Step != 1 {
+		t.Errorf("escalation of unacknowledged device not run: %v", escalations.Escalations)
+	}
+}
@@ -0,0 +1,57 @@
+package alarm
+
+import (
+	"fmt"
+	"github.com/tryffel/fusio/expression"
+	"sync"
+)
+
+// Maximum number of compiled expressions to keep. Cache is emptied when it's full,
+// so that expressions of edited or deleted alarms don't pile up
+const maxCachedExpressions = 1000
+
+// expressionCache holds parsed expressions by their source. Parsed expressions are only read when evaluated,
+// so they can be shared between workers
+type expressionCache struct {
+	lock        sync.RWMutex
+	expressions map[string]*expression.Expression
+}
+
+var expressions = &expressionCache{expressions: map[string]*expression.Expression{}}
+
+func (c *expressionCache) get(key string, compile func() (*expression.Expression, error)) (
+	*expression.Expression, error) {
+	c.lock.RLock()
+	exp, ok := c.expressions[key]
+	c.lock.RUnlock()
+	if ok {
+		return exp, nil
+	}
+
+	exp, err := compile()
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	if len(c.expressions) >= maxCachedExpressions {
+		c.expressions = make(map[string]*expression.Expression, maxCachedExpressions)
+	}
+	c.expressions[key] = exp
+	c.lock.Unlock()
+	return exp, nil
+}
+
+// compileExpression returns parsed condition from cache, parsing it on first use
+func compileExpression(source string) (*expression.Expression, error) {
+	return expressions.get(source, func() (*expression.Expression, error) {
+		return expression.ParseCondition(source)
+	})
+}
+
+// compileClearExpression returns cached negation of expression with deadband, see negateWithDeadband
+func compileClearExpression(source string, deadband float64) (*expression.Expression, error) {
+	key := fmt.Sprintf("clear:%g:%s", deadband, source)
+	return expressions.get(key, func() (*expression.Expression, error) {
+		return negateWithDeadband(source, deadband)
+	})
+}
@@ -0,0 +1,77 @@
+package alarm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tryffel/fusio/err"
+	"github.com/tryffel/fusio/forecast"
+	"github.com/tryffel/fusio/storage"
+	"github.com/tryffel/fusio/storage/Influxdb"
+	"github.com/tryffel/fusio/storage/models"
+	"time"
+)
+
+// ValuateForecast evaluates forecast alarm. Forecast is computed separately for each device in group
+// and each filter. Alarm fires when any of them is predicted to cross threshold within horizon.
+func ValuateForecast(ctx context.Context, alarm *models.Alarm, store storage.Store) (bool, error, *map[string]float64) {
+	out := make(map[string]float64)
+	config := alarm.Filter.Forecast
+	if config == nil || config.History <= 0 || config.Horizon <= 0 {
+		return false, &Err.Error{Code: Err.Einvalid, Err: errors.New("forecast alarm needs history and horizon")}, &out
+	}
+	method, err := forecast.ParseMethod(config.Method)
+	if err != nil {
+		return false, &Err.Error{Code: Err.Einvalid, Err: err}, &out
+	}
+
+	points := config.HistoryPoints()
+	horizon := config.HorizonPoints()
+	if horizon > models.MaxForecastHorizon {
+		return false, &Err.Error{Code: Err.Einvalid, Err: fmt.Errorf("forecast horizon is over %d points",
+			models.MaxForecastHorizon)}, &out
+	}
+	opts := forecast.Options{
+		Method:  method,
+		Horizon: horizon,
+		Step:    config.Step(),
+		Season:  config.Season,
+	}
+
+	devices, err := alarmDevices(alarm, store)
+	if err != nil {
+		return false, err, &out
+	}
+
+	now := time.Now()
+	fired := false
+	for _, device := range *devices {
+		batch, err := store.Measurement.Read(ctx, device, alarm.Group, alarm.Filter.Filters, now.Add(-config.History), now,
+			points, Influxdb.DefaultReadOpts())
+		if err != nil {
+			return false, err, &out
+		}
+
+		for _, filter := range alarm.Filter.Filters {
+			key := filter.StringSimplified()
+			series := batch[key]
+			predictions, err := forecast.Forecast(series, opts)
+			if err != nil {
+				// Not enough data to predict this device yet
+				continue
+			}
+			last := series[len(series)-1]
+			crossing, ok := forecast.Crossing(last, predictions, config.Threshold, forecast.Direction(config.Direction))
+			if ok && crossing.Before(now.Add(config.Horizon)) {
+				fired = true
+				until := crossing.Sub(now)
+				if until < 0 {
+					until = 0
+				}
+				out[fmt.Sprintf("%s.%s", device, key)] = float64(last.Value)
+				out[fmt.Sprintf("%s.%s_crossing_seconds", device, key)] = until.Seconds()
+			}
+		}
+	}
+	return fired, nil, &out
+}
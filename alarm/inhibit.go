@@ -0,0 +1,34 @@
+package alarm
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/tryffel/fusio/storage"
+	"github.com/tryffel/fusio/storage/models"
+)
+
+// inhibitOutputs returns true if outputs of alarm should be suppressed because of fired parent alarm.
+// Alarm that fires while parent is fired records parent to its history, and stays inhibited until it clears.
+// That way escalations and clear of inhibited alarm are not notified either, even if parent has cleared.
+func inhibitOutputs(store storage.Store, alarm *models.Alarm, device string, outType OutputType,
+	escalation bool) (bool, error) {
+	if outType != Error {
+		inhibited, err := store.Inhibit.IsInhibited(alarm, device)
+		if err != nil || inhibited {
+			return inhibited, err
+		}
+	}
+	// Only new fires get inhibited, alarm that was notified before parent fired keeps notifying
+	if outType == Clear || escalation {
+		return false, nil
+	}
+
+	parent, err := store.Inhibit.GetInhibitingAlarm(alarm)
+	if err != nil || parent == nil {
+		return false, err
+	}
+	logrus.Debug("Alarm ", alarm.ID, " is inhibited by fired alarm ", parent.ID, ", skipping ", outType, " outputs")
+	if outType == Fire {
+		err = store.Inhibit.SetInhibited(alarm, device, parent)
+	}
+	return true, err
+}
@@ -0,0 +1,80 @@
+package alarm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/tryffel/fusio/err"
+	"github.com/tryffel/fusio/storage"
+	"github.com/tryffel/fusio/storage/models"
+	"time"
+)
+
+// noDataLookback is number of timeouts no-data alarm looks back for last points. Keys silent for longer
+// are reported like keys that never reported
+const noDataLookback = 10
+
+// ValuateNoData evaluates no-data alarm for all devices of alarm. Evaluation is abandoned once ctx is done
+func ValuateNoData(ctx context.Context, alarm *models.Alarm, store storage.Store) (bool, error, *map[string]float64) {
+	devices, err := alarmDevices(alarm, store)
+	if err != nil {
+		return false, err, &map[string]float64{}
+	}
+	return valuateNoData(ctx, alarm, store, *devices, time.Now())
+}
+
+// valuateNoData fires if newest point of devices is older than timeout. Devices are combined, so
+// group fires only when all of its devices are silent. If keys are configured, each key is checked separately.
+// Group without devices has nothing to report and never fires.
+func valuateNoData(ctx context.Context, alarm *models.Alarm, store storage.Store, devices []string,
+	now time.Time) (bool, error, *map[string]float64) {
+	out := make(map[string]float64)
+	config := alarm.Filter.NoData
+	if config == nil || config.Timeout <= 0 {
+		return false, &Err.Error{Code: Err.Einvalid, Err: errors.New("no-data alarm needs timeout")}, &out
+	}
+
+	if len(devices) == 0 {
+		return false, nil, &out
+	}
+
+	// Newest point of each key, empty key is any key
+	keys := make(map[string]time.Time, len(config.Keys))
+	for _, v := range config.Keys {
+		keys[v] = time.Time{}
+	}
+	if len(keys) == 0 {
+		keys[""] = time.Time{}
+	}
+
+	lastSeen, err := store.Measurement.GetLastSeen(ctx, devices, now.Add(-config.Timeout*noDataLookback))
+	if err != nil {
+		return false, err, &out
+	}
+	for name, ts := range lastSeen {
+		for key, seen := range keys {
+			if (key == "" || key == name) && ts.After(seen) {
+				keys[key] = ts
+			}
+		}
+	}
+
+	fired := false
+	for key, seen := range keys {
+		if now.Sub(seen) <= config.Timeout {
+			continue
+		}
+		fired = true
+		name := "silent_seconds"
+		if key != "" {
+			name = fmt.Sprintf("%s_silent_seconds", key)
+		}
+		if seen.IsZero() {
+			// Not reported within lookback
+			out[name] = -1
+		} else {
+			out[name] = now.Sub(seen).Seconds()
+		}
+	}
+	return fired, nil, &out
+}
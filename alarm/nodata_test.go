@@ -0,0 +1,57 @@
+package alarm
+
+import (
+	"context"
+	"github.com/tryffel/fusio/storage"
+	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/storage/repository"
+	"github.com/tryffel/fusio/storage/repository_mock"
+	"testing"
+	"time"
+)
+
+func TestValuateNoData(T *testing.T) {
+	store, _ := storage.NewMockStore()
+	mock := store.Measurement.(*repository_mock.MockMeasurementRepository)
+
+	now := time.Now()
+	mock.Catalog["a"] = []repository.MeasurementInfo{
+		{Device: "a", Key: "temperature", LastSeen: now.Add(-time.Hour)},
+		{Device: "a", Key: "humidity", LastSeen: now.Add(-time.Minute)},
+	}
+	mock.Catalog["b"] = []repository.MeasurementInfo{
+		{Device: "b", Key: "temperature", LastSeen: now.Add(-2 * time.Minute)},
+	}
+	mock.Catalog["d"] = []repository.MeasurementInfo{
+		{Device: "d", Key: "temperature", LastSeen: now.Add(-72 * time.Hour)},
+	}
+
+	tests := []struct {
+		name    string
+		devices []string
+		keys    []string
+		want    bool
+	}{
+		{"device reports other key", []string{"a"}, nil, false},
+		{"silent key", []string{"a"}, []string{"temperature"}, true},
+		{"group has reporting device", []string{"a", "b"}, []string{"temperature"}, false},
+		{"never reported", []string{"c"}, nil, true},
+		{"missing key", []string{"b"}, []string{"humidity"}, true},
+		{"silent for days", []string{"d"}, nil, true},
+		{"group without devices", []string{}, nil, false},
+	}
+
+	for _, v := range tests {
+		alarm := &models.Alarm{Filter: models.AlarmFilter{
+			Type:   models.AlarmNoData,
+			NoData: &models.NoDataConfig{Timeout: 10 * time.Minute, Keys: v.keys},
+		}}
+		fired, err, _ := valuateNoData(context.Background(), alarm, *store, v.devices, now)
+		if err != nil {
+			T.Errorf("%s: %s", v.name, err)
+		}
+		if fired != v.want {
+			T.Errorf("%s: expected %t, got %t", v.name, v.want, fired)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package alarm
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"github.com/tryffel/fusio/metrics"
+	"github.com/tryffel/fusio/storage"
+	"github.com/tryffel/fusio/storage/models"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultWorkers = 4
+	DefaultTimeout = time.Second * 30
+)
+
+// Pool evaluates alarms concurrently with bounded number of workers, so that single slow query doesn't delay
+// other alarms. Each evaluation has its own timeout, which cancels its measurement reads. Result of evaluation
+// that timed out is discarded. Outputs are pushed from separate queue and don't count towards timeout.
+type Pool struct {
+	workers int
+	timeout time.Duration
+	store   *storage.Store
+	metrics metrics.Metrics
+
+	// run evaluates single alarm, defaults to runAlarm. Run must return once ctx is done
+	run func(ctx context.Context, alarm *models.Alarm)
+	// active returns false if pool should stop evaluating alarms, e.g. when other instance took over.
+	// It is checked again before results are applied
+	active func() bool
+}
+
+// NewPool creates pool. Zero workers or timeout are replaced with defaults
+func NewPool(workers int, timeout time.Duration, store *storage.Store, metrics metrics.Metrics) *Pool {
+	if workers < 1 {
+		workers = DefaultWorkers
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	p := &Pool{
+		workers: workers,
+		timeout: timeout,
+		store:   store,
+		metrics: metrics,
+	}
+	p.run = func(ctx context.Context, alarm *models.Alarm) {
+		runAlarm(ctx, alarm, *p.store, p.metrics, p.active)
+	}
+	return p
+}
+
+// Run evaluates alarms and returns when every alarm has been evaluated or timed out. Since run returns
+// once its ctx is done, evaluations never overlap with next Run
+func (p *Pool) Run(alarms []models.Alarm) {
+	queue := make(chan *models.Alarm, len(alarms))
+	for i := range alarms {
+		queue <- &alarms[i]
+	}
+	close(queue)
+	p.metrics.GaugeIncrease("alarm_queue_depth", float64(len(queue)))
+
+	workers := p.workers
+	if len(queue) < workers {
+		workers = len(queue)
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for alarm := range queue {
+				p.metrics.GaugeDecrease("alarm_queue_depth", 1)
+				if p.active != nil && !p.active() {
+					continue
+				}
+				p.evaluate(alarm)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// evaluate runs alarm in worker with timeout. Worker is held until evaluation returns,
+// so that number of running evaluations never exceeds number of workers
+func (p *Pool) evaluate(alarm *models.Alarm) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	defer func() {
+		if err := recover(); err != nil {
+			logrus.Error("Panic evaluating alarm ", alarm.ID, ": ", err)
+			debug.PrintStack()
+		}
+	}()
+
+	start := time.Now()
+	p.run(ctx, alarm)
+	if ctx.Err() != nil {
+		logrus.Warningf("Alarm %s, %s timed out after %s", alarm.ID, alarm.Name, p.timeout)
+		p.metrics.CounterIncrease("alarm_evaluation_timeout", 1)
+		return
+	}
+	p.metrics.CounterIncrease("alarm_evaluations", 1)
+	p.metrics.CounterIncrease("alarm_evaluation_latency_us", float64(time.Since(start).Nanoseconds()/1000))
+}
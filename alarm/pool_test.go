@@ -0,0 +1,145 @@
+package alarm
+
+import (
+	"context"
+	"github.com/tryffel/fusio/metrics"
+	"github.com/tryffel/fusio/storage/models"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolWorkers(t *testing.T) {
+	pool := NewPool(3, time.Second, nil, &metrics.MockTask{})
+	var running, max, total int32
+	pool.run = func(ctx context.Context, alarm *models.Alarm) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 20)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&total, 1)
+	}
+
+	alarms := make([]models.Alarm, 10)
+	for i := range alarms {
+		alarms[i].ID = string(rune('a' + i))
+	}
+	pool.Run(alarms)
+
+	if total != 10 {
+		t.Errorf("expected 10 evaluations, got %d", total)
+	}
+	if max != 3 {
+		t.Errorf("expected 3 concurrent evaluations, got %d", max)
+	}
+}
+
+func TestPoolTimeout(t *testing.T) {
+	pool := NewPool(1, time.Millisecond*20, nil, &metrics.MockTask{})
+	var cancelled, running, max int32
+	pool.run = func(ctx context.Context, alarm *models.Alarm) {
+		n := atomic.AddInt32(&running, 1)
+		if n > atomic.LoadInt32(&max) {
+			atomic.StoreInt32(&max, n)
+		}
+		defer atomic.AddInt32(&running, -1)
+		if alarm.ID != "slow" {
+			return
+		}
+		// Slow read returns once timeout cancels it
+		<-ctx.Done()
+		atomic.StoreInt32(&cancelled, 1)
+	}
+
+	alarms := []models.Alarm{{ID: "slow"}, {ID: "fast"}}
+	start := time.Now()
+	pool.Run(alarms)
+	if time.Since(start) > time.Second {
+		t.Fatal("slow alarm blocked pool")
+	}
+	if cancelled != 1 {
+		t.Error("context of timed out alarm should be done")
+	}
+	if max != 1 {
+		t.Errorf("timed out alarm should hold its worker, got %d concurrent evaluations", max)
+	}
+}
+
+func TestCompileExpression(t *testing.T) {
+	a, err := compileExpression("mean_temperature > 5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := compileExpression("mean_temperature > 5")
+	if a != b {
+		t.Error("expression should be compiled only once")
+	}
+	clear, err := compileClearExpression("mean_temperature > 5", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clear == a {
+		t.Error("clear expression should be cached separately")
+	}
+	_, err = compileExpression("mean_temperature >")
+	if err == nil {
+		t.Error("invalid expression should fail")
+	}
+}
+
+func TestPoolInactive(t *testing.T) {
+	pool := NewPool(2, time.Second, nil, &metrics.MockTask{})
+	var total int32
+	pool.run = func(ctx context.Context, alarm *models.Alarm) {
+		atomic.AddInt32(&total, 1)
+	}
+	// Other instance holds lease
+	pool.active = func() bool { return false }
+	pool.Run([]models.Alarm{{ID: "a"}, {ID: "b"}})
+	if total != 0 {
+		t.Errorf("inactive pool should not evaluate alarms, evaluated %d", total)
+	}
+}
+
+func TestCanApply(t *testing.T) {
+	active := true
+	isActive := func() bool { return active }
+	ctx, cancel := context.WithCancel(context.Background())
+	if !canApply(ctx, nil) || !canApply(ctx, isActive) {
+		t.Error("active evaluation should be applied")
+	}
+	// Lease lost during evaluation
+	active = false
+	if canApply(ctx, isActive) {
+		t.Error("inactive instance should not apply results")
+	}
+	active = true
+	cancel()
+	if canApply(ctx, isActive) {
+		t.Error("timed out evaluation should not be applied")
+	}
+}
+
+func TestOutputQueueTimeout(t *testing.T) {
+	queue := newOutputQueue(1, time.Millisecond*20)
+	var cancelled, total int32
+	queue.push(func(ctx context.Context) {
+		<-ctx.Done()
+		atomic.StoreInt32(&cancelled, 1)
+	})
+	queue.push(func(ctx context.Context) {
+		atomic.AddInt32(&total, 1)
+	})
+	queue.wait()
+	if cancelled != 1 {
+		t.Error("slow push should be cancelled after timeout")
+	}
+	if total != 1 {
+		t.Error("push after slow push should run")
+	}
+}
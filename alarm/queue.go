@@ -0,0 +1,74 @@
+package alarm
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultOutputWorkers = 4
+	// DefaultOutputTimeout is maximum duration of single output push
+	DefaultOutputTimeout = time.Second * 30
+	// outputQueueSize is number of pushes waiting before pushing blocks evaluation
+	outputQueueSize = 1000
+)
+
+// outputQueue pushes outputs in background with its own workers, so that slow output channel doesn't use up
+// alarm evaluation timeout or delay other alarms. Each push has its own timeout.
+type outputQueue struct {
+	workers int
+	timeout time.Duration
+	start   sync.Once
+	queue   chan func(ctx context.Context)
+	// pending is number of pushes queued or running
+	pending sync.WaitGroup
+}
+
+// outputs is queue all alarm outputs and escalations are pushed from
+var outputs = newOutputQueue(DefaultOutputWorkers, DefaultOutputTimeout)
+
+func newOutputQueue(workers int, timeout time.Duration) *outputQueue {
+	return &outputQueue{
+		workers: workers,
+		timeout: timeout,
+		queue:   make(chan func(ctx context.Context), outputQueueSize),
+	}
+}
+
+// push queues push. Workers are started on first push
+func (q *outputQueue) push(push func(ctx context.Context)) {
+	q.start.Do(func() {
+		for i := 0; i < q.workers; i++ {
+			go q.work()
+		}
+	})
+	q.pending.Add(1)
+	q.queue <- push
+}
+
+// wait blocks until all queued pushes have finished
+func (q *outputQueue) wait() {
+	q.pending.Wait()
+}
+
+func (q *outputQueue) work() {
+	for push := range q.queue {
+		q.run(push)
+	}
+}
+
+func (q *outputQueue) run(push func(ctx context.Context)) {
+	ctx, cancel := context.WithTimeout(context.Background(), q.timeout)
+	defer cancel()
+	defer q.pending.Done()
+	defer func() {
+		if err := recover(); err != nil {
+			logrus.Error("Panic pushing output: ", err)
+			debug.PrintStack()
+		}
+	}()
+	push(ctx)
+}
@@ -0,0 +1,132 @@
+package alarm
+
+import (
+	"context"
+	"github.com/tryffel/fusio/err"
+	"github.com/tryffel/fusio/storage"
+	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/storage/repository"
+	"time"
+)
+
+// repeatDue returns true if output should be pushed again for alarm or device that fired at firedAt
+func repeatDue(out *models.Output, repeat *models.OutputRepeat, firedAt time.Time, now time.Time) bool {
+	if out.Repeat <= 0 {
+		return false
+	}
+	if out.MaxRepeat > 0 && repeat.Count >= out.MaxRepeat {
+		return false
+	}
+	last := repeat.LastPushed
+	if firedAt.After(last) {
+		last = firedAt
+	}
+	return !now.Before(last.Add(out.Repeat))
+}
+
+// repeatOutputs pushes fire outputs again for fired alarm once output repeat interval has passed since firing
+// or last repeat. Each fired history item, i.e. each fired device of per-device alarm, is repeated separately
+// with its fire value and time elapsed since firing. Acknowledged history items, and silenced, inhibited and
+// flapping alarms and devices are not repeated.
+func repeatOutputs(store storage.Store, alarm *models.Alarm, now time.Time) error {
+	if !alarm.Fired || alarm.Flapping {
+		return nil
+	}
+	outputs, err := store.Output.FindByAlarm(alarm.ID, repository.OutputOpts{OnlyEnabled: true, OnFire: true})
+	if err != nil {
+		return err
+	}
+	due := make([]*models.Output, 0)
+	for i := range *outputs {
+		if (*outputs)[i].Repeat > 0 {
+			due = append(due, &(*outputs)[i])
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	history, err := store.Alarm.GetHistory([]string{alarm.ID}, now, now)
+	if err != nil {
+		return err
+	}
+	flapping := make(map[string]bool)
+	if alarm.GetScope() == models.ScopePerDevice {
+		states, err := store.Alarm.GetDeviceStates(alarm)
+		if err != nil {
+			return err
+		}
+		for _, v := range *states {
+			flapping[v.DeviceId] = v.Flapping
+		}
+	}
+	fired := make([]models.AlarmHistory, 0)
+	for _, v := range *history {
+		if v.Cleared || v.Acknowledged || flapping[v.DeviceId] {
+			continue
+		}
+		silenced, err := store.Silence.IsSilenced(alarm, v.DeviceId, now)
+		if err != nil {
+			return err
+		}
+		if silenced {
+			continue
+		}
+		inhibited, err := store.Inhibit.IsInhibited(alarm, v.DeviceId)
+		if err != nil {
+			return err
+		}
+		if inhibited {
+			continue
+		}
+		fired = append(fired, v)
+	}
+	if len(fired) == 0 {
+		return nil
+	}
+
+	for _, out := range due {
+		for _, v := range fired {
+			if !acceptsSeverity(out.MinSeverity, v.Severity, "") {
+				continue
+			}
+			repeat, err := store.Output.GetRepeat(out, v.DeviceId)
+			if err != nil {
+				return err
+			}
+			if !repeatDue(out, repeat, v.FiredAt, now) {
+				continue
+			}
+			n := newNotification(store, alarm, v.DeviceId, &map[string]float64{}, v.Severity)
+			n.Value = v.Value
+			n.Occurrence = repeat.Count + 2
+			n.Elapsed = now.Sub(v.FiredAt).Round(time.Second).String()
+			text, err := n.Parse(out.FireTemplate)
+			if err != nil {
+				Err.Log(err)
+				continue
+			}
+			// Failed push is retried after next repeat interval
+			repeat.LastPushed = now
+			err = store.Output.UpdateRepeat(repeat)
+			if err != nil {
+				return err
+			}
+			pushRepeat(store, out, repeat, text)
+		}
+	}
+	return nil
+}
+
+// pushRepeat queues repeated output. Repeat is counted only once it has been pushed successfully
+func pushRepeat(store storage.Store, out *models.Output, repeat *models.OutputRepeat, text string) {
+	output := *out
+	outputs.push(func(ctx context.Context) {
+		if sendOutput(ctx, store, &output, text) != nil {
+			return
+		}
+		repeat.Count += 1
+		err := store.Output.UpdateRepeat(repeat)
+		Err.Log(err)
+	})
+}
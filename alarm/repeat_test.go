@@ -0,0 +1,66 @@
+package alarm
+
+import (
+	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/storage/repository_mock"
+	"testing"
+	"time"
+)
+
+func TestRepeatDue(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		output  models.Output
+		repeat  models.OutputRepeat
+		firedAt time.Time
+		want    bool
+	}{
+		{"repeat disabled", models.Output{}, models.OutputRepeat{}, now.Add(-time.Hour), false},
+		{"interval passed since fire", models.Output{Repeat: time.Minute}, models.OutputRepeat{},
+			now.Add(-time.Minute), true},
+		{"interval not passed since fire", models.Output{Repeat: time.Hour}, models.OutputRepeat{},
+			now.Add(-time.Minute), false},
+		{"interval passed since repeat", models.Output{Repeat: time.Minute},
+			models.OutputRepeat{Count: 1, LastPushed: now.Add(-time.Minute)}, now.Add(-time.Hour), true},
+		{"interval not passed since repeat", models.Output{Repeat: time.Hour},
+			models.OutputRepeat{Count: 1, LastPushed: now.Add(-time.Minute)}, now.Add(-time.Hour * 2), false},
+		{"repeat before refire", models.Output{Repeat: time.Hour},
+			models.OutputRepeat{Count: 1, LastPushed: now.Add(-time.Hour * 2)}, now.Add(-time.Minute), false},
+		{"max repeats reached", models.Output{Repeat: time.Minute, MaxRepeat: 3},
+			models.OutputRepeat{Count: 3, LastPushed: now.Add(-time.Hour)}, now.Add(-time.Hour), false},
+		{"below max repeats", models.Output{Repeat: time.Minute, MaxRepeat: 3},
+			models.OutputRepeat{Count: 2, LastPushed: now.Add(-time.Hour)}, now.Add(-time.Hour), true},
+	}
+
+	for _, v := range tests {
+		if got := repeatDue(&v.output, &v.repeat, v.firedAt, now); got != v.want {
+			t.Errorf("%s: expected %t, got %t", v.name, v.want, got)
+		}
+	}
+}
+
+func TestRepeatOutputsDeviceAcknowledged(t *testing.T) {
+	a := newApplyTest(t, &models.Alarm{Name: "test", OwnerId: 1})
+	defer a.server.Close()
+	a.store.Output.(*repository_mock.MockOutputRepository).Outputs[0].Repeat = time.Minute
+
+	// Device a was acknowledged before device b fired
+	now := time.Now()
+	a.alarm.Fired = true
+	a.alarm.Acknowledged = true
+	a.store.Alarm.(*repository_mock.MockAlarmRepository).History = []models.AlarmHistory{
+		{AlarmId: a.alarm.ID, DeviceId: "a", Severity: models.SeverityCritical, FiredAt: now.Add(-time.Hour),
+			Acknowledged: true},
+		{AlarmId: a.alarm.ID, DeviceId: "b", Severity: models.SeverityWarning, FiredAt: now.Add(-time.Hour)},
+	}
+
+	err := repeatOutputs(*a.store, a.alarm, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs.wait()
+	if len(a.pushed) != 1 || a.pushed[0] != "fire warning" {
+		t.Errorf("expected repeat of unacknowledged device only, got %v", a.pushed)
+	}
+}
@@ -0,0 +1,167 @@
+package alarm
+
+import (
+	"context"
+	"fmt"
+	"github.com/tryffel/fusio/err"
+	"github.com/tryffel/fusio/metrics"
+	"github.com/tryffel/fusio/storage"
+	"github.com/tryffel/fusio/storage/models"
+	"time"
+)
+
+// target is alarm, or single device of per-device alarm, that is fired and cleared
+type target struct {
+	alarm *models.Alarm
+	// state is set for device of per-device alarm
+	state *models.AlarmDeviceState
+}
+
+func (t *target) fired() bool {
+	if t.state != nil {
+		return t.state.Fired
+	}
+	return t.alarm.Fired
+}
+
+func (t *target) firedSeverity() models.Severity {
+	if t.state != nil {
+		return t.state.FiredSeverity
+	}
+	return t.alarm.FiredSeverity
+}
+
+// currentState returns state of alarm or device
+func (t *target) currentState() models.AlarmState {
+	if t.state != nil {
+		return t.state.GetState()
+	}
+	return t.alarm.GetState()
+}
+
+func (t *target) pendingSince() time.Time {
+	if t.state != nil {
+		return t.state.PendingSince
+	}
+	return t.alarm.PendingSince
+}
+
+func (t *target) flapping() bool {
+	if t.state != nil {
+		return t.state.Flapping
+	}
+	return t.alarm.Flapping
+}
+
+// device returns device alarm is evaluated for, or empty string for group alarm
+func (t *target) device() string {
+	if t.state != nil {
+		return t.state.DeviceId
+	}
+	if t.alarm.GetScope() == models.ScopeDevice {
+		return t.alarm.DeviceId
+	}
+	return ""
+}
+
+func (t *target) describe() string {
+	if t.state != nil {
+		return fmt.Sprintf(" (device %s)", t.state.DeviceId)
+	}
+	return ""
+}
+
+func (t *target) fire(store storage.Store, value float32, severity models.Severity) error {
+	if t.state != nil {
+		return store.Alarm.FireDevice(t.alarm, t.state, value, severity, time.Now())
+	}
+	return store.Alarm.Fire(t.alarm, value, severity, time.Now())
+}
+
+func (t *target) setSeverity(store storage.Store, severity models.Severity) error {
+	if t.state != nil {
+		return store.Alarm.SetDeviceSeverity(t.alarm, t.state, severity)
+	}
+	return store.Alarm.SetSeverity(t.alarm, severity)
+}
+
+func (t *target) clear(store storage.Store) error {
+	if t.state != nil {
+		return store.Alarm.ClearDevice(t.alarm, t.state, time.Now())
+	}
+	return store.Alarm.Clear(t.alarm, time.Now())
+}
+
+// setState sets target pending or inactive
+func (t *target) setState(store storage.Store, to models.AlarmState) error {
+	return store.Alarm.SetState(t.alarm, t.state, to, time.Now())
+}
+
+func (t *target) setFlapping(store storage.Store, flapping bool) error {
+	return store.Alarm.SetFlapping(t.alarm, t.state, flapping)
+}
+
+// alarmDevices returns devices alarm is evaluated for
+func alarmDevices(alarm *models.Alarm, store storage.Store) (*[]string, error) {
+	if alarm.GetScope() == models.ScopeDevice {
+		return &[]string{alarm.DeviceId}, nil
+	}
+	return store.Group.GetDevices(alarm.OwnerId, alarm.Group)
+}
+
+// runPerDevice evaluates each device in alarm group separately. Threshold and no-data alarms are supported. Devices that have left group are cleared.
+// Results of devices evaluated after ctx is done or instance is no longer active are discarded
+func runPerDevice(ctx context.Context, alarm *models.Alarm, store storage.Store, metrics metrics.Metrics,
+	active func() bool) {
+	devices, err := alarmDevices(alarm, store)
+	if err != nil {
+		Err.Log(err)
+		return
+	}
+	stored, err := store.Alarm.GetDeviceStates(alarm)
+	if err != nil {
+		Err.Log(err)
+		return
+	}
+	states := make(map[string]*models.AlarmDeviceState, len(*stored))
+	for i, v := range *stored {
+		states[v.DeviceId] = &(*stored)[i]
+	}
+
+	for _, device := range *devices {
+		state, ok := states[device]
+		if !ok {
+			state = &models.AlarmDeviceState{AlarmId: alarm.ID, DeviceId: device}
+		}
+		delete(states, device)
+
+		var severity models.Severity
+		var err error
+		var measurement *map[string]float64
+		if alarm.Filter.GetType() == models.AlarmNoData {
+			var status bool
+			status, err, measurement = valuateNoData(ctx, alarm, store, []string{device}, time.Now())
+			if status {
+				severity = alarm.GetSeverity()
+			}
+		} else {
+			query := alarm.ToAlarmQuery()
+			query.Device = device
+			query.Fired = state.Fired
+			severity, err, measurement = Valuate(ctx, *query, store.Measurement, alarm.RunInterval)
+		}
+		if !canApply(ctx, active) {
+			return
+		}
+		applyResult(store, metrics, &target{alarm: alarm, state: state}, severity, err, measurement)
+	}
+
+	for _, state := range states {
+		if state.Fired || state.GetState() == models.StatePending {
+			if !canApply(ctx, active) {
+				return
+			}
+			applyResult(store, metrics, &target{alarm: alarm, state: state}, "", nil, &map[string]float64{})
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package alarm
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/tryffel/fusio/storage"
+	"github.com/tryffel/fusio/storage/models"
+	"time"
+)
+
+// action is change to target state after evaluation
+type action int
+
+const (
+	actionNone action = iota
+	// actionPending starts waiting for alarms for-duration
+	actionPending
+	actionFire
+	actionClear
+	// actionInactive cancels pending alarm whose condition no longer holds
+	actionInactive
+)
+
+// nextAction returns action for target in state, when its condition evaluated to status.
+// Alarm with for-duration stays pending until condition has held for the duration, measured in wall-clock time
+func nextAction(state models.AlarmState, status bool, pendingSince time.Time, forDuration time.Duration,
+	now time.Time) action {
+	switch {
+	case status && state == models.StateFiring:
+		return actionNone
+	case status && forDuration <= 0:
+		return actionFire
+	case status && state != models.StatePending:
+		return actionPending
+	case status && now.Sub(pendingSince) >= forDuration:
+		return actionFire
+	case !status && state == models.StateFiring:
+		return actionClear
+	case !status && state == models.StatePending:
+		return actionInactive
+	}
+	return actionNone
+}
+
+// isFlapping returns true if target that has fired or resolved changes times within flap window is flapping.
+// Target starts flapping at threshold and is stable again once changes drop below half of threshold
+func isFlapping(flapping bool, changes int, threshold int) bool {
+	if flapping {
+		return changes*2 >= threshold
+	}
+	return changes >= threshold
+}
+
+// updateFlapping checks whether target is flapping and stores the result if it changed.
+// Returns true if target stopped flapping. Flap detection is disabled without window and threshold
+func updateFlapping(store storage.Store, t *target, now time.Time) (bool, error) {
+	a := t.alarm
+	flapping := false
+	if a.FlapWindow > 0 && a.FlapThreshold > 0 {
+		changes, err := store.Alarm.CountTransitions(a, t.state, now.Add(-a.FlapWindow))
+		if err != nil {
+			return false, err
+		}
+		flapping = isFlapping(t.flapping(), changes, a.FlapThreshold)
+	}
+	if flapping == t.flapping() {
+		return false, nil
+	}
+
+	if flapping {
+		logrus.Info("Alarm ", a.ID, ", ", a.Name, t.describe(), " is flapping, suppressing outputs")
+	} else {
+		logrus.Info("Alarm ", a.ID, ", ", a.Name, t.describe(), " stopped flapping")
+	}
+	return !flapping, t.setFlapping(store, flapping)
+}
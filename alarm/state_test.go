@@ -0,0 +1,58 @@
+package alarm
+
+import (
+	"github.com/tryffel/fusio/storage/models"
+	"testing"
+	"time"
+)
+
+func TestNextAction(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name         string
+		state        models.AlarmState
+		status       bool
+		pendingSince time.Time
+		forDuration  time.Duration
+		want         action
+	}{
+		{"fire immediately", models.StateInactive, true, time.Time{}, 0, actionFire},
+		{"fire resolved", models.StateResolved, true, time.Time{}, 0, actionFire},
+		{"already firing", models.StateFiring, true, time.Time{}, time.Minute, actionNone},
+		{"start pending", models.StateInactive, true, time.Time{}, time.Minute, actionPending},
+		{"start pending after resolved", models.StateResolved, true, time.Time{}, time.Minute, actionPending},
+		{"still pending", models.StatePending, true, now.Add(-time.Second * 30), time.Minute, actionNone},
+		{"pending for duration", models.StatePending, true, now.Add(-time.Minute), time.Minute, actionFire},
+		{"clear", models.StateFiring, false, time.Time{}, 0, actionClear},
+		{"cancel pending", models.StatePending, false, now.Add(-time.Second), time.Minute, actionInactive},
+		{"stay inactive", models.StateInactive, false, time.Time{}, time.Minute, actionNone},
+		{"stay resolved", models.StateResolved, false, time.Time{}, 0, actionNone},
+	}
+
+	for _, v := range tests {
+		if got := nextAction(v.state, v.status, v.pendingSince, v.forDuration, now); got != v.want {
+			t.Errorf("%s: expected %d, got %d", v.name, v.want, got)
+		}
+	}
+}
+
+func TestIsFlapping(t *testing.T) {
+	tests := []struct {
+		name      string
+		flapping  bool
+		changes   int
+		threshold int
+		want      bool
+	}{
+		{"stable", false, 3, 4, false},
+		{"starts flapping", false, 4, 4, true},
+		{"keeps flapping", true, 2, 4, true},
+		{"stops flapping", true, 1, 4, false},
+	}
+
+	for _, v := range tests {
+		if got := isFlapping(v.flapping, v.changes, v.threshold); got != v.want {
+			t.Errorf("%s: expected %t, got %t", v.name, v.want, got)
+		}
+	}
+}
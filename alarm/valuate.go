@@ -1,17 +1,19 @@
 package alarm
 
 import (
+	"context"
 	"fmt"
-	"github.com/knetic/govaluate"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/tryffel/fusio/err"
+	"github.com/tryffel/fusio/expression"
 	"github.com/tryffel/fusio/metrics"
 	"github.com/tryffel/fusio/notifications"
 	"github.com/tryffel/fusio/storage"
 	"github.com/tryffel/fusio/storage/Influxdb"
 	"github.com/tryffel/fusio/storage/models"
 	"github.com/tryffel/fusio/storage/repository"
+	"sort"
 	"time"
 )
 
@@ -31,124 +33,435 @@ func (p *Parameters) Get(name string) (interface{}, error) {
 	return (*p)[name], nil
 }
 
-// RunAlarms checks alarms and fires / clears them if needed
+// RunAlarms checks alarms one after another and fires / clears them if needed
 func RunAlarms(alarms []models.Alarm, store storage.Store, metrics metrics.Metrics) {
 	for _, v := range alarms {
-		status, err, measurement := Valuate(*v.ToAlarmQuery(), store.Measurement, v.RunInterval)
-		if err != nil {
-			if e, ok := err.(*Err.Error); ok {
-				if e.Cause() != "Alarm has not enough measurement points" {
-					logrus.Errorf("Failure running alarms: %s", err.Error())
-				}
-			} else {
+		runAlarm(context.Background(), &v, store, metrics, nil)
+	}
+}
+
+// runAlarm evaluates single alarm and applies result. Measurements are read with ctx, so evaluation stops
+// once ctx is done. Result of such evaluation is discarded and alarm is evaluated again on next run.
+// Active is checked before each result is applied, so that instance that lost alarm lease during evaluation
+// doesn't apply results alongside instance that took over. Nil active is always active
+func runAlarm(ctx context.Context, alarm *models.Alarm, store storage.Store, metrics metrics.Metrics,
+	active func() bool) {
+	if alarm.GetScope() == models.ScopePerDevice {
+		runPerDevice(ctx, alarm, store, metrics, active)
+	} else {
+		severity, err, measurement := evaluateAlarm(ctx, alarm, store)
+		if !canApply(ctx, active) {
+			return
+		}
+		applyResult(store, metrics, &target{alarm: alarm}, severity, err, measurement)
+	}
+	if !canApply(ctx, active) {
+		return
+	}
+	err := repeatOutputs(store, alarm, time.Now())
+	Err.Log(err)
+	err = store.Alarm.UpdateRunTimestamp(alarm, time.Now())
+	Err.Log(err)
+}
+
+// canApply returns false if evaluation timed out or instance is no longer active
+func canApply(ctx context.Context, active func() bool) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	return active == nil || active()
+}
+
+// applyResult fires, clears or changes severity of target based on evaluation result and pushes outputs
+func applyResult(store storage.Store, metrics metrics.Metrics, t *target, severity models.Severity, err error,
+	measurement *map[string]float64) {
+	v := t.alarm
+	if err != nil {
+		if e, ok := err.(*Err.Error); ok {
+			if e.Cause() != "Alarm has not enough measurement points" {
 				logrus.Errorf("Failure running alarms: %s", err.Error())
 			}
+		} else {
+			logrus.Errorf("Failure running alarms: %s", err.Error())
 		}
+	}
 
-		if err == nil {
-			var val float64
-			for _, v := range *measurement {
-				val = v
-				break
-			}
-			if v.Fired == false && status == true {
-				logrus.Debug("Alarm ", v.ID, ", ", v.Name, " fired!")
-				err = store.Alarm.Fire(&v, float32(val), time.Now())
-				Err.Log(err)
-				err = pushOutputs(store, &v, measurement, Fire)
+	if err == nil {
+		status := severity != ""
+		var val float64
+		for _, v := range *measurement {
+			val = v
+			break
+		}
+		now := time.Now()
+		switch nextAction(t.currentState(), status, t.pendingSince(), v.ForDuration, now) {
+		case actionPending:
+			logrus.Debug("Alarm ", v.ID, ", ", v.Name, t.describe(), " pending for ", v.ForDuration)
+			err = t.setState(store, models.StatePending)
+			Err.Log(err)
+		case actionInactive:
+			logrus.Debug("Alarm ", v.ID, ", ", v.Name, t.describe(), " no longer pending")
+			err = t.setState(store, models.StateInactive)
+			Err.Log(err)
+		case actionFire:
+			logrus.Debug("Alarm ", v.ID, ", ", v.Name, t.describe(), " fired with severity ", severity)
+			err = t.fire(store, float32(val), severity)
+			Err.Log(err)
+			// Repeats start over on every fire, even if fire isn't pushed
+			err = store.Output.ResetRepeats(v.ID, t.device())
+			Err.Log(err)
+			_, err = updateFlapping(store, t, now)
+			Err.Log(err)
+			if !t.flapping() {
+				// Escalation runs alongside outputs until alarm is acknowledged or cleared
+				startEscalation(store, v, t.device())
+				err = pushOutputs(store, v, t.device(), measurement, Fire, severity, "")
 				Err.Log(err)
 				metrics.CounterIncrease("alarm_notification_fired", 1)
 				metrics.CounterIncrease("alarm_notification", 1)
 			}
-			if v.Fired == true && status == false {
-				logrus.Debug("Alarm ", v.ID, ", ", v.Name, " cleared!")
-				err = store.Alarm.Clear(&v, time.Now())
-				Err.Log(err)
-				err = pushOutputs(store, &v, measurement, Clear)
+		case actionClear:
+			logrus.Debug("Alarm ", v.ID, ", ", v.Name, t.describe(), " cleared!")
+			fired := t.firedSeverity()
+			err = t.clear(store)
+			Err.Log(err)
+			stopEscalation(store, v, t.device())
+			_, err = updateFlapping(store, t, now)
+			Err.Log(err)
+			if !t.flapping() {
+				err = pushOutputs(store, v, t.device(), measurement, Clear, fired, "")
 				Err.Log(err)
 				metrics.CounterIncrease("alarm_notification_cleared", 1)
 				metrics.CounterIncrease("alarm_notification", 1)
 			}
-		} else {
-			// Push errors
-			if e, ok := err.(*Err.Error); ok {
-				if e.Code == Err.Einternal {
-					Err.Log(e)
-				} else {
-					err = pushOutputs(store, &v, measurement, Error)
+		case actionNone:
+			if t.fired() && status && severity != t.firedSeverity() {
+				// Severity changed while alarm is fired. Outputs are notified only on escalation
+				previous := t.firedSeverity()
+				logrus.Debug("Alarm ", v.ID, ", ", v.Name, t.describe(), " severity changed to ", severity)
+				err = t.setSeverity(store, severity)
+				Err.Log(err)
+				// Acknowledged alarm is already being handled, don't notify again
+				if severity.Level() > previous.Level() && !v.Acknowledged && !t.flapping() {
+					err = pushOutputs(store, v, t.device(), measurement, Fire, severity, previous)
 					Err.Log(err)
-					metrics.CounterIncrease("alarm_notification_error", 1)
+					metrics.CounterIncrease("alarm_notification_fired", 1)
 					metrics.CounterIncrease("alarm_notification", 1)
 				}
 			}
+			// Flapping target stabilises once its changes age out of flap window.
+			// Outputs of current state are pushed, as changes while flapping were not notified
+			if t.flapping() {
+				stopped, err := updateFlapping(store, t, now)
+				Err.Log(err)
+				if stopped && t.fired() {
+					startEscalation(store, v, t.device())
+					err = pushOutputs(store, v, t.device(), measurement, Fire, t.firedSeverity(), "")
+					Err.Log(err)
+				} else if stopped && t.currentState() == models.StateResolved {
+					fired, err := resolvedSeverity(store, t)
+					Err.Log(err)
+					if err == nil {
+						err = pushOutputs(store, v, t.device(), measurement, Clear, fired, "")
+						Err.Log(err)
+					}
+				}
+			}
 		}
-		err = store.Alarm.UpdateRunTimestamp(&v, time.Now())
-		Err.Log(err)
+	} else {
+		// Push errors
+		if e, ok := err.(*Err.Error); ok {
+			if e.Code == Err.Einternal {
+				Err.Log(e)
+			} else {
+				err = pushOutputs(store, v, t.device(), measurement, Error, v.GetSeverity(), "")
+				Err.Log(err)
+				metrics.CounterIncrease("alarm_notification_error", 1)
+				metrics.CounterIncrease("alarm_notification", 1)
+			}
+		}
+	}
+}
+
+// resolvedSeverity returns severity resolved target had fired with, which is recorded in its last transition
+func resolvedSeverity(store storage.Store, t *target) (models.Severity, error) {
+	transitions, err := store.Alarm.GetTransitions(t.alarm, t.device(), 1)
+	if err != nil {
+		return "", err
+	}
+	if len(*transitions) == 0 {
+		return t.alarm.GetSeverity(), nil
+	}
+	return (*transitions)[0].Severity, nil
+}
+
+// evaluateAlarm evaluates alarm with method defined by alarm type. Returns severity alarm fires with,
+// or empty severity if alarm is not fired
+func evaluateAlarm(ctx context.Context, alarm *models.Alarm, store storage.Store) (models.Severity, error, *map[string]float64) {
+	var status bool
+	var err error
+	var measurements *map[string]float64
+	switch alarm.Filter.GetType() {
+	case models.AlarmAnomaly:
+		status, err, measurements = ValuateAnomaly(ctx, alarm, store)
+	case models.AlarmForecast:
+		status, err, measurements = ValuateForecast(ctx, alarm, store)
+	case models.AlarmNoData:
+		status, err, measurements = ValuateNoData(ctx, alarm, store)
+	default:
+		return Valuate(ctx, *alarm.ToAlarmQuery(), store.Measurement, alarm.RunInterval)
+	}
+	if !status {
+		return "", err, measurements
 	}
+	return alarm.GetSeverity(), err, measurements
 }
 
-// Valuate evaluates single alarm and returns true if fired
-func Valuate(alarmQuery models.AlarmQuery, i repository.Measurement, runInterval time.Duration) (bool, error, *map[string]float64) {
-	meas, err := i.Read("", alarmQuery.Group, alarmQuery.Filters, time.Now().Add(-time.Duration(alarmQuery.Limit)*alarmQuery.Interval), time.Now(), alarmQuery.Limit)
+// Valuate evaluates single alarm and returns severity it fires with. Empty severity means alarm is not fired.
+// Measurements are read with ctx
+func Valuate(ctx context.Context, alarmQuery models.AlarmQuery, i repository.Measurement, runInterval time.Duration) (models.Severity, error, *map[string]float64) {
+	// Gaps can only be detected if empty intervals are returned
+	opts := Influxdb.DefaultReadOpts()
+	if alarmQuery.Gaps != models.GapNone {
+		opts.Fill = Influxdb.FillNull
+	}
+
+	// Fired alarm may need more points to clear than to fire
+	points := alarmQuery.Limit
+	if alarmQuery.Fired && alarmQuery.ClearLimit > points {
+		points = alarmQuery.ClearLimit
+	}
+
+	meas, err := i.Read(ctx, alarmQuery.Device, alarmQuery.Group, alarmQuery.Filters, time.Now().Add(-time.Duration(points)*alarmQuery.Interval),
+		time.Now(), points, opts)
 	if err != nil {
 		Err.Log(err)
-		return false, err, &map[string]float64{}
+		return "", err, &map[string]float64{}
 	}
 
 	if meas == nil {
-		return false, nil, &map[string]float64{}
+		return "", nil, &map[string]float64{}
 	}
 	if len(meas) == 0 {
 		logrus.Debug("No measurements for alarm")
-		return false, nil, &map[string]float64{}
+		return "", nil, &map[string]float64{}
+	}
+
+	return ValuateSeverity(&alarmQuery, meas)
+}
+
+// ValuateSeverity evaluates query expression and thresholds, starting from most severe.
+// Severity of first matching expression is returned, or empty severity if none match.
+// Fired alarm that has separate clear conditions keeps query severity until clear conditions are met
+func ValuateSeverity(query *models.AlarmQuery, batch Influxdb.Batch) (models.Severity, error, *map[string]float64) {
+	severity := query.Severity
+	if severity == "" {
+		severity = models.SeverityWarning
+	}
+	levels := append([]models.Threshold{{Severity: severity, Expression: query.Expression}}, query.Thresholds...)
+	sort.SliceStable(levels, func(i, j int) bool {
+		return levels[i].Severity.Level() > levels[j].Severity.Level()
+	})
+
+	for _, v := range levels {
+		exp, err := compileExpression(v.Expression)
+		if err != nil {
+			return v.Severity, err, &map[string]float64{}
+		}
+		status, err, out := valuateExpression(query, exp, query.Limit, batch)
+		if err != nil || status {
+			return v.Severity, err, out
+		}
 	}
 
-	status, err, measurements := ValuateSeries(&alarmQuery, meas)
-	return status, err, measurements
+	if query.Fired && query.Hysteresis() {
+		cleared, err, out := valuateClear(query, batch)
+		if err != nil || !cleared {
+			return severity, err, out
+		}
+	}
+	return "", nil, &map[string]float64{}
 }
 
-// ValuateSeries valuates series of measurements. In each point, evaluation must be true in order to return true
+// ValuateSeries valuates series of measurements. In each point, evaluation must be true in order to return true.
+// Missing points are handled as defined by query.Gaps. If query is fired and has separate clear conditions,
+// true is returned until clear conditions are met.
 func ValuateSeries(query *models.AlarmQuery, batch Influxdb.Batch) (bool, error, *map[string]float64) {
-	out := make(map[string]float64)
-	exp, err := govaluate.NewEvaluableExpression(query.Expression)
+	exp, err := compileExpression(query.Expression)
+	if err != nil {
+		return false, err, &map[string]float64{}
+	}
+	status, err, out := valuateExpression(query, exp, query.Limit, batch)
+	if err != nil || status || !query.Fired || !query.Hysteresis() {
+		return status, err, out
+	}
+	cleared, err, out := valuateClear(query, batch)
+	return !cleared, err, out
+}
+
+// valuateClear returns true if clear conditions of query hold for query.ClearLimit consecutive points.
+// Without clear expression alarm clears when expression with deadband is false.
+func valuateClear(query *models.AlarmQuery, batch Influxdb.Batch) (bool, error, *map[string]float64) {
+	limit := query.ClearLimit
+	if limit < 1 {
+		limit = 1
+	}
+
+	var exp *expression.Expression
+	var err error
+	if query.ClearExpression != "" {
+		exp, err = compileExpression(query.ClearExpression)
+	} else {
+		exp, err = compileClearExpression(query.Expression, query.Deadband)
+	}
+	if err != nil {
+		return false, err, &map[string]float64{}
+	}
+	return valuateExpression(query, exp, limit, batch)
+}
+
+// negateWithDeadband returns negation of expression, where each comparison of measurement is moved by deadband
+// away from its threshold: 'a > b' is cleared with '!(a > b - deadband)'. Comparisons that don't involve
+// measurements, such as 'hour() >= 22', are kept as is
+func negateWithDeadband(source string, deadband float64) (*expression.Expression, error) {
+	exp, err := compileExpression(source)
 	if err != nil {
-		return false, err, &out
+		return nil, err
 	}
-	params := make(map[string]interface{}, len(query.Filters))
-	var ts int64 = 0
+
+	root := expression.Rewrite(exp.Root, func(n expression.Node) expression.Node {
+		v, ok := n.(*expression.Binary)
+		if !ok || deadband == 0 || !(hasMeasurement(v.X) || hasMeasurement(v.Y)) {
+			return n
+		}
+		switch v.Op {
+		case ">", ">=":
+			v.Y = &expression.Binary{Op: "-", X: v.Y, Y: &expression.Number{Value: deadband}}
+		case "<", "<=":
+			v.Y = &expression.Binary{Op: "+", X: v.Y, Y: &expression.Number{Value: deadband}}
+		}
+		return v
+	})
+	return expression.New(&expression.Unary{Op: "!", X: root})
+}
+
+// hasMeasurement returns true if node refers to measurement value, i.e. aggregation or its key
+func hasMeasurement(n expression.Node) bool {
+	found := false
+	expression.Walk(n, func(n expression.Node) bool {
+		switch v := n.(type) {
+		case *expression.Ident:
+			found = true
+		case *expression.Call:
+			if v.IsAggregation() {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// valuateExpression valuates expression over last count points of batch
+func valuateExpression(query *models.AlarmQuery, exp *expression.Expression, count int64,
+	batch Influxdb.Batch) (bool, error, *map[string]float64) {
+	out := make(map[string]float64)
+	env := &expression.Env{Values: make(map[string]float64, len(query.Filters))}
 
 	// Check batch has enough measurement points
 	for _, v := range batch {
-		if len(v) < int(query.Limit) {
+		if len(v) < int(count) {
 			e := &Err.Error{Code: Err.Econflict, Err: errors.New("Alarm has not enough measurement points")}
 			return false, e, &out
 		}
 	}
+
+	// Last known values for carrying forward
+	previous := make(map[string]float32, len(batch))
+	evaluated := 0
+
 	// Evaluate
-	for ts = 0; ts < query.Limit; ts++ {
+	for ts := int64(0); ts < count; ts++ {
+		skip := false
 		for i, v := range batch {
-			params[i] = v[ts].Value
+			point := v[int64(len(v))-count+ts]
+			if point.Missing {
+				switch query.Gaps {
+				case models.GapFail:
+					return false, nil, &out
+				case models.GapPrevious:
+					value, ok := previous[i]
+					if !ok {
+						skip = true
+						continue
+					}
+					point.Value = value
+				default:
+					skip = true
+					continue
+				}
+			}
+			previous[i] = point.Value
+			env.Values[i] = float64(point.Value)
+			// Time functions are evaluated in server local time
+			env.Time = point.Timestamp.Local()
+		}
+		if skip {
+			continue
 		}
-		res, err := exp.Evaluate(params)
+
+		res, err := exp.EvalBool(env)
 		if err != nil {
 			e := Err.Wrap(&err, "Failed to evaluate alarm state")
 			e.Code = Err.Einvalid
 			return false, e, &out
 		}
-		if res == false {
+		if !res {
 			return false, nil, &out
 		}
-		// Last round, fill output data
-		if ts == (query.Limit - 1) {
-			for i, v := range batch {
-				out[i] = float64(v[ts].Value)
-			}
-		}
+		evaluated += 1
+	}
+
+	// Every point was skipped, nothing to fire
+	if evaluated == 0 {
+		return false, nil, &out
+	}
+
+	for i, v := range previous {
+		out[i] = float64(v)
 	}
 	return true, nil, &out
 }
 
-func pushOutputs(store storage.Store, alarm *models.Alarm, measurements *map[string]float64, outType OutputType) error {
+// acceptsSeverity returns true if output with minimum severity should be pushed for severity. When alarm escalates
+// from previous severity, outputs that were already pushed for previous severity are skipped
+func acceptsSeverity(min models.Severity, severity models.Severity, previous models.Severity) bool {
+	level := min.Level()
+	if level == 0 {
+		level = models.SeverityInfo.Level()
+	}
+	return level <= severity.Level() && level > previous.Level()
+}
+
+func pushOutputs(store storage.Store, alarm *models.Alarm, device string, measurements *map[string]float64,
+	outType OutputType, severity models.Severity, previous models.Severity) error {
+	// Silenced alarms are evaluated and recorded as usual, only outputs are suppressed
+	silenced, err := store.Silence.IsSilenced(alarm, device, time.Now())
+	if err != nil {
+		return err
+	}
+	if silenced {
+		logrus.Debug("Alarm ", alarm.ID, " is silenced, skipping ", outType, " outputs")
+		return nil
+	}
+	inhibited, err := inhibitOutputs(store, alarm, device, outType, previous != "")
+	if err != nil {
+		return err
+	}
+	if inhibited {
+		return nil
+	}
+
 	opts := repository.OutputOpts{}
 	opts.OnlyEnabled = true
 	switch outType {
@@ -168,27 +481,16 @@ func pushOutputs(store storage.Store, alarm *models.Alarm, measurements *map[str
 		return err
 	}
 
-	// Construct value string
-	value := ""
-
-	for i, v := range *measurements {
-		value = fmt.Sprintf("%s %s=%.2f", value, i, v)
-	}
-
-	n := notifications.Notification{
-		AlarmName:     alarm.Name,
-		AlarmMsg:      alarm.Message,
-		AlarmId:       alarm.ID,
-		Timestamp:     time.Now().Format(time.Kitchen),
-		TimestampUnix: fmt.Sprintf("%d", time.Now().Second()),
-		Value:         value,
-		Title:         "",
-		GroupId:       alarm.Group,
-		GroupName:     "",
-		Error:         "unknown error",
+	n := newNotification(store, alarm, device, measurements, severity)
+	if outType == Fire {
+		n.Occurrence = 1
+		n.Elapsed = time.Duration(0).String()
 	}
 
 	for _, out := range *outputs {
+		if !acceptsSeverity(out.MinSeverity, severity, previous) {
+			continue
+		}
 		var text string
 		var err error
 		switch outType {
@@ -208,29 +510,7 @@ func pushOutputs(store storage.Store, alarm *models.Alarm, measurements *map[str
 			}
 
 		} else {
-			notifier, err := notifications.GetNotifier(out.OutputChannel.OutputType, out.OutputChannel.Data)
-			if err != nil {
-				e := Err.Wrap(&err, "Failed to get output implementation")
-				Err.Log(e)
-			} else {
-				success := notifier.Notify(text)
-				out.LastPushed = time.Now()
-				err = store.Output.Update(&out)
-				if err != nil {
-					e := Err.Wrap(&err, "Failed to update outputs")
-					Err.Log(e)
-				}
-				if success != nil {
-					err = store.Output.MarkPushed(&out, false, success.Error())
-				} else {
-					err = store.Output.MarkPushed(&out, true, "")
-				}
-
-				if err != nil {
-					e := Err.Wrap(&err, "Failed to mark output push")
-					Err.Log(e)
-				}
-			}
+			pushOutput(store, &out, text)
 		}
 	}
 
@@ -240,3 +520,66 @@ func pushOutputs(store storage.Store, alarm *models.Alarm, measurements *map[str
 	}
 	return nil
 }
+
+// newNotification fills notification fields of alarm. Device is set for device and per-device alarms
+func newNotification(store storage.Store, alarm *models.Alarm, device string, measurements *map[string]float64,
+	severity models.Severity) notifications.Notification {
+	// Construct value string
+	value := ""
+
+	for i, v := range *measurements {
+		value = fmt.Sprintf("%s %s=%.2f", value, i, v)
+	}
+
+	n := notifications.Notification{
+		AlarmName:     alarm.Name,
+		AlarmMsg:      alarm.Message,
+		AlarmId:       alarm.ID,
+		Timestamp:     time.Now().Format(time.Kitchen),
+		TimestampUnix: fmt.Sprintf("%d", time.Now().Second()),
+		Value:         value,
+		Title:         "",
+		GroupId:       alarm.Group,
+		GroupName:     "",
+		Error:         "unknown error",
+		Severity:      string(severity),
+		DeviceId:      device,
+	}
+	if device != "" {
+		d, err := store.Device.GetById(device)
+		if err == nil {
+			n.DeviceName = d.Name
+		}
+	}
+	return n
+}
+
+// pushOutput queues text to be sent to output channel. Push is recorded to output history once sent
+func pushOutput(store storage.Store, out *models.Output, text string) {
+	output := *out
+	outputs.push(func(ctx context.Context) {
+		sendOutput(ctx, store, &output, text)
+	})
+}
+
+// sendOutput sends text to output channel and records push to output history. Returns error if push failed
+func sendOutput(ctx context.Context, store storage.Store, out *models.Output, text string) error {
+	notifier, err := notifications.GetNotifier(out.OutputChannel.OutputType, out.OutputChannel.Data)
+	if err != nil {
+		e := Err.Wrap(&err, "Failed to get output implementation")
+		Err.Log(e)
+		return err
+	}
+	success := notifier.Notify(ctx, text)
+	if success != nil {
+		err = store.Output.MarkPushed(out, false, success.Error())
+	} else {
+		err = store.Output.MarkPushed(out, true, "")
+	}
+
+	if err != nil {
+		e := Err.Wrap(&err, "Failed to mark output push")
+		Err.Log(e)
+	}
+	return success
+}
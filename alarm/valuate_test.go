@@ -1,8 +1,17 @@
 package alarm
 
 import (
+	"fmt"
+	"github.com/tryffel/fusio/metrics"
+	"github.com/tryffel/fusio/storage"
 	"github.com/tryffel/fusio/storage/Influxdb"
 	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/storage/repository_mock"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 )
@@ -63,6 +72,70 @@ func TestValuateAlarmSeries(T *testing.T) {
 
 }
 
+func TestValuateAlarmSeriesGaps(T *testing.T) {
+	rounds := 4
+
+	filters, err := Influxdb.FilterFromString("mean(temperature) > 10")
+	if err != nil {
+		T.Errorf("Failed to create influxdb filters from string: %s", err)
+	}
+
+	query := &models.AlarmQuery{
+		Filters:    *filters,
+		Interval:   time.Second * 1,
+		Expression: "mean_temperature > 10",
+		Limit:      int64(rounds),
+	}
+
+	newBatch := func() Influxdb.Batch {
+		temps := make([]Influxdb.Point, rounds)
+		for i := 0; i < rounds; i++ {
+			temps[i] = Influxdb.Point{
+				Timestamp: time.Now().Add(-time.Second * time.Duration(rounds-i)),
+				Value:     20.0,
+			}
+		}
+		temps[2].Missing = true
+		temps[2].Value = 0
+		return Influxdb.Batch{"mean_temperature": temps}
+	}
+
+	cases := []struct {
+		gaps  models.GapPolicy
+		fired bool
+	}{
+		{models.GapNone, true},
+		{models.GapFail, false},
+		{models.GapSkip, true},
+		{models.GapPrevious, true},
+	}
+
+	for _, c := range cases {
+		query.Gaps = c.gaps
+		status, err, out := ValuateSeries(query, newBatch())
+		if err != nil {
+			T.Error(err)
+		}
+		if status != c.fired {
+			T.Errorf("Gap policy '%s': expected %t, got %t", c.gaps, c.fired, status)
+		}
+		if status && (*out)["mean_temperature"] != 20 {
+			T.Errorf("Gap policy '%s': unexpected output value %f", c.gaps, (*out)["mean_temperature"])
+		}
+	}
+
+	// Series with only missing values should never fire
+	batch := newBatch()
+	for i := range batch["mean_temperature"] {
+		batch["mean_temperature"][i].Missing = true
+	}
+	query.Gaps = models.GapPrevious
+	status, _, _ := ValuateSeries(query, batch)
+	if status {
+		T.Error("Fired alarm without any data")
+	}
+}
+
 func BenchmarkValuateTwoSeriesFiveRounds(b *testing.B) {
 
 	rounds := 5
@@ -136,3 +209,296 @@ func BenchmarkValuateTwoSeriesSingleRound(b *testing.B) {
 		ValuateSeries(query, batch)
 	}
 }
+
+func TestValuateSeverity(T *testing.T) {
+	filters, err := Influxdb.FilterFromString("mean(temperature) > 20")
+	if err != nil {
+		T.Errorf("Failed to create influxdb filters from string: %s", err)
+	}
+
+	query := &models.AlarmQuery{
+		Filters:    *filters,
+		Interval:   time.Second * 1,
+		Expression: "mean_temperature>20",
+		Limit:      2,
+		Severity:   models.SeverityWarning,
+		Thresholds: []models.Threshold{
+			{Severity: models.SeverityInfo, Expression: "mean_temperature>10"},
+			{Severity: models.SeverityCritical, Expression: "mean_temperature>30"},
+		},
+	}
+
+	tests := []struct {
+		value float32
+		want  models.Severity
+	}{
+		{5, ""},
+		{15, models.SeverityInfo},
+		{25, models.SeverityWarning},
+		{35, models.SeverityCritical},
+	}
+
+	now := time.Now()
+	for _, v := range tests {
+		batch := Influxdb.Batch{"mean_temperature": []Influxdb.Point{
+			{Timestamp: now.Add(-2 * time.Second), Value: v.value},
+			{Timestamp: now.Add(-time.Second), Value: v.value},
+		}}
+		severity, err, _ := ValuateSeverity(query, batch)
+		if err != nil {
+			T.Error(err)
+		}
+		if severity != v.want {
+			T.Errorf("Value %f: expected severity '%s', got '%s'", v.value, v.want, severity)
+		}
+	}
+}
+
+func TestAcceptsSeverity(T *testing.T) {
+	if acceptsSeverity(models.SeverityCritical, models.SeverityWarning, "") {
+		T.Error("Critical output pushed for warning")
+	}
+	if !acceptsSeverity("", models.SeverityInfo, "") {
+		T.Error("Output without minimum severity not pushed for info")
+	}
+	// Escalation from warning to critical only pushes outputs that didn't receive warning
+	if acceptsSeverity(models.SeverityWarning, models.SeverityCritical, models.SeverityWarning) {
+		T.Error("Warning output pushed again on escalation")
+	}
+	if !acceptsSeverity(models.SeverityCritical, models.SeverityCritical, models.SeverityWarning) {
+		T.Error("Critical output not pushed on escalation")
+	}
+}
+
+func TestValuateSeriesHysteresis(T *testing.T) {
+	filters, err := Influxdb.FilterFromString("mean(temperature) > 30")
+	if err != nil {
+		T.Errorf("Failed to create influxdb filters from string: %s", err)
+	}
+
+	series := func(values ...float32) Influxdb.Batch {
+		points := make([]Influxdb.Point, len(values))
+		for i, v := range values {
+			points[i] = Influxdb.Point{Timestamp: time.Now().Add(time.Duration(i-len(values)) * time.Second), Value: v}
+		}
+		return Influxdb.Batch{"mean_temperature": points}
+	}
+
+	tests := []struct {
+		name  string
+		query models.AlarmQuery
+		batch Influxdb.Batch
+		want  bool
+	}{
+		{"no hysteresis clears", models.AlarmQuery{Fired: true}, series(29), false},
+		{"inside deadband", models.AlarmQuery{Fired: true, Deadband: 2}, series(29), true},
+		{"past deadband", models.AlarmQuery{Fired: true, Deadband: 2}, series(27.5), false},
+		{"deadband not fired", models.AlarmQuery{Deadband: 2}, series(29), false},
+		{"clear expression holds", models.AlarmQuery{Fired: true, ClearExpression: "mean_temperature<25"},
+			series(24), false},
+		{"clear expression not met", models.AlarmQuery{Fired: true, ClearExpression: "mean_temperature<25"},
+			series(26), true},
+		{"clear limit not met", models.AlarmQuery{Fired: true, ClearLimit: 3}, series(31, 29, 29), true},
+		{"clear limit met", models.AlarmQuery{Fired: true, ClearLimit: 3}, series(29, 29, 29), false},
+	}
+
+	for _, v := range tests {
+		query := v.query
+		query.Filters = *filters
+		query.Interval = time.Second
+		query.Expression = "mean_temperature>30"
+		query.Limit = 1
+
+		status, err, _ := ValuateSeries(&query, v.batch)
+		if err != nil {
+			T.Errorf("%s: %s", v.name, err)
+		}
+		if status != v.want {
+			T.Errorf("%s: expected %t, got %t", v.name, v.want, status)
+		}
+	}
+}
+
+func TestNegateWithDeadband(T *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"mean_temperature > 30", "!(mean_temperature > 30 - 5)"},
+		{"mean_temperature < 10 && hour() >= 22", "!(mean_temperature < 10 + 5 && hour() >= 22)"},
+		{"weekday() == 0 || 30 < max_temperature", "!(weekday() == 0 || 30 < max_temperature + 5)"},
+	}
+	for _, v := range tests {
+		exp, err := negateWithDeadband(v.source, 5)
+		if err != nil {
+			T.Fatal(err)
+		}
+		if exp.String() != v.want {
+			T.Errorf("%s: expected %s, got %s", v.source, v.want, exp.String())
+		}
+	}
+}
+
+// applyTest applies evaluation results to alarm with mock store and records outputs pushed to webhook
+type applyTest struct {
+	t      *testing.T
+	store  *storage.Store
+	alarm  *models.Alarm
+	server *httptest.Server
+	lock   sync.Mutex
+	pushed []string
+}
+
+func newApplyTest(t *testing.T, alarm *models.Alarm) *applyTest {
+	a := &applyTest{t: t}
+	a.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		a.lock.Lock()
+		a.pushed = append(a.pushed, string(body))
+		a.lock.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	a.store, _ = storage.NewMockStore()
+	a.store.Alarm.Create(alarm)
+	a.alarm, _ = a.store.Alarm.FindById(alarm.ID)
+	a.store.Output.Create(&models.Output{
+		AlarmId:       a.alarm.ID,
+		FireTemplate:  "fire {{.Severity}}",
+		ClearTemplate: "clear {{.Severity}}",
+		OutputChannel: models.OutputChannel{OutputType: "webhook",
+			Data: fmt.Sprintf(`{"url":"%s","method":"post","expect_status_code":200}`, a.server.URL)},
+		Enabled: true,
+		OnFire:  true,
+		OnClear: true,
+	})
+	return a
+}
+
+// apply applies result and waits for outputs to be pushed
+func (a *applyTest) apply(severity models.Severity) {
+	applyResult(*a.store, &metrics.MockTask{}, &target{alarm: a.alarm}, severity, nil,
+		&map[string]float64{"mean_temperature": 35})
+	outputs.wait()
+}
+
+// expect checks state of alarm and outputs pushed since last check
+func (a *applyTest) expect(state models.AlarmState, pushed ...string) {
+	a.t.Helper()
+	if a.alarm.GetState() != state {
+		a.t.Errorf("expected state %s, got %s", state, a.alarm.GetState())
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if len(pushed) == 0 {
+		pushed = nil
+	}
+	if !reflect.DeepEqual(a.pushed, pushed) {
+		a.t.Errorf("expected outputs %v, got %v", pushed, a.pushed)
+	}
+	a.pushed = nil
+}
+
+// age moves transitions back in time, as if they happened before flap window
+func (a *applyTest) age(d time.Duration) {
+	transitions := a.store.Alarm.(*repository_mock.MockAlarmRepository).Transitions
+	for i := range transitions {
+		transitions[i].Timestamp = transitions[i].Timestamp.Add(-d)
+	}
+}
+
+func TestApplyResultPending(t *testing.T) {
+	a := newApplyTest(t, &models.Alarm{Name: "test", ForDuration: time.Minute})
+	defer a.server.Close()
+
+	a.apply(models.SeverityWarning)
+	a.expect(models.StatePending)
+	a.apply(models.SeverityWarning)
+	a.expect(models.StatePending)
+
+	// Cancelled before duration
+	a.apply("")
+	a.expect(models.StateInactive)
+
+	a.apply(models.SeverityWarning)
+	a.expect(models.StatePending)
+	a.alarm.PendingSince = a.alarm.PendingSince.Add(-time.Minute)
+	a.apply(models.SeverityWarning)
+	a.expect(models.StateFiring, "fire warning")
+
+	a.apply("")
+	a.expect(models.StateResolved, "clear warning")
+}
+
+func TestApplyResultFlapping(t *testing.T) {
+	a := newApplyTest(t, &models.Alarm{Name: "test", Severity: models.SeverityCritical, FlapWindow: time.Hour,
+		FlapThreshold: 3})
+	defer a.server.Close()
+
+	a.apply(models.SeverityWarning)
+	a.expect(models.StateFiring, "fire warning")
+	a.apply("")
+	a.expect(models.StateResolved, "clear warning")
+
+	// Third change starts flapping and suppresses outputs
+	a.apply(models.SeverityWarning)
+	a.expect(models.StateFiring)
+	if !a.alarm.Flapping {
+		t.Fatal("alarm should be flapping")
+	}
+	a.apply("")
+	a.expect(models.StateResolved)
+	a.apply("")
+	a.expect(models.StateResolved)
+
+	// Changes age out of flap window, resolved alarm is notified with severity it fired with
+	a.age(time.Hour * 2)
+	a.apply("")
+	a.expect(models.StateResolved, "clear warning")
+	if a.alarm.Flapping {
+		t.Error("alarm should be stable")
+	}
+
+	for i := 0; i < 3; i++ {
+		a.apply(models.SeverityWarning)
+		a.apply("")
+	}
+	a.apply(models.SeverityWarning)
+	a.expect(models.StateFiring, "fire warning", "clear warning")
+
+	// Stable fired alarm is notified again
+	a.age(time.Hour * 2)
+	a.apply(models.SeverityWarning)
+	a.expect(models.StateFiring, "fire warning")
+}
+
+func TestApplyResultSilenced(t *testing.T) {
+	a := newApplyTest(t, &models.Alarm{Name: "test", OwnerId: 1})
+	defer a.server.Close()
+
+	now := time.Now()
+	silence := &models.Silence{OwnerId: 1, AlarmId: a.alarm.ID, StartsAt: now.Add(-time.Minute),
+		EndsAt: now.Add(time.Hour)}
+	a.store.Silence.Create(silence)
+	a.apply(models.SeverityWarning)
+	a.expect(models.StateFiring)
+	a.store.Silence.Expire(silence, now)
+	a.apply("")
+	a.expect(models.StateResolved, "clear warning")
+}
+
+func TestApplyResultInhibited(t *testing.T) {
+	a := newApplyTest(t, &models.Alarm{Name: "test", OwnerId: 1})
+	defer a.server.Close()
+
+	parent := &models.Alarm{Name: "parent", OwnerId: 1}
+	a.store.Alarm.Create(parent)
+	parent, _ = a.store.Alarm.FindById(parent.ID)
+	a.store.Alarm.Fire(parent, 1, models.SeverityCritical, time.Now())
+	a.store.Inhibit.Create(&models.InhibitRule{OwnerId: 1, SourceAlarmId: parent.ID, TargetAlarmId: a.alarm.ID})
+	a.apply(models.SeverityWarning)
+	a.expect(models.StateFiring)
+	// Inhibition lasts until alarm clears
+	a.apply("")
+	a.expect(models.StateResolved)
+}
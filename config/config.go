@@ -53,7 +53,9 @@ type Database struct {
 	Password string `yaml:"password"`
 	File     string `yaml:"file"`
 	Ssl      bool   `yaml:"ssl"`
-	loadDemo bool
+	// Record time ranges devices belong to groups, so group history shows devices that were members at the time
+	MembershipHistory bool `yaml:"group_membership_history"`
+	loadDemo          bool
 }
 
 type Influxdb struct {
@@ -75,6 +77,14 @@ type Logging struct {
 type Alarms struct {
 	RunBackground bool          `yaml:"enabled"`
 	Interval      util.Interval `yaml:"interval"`
+	// Workers is number of alarms evaluated concurrently
+	Workers int `yaml:"workers"`
+	// Timeout is maximum duration of single alarm evaluation
+	Timeout util.Interval `yaml:"timeout"`
+	// Instance identifies this instance when multiple instances share database. Defaults to hostname
+	Instance string `yaml:"instance"`
+	// LeaseTimeout is how long other instances wait before taking over alarms from failed instance
+	LeaseTimeout util.Interval `yaml:"lease_timeout"`
 }
 
 type Metrics struct {
@@ -1,10 +1,14 @@
 package dtos
 
 import (
+	"errors"
+	"fmt"
 	"github.com/thedevsaddam/govalidator"
+	"github.com/tryffel/fusio/expression"
 	"github.com/tryffel/fusio/storage/Influxdb"
 	"github.com/tryffel/fusio/storage/models"
 	"github.com/tryffel/fusio/util"
+	"sort"
 	"strings"
 	"time"
 )
@@ -21,6 +25,108 @@ type NewAlarm struct {
 	// e.g. 5 with 2 min interval = 5 consecutive positive fires after 10 min evaluation
 	Trigger int64  `json:"trigger"`
 	Filter  string `json:"filter"`
+	// Gaps: how to handle intervals without data: fail|skip|previous. Empty evaluates only intervals with data
+	Gaps string `json:"gaps"`
+	// Type: threshold (default), anomaly or forecast. Anomaly and forecast alarms only need filters,
+	// e.g. 'mean(temperature)'
+	Type     string                `json:"type"`
+	Anomaly  *models.AnomalyConfig `json:"anomaly"`
+	Forecast *ForecastAlarm        `json:"forecast"`
+	NoData   *NoDataAlarm          `json:"nodata"`
+	// Severity of filter: info, warning (default) or critical
+	Severity string `json:"severity"`
+	// Thresholds are additional filters with own severity for threshold alarm
+	Thresholds []NewThreshold `json:"thresholds"`
+	// ClearFilter: condition to clear fired alarm, e.g. 'mean(temperature) < 25'.
+	// Defaults to filter no longer being true
+	ClearFilter string `json:"clear_filter"`
+	// Deadband: margin to pass back over filter thresholds before clearing, e.g. 2 with filter
+	// 'mean(temperature) > 30' clears at 28
+	Deadband float64 `json:"deadband"`
+	// ClearTrigger: how many consecutive clear evaluations to count before clearing alarm
+	ClearTrigger int64 `json:"clear_trigger"`
+	// Scope: group (default) evaluates group aggregate, device evaluates single device and per_device
+	// evaluates each device in group separately
+	Scope  string `json:"scope"`
+	Device string `json:"device"`
+	// Labels are free-form key-value pairs that silences can match, e.g. site: helsinki
+	Labels map[string]string `json:"labels"`
+	// Escalation: id of escalation policy to notify with until alarm is acknowledged
+	Escalation string `json:"escalation"`
+	// For: how long condition must hold before pending alarm fires, e.g. 10m. Empty fires immediately
+	For string `json:"for"`
+	// FlapWindow and FlapThreshold: alarm that fires or clears flap_threshold times within flap_window
+	// is flapping and its outputs are suppressed until it stabilises. Empty window disables flap detection
+	FlapWindow    string `json:"flap_window"`
+	FlapThreshold int    `json:"flap_threshold"`
+}
+
+// NewThreshold is filter expression with severity, e.g. critical: 'mean(temperature) > 30'
+type NewThreshold struct {
+	Severity string `json:"severity"`
+	Filter   string `json:"filter"`
+}
+
+// ForecastAlarm fires when filter is predicted to go above or below threshold within horizon
+type ForecastAlarm struct {
+	Method    string  `json:"method"`
+	Threshold float64 `json:"threshold"`
+	Direction string  `json:"direction"`
+	// Horizon e.g. '12h'
+	Horizon string `json:"horizon"`
+	// History to fit forecast with, e.g. '24h'
+	History string `json:"history"`
+	Points  int64  `json:"points"`
+	Season  int    `json:"season"`
+}
+
+func (f *ForecastAlarm) ToConfig() (*models.ForecastConfig, error) {
+	config := &models.ForecastConfig{
+		Method:    f.Method,
+		Threshold: f.Threshold,
+		Direction: f.Direction,
+		Points:    f.Points,
+		Season:    f.Season,
+	}
+	switch f.Method {
+	case "", "linear", "holt-winters":
+	default:
+		return config, errors.New("forecast method must be linear or holt-winters")
+	}
+	if f.Direction != "above" && f.Direction != "below" {
+		return config, errors.New("forecast direction must be above or below")
+	}
+
+	var err error
+	config.Horizon, err = time.ParseDuration(f.Horizon)
+	if err != nil || config.Horizon <= 0 {
+		return config, errors.New("invalid forecast horizon")
+	}
+	config.History, err = time.ParseDuration(f.History)
+	if err != nil || config.History <= 0 {
+		return config, errors.New("invalid forecast history")
+	}
+	if config.HorizonPoints() > models.MaxForecastHorizon {
+		return config, fmt.Errorf("forecast horizon can be at most %d points of history, i.e. %s",
+			models.MaxForecastHorizon, config.Step()*models.MaxForecastHorizon)
+	}
+	return config, nil
+}
+
+// NoDataAlarm fires when no measurements have been received within timeout
+type NoDataAlarm struct {
+	// Timeout e.g. '15m'
+	Timeout string `json:"timeout"`
+	// Keys to check separately, e.g. ['temperature']. Leave empty to accept any key
+	Keys []string `json:"keys"`
+}
+
+func (n *NoDataAlarm) ToConfig() (*models.NoDataConfig, error) {
+	timeout, err := time.ParseDuration(n.Timeout)
+	if err != nil || timeout <= 0 {
+		return &models.NoDataConfig{}, errors.New("invalid no-data timeout")
+	}
+	return &models.NoDataConfig{Timeout: timeout, Keys: n.Keys}, nil
 }
 
 func (n *NewAlarm) ToAlarm() (*models.Alarm, error) {
@@ -30,6 +136,11 @@ func (n *NewAlarm) ToAlarm() (*models.Alarm, error) {
 		return &models.Alarm{}, err
 	}
 
+	severity, err := models.ParseSeverity(n.Severity)
+	if err != nil {
+		return &models.Alarm{}, err
+	}
+
 	a := &models.Alarm{
 		Name:        n.Name,
 		Info:        n.Info,
@@ -37,40 +148,332 @@ func (n *NewAlarm) ToAlarm() (*models.Alarm, error) {
 		Message:     n.Message,
 		Enabled:     n.Enabled,
 		RunInterval: dur,
+		Severity:    severity,
+		Scope:       models.AlarmScope(n.Scope),
+		Labels:      models.Labels(n.Labels),
+
+		EscalationPolicyId: n.Escalation,
 	}
-	inputs, err := Influxdb.FilterFromString(n.Filter)
-	if err != nil {
-		return a, err
+	if n.For != "" {
+		a.ForDuration, err = time.ParseDuration(n.For)
+		if err != nil || a.ForDuration < 0 {
+			return a, errors.New("for must be positive duration, e.g. 10m")
+		}
+	}
+	if n.FlapWindow != "" || n.FlapThreshold != 0 {
+		a.FlapWindow, err = time.ParseDuration(n.FlapWindow)
+		if err != nil || a.FlapWindow <= 0 {
+			return a, errors.New("flap_window must be positive duration, e.g. 1h")
+		}
+		if n.FlapThreshold < 2 {
+			return a, errors.New("flap_threshold must be at least 2")
+		}
+		a.FlapThreshold = n.FlapThreshold
+	}
+	switch a.GetScope() {
+	case models.ScopeGroup, models.ScopePerDevice:
+		if n.Group == "" {
+			return a, errors.New("group is required")
+		}
+	case models.ScopeDevice:
+		if n.Device == "" {
+			return a, errors.New("device is required for device scope")
+		}
+		a.DeviceId = n.Device
+	default:
+		return a, errors.New("scope must be one of group, device, per_device")
+	}
+	alarmType := models.AlarmType(n.Type)
+	if alarmType == "" {
+		alarmType = models.AlarmThreshold
+	}
+	if a.GetScope() == models.ScopePerDevice && alarmType != models.AlarmThreshold && alarmType != models.AlarmNoData {
+		return a, errors.New("per_device scope is only supported for threshold and nodata alarms")
+	}
+	if n.Filter == "" && alarmType != models.AlarmNoData {
+		return a, errors.New("filter is required")
+	}
+
+	var forecast *models.ForecastConfig
+	var noData *models.NoDataConfig
+	switch alarmType {
+	case models.AlarmAnomaly:
+		if n.Anomaly == nil {
+			n.Anomaly = &models.AnomalyConfig{}
+		}
+		switch n.Anomaly.Method {
+		case "", models.BaselineRolling, models.BaselineEwma, models.BaselineSeasonal:
+		default:
+			return a, errors.New("anomaly method must be one of rolling, ewma, seasonal")
+		}
+	case models.AlarmForecast:
+		if n.Forecast == nil {
+			return a, errors.New("forecast alarm needs forecast configuration")
+		}
+		forecast, err = n.Forecast.ToConfig()
+		if err != nil {
+			return a, err
+		}
+	case models.AlarmNoData:
+		if n.NoData == nil {
+			return a, errors.New("nodata alarm needs nodata configuration")
+		}
+		noData, err = n.NoData.ToConfig()
+		if err != nil {
+			return a, err
+		}
 	}
 
-	// Simplify filter clause: mean(temp) -> mean_temp
-	filter := strings.Replace(n.Filter, " ", "", -1)
-	for _, v := range *inputs {
-		s := v.String()
-		sim := v.StringSimplified()
-		filter = strings.Replace(filter, s, sim, -1)
+	filters := []Influxdb.Filter{}
+	filterExpression := ""
+	if n.Filter != "" {
+		// Anomaly and forecast alarms only need aggregation, e.g. 'mean(temperature)'
+		filters, filterExpression, err = parseFilter("filter", n.Filter, alarmType == models.AlarmThreshold)
+		if err != nil {
+			return a, err
+		}
+		if len(filters) == 0 {
+			return a, errors.New("filter needs aggregation, e.g. 'mean(temperature) > 10'")
+		}
+	}
+
+	var thresholds []models.Threshold
+	if len(n.Thresholds) > 0 && alarmType != models.AlarmThreshold {
+		return a, errors.New("thresholds are only supported for threshold alarms")
+	}
+	for _, v := range n.Thresholds {
+		severity, err := models.ParseSeverity(v.Severity)
+		if err != nil {
+			return a, err
+		}
+		if severity == "" {
+			return a, errors.New("threshold needs severity")
+		}
+		thresholdInputs, thresholdExpression, err := parseFilter("threshold filter", v.Filter, true)
+		if err != nil {
+			return a, err
+		}
+		for _, input := range thresholdInputs {
+			if !containsFilter(filters, input) {
+				filters = append(filters, input)
+			}
+		}
+		thresholds = append(thresholds, models.Threshold{
+			Severity:   severity,
+			Expression: thresholdExpression,
+		})
+	}
+
+	clearExpression := ""
+	if n.ClearFilter != "" || n.Deadband != 0 || n.ClearTrigger != 0 {
+		if alarmType != models.AlarmThreshold {
+			return a, errors.New("clear conditions are only supported for threshold alarms")
+		}
+		if n.ClearFilter != "" && n.Deadband != 0 {
+			return a, errors.New("use either clear filter or deadband")
+		}
+		if n.Deadband < 0 || n.ClearTrigger < 0 {
+			return a, errors.New("deadband and clear trigger cannot be negative")
+		}
+	}
+	if n.ClearFilter != "" {
+		clearInputs, simplified, err := parseFilter("clear filter", n.ClearFilter, true)
+		if err != nil {
+			return a, err
+		}
+		for _, input := range clearInputs {
+			if !containsFilter(filters, input) {
+				filters = append(filters, input)
+			}
+		}
+		clearExpression = simplified
 	}
 
 	af := models.AlarmFilter{
-		Filters:    *inputs,
-		Expression: filter,
+		Type:       alarmType,
+		Filters:    filters,
+		Expression: filterExpression,
 		Limit:      n.Trigger,
+		Gaps:       models.GapPolicy(n.Gaps),
+		Thresholds: thresholds,
+
+		ClearExpression: clearExpression,
+		Deadband:        n.Deadband,
+		ClearLimit:      n.ClearTrigger,
+	}
+	if alarmType == models.AlarmAnomaly {
+		anomaly := n.Anomaly.WithDefaults()
+		af.Anomaly = &anomaly
 	}
+	af.Forecast = forecast
+	af.NoData = noData
 	a.Filter = af
 	return a, nil
 }
 
+// parseFilter parses filter and returns its aggregations and simplified expression:
+// 'mean(temp) > 10' -> 'mean_temp>10'. Condition filter must evaluate to boolean.
+// Errors are prefixed with name of filter and point at offending token
+func parseFilter(name string, filter string, condition bool) ([]Influxdb.Filter, string, error) {
+	var e *expression.Expression
+	var err error
+	if condition {
+		e, err = expression.ParseCondition(filter)
+	} else {
+		e, err = expression.Parse(filter)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %s", name, err.Error())
+	}
+
+	filters := make([]Influxdb.Filter, 0)
+	keys := make(map[string]bool)
+	for _, v := range e.Aggregations() {
+		parsed, err := Influxdb.FilterFromCall(v)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %s at position %d", name, err.Error(), v.Pos())
+		}
+		keys[v.Key()] = true
+		if !containsFilter(filters, parsed) {
+			filters = append(filters, parsed)
+		}
+	}
+
+	// Bare measurement key has no value when evaluated, e.g. 'humidity > 5' instead of 'mean(humidity) > 5'
+	var unknown *expression.Ident
+	expression.Walk(e.Root, func(n expression.Node) bool {
+		if call, ok := n.(*expression.Call); ok && call.IsAggregation() {
+			return false
+		}
+		if ident, ok := n.(*expression.Ident); ok && !keys[ident.Name] && unknown == nil {
+			unknown = ident
+		}
+		return true
+	})
+	if unknown != nil {
+		return nil, "", fmt.Errorf("%s: measurement key must be aggregated, e.g. mean(%s) at position %d: '%s'",
+			name, unknown.Name, unknown.Pos(), unknown.Name)
+	}
+	// Stored expressions are kept without whitespace, as they were before parser
+	return filters, strings.Replace(e.Simplified(), " ", "", -1), nil
+}
+
+// RestoreFilter restores simplified expression back to filter clause: mean_temp -> mean(temp)
+func RestoreFilter(expression string, inputs []Influxdb.Filter) string {
+	// Replace longest names first, so 'max_temp' doesn't match inside 'derivative_max_temp'
+	filters := make([]Influxdb.Filter, len(inputs))
+	copy(filters, inputs)
+	sort.Slice(filters, func(i, j int) bool {
+		return len(filters[i].StringSimplified()) > len(filters[j].StringSimplified())
+	})
+	for _, v := range filters {
+		expression = strings.Replace(expression, v.StringSimplified(), v.String(), -1)
+	}
+	return expression
+}
+
+func containsFilter(filters []Influxdb.Filter, filter Influxdb.Filter) bool {
+	for _, v := range filters {
+		if v.StringSimplified() == filter.StringSimplified() {
+			return true
+		}
+	}
+	return false
+}
+
+// AlarmToNewAlarm converts alarm back to editable form. Filter is restored from simplified expression
+func AlarmToNewAlarm(a *models.Alarm) *NewAlarm {
+	filter := RestoreFilter(a.Filter.Expression, a.Filter.Filters)
+
+	n := &NewAlarm{
+		Name:     a.Name,
+		Info:     a.Info,
+		Group:    a.Group,
+		Message:  a.Message,
+		Enabled:  a.Enabled,
+		Interval: a.RunInterval.String(),
+		Trigger:  a.Filter.Limit,
+		Filter:   filter,
+		Gaps:     string(a.Filter.Gaps),
+		Type:     string(a.Filter.GetType()),
+		Severity: string(a.Severity),
+
+		ClearFilter:  RestoreFilter(a.Filter.ClearExpression, a.Filter.Filters),
+		Deadband:     a.Filter.Deadband,
+		ClearTrigger: a.Filter.ClearLimit,
+		Scope:        string(a.GetScope()),
+		Device:       a.DeviceId,
+		Escalation:   a.EscalationPolicyId,
+
+		FlapThreshold: a.FlapThreshold,
+	}
+	// Editing restored alarm must not modify alarm it was restored from
+	if a.Filter.Anomaly != nil {
+		anomaly := *a.Filter.Anomaly
+		n.Anomaly = &anomaly
+	}
+	if a.Labels != nil {
+		n.Labels = make(map[string]string, len(a.Labels))
+		for k, v := range a.Labels {
+			n.Labels[k] = v
+		}
+	}
+	if a.ForDuration > 0 {
+		n.For = a.ForDuration.String()
+	}
+	if a.FlapWindow > 0 {
+		n.FlapWindow = a.FlapWindow.String()
+	}
+	for _, v := range a.Filter.Thresholds {
+		n.Thresholds = append(n.Thresholds, NewThreshold{
+			Severity: string(v.Severity),
+			Filter:   RestoreFilter(v.Expression, a.Filter.Filters),
+		})
+	}
+	if f := a.Filter.NoData; f != nil {
+		n.NoData = &NoDataAlarm{
+			Timeout: f.Timeout.String(),
+			Keys:    append([]string(nil), f.Keys...),
+		}
+	}
+	if f := a.Filter.Forecast; f != nil {
+		n.Forecast = &ForecastAlarm{
+			Method:    f.Method,
+			Threshold: f.Threshold,
+			Direction: f.Direction,
+			Horizon:   f.Horizon.String(),
+			History:   f.History.String(),
+			Points:    f.Points,
+			Season:    f.Season,
+		}
+	}
+	return n
+}
+
 func (n *NewAlarm) ValidationMap() *govalidator.MapData {
 	return &govalidator.MapData{
 		"name":    []string{"required"},
 		"info":    []string{},
-		"group":   []string{"uuid", "required"},
+		"group":   []string{"uuid"},
 		"message": []string{},
 		// Interval has to be between 1s-1y
 		"interval": []string{"duration"},
 		"trigger":  []string{"required"},
 		// Expression will be should when changing to alarm
-		"filter": []string{"regex:.+[+-><=].+", "required"},
+		"filter":         []string{},
+		"gaps":           []string{"in:fail,skip,previous"},
+		"type":           []string{"in:threshold,anomaly,forecast,nodata"},
+		"severity":       []string{"in:info,warning,critical"},
+		"clear_filter":   []string{},
+		"deadband":       []string{},
+		"clear_trigger":  []string{},
+		"scope":          []string{"in:group,device,per_device"},
+		"device":         []string{"uuid"},
+		"labels":         []string{},
+		"escalation":     []string{"uuid"},
+		"for":            []string{},
+		"flap_window":    []string{},
+		"flap_threshold": []string{},
 	}
 }
 
@@ -78,13 +481,27 @@ func (n *NewAlarm) ValidationMessages() *govalidator.MapData {
 	return &govalidator.MapData{
 		"name":     []string{"Descriptive name for alarm. Required"},
 		"info":     []string{"Additional information about alarm"},
-		"group":    []string{"Group that alarms get's valuated inside"},
+		"group":    []string{"Group that alarms get's valuated inside. Required unless scope is device"},
 		"message":  []string{"Message that get's sent when alarm gets fired"},
 		"interval": []string{"Interval for evaluating alarm. E.g. '1m' means alarm is evaluated every 1m"},
 		"trigger": []string{"Trigger for how many consecutive positive before alarming. E.g. with interval of 1m " +
 			"and trigger of 10, after 10 min of positive evaluations alarm will get fired. Set to 1 to immediately " +
 			"fire alarm after one positive evaluation"},
-		"filter": []string{"Expression for evaluation. e.g. 'mean(temperature) - max(humidity) > 10'"},
+		"filter": []string{"Expression for evaluation. e.g. 'mean(temperature) - max(humidity) > 10'. " +
+			"Supports operators + - * / %, comparisons, '&&' (and), '||' (or), '!' (not), " +
+			"functions abs, min, max, clamp, round and time functions hour(), minute() and weekday(). " +
+			"Transformations derivative, non_negative_derivative, moving_average, difference, cumulative_sum " +
+			"and elapsed can be nested, e.g. 'derivative(moving_average(mean(temperature),5),1m) > 1'. " +
+			"Required for all but nodata alarms"},
+		"gaps": []string{"How to handle intervals without data: 'fail' counts as negative evaluation, " +
+			"'skip' ignores interval and 'previous' uses previous value. Leave empty to evaluate only intervals with data"},
+		"type": []string{"Alarm type: 'threshold' evaluates filter expression, 'anomaly' fires when measurements " +
+			"differ from learned baseline, 'forecast' fires when measurements are predicted to cross threshold, " +
+			"'nodata' fires when devices have not reported within timeout"},
+		"for": []string{"How long condition must hold before alarm fires, e.g. '10m'. Alarm is pending meanwhile. " +
+			"Leave empty to fire immediately"},
+		"flap_window":    []string{"Time window for flap detection, e.g. '1h'. Leave empty to disable flap detection"},
+		"flap_threshold": []string{"Number of times alarm can fire or clear within flap_window before it is flapping, at least 2"},
 	}
 }
 
@@ -96,7 +513,7 @@ type Alarm struct {
 	Fired    bool          `json:"fired"`
 	Enabled  bool          `json:"enabled"`
 	Group    string        `json:"group"`
-	Interval util.Interval `json:interval`
+	Interval util.Interval `json:"interval"`
 	Trigger  int64         `json:"trigger"`
 	Filter   string        `json:"filter"`
 }
@@ -114,3 +531,20 @@ func AlarmToDto(a *models.Alarm) *Alarm {
 	}
 	return alarm
 }
+
+// AlarmAck is optional comment for acknowledging alarm
+type AlarmAck struct {
+	Comment string `json:"comment"`
+}
+
+func (a *AlarmAck) ValidationMap() *govalidator.MapData {
+	return &govalidator.MapData{
+		"comment": []string{"max:500"},
+	}
+}
+
+func (a *AlarmAck) ValidationMessages() *govalidator.MapData {
+	return &govalidator.MapData{
+		"comment": []string{"Optional comment on how alarm is being handled"},
+	}
+}
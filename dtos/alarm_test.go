@@ -1,6 +1,7 @@
 package dtos
 
 import (
+	"github.com/tryffel/fusio/storage/models"
 	"testing"
 )
 
@@ -31,7 +32,141 @@ func TestAlarmDtoToAlarm(t *testing.T) {
 		t.Error("Alarm querys group doesn't match dto")
 	}
 
-	if query.Expression != "mean_temperature-derivative_max_temperature>10" {
+	if query.Expression != "mean_temperature-derivative_10_max_temperature>10" {
 		t.Errorf("alarm query doesn't match expected: %s", query.Expression)
 	}
 }
+
+func TestAlarmToNewAlarm(t *testing.T) {
+	dto := NewAlarm{
+		Name:     "test",
+		Group:    "abcd-1234",
+		Interval: "1m0s",
+		Trigger:  3,
+		Filter:   "mean(temperature)-derivative(max(temperature),10)>10",
+		Gaps:     "skip",
+	}
+
+	alarm, err := dto.ToAlarm()
+	if err != nil {
+		t.Fatalf("Error creating alarm from dto: %s", err.Error())
+	}
+
+	restored := AlarmToNewAlarm(alarm)
+	if restored.Filter != dto.Filter {
+		t.Errorf("Filter not restored: expected %s, got %s", dto.Filter, restored.Filter)
+	}
+	if restored.Interval != dto.Interval || restored.Trigger != dto.Trigger || restored.Gaps != dto.Gaps {
+		t.Error("Restored dto doesn't match original")
+	}
+}
+
+func TestAlarmToNewAlarmCopies(t *testing.T) {
+	alarm := &models.Alarm{
+		Labels: models.Labels{"site": "helsinki"},
+		Filter: models.AlarmFilter{Anomaly: &models.AnomalyConfig{Threshold: 3}},
+	}
+	restored := AlarmToNewAlarm(alarm)
+	restored.Labels["site"] = "tampere"
+	restored.Anomaly.Threshold = 4
+	if alarm.Labels["site"] != "helsinki" {
+		t.Error("editing restored labels modified alarm")
+	}
+	if alarm.Filter.Anomaly.Threshold != 3 {
+		t.Error("editing restored anomaly config modified alarm")
+	}
+}
+
+func TestAlarmDtoInvalidFilter(t *testing.T) {
+	filters := []string{
+		"mean(temperature) = 10",
+		"mean(temperature) > 10 && 5",
+		"1 > 0",
+		"mean(temperature) + 10",
+		"mean(temperature) > 30 && humidity > 5",
+	}
+	for _, v := range filters {
+		dto := NewAlarm{
+			Name:     "test",
+			Group:    "abcd-1234",
+			Interval: "60s",
+			Trigger:  1,
+			Filter:   v,
+		}
+		if _, err := dto.ToAlarm(); err == nil {
+			t.Errorf("expected error for filter '%s'", v)
+		}
+	}
+}
+
+func TestAlarmNestedTransformation(t *testing.T) {
+	dto := NewAlarm{
+		Name:     "test",
+		Group:    "abcd-1234",
+		Interval: "1m0s",
+		Trigger:  1,
+		Filter:   "derivative(moving_average(mean(temperature),5),1m)>1&&moving_average(mean(temperature),5)>20",
+	}
+
+	alarm, err := dto.ToAlarm()
+	if err != nil {
+		t.Fatalf("Error creating alarm from dto: %s", err.Error())
+	}
+	if len(alarm.Filter.Filters) != 2 {
+		t.Fatalf("expected 2 filters, got %d", len(alarm.Filter.Filters))
+	}
+	if alarm.Filter.Expression != "derivative_1m_moving_average_5_mean_temperature>1&&moving_average_5_mean_temperature>20" {
+		t.Errorf("unexpected expression: %s", alarm.Filter.Expression)
+	}
+
+	restored := AlarmToNewAlarm(alarm)
+	if restored.Filter != dto.Filter {
+		t.Errorf("Filter not restored: expected %s, got %s", dto.Filter, restored.Filter)
+	}
+}
+
+func TestAlarmTransformationParameters(t *testing.T) {
+	dto := NewAlarm{
+		Name:     "test",
+		Group:    "abcd-1234",
+		Interval: "1m0s",
+		Trigger:  1,
+		Filter:   "derivative(mean(temperature),10s)>1||derivative(mean(temperature),1m)>5",
+	}
+
+	alarm, err := dto.ToAlarm()
+	if err != nil {
+		t.Fatalf("Error creating alarm from dto: %s", err.Error())
+	}
+	if len(alarm.Filter.Filters) != 2 {
+		t.Fatalf("expected 2 filters, got %d", len(alarm.Filter.Filters))
+	}
+	if alarm.Filter.Expression != "derivative_10s_mean_temperature>1||derivative_1m_mean_temperature>5" {
+		t.Errorf("unexpected expression: %s", alarm.Filter.Expression)
+	}
+	restored := AlarmToNewAlarm(alarm)
+	if restored.Filter != dto.Filter {
+		t.Errorf("Filter not restored: expected %s, got %s", dto.Filter, restored.Filter)
+	}
+}
+
+func TestForecastAlarmHorizon(t *testing.T) {
+	tests := []struct {
+		name    string
+		dto     ForecastAlarm
+		wantErr bool
+	}{
+		{"horizon within limit", ForecastAlarm{Direction: "above", Horizon: "12h", History: "24h"}, false},
+		{"horizon at limit", ForecastAlarm{Direction: "above", Horizon: "144h", History: "24h"}, false},
+		{"horizon over limit", ForecastAlarm{Direction: "above", Horizon: "168h", History: "24h"}, true},
+		{"fewer points allow longer horizon", ForecastAlarm{Direction: "above", Horizon: "168h", History: "24h",
+			Points: 10}, false},
+	}
+
+	for _, v := range tests {
+		_, err := v.dto.ToConfig()
+		if (err != nil) != v.wantErr {
+			t.Errorf("%s: expected error %t, got %v", v.name, v.wantErr, err)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package dtos
+
+import (
+	"github.com/thedevsaddam/govalidator"
+	"time"
+)
+
+// BacktestRequest replays alarm over historical measurements
+type BacktestRequest struct {
+	Alarm NewAlarm `json:"alarm"`
+	// From and To in RFC3339
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (b *BacktestRequest) ValidationMap() *govalidator.MapData {
+	return &govalidator.MapData{
+		"from": []string{"required"},
+		"to":   []string{"required"},
+	}
+}
+
+func (b *BacktestRequest) ValidationMessages() *govalidator.MapData {
+	return &govalidator.MapData{
+		"from": []string{"Start of time range to replay alarm over, e.g. '2019-06-01T00:00:00Z'"},
+		"to":   []string{"End of time range to replay alarm over, e.g. '2019-06-08T00:00:00Z'"},
+	}
+}
+
+// BacktestEvent is fire, clear or severity change alarm would have produced
+type BacktestEvent struct {
+	Timestamp time.Time          `json:"timestamp"`
+	Type      string             `json:"type"`
+	Severity  string             `json:"severity"`
+	Device    string             `json:"device,omitempty"`
+	Values    map[string]float64 `json:"values,omitempty"`
+	// Suppressed is true if alarm was flapping and outputs would not have been pushed
+	Suppressed bool `json:"suppressed,omitempty"`
+}
+
+// BacktestResult is timeline of alarm over time range
+type BacktestResult struct {
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+	Fires int       `json:"fires"`
+	// FiredSeconds is total time alarm would have been fired. Per-device alarms count each device separately
+	FiredSeconds float64         `json:"fired_seconds"`
+	Events       []BacktestEvent `json:"events"`
+}
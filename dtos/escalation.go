@@ -0,0 +1,101 @@
+package dtos
+
+import (
+	"errors"
+	"fmt"
+	"github.com/thedevsaddam/govalidator"
+	"github.com/tryffel/fusio/storage/models"
+	"time"
+)
+
+// NewEscalationPolicy has ordered steps that notify output channels until alarm is acknowledged or cleared
+type NewEscalationPolicy struct {
+	Name string `json:"name"`
+	// Repeat starts from first step after last step
+	Repeat bool                `json:"repeat"`
+	Steps  []NewEscalationStep `json:"steps"`
+}
+
+// NewEscalationStep notifies output channels and waits delay before next step
+type NewEscalationStep struct {
+	OutputChannels []string `json:"output_channels"`
+	// Template: notification template, e.g. '{{.AlarmName}} not acknowledged'
+	Template string `json:"template"`
+	// Delay before next step, e.g. '15m'
+	Delay string `json:"delay"`
+}
+
+func (n *NewEscalationPolicy) ToPolicy() (*models.EscalationPolicy, error) {
+	policy := &models.EscalationPolicy{
+		Name:   n.Name,
+		Repeat: n.Repeat,
+		Steps:  models.EscalationSteps{},
+	}
+	if len(n.Steps) == 0 {
+		return policy, errors.New("escalation policy needs at least one step")
+	}
+	for i, v := range n.Steps {
+		if len(v.OutputChannels) == 0 {
+			return policy, fmt.Errorf("step %d has no output channels", i+1)
+		}
+		step := models.EscalationStep{
+			OutputChannels: v.OutputChannels,
+			Template:       v.Template,
+		}
+		if v.Delay != "" {
+			delay, err := time.ParseDuration(v.Delay)
+			if err != nil {
+				return policy, fmt.Errorf("invalid delay in step %d: %s", i+1, v.Delay)
+			}
+			step.Delay = delay
+		}
+		// Only last step of non-repeating policy can be without delay
+		last := i == len(n.Steps)-1 && !n.Repeat
+		if step.Delay <= 0 && !last {
+			return policy, fmt.Errorf("step %d needs delay", i+1)
+		}
+		policy.Steps = append(policy.Steps, step)
+	}
+	return policy, nil
+}
+
+func (n *NewEscalationPolicy) ValidationMap() *govalidator.MapData {
+	return &govalidator.MapData{
+		"name":   []string{"required", "max:100"},
+		"repeat": []string{"bool"},
+		"steps":  []string{"required"},
+	}
+}
+
+func (n *NewEscalationPolicy) ValidationMessages() *govalidator.MapData {
+	return &govalidator.MapData{
+		"name":   []string{"Name of policy. Required"},
+		"repeat": []string{"Start again from first step after last step"},
+		"steps": []string{"Ordered steps, e.g. [{\"output_channels\": [\"<id>\"], \"delay\": \"15m\"}]. " +
+			"Each step notifies its output channels and waits delay before next step"},
+	}
+}
+
+type EscalationPolicy struct {
+	Id     string              `json:"id"`
+	Name   string              `json:"name"`
+	Repeat bool                `json:"repeat"`
+	Steps  []NewEscalationStep `json:"steps"`
+}
+
+func EscalationPolicyToDto(p *models.EscalationPolicy) *EscalationPolicy {
+	dto := &EscalationPolicy{
+		Id:     p.ID,
+		Name:   p.Name,
+		Repeat: p.Repeat,
+		Steps:  make([]NewEscalationStep, len(p.Steps)),
+	}
+	for i, v := range p.Steps {
+		dto.Steps[i] = NewEscalationStep{
+			OutputChannels: v.OutputChannels,
+			Template:       v.Template,
+			Delay:          v.Delay.String(),
+		}
+	}
+	return dto
+}
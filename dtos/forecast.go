@@ -0,0 +1,69 @@
+package dtos
+
+import (
+	"github.com/thedevsaddam/govalidator"
+	"time"
+)
+
+// ForecastRequest requests prediction for device or group measurements
+type ForecastRequest struct {
+	Device string `json:"device"`
+	Group  string `json:"group"`
+	// Filter selects measurements to forecast, e.g. 'mean(level)'
+	Filter string `json:"filter"`
+	// Range is history to fit model with, e.g. '24h'
+	Range string `json:"range"`
+	// Points is number of points in history
+	Points int64 `json:"points"`
+	// Method is linear or holt-winters
+	Method string `json:"method"`
+	// Horizon is number of points to predict
+	Horizon int `json:"horizon"`
+	// Season is length of season in points for holt-winters
+	Season int `json:"season"`
+	// Threshold to find crossing time for. Crossing is only computed if direction is set
+	Threshold float64 `json:"threshold"`
+	Direction string  `json:"direction"`
+}
+
+func (f *ForecastRequest) ValidationMap() *govalidator.MapData {
+	return &govalidator.MapData{
+		"device":    []string{"uuid"},
+		"group":     []string{"uuid"},
+		"filter":    []string{"required"},
+		"range":     []string{"required", "duration"},
+		"points":    []string{"numeric_between:3,300"},
+		"method":    []string{"in:linear,holt-winters"},
+		"horizon":   []string{"numeric_between:1,300"},
+		"season":    []string{"numeric_between:0,300"},
+		"direction": []string{"in:above,below"},
+	}
+}
+
+func (f *ForecastRequest) ValidationMessages() *govalidator.MapData {
+	return &govalidator.MapData{
+		"device":    []string{"Device to forecast. Either device or group is required"},
+		"group":     []string{"Group to forecast. Either device or group is required"},
+		"filter":    []string{"Measurements to forecast, e.g. 'mean(level)'"},
+		"range":     []string{"History to fit forecast with, e.g. '24h'"},
+		"points":    []string{"Number of points in history, 3-300. Defaults to 50"},
+		"method":    []string{"Forecast method: 'linear' (default) or 'holt-winters'"},
+		"horizon":   []string{"Number of points to predict, 1-300. Defaults to 10"},
+		"season":    []string{"Length of season in points for holt-winters, e.g. 24 for daily cycle with hourly points"},
+		"direction": []string{"Find time when forecast goes 'above' or 'below' threshold"},
+	}
+}
+
+type ForecastPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+	Lower     float64   `json:"lower"`
+	Upper     float64   `json:"upper"`
+}
+
+// Forecast for single filter. Crossing is time threshold is reached, if it is reached within forecast
+type Forecast struct {
+	Filter   string          `json:"filter"`
+	Points   []ForecastPoint `json:"points"`
+	Crossing *time.Time      `json:"crossing,omitempty"`
+}
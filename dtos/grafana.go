@@ -0,0 +1,89 @@
+package dtos
+
+import (
+	"time"
+)
+
+// Dtos for Grafana JSON / SimpleJSON datasource.
+// See https://grafana.com/grafana/plugins/grafana-simple-json-datasource for protocol
+
+const (
+	GrafanaTargetDevice = "device"
+	GrafanaTargetGroup  = "group"
+)
+
+type GrafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type GrafanaSearch struct {
+	Target string `json:"target"`
+}
+
+// GrafanaSearchResult is single selectable metric. Value is used as target in queries
+type GrafanaSearchResult struct {
+	Text  string `json:"text"`
+	Value string `json:"value"`
+}
+
+type GrafanaTarget struct {
+	Target string `json:"target"`
+	RefId  string `json:"refId"`
+	Type   string `json:"type"`
+}
+
+type GrafanaAdhocFilter struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+type GrafanaQuery struct {
+	Range         GrafanaRange         `json:"range"`
+	IntervalMs    int64                `json:"intervalMs"`
+	MaxDataPoints int64                `json:"maxDataPoints"`
+	Targets       []GrafanaTarget      `json:"targets"`
+	AdhocFilters  []GrafanaAdhocFilter `json:"adhocFilters"`
+}
+
+// GrafanaTimeSeries datapoints are [value, unix timestamp in milliseconds]. Value is null for missing data
+type GrafanaTimeSeries struct {
+	Target     string           `json:"target"`
+	Datapoints [][2]interface{} `json:"datapoints"`
+}
+
+type GrafanaAnnotationQuery struct {
+	Name       string `json:"name"`
+	Datasource string `json:"datasource"`
+	Enable     bool   `json:"enable"`
+	// Query is optional alarm or group id to filter annotations with
+	Query string `json:"query"`
+}
+
+type GrafanaAnnotationRequest struct {
+	Range      GrafanaRange           `json:"range"`
+	Annotation GrafanaAnnotationQuery `json:"annotation"`
+}
+
+type GrafanaAnnotation struct {
+	Annotation GrafanaAnnotationQuery `json:"annotation"`
+	// Time in unix milliseconds
+	Time  int64    `json:"time"`
+	Title string   `json:"title"`
+	Tags  []string `json:"tags"`
+	Text  string   `json:"text"`
+}
+
+type GrafanaTagKey struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type GrafanaTagValueRequest struct {
+	Key string `json:"key"`
+}
+
+type GrafanaTagValue struct {
+	Text string `json:"text"`
+}
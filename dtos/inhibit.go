@@ -0,0 +1,72 @@
+package dtos
+
+import (
+	"errors"
+	"github.com/thedevsaddam/govalidator"
+	"github.com/tryffel/fusio/storage/models"
+	"time"
+)
+
+// NewInhibitRule suppresses outputs of child alarms while source alarm is fired.
+// Children are either single alarm or all alarms in group.
+type NewInhibitRule struct {
+	Comment     string `json:"comment"`
+	Source      string `json:"source"`
+	TargetAlarm string `json:"target_alarm"`
+	TargetGroup string `json:"target_group"`
+}
+
+func (n *NewInhibitRule) ToInhibitRule() (*models.InhibitRule, error) {
+	rule := &models.InhibitRule{
+		Comment:       n.Comment,
+		SourceAlarmId: n.Source,
+		TargetAlarmId: n.TargetAlarm,
+		TargetGroupId: n.TargetGroup,
+	}
+	if (n.TargetAlarm == "") == (n.TargetGroup == "") {
+		return rule, errors.New("inhibit rule needs either target alarm or target group")
+	}
+	if n.TargetAlarm == n.Source {
+		return rule, errors.New("alarm cannot inhibit itself")
+	}
+	return rule, nil
+}
+
+func (n *NewInhibitRule) ValidationMap() *govalidator.MapData {
+	return &govalidator.MapData{
+		"comment":      []string{"max:500"},
+		"source":       []string{"required", "uuid"},
+		"target_alarm": []string{"uuid"},
+		"target_group": []string{"uuid"},
+	}
+}
+
+func (n *NewInhibitRule) ValidationMessages() *govalidator.MapData {
+	return &govalidator.MapData{
+		"comment":      []string{"Description of dependency, e.g. 'Sensors behind gateway'"},
+		"source":       []string{"Id of parent alarm that inhibits children when fired. Required"},
+		"target_alarm": []string{"Id of child alarm. Either target_alarm or target_group is required"},
+		"target_group": []string{"Id of group whose alarms are children. Either target_alarm or target_group " +
+			"is required"},
+	}
+}
+
+type InhibitRule struct {
+	Id          string    `json:"id"`
+	Comment     string    `json:"comment"`
+	Source      string    `json:"source"`
+	TargetAlarm string    `json:"target_alarm,omitempty"`
+	TargetGroup string    `json:"target_group,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func InhibitRuleToDto(r *models.InhibitRule) *InhibitRule {
+	return &InhibitRule{
+		Id:          r.ID,
+		Comment:     r.Comment,
+		Source:      r.SourceAlarmId,
+		TargetAlarm: r.TargetAlarmId,
+		TargetGroup: r.TargetGroupId,
+		CreatedAt:   r.CreatedAt,
+	}
+}
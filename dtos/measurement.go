@@ -1,5 +1,11 @@
 package dtos
 
+import (
+	"github.com/thedevsaddam/govalidator"
+	"github.com/tryffel/fusio/storage/repository"
+	"time"
+)
+
 type Measurement struct {
 	Unit   string `json:"unit"`
 	Values []interface{}
@@ -8,3 +14,44 @@ type Measurement struct {
 type MeasurementList struct {
 	Measurements []string
 }
+
+// MeasurementInfo summary of single measurement key
+type MeasurementInfo struct {
+	Key       string    `json:"key"`
+	Device    string    `json:"device"`
+	Unit      string    `json:"unit"`
+	LastValue float32   `json:"last_value"`
+	LastSeen  time.Time `json:"last_seen"`
+	Count24h  int64     `json:"count_24h"`
+}
+
+func MeasurementInfoToDto(info []repository.MeasurementInfo) []MeasurementInfo {
+	dto := make([]MeasurementInfo, len(info))
+	for i, v := range info {
+		dto[i] = MeasurementInfo{
+			Key:       v.Key,
+			Device:    v.Device,
+			Unit:      v.Unit,
+			LastValue: v.LastValue,
+			LastSeen:  v.LastSeen,
+			Count24h:  v.Count,
+		}
+	}
+	return dto
+}
+
+type MeasurementUnit struct {
+	Unit string `json:"unit"`
+}
+
+func (m *MeasurementUnit) ValidationMap() *govalidator.MapData {
+	return &govalidator.MapData{
+		"unit": []string{"max:20"},
+	}
+}
+
+func (m *MeasurementUnit) ValidationMessages() *govalidator.MapData {
+	return &govalidator.MapData{
+		"unit": []string{"Unit of measurement, e.g. '°C'. Max 20 characters"},
+	}
+}
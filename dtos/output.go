@@ -22,6 +22,10 @@ type NewOutput struct {
 	ClearTemplate string        `json:"template_clear"`
 	ErrorTemplate string        `json:"template_error"`
 	Repeat        util.Interval `json:"repeat"`
+	// MaxRepeat is maximum number of repeats per fire, 0 repeats until alarm is cleared or acknowledged
+	MaxRepeat int `json:"max_repeat"`
+	// MinSeverity is lowest alarm severity to push output for
+	MinSeverity string `json:"min_severity"`
 }
 
 func (o *NewOutput) ValidationMap() *govalidator.MapData {
@@ -34,6 +38,8 @@ func (o *NewOutput) ValidationMap() *govalidator.MapData {
 		"template_clear":    []string{""},
 		"template_error":    []string{""},
 		"repeat":            []string{},
+		"max_repeat":        []string{"numeric_between:0,1000"},
+		"min_severity":      []string{"in:info,warning,critical"},
 	}
 }
 
@@ -45,7 +51,12 @@ func (o *NewOutput) ValidationMessages() *govalidator.MapData {
 		"template_fire":     []string{"Template'd string to send when fired with filled data. See docs."},
 		"template_clear":    []string{"Template'd string to send when cleared with filled data. See docs."},
 		"template_error":    []string{"Template'd string to send on error with filled data. See docs."},
-		"repeat":            []string{"Repeat interval. Can be e.g. '1s', '1m', '1d'. Leave empty to disable."},
+		"repeat": []string{"Repeat interval to push fire output again while alarm stays fired and unacknowledged. " +
+			"Can be e.g. '1s', '1m', '1d'. Leave empty to disable. Templates can use {{.Occurrence}} and {{.Elapsed}}"},
+		"max_repeat": []string{"Maximum number of repeats per fire. Leave empty to repeat until alarm is cleared " +
+			"or acknowledged"},
+		"min_severity": []string{"Lowest alarm severity to push output for: 'info', 'warning' or 'critical'. " +
+			"Leave empty to push all severities."},
 	}
 }
 
@@ -60,6 +71,8 @@ func (o *NewOutput) ToOutput() *models.Output {
 		ClearTemplate:   o.ClearTemplate,
 		ErrorTemplate:   o.ErrorTemplate,
 		Repeat:          time.Duration(o.Repeat),
+		MaxRepeat:       o.MaxRepeat,
+		MinSeverity:     models.Severity(o.MinSeverity),
 	}
 
 	if output.FireTemplate == "" {
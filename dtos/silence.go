@@ -0,0 +1,148 @@
+package dtos
+
+import (
+	"errors"
+	"fmt"
+	"github.com/thedevsaddam/govalidator"
+	"github.com/tryffel/fusio/storage/models"
+	"time"
+)
+
+// NewSilence suppresses outputs of matching alarms during time range, e.g. planned maintenance.
+// At least one matcher is required, and all set matchers must match.
+type NewSilence struct {
+	Comment string `json:"comment"`
+	Alarm   string `json:"alarm"`
+	Group   string `json:"group"`
+	Device  string `json:"device"`
+	// Labels matches alarms that have all given labels
+	Labels map[string]string `json:"labels"`
+	// StartsAt and EndsAt in RFC3339. StartsAt defaults to now
+	StartsAt string `json:"starts_at"`
+	EndsAt   string `json:"ends_at"`
+	// Schedule limits silence to recurring window between StartsAt and EndsAt
+	Schedule *SilenceSchedule `json:"schedule"`
+}
+
+// SilenceSchedule is recurring window, e.g. every saturday at 22:00 for 4h
+type SilenceSchedule struct {
+	Weekdays []string `json:"weekdays"`
+	// Start is time of day, 'HH:MM'
+	Start string `json:"start"`
+	// Duration e.g. '4h'
+	Duration string `json:"duration"`
+	// Zone is IANA time zone, e.g. 'Europe/Helsinki'. Defaults to UTC
+	Zone string `json:"zone"`
+}
+
+func (n *NewSilence) ToSilence(now time.Time) (*models.Silence, error) {
+	s := &models.Silence{
+		Comment:  n.Comment,
+		AlarmId:  n.Alarm,
+		GroupId:  n.Group,
+		DeviceId: n.Device,
+		Labels:   models.Labels(n.Labels),
+		StartsAt: now,
+	}
+	if s.AlarmId == "" && s.GroupId == "" && s.DeviceId == "" && len(s.Labels) == 0 {
+		return s, errors.New("silence needs at least one of alarm, group, device or labels")
+	}
+
+	var err error
+	if n.StartsAt != "" {
+		s.StartsAt, err = time.Parse(time.RFC3339, n.StartsAt)
+		if err != nil {
+			return s, fmt.Errorf("invalid starts_at: %s", n.StartsAt)
+		}
+	}
+	s.EndsAt, err = time.Parse(time.RFC3339, n.EndsAt)
+	if err != nil {
+		return s, fmt.Errorf("invalid ends_at: %s", n.EndsAt)
+	}
+	if !s.StartsAt.Before(s.EndsAt) {
+		return s, errors.New("starts_at must be before ends_at")
+	}
+	if !now.Before(s.EndsAt) {
+		return s, errors.New("ends_at must be in future")
+	}
+
+	if n.Schedule != nil {
+		duration, err := time.ParseDuration(n.Schedule.Duration)
+		if err != nil {
+			return s, fmt.Errorf("invalid schedule duration: %s", n.Schedule.Duration)
+		}
+		s.Schedule = &models.SilenceSchedule{
+			Weekdays: n.Schedule.Weekdays,
+			Start:    n.Schedule.Start,
+			Duration: duration,
+			Zone:     n.Schedule.Zone,
+		}
+		err = s.Schedule.Validate()
+		if err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+func (n *NewSilence) ValidationMap() *govalidator.MapData {
+	return &govalidator.MapData{
+		"comment":   []string{"max:500"},
+		"alarm":     []string{"uuid"},
+		"group":     []string{"uuid"},
+		"device":    []string{"uuid"},
+		"labels":    []string{},
+		"starts_at": []string{},
+		"ends_at":   []string{"required"},
+		"schedule":  []string{},
+	}
+}
+
+func (n *NewSilence) ValidationMessages() *govalidator.MapData {
+	return &govalidator.MapData{
+		"comment": []string{"Reason for silence, e.g. 'Planned maintenance'"},
+		"alarm":   []string{"Id of alarm to silence"},
+		"group":   []string{"Id of group whose alarms to silence"},
+		"device":  []string{"Id of device to silence alarms for"},
+		"ends_at": []string{"End of silence, e.g. '2019-06-01T18:00:00Z'. Required"},
+		"schedule": []string{"Recurring window, e.g. {\"weekdays\": [\"sat\"], \"start\": \"22:00\", " +
+			"\"duration\": \"4h\", \"zone\": \"Europe/Helsinki\"}"},
+	}
+}
+
+// Silence is silence with its current state: active, upcoming or expired
+type Silence struct {
+	Id       string            `json:"id"`
+	Comment  string            `json:"comment"`
+	Alarm    string            `json:"alarm,omitempty"`
+	Group    string            `json:"group,omitempty"`
+	Device   string            `json:"device,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	StartsAt time.Time         `json:"starts_at"`
+	EndsAt   time.Time         `json:"ends_at"`
+	Schedule *SilenceSchedule  `json:"schedule,omitempty"`
+	State    string            `json:"state"`
+}
+
+func SilenceToDto(s *models.Silence, now time.Time) *Silence {
+	dto := &Silence{
+		Id:       s.ID,
+		Comment:  s.Comment,
+		Alarm:    s.AlarmId,
+		Group:    s.GroupId,
+		Device:   s.DeviceId,
+		Labels:   s.Labels,
+		StartsAt: s.StartsAt,
+		EndsAt:   s.EndsAt,
+		State:    s.State(now),
+	}
+	if s.Schedule != nil {
+		dto.Schedule = &SilenceSchedule{
+			Weekdays: s.Schedule.Weekdays,
+			Start:    s.Schedule.Start,
+			Duration: s.Schedule.Duration.String(),
+			Zone:     s.Schedule.Zone,
+		}
+	}
+	return dto
+}
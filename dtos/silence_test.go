@@ -0,0 +1,70 @@
+package dtos
+
+import (
+	"github.com/tryffel/fusio/storage/models"
+	"testing"
+	"time"
+)
+
+func TestSilenceSchedule(t *testing.T) {
+	// Saturday
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	dto := NewSilence{
+		Group:  "9e3c6b1a-3f7c-4c2a-9d4e-2b6f1c0e8a11",
+		EndsAt: "2019-07-01T00:00:00Z",
+		Schedule: &SilenceSchedule{
+			Weekdays: []string{"sat"},
+			Start:    "22:00",
+			Duration: "4h",
+		},
+	}
+	silence, err := dto.ToSilence(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		at    time.Time
+		state string
+	}{
+		{now, models.SilenceUpcoming},
+		{time.Date(2019, 6, 1, 22, 0, 0, 0, time.UTC), models.SilenceActive},
+		// Window continues over midnight to sunday
+		{time.Date(2019, 6, 2, 1, 59, 0, 0, time.UTC), models.SilenceActive},
+		{time.Date(2019, 6, 2, 2, 0, 0, 0, time.UTC), models.SilenceUpcoming},
+		{time.Date(2019, 6, 7, 23, 0, 0, 0, time.UTC), models.SilenceUpcoming},
+		{time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC), models.SilenceExpired},
+	}
+	for _, v := range tests {
+		if state := silence.State(v.at); state != v.state {
+			t.Errorf("silence state at %s: expected %s, got %s", v.at, v.state, state)
+		}
+	}
+}
+
+func TestSilenceMatches(t *testing.T) {
+	now := time.Now()
+	dto := NewSilence{
+		Group:  "group",
+		Labels: map[string]string{"site": "helsinki"},
+		EndsAt: now.Add(time.Hour).Format(time.RFC3339),
+	}
+	silence, err := dto.ToSilence(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alarm := &models.Alarm{Group: "group", Labels: models.Labels{"site": "helsinki", "floor": "2"}}
+	if !silence.Matches(alarm, "") {
+		t.Error("silence does not match alarm with group and labels")
+	}
+	alarm.Labels = models.Labels{"site": "tampere"}
+	if silence.Matches(alarm, "") {
+		t.Error("silence matches alarm with different label")
+	}
+
+	_, err = (&NewSilence{EndsAt: dto.EndsAt}).ToSilence(now)
+	if err == nil {
+		t.Error("silence without matchers accepted")
+	}
+}
@@ -0,0 +1,244 @@
+package dtos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/thedevsaddam/govalidator"
+	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/util"
+	"reflect"
+	"sort"
+)
+
+// NewAlarmTemplate is alarm definition with outputs that can be instantiated for many groups or devices.
+// Group and device of alarm are ignored, they are set when template is instantiated
+type NewAlarmTemplate struct {
+	Alarm   NewAlarm    `json:"alarm"`
+	Outputs []NewOutput `json:"outputs"`
+}
+
+// Placeholder target to validate template alarm with
+const templateTarget = "00000000-0000-0000-0000-000000000000"
+
+func (n *NewAlarmTemplate) ToTemplate() (*models.AlarmTemplate, error) {
+	definition := n.Alarm
+	definition.Group = ""
+	definition.Device = ""
+	if models.AlarmScope(definition.Scope) == models.ScopeDevice {
+		definition.Device = templateTarget
+	} else {
+		definition.Group = templateTarget
+	}
+	alarm, err := definition.ToAlarm()
+	if err != nil {
+		return &models.AlarmTemplate{}, err
+	}
+
+	template := &models.AlarmTemplate{
+		Name:               alarm.Name,
+		Info:               alarm.Info,
+		Message:            alarm.Message,
+		Enabled:            alarm.Enabled,
+		Scope:              alarm.GetScope(),
+		Severity:           alarm.Severity,
+		Labels:             alarm.Labels,
+		EscalationPolicyId: alarm.EscalationPolicyId,
+		Filter:             alarm.Filter,
+		RunInterval:        alarm.RunInterval,
+		Outputs:            models.TemplateOutputs{},
+	}
+	for i, v := range n.Outputs {
+		if !util.IsUuid(v.OutputChannel) {
+			return template, fmt.Errorf("output %d needs output_channel_id", i+1)
+		}
+		severity, err := models.ParseSeverity(v.MinSeverity)
+		if err != nil {
+			return template, err
+		}
+		out := v.ToOutput()
+		template.Outputs = append(template.Outputs, models.TemplateOutput{
+			Name:            out.Name,
+			OutputChannelId: out.OutputChannelId,
+			FireTemplate:    out.FireTemplate,
+			ClearTemplate:   out.ClearTemplate,
+			ErrorTemplate:   out.ErrorTemplate,
+			Repeat:          out.Repeat,
+			MaxRepeat:       out.MaxRepeat,
+			MinSeverity:     severity,
+		})
+	}
+	return template, nil
+}
+
+func (n *NewAlarmTemplate) ValidationMap() *govalidator.MapData {
+	return &govalidator.MapData{
+		"alarm":   []string{"required"},
+		"outputs": []string{},
+	}
+}
+
+func (n *NewAlarmTemplate) ValidationMessages() *govalidator.MapData {
+	return &govalidator.MapData{
+		"alarm": []string{"Alarm definition, see alarms. Group and device are set when template is instantiated"},
+		"outputs": []string{"Outputs to create for each alarm, see outputs. " +
+			"alarm_id is set when template is instantiated"},
+	}
+}
+
+// AlarmTemplate is template with number of alarms created from it
+type AlarmTemplate struct {
+	Id        string      `json:"id"`
+	Alarm     NewAlarm    `json:"alarm"`
+	Outputs   []NewOutput `json:"outputs"`
+	Instances int         `json:"instances"`
+}
+
+func AlarmTemplateToDto(t *models.AlarmTemplate, instances int) *AlarmTemplate {
+	dto := &AlarmTemplate{
+		Id:        t.ID,
+		Alarm:     *AlarmToNewAlarm(t.ToAlarm("", "")),
+		Outputs:   make([]NewOutput, len(t.Outputs)),
+		Instances: instances,
+	}
+	for i, v := range t.Outputs {
+		dto.Outputs[i] = NewOutput{
+			Name:          v.Name,
+			OutputChannel: v.OutputChannelId,
+			FireTemplate:  v.FireTemplate,
+			ClearTemplate: v.ClearTemplate,
+			ErrorTemplate: v.ErrorTemplate,
+			Repeat:        util.Interval(v.Repeat),
+			MaxRepeat:     v.MaxRepeat,
+			MinSeverity:   string(v.MinSeverity),
+		}
+	}
+	return dto
+}
+
+// TemplateTargets are groups or devices to create alarms for. Group and per-device templates need groups,
+// device templates need devices
+type TemplateTargets struct {
+	Groups  []string `json:"groups"`
+	Devices []string `json:"devices"`
+}
+
+func (t *TemplateTargets) ValidationMap() *govalidator.MapData {
+	return &govalidator.MapData{
+		"groups":  []string{},
+		"devices": []string{},
+	}
+}
+
+func (t *TemplateTargets) ValidationMessages() *govalidator.MapData {
+	return &govalidator.MapData{
+		"groups":  []string{"Ids of groups to create alarm for"},
+		"devices": []string{"Ids of devices to create alarm for"},
+	}
+}
+
+// Targets returns targets for template scope
+func (t *TemplateTargets) Targets(scope models.AlarmScope) ([]string, error) {
+	targets := t.Groups
+	other := t.Devices
+	if scope == models.ScopeDevice {
+		targets, other = other, targets
+	}
+	if len(other) > 0 {
+		return targets, fmt.Errorf("%s template can only be instantiated for %s", scope, targetName(scope))
+	}
+	if len(targets) == 0 {
+		return targets, errors.New("no " + targetName(scope) + " given")
+	}
+	for _, v := range targets {
+		if !util.IsUuid(v) {
+			return targets, fmt.Errorf("invalid id: %s", v)
+		}
+	}
+	return targets, nil
+}
+
+func targetName(scope models.AlarmScope) string {
+	if scope == models.ScopeDevice {
+		return "devices"
+	}
+	return "groups"
+}
+
+// FieldDiff is field where alarm differs from its template
+type FieldDiff struct {
+	Field    string      `json:"field"`
+	Template interface{} `json:"template"`
+	Alarm    interface{} `json:"alarm"`
+}
+
+// Fields that are set per alarm and not compared to template
+var instanceFields = map[string]bool{
+	"name":    true,
+	"group":   true,
+	"device":  true,
+	"enabled": true,
+}
+
+// DiffAlarm returns fields where alarm and its outputs differ from template. Outputs are matched by name
+func DiffAlarm(template *models.AlarmTemplate, alarm *models.Alarm, outputs *[]models.Output) ([]FieldDiff, error) {
+	expected, err := toFieldMap(AlarmToNewAlarm(template.ToAlarm(alarm.Group, alarm.DeviceId)))
+	if err != nil {
+		return nil, err
+	}
+	actual, err := toFieldMap(AlarmToNewAlarm(alarm))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(expected))
+	for k := range expected {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	diff := make([]FieldDiff, 0)
+	for _, k := range keys {
+		if instanceFields[k] || reflect.DeepEqual(expected[k], actual[k]) {
+			continue
+		}
+		diff = append(diff, FieldDiff{Field: k, Template: expected[k], Alarm: actual[k]})
+	}
+
+	for _, v := range template.Outputs {
+		field := "outputs." + v.Name
+		var found *models.TemplateOutput
+		for _, out := range *outputs {
+			if out.Name == v.Name {
+				found = &models.TemplateOutput{
+					Name:            out.Name,
+					OutputChannelId: out.OutputChannelId,
+					FireTemplate:    out.FireTemplate,
+					ClearTemplate:   out.ClearTemplate,
+					ErrorTemplate:   out.ErrorTemplate,
+					Repeat:          out.Repeat,
+					MaxRepeat:       out.MaxRepeat,
+					MinSeverity:     out.MinSeverity,
+				}
+				break
+			}
+		}
+		if found == nil {
+			diff = append(diff, FieldDiff{Field: field, Template: v, Alarm: nil})
+		} else if !reflect.DeepEqual(*found, v) {
+			diff = append(diff, FieldDiff{Field: field, Template: v, Alarm: *found})
+		}
+	}
+	return diff, nil
+}
+
+// toFieldMap returns json fields of value
+func toFieldMap(value interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
@@ -0,0 +1,62 @@
+package dtos
+
+import (
+	"github.com/tryffel/fusio/storage/models"
+	"testing"
+	"time"
+)
+
+func TestDiffAlarm(t *testing.T) {
+	dto := NewAlarmTemplate{
+		Alarm: NewAlarm{
+			Name:     "Cold room temperature",
+			Enabled:  true,
+			Interval: "2m",
+			Filter:   "mean(temperature) > 5",
+			Severity: "critical",
+		},
+		Outputs: []NewOutput{{
+			Name:          "email",
+			OutputChannel: "4b0f7a52-6e1d-4c8b-a2f3-0d9e8c7b6a51",
+		}},
+	}
+	template, err := dto.ToTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.Scope != models.ScopeGroup || len(template.Outputs) != 1 {
+		t.Fatalf("invalid template: %+v", template)
+	}
+
+	alarm := template.ToAlarm("9e3c6b1a-3f7c-4c2a-9d4e-2b6f1c0e8a11", "")
+	alarm.Name = "Cold room 7"
+	alarm.Enabled = false
+	outputs := []models.Output{*template.Outputs[0].ToOutput(alarm)}
+
+	diff, err := DiffAlarm(template, alarm, &outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 0 {
+		t.Errorf("instance fields should not differ, got %+v", diff)
+	}
+
+	alarm.RunInterval = time.Minute * 5
+	outputs[0].MaxRepeat = 3
+	diff, err = DiffAlarm(template, alarm, &outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 2 || diff[0].Field != "interval" || diff[1].Field != "outputs.email" {
+		t.Errorf("expected interval and output to differ, got %+v", diff)
+	}
+
+	outputs = []models.Output{}
+	diff, err = DiffAlarm(template, alarm, &outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 2 || diff[1].Alarm != nil {
+		t.Errorf("expected missing output, got %+v", diff)
+	}
+}
@@ -35,8 +35,23 @@ func Validate(w http.ResponseWriter, r *http.Request, v Validator) error {
 	}
 
 	va := govalidator.New(opts)
+	return writeValidationErrors(w, va.ValidateJSON())
+}
+
+// ValidateNested validates dto that was decoded as part of other dto, e.g. alarm of backtest request.
+// If validation fails, automatically write error msg into response
+func ValidateNested(w http.ResponseWriter, v Validator) error {
+	opts := govalidator.Options{
+		Rules:           *v.ValidationMap(),
+		Data:            v,
+		Messages:        *v.ValidationMessages(),
+		RequiredDefault: false,
+	}
+	va := govalidator.New(opts)
+	return writeValidationErrors(w, va.ValidateStruct())
+}
 
-	e := va.ValidateJSON()
+func writeValidationErrors(w http.ResponseWriter, e map[string][]string) error {
 	if len(e) > 0 {
 		err := map[string]interface{}{"invalid_request_error": e}
 		w.Header().Set("Content-type", "application/json")
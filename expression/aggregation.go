@@ -0,0 +1,139 @@
+package expression
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Selectors aggregate measurement values over interval: mean(temperature)
+var selectors = []string{"count", "first", "integral", "last", "max", "mean", "median", "min", "mode",
+	"spread", "stddev", "sum"}
+
+type paramKind int
+
+const (
+	paramNone paramKind = iota
+	// paramUnit is optional duration, e.g. derivative(mean(temperature),1m). Number is in seconds
+	paramUnit
+	// paramCount is required positive integer, e.g. moving_average(mean(temperature),5)
+	paramCount
+)
+
+// Transformations are applied to aggregated values and can be nested:
+// derivative(moving_average(mean(temperature),5),1m)
+var transformations = map[string]paramKind{
+	"cumulative_sum":          paramNone,
+	"derivative":              paramUnit,
+	"difference":              paramNone,
+	"elapsed":                 paramUnit,
+	"moving_average":          paramCount,
+	"non_negative_derivative": paramUnit,
+}
+
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  time.Hour * 24,
+	"w":  time.Hour * 24 * 7,
+}
+
+// IsSelector returns true if name is selector, e.g. mean
+func IsSelector(name string) bool {
+	for _, v := range selectors {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTransformation returns true if name is transformation, e.g. derivative
+func IsTransformation(name string) bool {
+	_, ok := transformations[name]
+	return ok
+}
+
+// checkAggregation validates aggregation: selector(key), e.g. mean(temperature),
+// or transformation(aggregation, parameters), e.g. derivative(mean(temperature),10s)
+func checkAggregation(c *Call) error {
+	if len(c.Args) == 0 {
+		return &Error{Pos: c.Pos(), Token: c.String(),
+			Message: "unknown function, aggregation needs measurement key, e.g. mean(temperature)"}
+	}
+	switch arg := c.Args[0].(type) {
+	case *Ident:
+		if !IsSelector(c.Name) {
+			return &Error{Pos: c.Pos(), Token: c.Name,
+				Message: "unknown selector, expected one of " + strings.Join(selectors, ", ")}
+		}
+		if len(c.Args) > 1 {
+			return &Error{Pos: c.Args[1].Pos(), Token: c.Args[1].String(),
+				Message: "selector takes only measurement key"}
+		}
+		return nil
+	case *Call:
+		if !IsTransformation(c.Name) {
+			return &Error{Pos: c.Pos(), Token: c.Name,
+				Message: "unknown transformation, expected one of " + transformationNames()}
+		}
+		if !arg.IsAggregation() {
+			return &Error{Pos: arg.Pos(), Token: arg.String(), Message: "expected aggregation"}
+		}
+		if err := checkAggregation(arg); err != nil {
+			return err
+		}
+		return checkParams(c, transformations[c.Name])
+	default:
+		return &Error{Pos: arg.Pos(), Token: arg.String(), Message: "expected measurement key or aggregation"}
+	}
+}
+
+// checkParams validates parameters of transformation
+func checkParams(c *Call, kind paramKind) error {
+	params := c.Args[1:]
+	switch {
+	case kind == paramNone && len(params) > 0:
+		return &Error{Pos: params[0].Pos(), Token: params[0].String(),
+			Message: fmt.Sprintf("%s takes no parameters", c.Name)}
+	case kind == paramCount && len(params) == 0:
+		return &Error{Pos: c.Pos(), Token: c.Name, Message: fmt.Sprintf("%s needs number of points", c.Name)}
+	case len(params) > 1:
+		return &Error{Pos: params[1].Pos(), Token: params[1].String(),
+			Message: fmt.Sprintf("%s takes only one parameter", c.Name)}
+	case len(params) == 0:
+		return nil
+	}
+
+	switch param := params[0].(type) {
+	case *Number:
+		if param.Value <= 0 || param.Value != float64(int64(param.Value)) {
+			return &Error{Pos: param.Pos(), Token: param.String(), Message: "parameter must be positive integer"}
+		}
+		return nil
+	case *Duration:
+		if kind != paramUnit {
+			return &Error{Pos: param.Pos(), Token: param.String(),
+				Message: fmt.Sprintf("%s needs number of points, not duration", c.Name)}
+		}
+		if param.Value <= 0 {
+			return &Error{Pos: param.Pos(), Token: param.String(), Message: "duration must be positive"}
+		}
+		return nil
+	}
+	return &Error{Pos: params[0].Pos(), Token: params[0].String(), Message: "aggregation parameter must be number"}
+}
+
+func transformationNames() string {
+	names := make([]string, 0, len(transformations))
+	for k := range transformations {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,217 @@
+package expression
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Node is node of expression syntax tree
+type Node interface {
+	// Pos returns 1-based position of node in source
+	Pos() int
+	// String returns node in source form
+	String() string
+}
+
+// Number is numeric literal
+type Number struct {
+	Value float64
+	pos   int
+}
+
+// Duration is duration literal, e.g. 10s. Durations are only allowed as parameters of transformations
+type Duration struct {
+	Value int64
+	Unit  string
+	pos   int
+}
+
+// Bool is true or false
+type Bool struct {
+	Value bool
+	pos   int
+}
+
+// Ident is variable, e.g. simplified aggregation 'mean_temperature'
+type Ident struct {
+	Name string
+	pos  int
+}
+
+// Unary is '-x' or '!x'
+type Unary struct {
+	Op  string
+	X   Node
+	pos int
+}
+
+// Binary is arithmetic, comparison or boolean operation
+type Binary struct {
+	Op  string
+	X   Node
+	Y   Node
+	pos int
+	// boolOperands is set on type check for '==' and '!=' of booleans
+	boolOperands bool
+}
+
+// Call is call to builtin function, e.g. abs(x), or aggregation of measurement, e.g. mean(temperature)
+// or derivative(mean(temperature),10)
+type Call struct {
+	Name string
+	Args []Node
+	pos  int
+}
+
+func (n *Number) Pos() int   { return n.pos + 1 }
+func (n *Duration) Pos() int { return n.pos + 1 }
+func (n *Bool) Pos() int     { return n.pos + 1 }
+func (n *Ident) Pos() int    { return n.pos + 1 }
+func (n *Unary) Pos() int    { return n.pos + 1 }
+func (n *Binary) Pos() int   { return n.X.Pos() }
+func (n *Call) Pos() int     { return n.pos + 1 }
+
+func (n *Number) String() string {
+	return strconv.FormatFloat(n.Value, 'f', -1, 64)
+}
+
+func (n *Duration) String() string {
+	return strconv.FormatInt(n.Value, 10) + n.Unit
+}
+
+// Duration returns value as time.Duration
+func (n *Duration) Duration() time.Duration {
+	return time.Duration(n.Value) * durationUnits[n.Unit]
+}
+
+func (n *Bool) String() string {
+	return strconv.FormatBool(n.Value)
+}
+
+func (n *Ident) String() string {
+	return n.Name
+}
+
+func (n *Unary) String() string {
+	return n.Op + operand(n.X, precedenceUnary, false)
+}
+
+func (n *Binary) String() string {
+	p := precedence(n.Op)
+	return operand(n.X, p, false) + " " + n.Op + " " + operand(n.Y, p, true)
+}
+
+func (n *Call) String() string {
+	args := make([]string, len(n.Args))
+	for i, v := range n.Args {
+		args[i] = v.String()
+	}
+	return n.Name + "(" + strings.Join(args, ",") + ")"
+}
+
+// IsAggregation returns true if call is aggregation of measurement instead of builtin function
+func (n *Call) IsAggregation() bool {
+	f, ok := functions[n.Name]
+	return !ok || !f.accepts(len(n.Args))
+}
+
+// Key returns name that value of aggregation is referred with: mean(temperature) -> mean_temperature,
+// derivative(mean(temperature),1m) -> derivative_1m_mean_temperature. Parameters are included, so that
+// same aggregation with different parameters has different key
+func (n *Call) Key() string {
+	if len(n.Args) == 0 {
+		return n.Name
+	}
+	name := n.Name
+	for _, v := range n.Args[1:] {
+		name += "_" + v.String()
+	}
+	switch arg := n.Args[0].(type) {
+	case *Call:
+		return name + "_" + arg.Key()
+	default:
+		return name + "_" + arg.String()
+	}
+}
+
+const (
+	precedenceOr = iota + 1
+	precedenceAnd
+	precedenceNot
+	precedenceCompare
+	precedenceAdd
+	precedenceMultiply
+	precedenceUnary
+)
+
+func precedence(op string) int {
+	switch op {
+	case "||":
+		return precedenceOr
+	case "&&":
+		return precedenceAnd
+	case ">", ">=", "<", "<=", "==", "!=":
+		return precedenceCompare
+	case "+", "-":
+		return precedenceAdd
+	case "*", "/", "%":
+		return precedenceMultiply
+	}
+	return 0
+}
+
+// operand returns node as operand of operator with precedence, adding parentheses if needed.
+// Right operand needs parentheses on equal precedence too: a - (b - c)
+func operand(n Node, parent int, right bool) string {
+	p := precedenceUnary + 1
+	switch v := n.(type) {
+	case *Binary:
+		p = precedence(v.Op)
+	case *Unary:
+		if v.Op == "!" {
+			p = precedenceNot
+		} else {
+			p = precedenceUnary
+		}
+	}
+	if p < parent || right && p == parent {
+		return "(" + n.String() + ")"
+	}
+	return n.String()
+}
+
+// Walk calls fn for node and its children, depth first. Children are skipped if fn returns false
+func Walk(n Node, fn func(n Node) bool) {
+	if !fn(n) {
+		return
+	}
+	switch v := n.(type) {
+	case *Unary:
+		Walk(v.X, fn)
+	case *Binary:
+		Walk(v.X, fn)
+		Walk(v.Y, fn)
+	case *Call:
+		for _, arg := range v.Args {
+			Walk(arg, fn)
+		}
+	}
+}
+
+// Rewrite returns copy of node where each node is replaced with result of fn. Children are rewritten first
+func Rewrite(n Node, fn func(n Node) Node) Node {
+	switch v := n.(type) {
+	case *Unary:
+		n = &Unary{Op: v.Op, X: Rewrite(v.X, fn), pos: v.pos}
+	case *Binary:
+		n = &Binary{Op: v.Op, X: Rewrite(v.X, fn), Y: Rewrite(v.Y, fn), pos: v.pos}
+	case *Call:
+		args := make([]Node, len(v.Args))
+		for i, arg := range v.Args {
+			args[i] = Rewrite(arg, fn)
+		}
+		n = &Call{Name: v.Name, Args: args, pos: v.pos}
+	}
+	return fn(n)
+}
@@ -0,0 +1,106 @@
+package expression
+
+import (
+	"fmt"
+)
+
+// Type is type of expression value
+type Type int
+
+const (
+	TypeNumber Type = iota + 1
+	TypeBool
+)
+
+func (t Type) String() string {
+	if t == TypeBool {
+		return "boolean"
+	}
+	return "number"
+}
+
+// check returns type of node or error at first node with invalid type
+func check(n Node) (Type, error) {
+	switch v := n.(type) {
+	case *Number, *Ident:
+		return TypeNumber, nil
+	case *Bool:
+		return TypeBool, nil
+	case *Duration:
+		return 0, &Error{Pos: v.Pos(), Token: v.String(),
+			Message: "duration is only allowed as parameter of transformation, e.g. derivative(mean(temperature),1m)"}
+	case *Unary:
+		want := TypeNumber
+		if v.Op == "!" {
+			want = TypeBool
+		}
+		return want, expect(v.X, want)
+	case *Binary:
+		switch v.Op {
+		case "&&", "||":
+			if err := expect(v.X, TypeBool); err != nil {
+				return TypeBool, err
+			}
+			return TypeBool, expect(v.Y, TypeBool)
+		case "==", "!=":
+			x, err := check(v.X)
+			if err != nil {
+				return TypeBool, err
+			}
+			v.boolOperands = x == TypeBool
+			return TypeBool, expect(v.Y, x)
+		case ">", ">=", "<", "<=":
+			if err := expect(v.X, TypeNumber); err != nil {
+				return TypeBool, err
+			}
+			return TypeBool, expect(v.Y, TypeNumber)
+		default:
+			if err := expect(v.X, TypeNumber); err != nil {
+				return TypeNumber, err
+			}
+			return TypeNumber, expect(v.Y, TypeNumber)
+		}
+	case *Call:
+		return TypeNumber, checkCall(v)
+	}
+	return 0, &Error{Pos: n.Pos(), Token: n.String(), Message: "unknown expression"}
+}
+
+func expect(n Node, want Type) error {
+	t, err := check(n)
+	if err != nil {
+		return err
+	}
+	if t != want {
+		return &Error{Pos: n.Pos(), Token: n.String(), Message: fmt.Sprintf("expected %s, got %s", want, t)}
+	}
+	return nil
+}
+
+func checkCall(c *Call) error {
+	if !c.IsAggregation() {
+		for _, arg := range c.Args {
+			if err := expect(arg, TypeNumber); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// Single argument min and max are aggregations, other builtins have wrong number of arguments
+	if f, ok := functions[c.Name]; ok && !((c.Name == "min" || c.Name == "max") && len(c.Args) == 1) {
+		return &Error{Pos: c.Pos(), Token: c.Name, Message: fmt.Sprintf("%s takes %s", c.Name, f.arity())}
+	}
+	return checkAggregation(c)
+}
+
+func (f *function) arity() string {
+	switch {
+	case f.minArgs == f.maxArgs && f.minArgs == 1:
+		return "1 argument"
+	case f.minArgs == f.maxArgs:
+		return fmt.Sprintf("%d arguments", f.minArgs)
+	case f.maxArgs < 0:
+		return fmt.Sprintf("at least %d arguments", f.minArgs)
+	}
+	return fmt.Sprintf("%d to %d arguments", f.minArgs, f.maxArgs)
+}
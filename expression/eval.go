@@ -0,0 +1,128 @@
+package expression
+
+import (
+	"math"
+)
+
+// Eval evaluates expression. Result is float64 or bool depending on expression type
+func (e *Expression) Eval(env *Env) (interface{}, error) {
+	if e.Type == TypeBool {
+		return evalBool(e.Root, env)
+	}
+	return evalNumber(e.Root, env)
+}
+
+// EvalBool evaluates condition
+func (e *Expression) EvalBool(env *Env) (bool, error) {
+	if e.Type != TypeBool {
+		return false, &Error{Pos: e.Root.Pos(), Message: "expression is not condition"}
+	}
+	return evalBool(e.Root, env)
+}
+
+func evalNumber(n Node, env *Env) (float64, error) {
+	switch v := n.(type) {
+	case *Number:
+		return v.Value, nil
+	case *Ident:
+		return lookup(v.Name, v, env)
+	case *Unary:
+		x, err := evalNumber(v.X, env)
+		return -x, err
+	case *Binary:
+		x, err := evalNumber(v.X, env)
+		if err != nil {
+			return 0, err
+		}
+		y, err := evalNumber(v.Y, env)
+		if err != nil {
+			return 0, err
+		}
+		switch v.Op {
+		case "+":
+			return x + y, nil
+		case "-":
+			return x - y, nil
+		case "*":
+			return x * y, nil
+		case "/":
+			return x / y, nil
+		case "%":
+			return math.Mod(x, y), nil
+		}
+	case *Call:
+		if v.IsAggregation() {
+			return lookup(v.Key(), v, env)
+		}
+		args := make([]float64, len(v.Args))
+		for i, arg := range v.Args {
+			value, err := evalNumber(arg, env)
+			if err != nil {
+				return 0, err
+			}
+			args[i] = value
+		}
+		f := functions[v.Name]
+		return f.call(args, env), nil
+	}
+	return 0, &Error{Pos: n.Pos(), Token: n.String(), Message: "expected number"}
+}
+
+func evalBool(n Node, env *Env) (bool, error) {
+	switch v := n.(type) {
+	case *Bool:
+		return v.Value, nil
+	case *Unary:
+		x, err := evalBool(v.X, env)
+		return !x, err
+	case *Binary:
+		switch v.Op {
+		case "&&", "||":
+			x, err := evalBool(v.X, env)
+			if err != nil || x == (v.Op == "||") {
+				return x, err
+			}
+			return evalBool(v.Y, env)
+		case "==", "!=":
+			if v.boolOperands {
+				x, err := evalBool(v.X, env)
+				if err != nil {
+					return false, err
+				}
+				y, err := evalBool(v.Y, env)
+				return (x == y) == (v.Op == "=="), err
+			}
+		}
+		x, err := evalNumber(v.X, env)
+		if err != nil {
+			return false, err
+		}
+		y, err := evalNumber(v.Y, env)
+		if err != nil {
+			return false, err
+		}
+		switch v.Op {
+		case ">":
+			return x > y, nil
+		case ">=":
+			return x >= y, nil
+		case "<":
+			return x < y, nil
+		case "<=":
+			return x <= y, nil
+		case "==":
+			return x == y, nil
+		case "!=":
+			return x != y, nil
+		}
+	}
+	return false, &Error{Pos: n.Pos(), Token: n.String(), Message: "expected boolean"}
+}
+
+func lookup(name string, n Node, env *Env) (float64, error) {
+	value, ok := env.Values[name]
+	if !ok {
+		return 0, &Error{Pos: n.Pos(), Token: n.String(), Message: "no measurement value"}
+	}
+	return value, nil
+}
@@ -0,0 +1,166 @@
+package expression
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEval(t *testing.T) {
+	// Sunday 23:30
+	env := &Env{
+		Values: map[string]float64{"mean_temperature": 31, "max_humidity": 80, "derivative_10_mean_temperature": -2},
+		Time:   time.Date(2019, 6, 2, 23, 30, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		expression string
+		want       interface{}
+	}{
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3", 9.0},
+		{"10 - 4 - 3", 3.0},
+		{"-2 * -3", 6.0},
+		{"7 % 4", 3.0},
+		{"mean(temperature) > 30", true},
+		{"mean_temperature > 30", true},
+		{"mean(temperature) > 30 && max(humidity) > 90", false},
+		{"mean(temperature) > 30 and max(humidity) > 90 or hour() >= 22", true},
+		{"mean(temperature) > 30 && (max(humidity) > 90 || hour() >= 22)", true},
+		{"!mean(temperature) > 30", false},
+		{"not (hour() >= 22 || hour() < 6)", false},
+		{"weekday() == 0", true},
+		{"minute()", 30.0},
+		{"abs(derivative(mean(temperature),10))", 2.0},
+		{"min(mean(temperature), 25, 40)", 25.0},
+		{"max(mean(temperature), max(humidity))", 80.0},
+		{"clamp(max(humidity), 0, 50)", 50.0},
+		{"round(2.456, 2)", 2.46},
+		{"round(2.5)", 3.0},
+		{"true == (mean(temperature) > 30)", true},
+	}
+	for _, v := range tests {
+		e, err := Parse(v.expression)
+		if err != nil {
+			t.Errorf("%s: %s", v.expression, err)
+			continue
+		}
+		got, err := e.Eval(env)
+		if err != nil {
+			t.Errorf("%s: %s", v.expression, err)
+		} else if got != v.want {
+			t.Errorf("%s: expected %v, got %v", v.expression, v.want, got)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		pos        int
+		token      string
+	}{
+		{"mean(temperature) = 10", 19, "="},
+		{"mean(temperature) > ", 21, ""},
+		{"mean(temperature) > 10)", 23, ")"},
+		{"(mean(temperature) > 10", 24, ""},
+		{"1 < mean(temperature) < 10", 23, "<"},
+		{"mean(temperature) > 10 && 5", 27, "5"},
+		{"mean(temperature) + (max(humidity) > 10)", 22, "max(humidity) > 10"},
+		{"abs(1, 2) > 0", 1, "abs"},
+		{"hour(temperature) > 0", 1, "hour"},
+		{"mean(temperature, 10) > 0", 19, "10"},
+		{"derivative(abs(5),10) > 0", 12, "abs(5)"},
+		{"mean(temperature) > 10 & max(humidity) > 10", 24, "&"},
+		{"mean(temperature) > $", 21, "$"},
+		{"foo(temperature) > 0", 1, "foo"},
+		{"diff(mean(temperature),10) > 0", 1, "diff"},
+		{"moving_average(mean(temperature)) > 0", 1, "moving_average"},
+		{"difference(mean(temperature),10) > 0", 30, "10"},
+		{"moving_average(mean(temperature),1m) > 0", 34, "1m"},
+		{"derivative(mean(temperature),10x) > 0", 30, "10x"},
+		{"derivative(mean(temperature),1.5) > 0", 30, "1.5"},
+		{"mean(temperature) > 10s", 21, "10s"},
+	}
+	for _, v := range tests {
+		_, err := ParseCondition(v.expression)
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%s: expected error, got %v", v.expression, err)
+			continue
+		}
+		if e.Pos != v.pos || e.Token != v.token {
+			t.Errorf("%s: expected error at %d '%s', got %s", v.expression, v.pos, v.token, e)
+		}
+	}
+
+	_, err := ParseCondition("mean(temperature) + 10")
+	if err == nil {
+		t.Error("number expression is not condition")
+	}
+}
+
+func TestAggregations(t *testing.T) {
+	e, err := Parse("derivative(mean(temperature),10) > 1 && mean(temperature) > 20 && " +
+		"abs(max(temperature)) > abs(mean(temperature)) && max(5, 3) > 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"derivative(mean(temperature),10)", "mean(temperature)", "max(temperature)"}
+	got := e.Aggregations()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d aggregations, got %d", len(want), len(got))
+	}
+	for i, v := range got {
+		if v.String() != want[i] {
+			t.Errorf("aggregation %d: expected %s, got %s", i, want[i], v.String())
+		}
+	}
+
+	simplified := "derivative_10_mean_temperature > 1 && mean_temperature > 20 && " +
+		"abs(max_temperature) > abs(mean_temperature) && max(5,3) > 1"
+	if s := e.Simplified(); s != simplified {
+		t.Errorf("expected simplified %s, got %s", simplified, s)
+	}
+}
+
+func TestNestedTransformations(t *testing.T) {
+	e, err := ParseCondition("derivative(moving_average(mean(temperature),5),1m) > 0.5 && " +
+		"cumulative_sum(difference(max(counter))) > 100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := e.Aggregations()
+	if len(got) != 2 {
+		t.Fatalf("expected 2 aggregations, got %d", len(got))
+	}
+	if s := got[0].String(); s != "derivative(moving_average(mean(temperature),5),1m)" {
+		t.Errorf("unexpected aggregation %s", s)
+	}
+	if d := got[0].Args[1].(*Duration).Duration(); d != time.Minute {
+		t.Errorf("expected duration 1m, got %s", d)
+	}
+	simplified := "derivative_1m_moving_average_5_mean_temperature > 0.5 && cumulative_sum_difference_max_counter > 100"
+	if s := e.Simplified(); s != simplified {
+		t.Errorf("expected simplified %s, got %s", simplified, s)
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []string{
+		"mean(temperature) > 30",
+		"a - (b - c) > 0",
+		"(a + b) * c > 0",
+		"!(a > 1) || b > 1 && c > 1",
+		"(a > 1 || b > 1) && c > 1",
+		"-a * 2 < round(b,1)",
+	}
+	for _, v := range tests {
+		e, err := Parse(v)
+		if err != nil {
+			t.Errorf("%s: %s", v, err)
+			continue
+		}
+		if s := e.String(); s != v {
+			t.Errorf("expected %s, got %s", v, s)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package expression
+
+import (
+	"math"
+	"time"
+)
+
+type function struct {
+	minArgs int
+	// maxArgs is -1 for any number of arguments
+	maxArgs int
+	call    func(args []float64, env *Env) float64
+}
+
+func (f *function) accepts(n int) bool {
+	return n >= f.minArgs && (f.maxArgs < 0 || n <= f.maxArgs)
+}
+
+// Builtin functions. min and max with single argument are aggregations: max(temperature).
+// Time functions use time of evaluated point in server local time
+var functions = map[string]function{
+	"abs": {1, 1, func(args []float64, env *Env) float64 {
+		return math.Abs(args[0])
+	}},
+	"min": {2, -1, func(args []float64, env *Env) float64 {
+		value := args[0]
+		for _, v := range args[1:] {
+			value = math.Min(value, v)
+		}
+		return value
+	}},
+	"max": {2, -1, func(args []float64, env *Env) float64 {
+		value := args[0]
+		for _, v := range args[1:] {
+			value = math.Max(value, v)
+		}
+		return value
+	}},
+	// clamp(x, low, high)
+	"clamp": {3, 3, func(args []float64, env *Env) float64 {
+		return math.Max(args[1], math.Min(args[2], args[0]))
+	}},
+	// round(x) or round(x, decimals)
+	"round": {1, 2, func(args []float64, env *Env) float64 {
+		if len(args) == 1 {
+			return math.Round(args[0])
+		}
+		scale := math.Pow(10, math.Round(args[1]))
+		return math.Round(args[0]*scale) / scale
+	}},
+	// hour() is 0-23
+	"hour": {0, 0, func(args []float64, env *Env) float64 {
+		return float64(env.time().Hour())
+	}},
+	// minute() is 0-59
+	"minute": {0, 0, func(args []float64, env *Env) float64 {
+		return float64(env.time().Minute())
+	}},
+	// weekday() is 0-6, sunday is 0
+	"weekday": {0, 0, func(args []float64, env *Env) float64 {
+		return float64(env.time().Weekday())
+	}},
+}
+
+// Env holds values of variables and aggregations, and time expression is evaluated at
+type Env struct {
+	Values map[string]float64
+	// Time of evaluation, defaults to current time
+	Time time.Time
+}
+
+func (e *Env) time() time.Time {
+	if e.Time.IsZero() {
+		return time.Now()
+	}
+	return e.Time
+}
@@ -0,0 +1,161 @@
+package expression
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenDuration
+	tokenIdent
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// pos is offset of token in source, in characters
+	pos   int
+	value float64
+	// unit of duration token
+	unit string
+}
+
+// Keywords that are aliases for operators
+var keywords = map[string]string{
+	"and": "&&",
+	"or":  "||",
+	"not": "!",
+}
+
+// Error is syntax or type error in expression. Pos is 1-based position of offending token
+type Error struct {
+	Pos     int
+	Token   string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("%s at position %d", e.Message, e.Pos)
+	}
+	return fmt.Sprintf("%s at position %d: '%s'", e.Message, e.Pos, e.Token)
+}
+
+func errorAt(pos int, text string, format string, args ...interface{}) *Error {
+	return &Error{Pos: pos + 1, Token: text, Message: fmt.Sprintf(format, args...)}
+}
+
+// lex splits source into tokens. Last token is always tokenEOF
+func lex(src string) ([]token, error) {
+	tokens := make([]token, 0, len(src)/2)
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case isDigit(r) || r == '.' && i+1 < len(runes) && isDigit(runes[i+1]):
+			for i < len(runes) && (isDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			// Exponent, e.g. 1e-3
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				j := i + 1
+				if j < len(runes) && (runes[j] == '+' || runes[j] == '-') {
+					j++
+				}
+				if j < len(runes) && isDigit(runes[j]) {
+					i = j
+					for i < len(runes) && isDigit(runes[i]) {
+						i++
+					}
+				}
+			}
+			number := string(runes[start:i])
+			// Duration, e.g. 10s
+			if i < len(runes) && isIdentStart(runes[i]) {
+				unitStart := i
+				for i < len(runes) && isIdentPart(runes[i]) {
+					i++
+				}
+				text := string(runes[start:i])
+				unit := string(runes[unitStart:i])
+				value, err := strconv.ParseInt(number, 10, 64)
+				if _, ok := durationUnits[unit]; !ok || err != nil {
+					return tokens, errorAt(start, text, "invalid duration, expected integer and unit ns, us, ms, s, m, h, d or w")
+				}
+				tokens = append(tokens, token{kind: tokenDuration, text: text, pos: start, value: float64(value), unit: unit})
+				continue
+			}
+			value, err := strconv.ParseFloat(number, 64)
+			if err != nil {
+				return tokens, errorAt(start, number, "invalid number")
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: number, pos: start, value: value})
+			continue
+		case isIdentStart(r):
+			for i < len(runes) && isIdentPart(runes[i]) {
+				i++
+			}
+			text := string(runes[start:i])
+			if op, ok := keywords[text]; ok {
+				tokens = append(tokens, token{kind: tokenOperator, text: op, pos: start})
+			} else {
+				tokens = append(tokens, token{kind: tokenIdent, text: text, pos: start})
+			}
+			continue
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: start})
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: start})
+		case r == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: start})
+		case r == '+' || r == '-' || r == '*' || r == '/' || r == '%':
+			tokens = append(tokens, token{kind: tokenOperator, text: string(r), pos: start})
+		case r == '>' || r == '<' || r == '!' || r == '=':
+			text := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				text += "="
+				i++
+			}
+			if text == "=" {
+				return tokens, errorAt(start, text, "unexpected '=', use '==' for equality")
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: text, pos: start})
+		case r == '&' || r == '|':
+			if i+1 >= len(runes) || runes[i+1] != r {
+				return tokens, errorAt(start, string(r), "unexpected '%c', use '%c%c'", r, r, r)
+			}
+			i++
+			tokens = append(tokens, token{kind: tokenOperator, text: string([]rune{r, r}), pos: start})
+		default:
+			return tokens, errorAt(start, string(r), "unexpected character")
+		}
+		i++
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(runes)})
+	return tokens, nil
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || isDigit(r)
+}
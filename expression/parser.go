@@ -0,0 +1,253 @@
+package expression
+
+// Expression is parsed and type-checked expression
+type Expression struct {
+	Root Node
+	Type Type
+}
+
+// Parse parses and type-checks expression. Operators from lowest to highest precedence are
+// '||' (or), '&&' (and), '!' (not), comparisons, '+' '-', '*' '/' '%' and unary '-'.
+// Comparisons can't be chained, use 'a < b && b < c'
+func Parse(src string) (*Expression, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, errorAt(t.pos, t.text, "unexpected token")
+	}
+	return New(root)
+}
+
+// New type-checks syntax tree, e.g. one built with Rewrite, and returns it as expression
+func New(root Node) (*Expression, error) {
+	typ, err := check(root)
+	if err != nil {
+		return nil, err
+	}
+	return &Expression{Root: root, Type: typ}, nil
+}
+
+// ParseCondition parses expression that must evaluate to boolean, e.g. 'mean(temperature) > 30'
+func ParseCondition(src string) (*Expression, error) {
+	e, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if e.Type != TypeBool {
+		return nil, &Error{Pos: e.Root.Pos(), Message: "expression must be condition, e.g. 'mean(temperature) > 10'"}
+	}
+	return e, nil
+}
+
+// String returns expression in source form
+func (e *Expression) String() string {
+	return e.Root.String()
+}
+
+// Aggregations returns aggregations of expression, each once. Aggregation nested inside transformation,
+// such as mean(temperature) in derivative(mean(temperature),10), is not returned separately
+func (e *Expression) Aggregations() []*Call {
+	found := make([]*Call, 0)
+	seen := make(map[string]bool)
+	Walk(e.Root, func(n Node) bool {
+		call, ok := n.(*Call)
+		if !ok || !call.IsAggregation() {
+			return true
+		}
+		if !seen[call.String()] {
+			seen[call.String()] = true
+			found = append(found, call)
+		}
+		return false
+	})
+	return found
+}
+
+// Simplified returns expression where aggregations are replaced with their keys:
+// 'mean(temperature) > 10' -> 'mean_temperature > 10'
+func (e *Expression) Simplified() string {
+	return Rewrite(e.Root, func(n Node) Node {
+		if call, ok := n.(*Call); ok && call.IsAggregation() {
+			return &Ident{Name: call.Key(), pos: call.pos}
+		}
+		return n
+	}).String()
+}
+
+type parser struct {
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokenEOF {
+		p.i++
+	}
+	return t
+}
+
+// accept consumes operator token if it's one of ops
+func (p *parser) accept(ops ...string) (token, bool) {
+	t := p.peek()
+	if t.kind != tokenOperator {
+		return t, false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.i++
+			return t, true
+		}
+	}
+	return t, false
+}
+
+func (p *parser) parseOr() (Node, error) {
+	return p.parseBinary(p.parseAnd, "||")
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	return p.parseBinary(p.parseNot, "&&")
+}
+
+func (p *parser) parseNot() (Node, error) {
+	if t, ok := p.accept("!"); ok {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &Unary{Op: "!", X: x, pos: t.pos}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (Node, error) {
+	x, err := p.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+	t, ok := p.accept(">", ">=", "<", "<=", "==", "!=")
+	if !ok {
+		return x, nil
+	}
+	y, err := p.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+	if next, chained := p.accept(">", ">=", "<", "<=", "==", "!="); chained {
+		return nil, errorAt(next.pos, next.text, "comparisons can't be chained, combine them with '&&'")
+	}
+	return &Binary{Op: t.text, X: x, Y: y, pos: t.pos}, nil
+}
+
+func (p *parser) parseAdd() (Node, error) {
+	return p.parseBinary(p.parseMultiply, "+", "-")
+}
+
+func (p *parser) parseMultiply() (Node, error) {
+	return p.parseBinary(p.parseUnary, "*", "/", "%")
+}
+
+// parseBinary parses left-associative operators of same precedence
+func (p *parser) parseBinary(operand func() (Node, error), ops ...string) (Node, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.accept(ops...)
+		if !ok {
+			return x, nil
+		}
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		x = &Binary{Op: t.text, X: x, Y: y, pos: t.pos}
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if t, ok := p.accept("-"); ok {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Unary{Op: "-", X: x, pos: t.pos}, nil
+	}
+	if t, ok := p.accept("+"); ok {
+		return nil, errorAt(t.pos, t.text, "unexpected operator")
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		return &Number{Value: t.value, pos: t.pos}, nil
+	case tokenDuration:
+		return &Duration{Value: int64(t.value), Unit: t.unit, pos: t.pos}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true", "false":
+			return &Bool{Value: t.text == "true", pos: t.pos}, nil
+		}
+		if p.peek().kind != tokenLParen {
+			return &Ident{Name: t.text, pos: t.pos}, nil
+		}
+		p.next()
+		return p.parseCall(t)
+	case tokenLParen:
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, p.unexpected(closing, "expected ')'")
+		}
+		return x, nil
+	}
+	return nil, p.unexpected(t, "expected number, name or '('")
+}
+
+func (p *parser) parseCall(name token) (Node, error) {
+	call := &Call{Name: name.text, Args: []Node{}, pos: name.pos}
+	if p.peek().kind == tokenRParen {
+		p.next()
+		return call, nil
+	}
+	for {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+		t := p.next()
+		switch t.kind {
+		case tokenRParen:
+			return call, nil
+		case tokenComma:
+			continue
+		}
+		return nil, p.unexpected(t, "expected ',' or ')'")
+	}
+}
+
+func (p *parser) unexpected(t token, message string) error {
+	if t.kind == tokenEOF {
+		return errorAt(t.pos, "", "unexpected end of expression, %s", message)
+	}
+	return errorAt(t.pos, t.text, "unexpected token, %s", message)
+}
@@ -0,0 +1,293 @@
+// Package forecast predicts future values of measurement series.
+// Supported methods are linear regression and Holt-Winters exponential smoothing.
+// Each prediction has confidence band computed from residuals of fitted model.
+package forecast
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tryffel/fusio/storage/Influxdb"
+	"math"
+	"sort"
+	"time"
+)
+
+// Method is forecasting model
+type Method string
+
+const (
+	MethodLinear Method = "linear"
+	// MethodHoltWinters uses additive seasonality if season is set, otherwise only level and trend
+	MethodHoltWinters Method = "holt-winters"
+)
+
+// Minimum number of points to fit model with
+const minPoints = 3
+
+// Options for forecasting. Zero values are replaced with defaults
+type Options struct {
+	Method Method
+	// Horizon is number of points to predict
+	Horizon int
+	// Step is interval between predicted points. Defaults to median interval of series
+	Step time.Duration
+	// Confidence is z-value for confidence band, 1.96 for 95%
+	Confidence float64
+	// Season is length of season in points for Holt-Winters, 0 disables seasonality
+	Season int
+	// Smoothing factors for level, trend and season in Holt-Winters
+	Alpha float64
+	Beta  float64
+	Gamma float64
+}
+
+func (o Options) withDefaults() Options {
+	if o.Method == "" {
+		o.Method = MethodLinear
+	}
+	if o.Horizon <= 0 {
+		o.Horizon = 10
+	}
+	if o.Confidence <= 0 {
+		o.Confidence = 1.96
+	}
+	if o.Alpha <= 0 || o.Alpha > 1 {
+		o.Alpha = 0.5
+	}
+	if o.Beta <= 0 || o.Beta > 1 {
+		o.Beta = 0.1
+	}
+	if o.Gamma <= 0 || o.Gamma > 1 {
+		o.Gamma = 0.1
+	}
+	return o
+}
+
+// Point is predicted value with confidence band
+type Point struct {
+	Timestamp time.Time
+	Value     float64
+	Lower     float64
+	Upper     float64
+}
+
+// ParseMethod validates method name. Empty method is linear
+func ParseMethod(s string) (Method, error) {
+	switch Method(s) {
+	case "", MethodLinear:
+		return MethodLinear, nil
+	case MethodHoltWinters:
+		return MethodHoltWinters, nil
+	}
+	return MethodLinear, fmt.Errorf("invalid forecast method '%s', expected linear or holt-winters", s)
+}
+
+// Forecast fits model to series and predicts opts.Horizon points after last point of series.
+// Missing points are ignored.
+func Forecast(series []Influxdb.Point, opts Options) ([]Point, error) {
+	opts = opts.withDefaults()
+	points := make([]Influxdb.Point, 0, len(series))
+	for _, v := range series {
+		if !v.Missing {
+			points = append(points, v)
+		}
+	}
+	if len(points) < minPoints {
+		return []Point{}, fmt.Errorf("forecast needs at least %d points, got %d", minPoints, len(points))
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].Timestamp.Before(points[j].Timestamp)
+	})
+
+	if opts.Step <= 0 {
+		opts.Step = medianStep(points)
+	}
+	if opts.Step <= 0 {
+		return []Point{}, errors.New("series has no time range")
+	}
+
+	switch opts.Method {
+	case MethodLinear:
+		return linear(points, opts), nil
+	case MethodHoltWinters:
+		return holtWinters(points, opts), nil
+	}
+	return []Point{}, fmt.Errorf("unknown forecast method '%s'", opts.Method)
+}
+
+// Direction of threshold crossing
+type Direction string
+
+const (
+	Above Direction = "above"
+	Below Direction = "below"
+)
+
+// past returns true if value is at or past threshold in given direction
+func (d Direction) past(value float64, threshold float64) bool {
+	if d == Below {
+		return value <= threshold
+	}
+	return value >= threshold
+}
+
+// Crossing returns first time value reaches threshold in given direction, interpolated between predicted
+// points. If last measured point is already past threshold, its timestamp is returned.
+func Crossing(last Influxdb.Point, forecast []Point, threshold float64, direction Direction) (time.Time, bool) {
+	prevTime := last.Timestamp
+	prevValue := float64(last.Value)
+	if direction.past(prevValue, threshold) {
+		return prevTime, true
+	}
+	for _, v := range forecast {
+		if direction.past(v.Value, threshold) {
+			ratio := (threshold - prevValue) / (v.Value - prevValue)
+			offset := time.Duration(ratio * float64(v.Timestamp.Sub(prevTime)))
+			return prevTime.Add(offset), true
+		}
+		prevTime = v.Timestamp
+		prevValue = v.Value
+	}
+	return time.Time{}, false
+}
+
+func medianStep(points []Influxdb.Point) time.Duration {
+	steps := make([]time.Duration, 0, len(points)-1)
+	for i := 1; i < len(points); i++ {
+		steps = append(steps, points[i].Timestamp.Sub(points[i-1].Timestamp))
+	}
+	sort.Slice(steps, func(i, j int) bool {
+		return steps[i] < steps[j]
+	})
+	return steps[len(steps)/2]
+}
+
+// linear fits least squares line. Band is prediction interval of regression
+func linear(points []Influxdb.Point, opts Options) []Point {
+	n := float64(len(points))
+	origin := points[0].Timestamp
+	x := func(t time.Time) float64 {
+		return t.Sub(origin).Seconds()
+	}
+
+	var meanX, meanY float64
+	for _, v := range points {
+		meanX += x(v.Timestamp)
+		meanY += float64(v.Value)
+	}
+	meanX /= n
+	meanY /= n
+
+	var sxx, sxy float64
+	for _, v := range points {
+		dx := x(v.Timestamp) - meanX
+		sxx += dx * dx
+		sxy += dx * (float64(v.Value) - meanY)
+	}
+	slope := 0.0
+	if sxx > 0 {
+		slope = sxy / sxx
+	}
+	intercept := meanY - slope*meanX
+
+	var sse float64
+	for _, v := range points {
+		residual := float64(v.Value) - (intercept + slope*x(v.Timestamp))
+		sse += residual * residual
+	}
+	sigma := math.Sqrt(sse / (n - 2))
+
+	last := points[len(points)-1].Timestamp
+	result := make([]Point, opts.Horizon)
+	for i := range result {
+		t := last.Add(time.Duration(i+1) * opts.Step)
+		value := intercept + slope*x(t)
+		dx := x(t) - meanX
+		spread := 1 + 1/n
+		if sxx > 0 {
+			spread += dx * dx / sxx
+		}
+		band := opts.Confidence * sigma * math.Sqrt(spread)
+		result[i] = Point{Timestamp: t, Value: value, Lower: value - band, Upper: value + band}
+	}
+	return result
+}
+
+// holtWinters uses additive Holt-Winters. Without season, or if there's less than two seasons of data,
+// only level and trend are used. Band widens with square root of steps ahead.
+func holtWinters(points []Influxdb.Point, opts Options) []Point {
+	season := opts.Season
+	if season < 2 || len(points) < 2*season {
+		season = 0
+	}
+
+	seasonal := make([]float64, season)
+	level := float64(points[0].Value)
+	trend := float64(points[1].Value - points[0].Value)
+	if season > 0 {
+		// Initialize from first two seasons
+		var first, second float64
+		for i := 0; i < season; i++ {
+			first += float64(points[i].Value)
+			second += float64(points[season+i].Value)
+		}
+		first /= float64(season)
+		second /= float64(season)
+		trend = (second - first) / float64(season)
+		// Season average is level at middle of season, shift it to last point of first season
+		middle := float64(season-1) / 2
+		level = first + trend*middle
+		for i := 0; i < season; i++ {
+			seasonal[i] = float64(points[i].Value) - (first + trend*(float64(i)-middle))
+		}
+	}
+
+	seasonAt := func(i int) float64 {
+		if season == 0 {
+			return 0
+		}
+		return seasonal[i%season]
+	}
+
+	// First season is only used for initialization
+	start := 1
+	if season > 0 {
+		start = season
+	}
+
+	var sse float64
+	residuals := 0
+	for i := start; i < len(points); i++ {
+		value := float64(points[i].Value)
+		predicted := level + trend + seasonAt(i)
+		sse += (value - predicted) * (value - predicted)
+		residuals += 1
+
+		previousLevel := level
+		level = opts.Alpha*(value-seasonAt(i)) + (1-opts.Alpha)*(level+trend)
+		trend = opts.Beta*(level-previousLevel) + (1-opts.Beta)*trend
+		if season > 0 {
+			seasonal[i%season] = opts.Gamma*(value-level) + (1-opts.Gamma)*seasonal[i%season]
+		}
+	}
+	sigma := 0.0
+	if residuals > 0 {
+		sigma = math.Sqrt(sse / float64(residuals))
+	}
+
+	n := len(points)
+	last := points[n-1].Timestamp
+	result := make([]Point, opts.Horizon)
+	for i := range result {
+		h := i + 1
+		value := level + float64(h)*trend + seasonAt(n-1+h)
+		band := opts.Confidence * sigma * math.Sqrt(float64(h))
+		result[i] = Point{
+			Timestamp: last.Add(time.Duration(h) * opts.Step),
+			Value:     value,
+			Lower:     value - band,
+			Upper:     value + band,
+		}
+	}
+	return result
+}
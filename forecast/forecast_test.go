@@ -0,0 +1,83 @@
+package forecast
+
+import (
+	"github.com/tryffel/fusio/storage/Influxdb"
+	"math"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+
+func series(f func(i int) float64, n int) []Influxdb.Point {
+	points := make([]Influxdb.Point, n)
+	for i := range points {
+		points[i] = Influxdb.Point{Timestamp: start.Add(time.Duration(i) * time.Hour), Value: float32(f(i))}
+	}
+	return points
+}
+
+func TestForecastLinear(t *testing.T) {
+	// Tank draining 2 units per hour
+	points := series(func(i int) float64 { return 100 - 2*float64(i) }, 24)
+
+	predictions, err := Forecast(points, Options{Method: MethodLinear, Horizon: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(predictions) != 5 {
+		t.Fatalf("expected 5 predictions, got %d", len(predictions))
+	}
+	for i, v := range predictions {
+		want := 100 - 2*float64(24+i)
+		if math.Abs(v.Value-want) > 1e-3 {
+			t.Errorf("prediction %d: expected %f, got %f", i, want, v.Value)
+		}
+		if !v.Timestamp.Equal(start.Add(time.Duration(24+i) * time.Hour)) {
+			t.Errorf("prediction %d: invalid timestamp %s", i, v.Timestamp)
+		}
+		if v.Lower > v.Value || v.Upper < v.Value {
+			t.Errorf("prediction %d: value outside confidence band", i)
+		}
+	}
+
+	crossing, ok := Crossing(points[len(points)-1], predictions, 50, Below)
+	if !ok {
+		t.Fatal("expected crossing")
+	}
+	if want := start.Add(25 * time.Hour); !crossing.Equal(want) {
+		t.Errorf("expected crossing at %s, got %s", want, crossing)
+	}
+	if _, ok := Crossing(points[len(points)-1], predictions, 60, Above); ok {
+		t.Error("draining tank should not cross threshold above")
+	}
+}
+
+func TestForecastHoltWinters(t *testing.T) {
+	// Daily cycle with rising trend
+	f := func(i int) float64 {
+		return 10 + 0.1*float64(i) + 5*math.Sin(2*math.Pi*float64(i)/24)
+	}
+	points := series(f, 24*7)
+
+	predictions, err := Forecast(points, Options{Method: MethodHoltWinters, Horizon: 24, Season: 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range predictions {
+		want := f(24*7 + i)
+		if math.Abs(v.Value-want) > 1 {
+			t.Errorf("prediction %d: expected %f, got %f", i, want, v.Value)
+		}
+	}
+	if predictions[23].Upper-predictions[23].Lower < predictions[0].Upper-predictions[0].Lower {
+		t.Error("confidence band should widen")
+	}
+}
+
+func TestForecastNotEnoughPoints(t *testing.T) {
+	points := series(func(i int) float64 { return 1 }, 2)
+	if _, err := Forecast(points, Options{}); err == nil {
+		t.Error("expected error with too few points")
+	}
+}
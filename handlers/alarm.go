@@ -1,12 +1,14 @@
 package handlers
 
 import (
+	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"github.com/tryffel/fusio/dtos"
 	"github.com/tryffel/fusio/storage/models"
 	"github.com/tryffel/fusio/util"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -15,20 +17,48 @@ const (
 	// How many points to evaluate per interval
 	// e.g. for 30 minute interval group by time is 3 min
 	AlarmEvaluteOverIntervalNum int = 10
+
+	transitionsDefaultLimit = 100
+	transitionsMaxLimit     = 1000
 )
 
 type AlarmDTO struct {
-	ID          string            `json:"id"`
-	Name        string            `json:"name"`
-	Info        string            `json:"info"`
-	Message     string            `json:"message"`
-	Fired       bool              `json:"fired"`
-	Enabled     bool              `json:"enabled"`
-	Group       string            `json:"group"`
-	Interval    Interval          `json:"past"`
-	Filter      string            `json:"filter"`
-	History     []AlarmHistoryDto `json:"history"`
-	HistorySize int               `json:"history_size"`
+	ID            string                 `json:"id"`
+	Name          string                 `json:"name"`
+	Info          string                 `json:"info"`
+	Message       string                 `json:"message"`
+	Fired         bool                   `json:"fired"`
+	Enabled       bool                   `json:"enabled"`
+	Group         string                 `json:"group"`
+	Interval      Interval               `json:"past"`
+	Filter        string                 `json:"filter"`
+	Gaps          string                 `json:"gaps"`
+	Type          string                 `json:"type"`
+	Anomaly       *models.AnomalyConfig  `json:"anomaly,omitempty"`
+	Forecast      *models.ForecastConfig `json:"forecast,omitempty"`
+	NoData        *models.NoDataConfig   `json:"nodata,omitempty"`
+	Severity      string                 `json:"severity"`
+	State         string                 `json:"state"`
+	FiredSeverity string                 `json:"fired_severity,omitempty"`
+	Thresholds    []models.Threshold     `json:"thresholds,omitempty"`
+	ClearFilter   string                 `json:"clear_filter,omitempty"`
+	Deadband      float64                `json:"deadband,omitempty"`
+	ClearTrigger  int64                  `json:"clear_trigger,omitempty"`
+	Scope         string                 `json:"scope"`
+	Device        string                 `json:"device,omitempty"`
+	FiredDevices  []string               `json:"fired_devices,omitempty"`
+	Labels        models.Labels          `json:"labels,omitempty"`
+	Escalation    string                 `json:"escalation,omitempty"`
+	Template      string                 `json:"template,omitempty"`
+	// Status is evaluation state of alarm: inactive, pending, firing or resolved
+	Status        string            `json:"status"`
+	PendingSince  *time.Time        `json:"pending_since,omitempty"`
+	Flapping      bool              `json:"flapping"`
+	For           string            `json:"for,omitempty"`
+	FlapWindow    string            `json:"flap_window,omitempty"`
+	FlapThreshold int               `json:"flap_threshold,omitempty"`
+	History       []AlarmHistoryDto `json:"history"`
+	HistorySize   int               `json:"history_size"`
 }
 
 type AlarmHistoryDto struct {
@@ -36,30 +66,60 @@ type AlarmHistoryDto struct {
 	Value     string    `json:"value"`
 	Cleared   bool      `json:"cleared"`
 	ClearedAt time.Time `json:"cleared_at"`
+	Severity  string    `json:"severity"`
+	// Device is set for history of per-device alarm
+	Device string `json:"device,omitempty"`
+	// Acknowledgement, set only if acknowledged
+	AckedBy    uint       `json:"acked_by,omitempty"`
+	AckedAt    *time.Time `json:"acked_at,omitempty"`
+	AckComment string     `json:"ack_comment,omitempty"`
+	// InhibitedBy is id of fired parent alarm that suppressed outputs
+	InhibitedBy string `json:"inhibited_by,omitempty"`
+}
+
+// Alarm states shown in alarm list
+const (
+	AlarmStateFired        = "fired"
+	AlarmStateAcknowledged = "acknowledged"
+	AlarmStateCleared      = "cleared"
+)
+
+// alarmState returns state of alarm: fired, acknowledged or cleared
+func alarmState(a *models.Alarm) string {
+	if !a.Fired {
+		return AlarmStateCleared
+	}
+	if a.Acknowledged {
+		return AlarmStateAcknowledged
+	}
+	return AlarmStateFired
 }
 
 func AlarmHistoryToDto(a *models.AlarmHistory) *AlarmHistoryDto {
 	dto := &AlarmHistoryDto{
-		FiredAt: a.FiredAt,
-		Value:   a.Value,
-		Cleared: a.Cleared,
+		FiredAt:  a.FiredAt,
+		Value:    a.Value,
+		Cleared:  a.Cleared,
+		Severity: string(a.Severity),
+		Device:   a.DeviceId,
 	}
 	if a.Cleared {
 		dto.ClearedAt = a.ClearedAt
 	}
+	if a.Acknowledged {
+		dto.AckedBy = a.AckedBy
+		dto.AckedAt = &a.AckedAt
+		dto.AckComment = a.AckComment
+	}
+	dto.InhibitedBy = a.InhibitedBy
 	return dto
 }
 
 func AlarmHistoryArrayToDto(arr *[]models.AlarmHistory) *[]AlarmHistoryDto {
 
 	dto := make([]AlarmHistoryDto, len(*arr))
-	for i, v := range *arr {
-		dto[i].FiredAt = v.FiredAt
-		dto[i].Value = v.Value
-		dto[i].Cleared = v.Cleared
-		if v.Cleared {
-			dto[i].ClearedAt = v.ClearedAt
-		}
+	for i := range *arr {
+		dto[i] = *AlarmHistoryToDto(&(*arr)[i])
 	}
 	return &dto
 }
@@ -99,21 +159,77 @@ type AlarmQueryDto struct {
 func AlarmToDto(a *models.Alarm, history_count int) *AlarmDTO {
 
 	dto := &AlarmDTO{
-		ID:          a.ID,
-		Name:        a.Name,
-		Info:        a.Info,
-		Message:     a.Message,
-		Fired:       a.Fired,
-		Enabled:     a.Enabled,
-		Group:       a.Group,
-		Filter:      a.Filter.Expression,
-		Interval:    Interval(a.RunInterval),
-		History:     *AlarmHistoryArrayToDto(&a.History),
-		HistorySize: history_count,
+		ID:            a.ID,
+		Name:          a.Name,
+		Info:          a.Info,
+		Message:       a.Message,
+		Fired:         a.Fired,
+		Enabled:       a.Enabled,
+		Group:         a.Group,
+		Filter:        dtos.RestoreFilter(a.Filter.Expression, a.Filter.Filters),
+		Gaps:          string(a.Filter.Gaps),
+		Type:          string(a.Filter.GetType()),
+		Anomaly:       a.Filter.Anomaly,
+		Forecast:      a.Filter.Forecast,
+		NoData:        a.Filter.NoData,
+		Severity:      string(a.GetSeverity()),
+		State:         alarmState(a),
+		FiredSeverity: string(a.FiredSeverity),
+		Thresholds:    a.Filter.Thresholds,
+		ClearFilter:   dtos.RestoreFilter(a.Filter.ClearExpression, a.Filter.Filters),
+		Deadband:      a.Filter.Deadband,
+		ClearTrigger:  a.Filter.ClearLimit,
+		Scope:         string(a.GetScope()),
+		Device:        a.DeviceId,
+		Labels:        a.Labels,
+		Escalation:    a.EscalationPolicyId,
+		Template:      a.TemplateId,
+		Interval:      Interval(a.RunInterval),
+		History:       *AlarmHistoryArrayToDto(&a.History),
+		HistorySize:   history_count,
+		Status:        string(a.GetState()),
+		Flapping:      a.Flapping,
+		FlapThreshold: a.FlapThreshold,
+	}
+	if a.GetState() == models.StatePending {
+		pendingSince := a.PendingSince
+		dto.PendingSince = &pendingSince
+	}
+	if a.ForDuration > 0 {
+		dto.For = a.ForDuration.String()
+	}
+	if a.FlapWindow > 0 {
+		dto.FlapWindow = a.FlapWindow.String()
 	}
 	return dto
 }
 
+// AlarmTransitionDto is single change of alarm state
+type AlarmTransitionDto struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Severity  string    `json:"severity,omitempty"`
+	Flapping  bool      `json:"flapping"`
+	Timestamp time.Time `json:"timestamp"`
+	// Device is set for transition of per-device alarm
+	Device string `json:"device,omitempty"`
+}
+
+func AlarmTransitionArrayToDto(arr *[]models.AlarmTransition) *[]AlarmTransitionDto {
+	dto := make([]AlarmTransitionDto, len(*arr))
+	for i, v := range *arr {
+		dto[i] = AlarmTransitionDto{
+			From:      string(v.FromState),
+			To:        string(v.ToState),
+			Severity:  string(v.Severity),
+			Flapping:  v.Flapping,
+			Timestamp: v.Timestamp,
+			Device:    v.DeviceId,
+		}
+	}
+	return &dto
+}
+
 func (h *Handler) GetAlarms(w http.ResponseWriter, r *http.Request) {
 	if !h.UserAuthenticated(r) {
 		JsonResponse(w, ResponseUnauthorized)
@@ -131,10 +247,29 @@ func (h *Handler) GetAlarms(w http.ResponseWriter, r *http.Request) {
 		logrus.Error("User authenticated but user not found from db: ", r.Context().Value("UserId"))
 		return
 	}
+	state := r.URL.Query().Get("state")
+	switch state {
+	case "", AlarmStateFired, AlarmStateAcknowledged, AlarmStateCleared:
+	default:
+		JsonErrorResponse(w, "state must be one of fired, acknowledged, cleared", http.StatusBadRequest)
+		return
+	}
+	status, err := models.ParseAlarmState(r.URL.Query().Get("status"))
+	if err != nil {
+		JsonErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	alarms, err := h.Store.Alarm.FindByOwner(int(user.ID))
 	dto := make([]AlarmDTO, 0)
 
 	for _, v := range *alarms {
+		if state != "" && alarmState(&v) != state {
+			continue
+		}
+		if status != "" && v.GetState() != status {
+			continue
+		}
 		dto = append(dto, *AlarmToDto(&v, -1))
 	}
 
@@ -176,6 +311,18 @@ func (h *Handler) GetAlarmById(w http.ResponseWriter, r *http.Request) {
 	}
 
 	dto := AlarmToDto(alarm, history)
+	if alarm.GetScope() == models.ScopePerDevice {
+		states, err := h.Store.Alarm.GetDeviceStates(alarm)
+		if err != nil {
+			logrus.Error(err)
+		} else {
+			for _, v := range *states {
+				if v.Fired {
+					dto.FiredDevices = append(dto.FiredDevices, v.DeviceId)
+				}
+			}
+		}
+	}
 	JsonResponse(w, dto)
 	return
 }
@@ -212,6 +359,14 @@ func (h *Handler) CreateAlarm(w http.ResponseWriter, r *http.Request) {
 		JsonErrorResponse(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !h.alarmTargetAccess(user.ID, alarm) {
+		JsonErrorResponse(w, "Group or device not found", http.StatusBadRequest)
+		return
+	}
+	if !h.escalationAccess(user.ID, alarm.EscalationPolicyId) {
+		JsonErrorResponse(w, "Escalation policy not found", http.StatusBadRequest)
+		return
+	}
 
 	err = h.Store.Alarm.Create(alarm)
 	if err != nil {
@@ -221,3 +376,258 @@ func (h *Handler) CreateAlarm(w http.ResponseWriter, r *http.Request) {
 	}
 	JsonMessage(w, "alarm", alarm.ID)
 }
+
+// UpdateAlarm replaces alarm with request body. Changing alarm condition resets its state
+func (h *Handler) UpdateAlarm(w http.ResponseWriter, r *http.Request) {
+	existing := h.getUserAlarm(w, r)
+	if existing == nil {
+		return
+	}
+
+	dto := &dtos.NewAlarm{}
+	err := dtos.Validate(w, r, dto)
+	if err != nil {
+		return
+	}
+	h.saveAlarm(w, existing, dto)
+}
+
+// PatchAlarm updates only fields that are present in request body
+func (h *Handler) PatchAlarm(w http.ResponseWriter, r *http.Request) {
+	existing := h.getUserAlarm(w, r)
+	if existing == nil {
+		return
+	}
+
+	dto := dtos.AlarmToNewAlarm(existing)
+	err := dtos.Validate(w, r, dto)
+	if err != nil {
+		return
+	}
+	h.saveAlarm(w, existing, dto)
+}
+
+// DeleteAlarm deletes alarm with its history and outputs
+func (h *Handler) DeleteAlarm(w http.ResponseWriter, r *http.Request) {
+	alarm := h.getUserAlarm(w, r)
+	if alarm == nil {
+		return
+	}
+
+	err := h.Store.Alarm.Remove(alarm)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "alarm")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	JsonResponseDeleted(w)
+}
+
+func (h *Handler) EnableAlarm(w http.ResponseWriter, r *http.Request) {
+	h.setAlarmEnabled(w, r, true)
+}
+
+// DisableAlarm disables alarm. Fired alarm is cleared
+func (h *Handler) DisableAlarm(w http.ResponseWriter, r *http.Request) {
+	h.setAlarmEnabled(w, r, false)
+}
+
+// AcknowledgeAlarm acknowledges fired alarm. Acknowledged alarm doesn't push repeated notifications
+// until it's cleared
+func (h *Handler) AcknowledgeAlarm(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if err != nil || user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+	alarm := h.getUserAlarm(w, r)
+	if alarm == nil {
+		return
+	}
+
+	// Comment is optional, so is body
+	dto := &dtos.AlarmAck{}
+	if r.ContentLength != 0 {
+		err = dtos.Validate(w, r, dto)
+		if err != nil {
+			return
+		}
+	}
+
+	if !alarm.Fired {
+		JsonErrorResponse(w, "Alarm is not fired", http.StatusConflict)
+		return
+	}
+
+	err = h.Store.Alarm.Acknowledge(alarm, user.ID, dto.Comment, time.Now())
+	if err == nil && alarm.EscalationPolicyId != "" {
+		err = h.Store.Escalation.Stop(alarm.ID, "")
+	}
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "alarm")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	JsonResponseUpdated(w, nil)
+}
+
+// GetAlarmTransitions returns newest state transitions of alarm. Transitions can be filtered with device
+func (h *Handler) GetAlarmTransitions(w http.ResponseWriter, r *http.Request) {
+	alarm := h.getUserAlarm(w, r)
+	if alarm == nil {
+		return
+	}
+
+	params := r.URL.Query()
+	limit := transitionsDefaultLimit
+	if l := params.Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > transitionsMaxLimit {
+			JsonErrorResponse(w, fmt.Sprintf("limit must be between 1 and %d", transitionsMaxLimit),
+				http.StatusBadRequest)
+			return
+		}
+	}
+
+	transitions, err := h.Store.Alarm.GetTransitions(alarm, params.Get("device"), limit)
+	if err != nil {
+		logrus.Error(err)
+		JsonErrorResponse(w, ResponseInternalError, http.StatusInternalServerError)
+		return
+	}
+	JsonResponse(w, AlarmTransitionArrayToDto(transitions))
+}
+
+// UnacknowledgeAlarm removes acknowledgement from fired alarm
+func (h *Handler) UnacknowledgeAlarm(w http.ResponseWriter, r *http.Request) {
+	alarm := h.getUserAlarm(w, r)
+	if alarm == nil {
+		return
+	}
+
+	err := h.Store.Alarm.Unacknowledge(alarm)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "alarm")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	JsonResponseUpdated(w, nil)
+}
+
+func (h *Handler) setAlarmEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	alarm := h.getUserAlarm(w, r)
+	if alarm == nil {
+		return
+	}
+	if alarm.Enabled == enabled {
+		JsonResponseUpdated(w, nil)
+		return
+	}
+
+	alarm.Enabled = enabled
+	err := h.Store.Alarm.Update(alarm)
+	if err == nil && !enabled {
+		err = h.Store.Alarm.ResetState(alarm)
+	}
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "alarm")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	JsonResponseUpdated(w, nil)
+}
+
+// getUserAlarm gets alarm in url that user owns. On failure error is written to response and nil returned
+func (h *Handler) getUserAlarm(w http.ResponseWriter, r *http.Request) *models.Alarm {
+	user, err := h.getUser(r)
+	if err != nil || user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return nil
+	}
+
+	id := mux.Vars(r)["id"]
+	if !util.IsUuid(id) {
+		JsonErrorResponse(w, ResponseInvalidId, http.StatusBadRequest)
+		return nil
+	}
+
+	alarm, err := h.Store.Alarm.FindByOwnerAndId(id, int(user.ID))
+	if err != nil || alarm.ID == "" {
+		JsonErrorResponse(w, ResponseNotFound, http.StatusNotFound)
+		return nil
+	}
+	return alarm
+}
+
+// alarmTargetAccess returns true if user has access to group and device alarm is evaluated for
+func (h *Handler) alarmTargetAccess(userId uint, alarm *models.Alarm) bool {
+	if alarm.Group != "" {
+		access, err := h.Store.Group.UserHasAccess(userId, []string{alarm.Group})
+		if err != nil || !access {
+			return false
+		}
+	}
+	if alarm.DeviceId != "" {
+		access, err := h.Store.Device.UserHasAccess(userId, []string{alarm.DeviceId})
+		if err != nil || !access {
+			return false
+		}
+	}
+	return true
+}
+
+// saveAlarm updates existing alarm from dto. If group, interval or filter changes, alarm state is reset
+func (h *Handler) saveAlarm(w http.ResponseWriter, existing *models.Alarm, dto *dtos.NewAlarm) {
+	alarm, err := dto.ToAlarm()
+	if err != nil {
+		JsonErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if alarm.Group != existing.Group || alarm.DeviceId != existing.DeviceId {
+		if !h.alarmTargetAccess(existing.OwnerId, alarm) {
+			JsonErrorResponse(w, "Group or device not found", http.StatusBadRequest)
+			return
+		}
+	}
+	if alarm.EscalationPolicyId != existing.EscalationPolicyId && !h.escalationAccess(existing.OwnerId,
+		alarm.EscalationPolicyId) {
+		JsonErrorResponse(w, "Escalation policy not found", http.StatusBadRequest)
+		return
+	}
+
+	alarm.TemplateId = existing.TemplateId
+	err = h.updateAlarm(existing, alarm)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "alarm")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	JsonResponse(w, AlarmToDto(alarm, -1))
+}
+
+// updateAlarm replaces existing alarm with alarm, keeping its id and state.
+// If group, interval or filter changes, alarm state is reset
+func (h *Handler) updateAlarm(existing *models.Alarm, alarm *models.Alarm) error {
+	changed := alarm.Group != existing.Group || alarm.RunInterval != existing.RunInterval ||
+		!alarm.Filter.Equal(&existing.Filter) || alarm.GetScope() != existing.GetScope() ||
+		alarm.DeviceId != existing.DeviceId
+
+	alarm.ID = existing.ID
+	alarm.OwnerId = existing.OwnerId
+	alarm.Fired = existing.Fired
+	alarm.FiredSeverity = existing.FiredSeverity
+	alarm.Acknowledged = existing.Acknowledged
+	alarm.State = existing.State
+	alarm.PendingSince = existing.PendingSince
+	alarm.Flapping = existing.Flapping
+	alarm.LastRun = existing.LastRun
+	alarm.CreatedAt = existing.CreatedAt
+
+	err := h.Store.Alarm.Update(alarm)
+	if err == nil && changed {
+		err = h.Store.Alarm.ResetState(alarm)
+	}
+	return err
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/tryffel/fusio/alarm"
+	"github.com/tryffel/fusio/dtos"
+	"net/http"
+	"time"
+)
+
+// BacktestAlarm replays alarm over historical measurements and returns fire / clear timeline it would have
+// produced. Alarm is not saved and no outputs are pushed.
+func (h *Handler) BacktestAlarm(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if err != nil || user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	dto := &dtos.BacktestRequest{}
+	err = dtos.Validate(w, r, dto)
+	if err != nil {
+		return
+	}
+	err = dtos.ValidateNested(w, &dto.Alarm)
+	if err != nil {
+		return
+	}
+
+	from, err := time.Parse(time.RFC3339, dto.From)
+	if err != nil {
+		JsonErrorResponse(w, fmt.Sprintf("Invalid from: %s", dto.From), http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse(time.RFC3339, dto.To)
+	if err != nil {
+		JsonErrorResponse(w, fmt.Sprintf("Invalid to: %s", dto.To), http.StatusBadRequest)
+		return
+	}
+	if !from.Before(to) {
+		JsonErrorResponse(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+	if now := time.Now(); to.After(now) {
+		to = now
+	}
+
+	a, err := dto.Alarm.ToAlarm()
+	if err != nil {
+		JsonErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a.OwnerId = user.ID
+	if !h.alarmTargetAccess(user.ID, a) {
+		JsonErrorResponse(w, "Group or device not found", http.StatusBadRequest)
+		return
+	}
+
+	events, err := alarm.Backtest(r.Context(), a, *h.Store, from, to)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "alarm")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := dtos.BacktestResult{
+		From:   from,
+		To:     to,
+		Events: make([]dtos.BacktestEvent, len(events)),
+	}
+	firedAt := make(map[string]time.Time)
+	for i, v := range events {
+		result.Events[i] = dtos.BacktestEvent{
+			Timestamp:  v.Timestamp,
+			Type:       string(v.Type),
+			Severity:   string(v.Severity),
+			Device:     v.Device,
+			Values:     v.Values,
+			Suppressed: v.Suppressed,
+		}
+		_, fired := firedAt[v.Device]
+		if v.Type == alarm.Fire && !fired {
+			result.Fires += 1
+			firedAt[v.Device] = v.Timestamp
+		} else if v.Type == alarm.Clear && fired {
+			result.FiredSeconds += v.Timestamp.Sub(firedAt[v.Device]).Seconds()
+			delete(firedAt, v.Device)
+		}
+	}
+	// Alarm still fired at end of range
+	for _, v := range firedAt {
+		result.FiredSeconds += to.Sub(v).Seconds()
+	}
+	JsonResponse(w, result)
+}
@@ -165,3 +165,78 @@ func (h *Handler) GetDeviceMeasurements(w http.ResponseWriter, r *http.Request)
 
 	JsonResponse(w, data)
 }
+
+// GetDeviceMeasurementCatalog sends last value, last timestamp, point count and unit of each devices measurement
+func (h *Handler) GetDeviceMeasurementCatalog(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "device")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	access, err := h.Store.Device.UserHasAccess(user.ID, []string{id})
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "device")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	if !access {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	catalog, err := h.Store.Measurement.GetDeviceCatalog(id)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "measurement")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	JsonResponse(w, dtos.MeasurementInfoToDto(catalog))
+}
+
+// SetMeasurementUnit sets unit for devices measurement key
+func (h *Handler) SetMeasurementUnit(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "device")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	key := mux.Vars(r)["key"]
+	access, err := h.Store.Device.UserHasAccess(user.ID, []string{id})
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "device")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	if !access {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	dto := &dtos.MeasurementUnit{}
+	err = dtos.Validate(w, r, dto)
+	if err != nil {
+		return
+	}
+
+	err = h.Store.Measurement.SetUnit(id, key, dto.Unit)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "measurement")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	JsonResponseUpdated(w, nil)
+}
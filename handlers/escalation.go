@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/tryffel/fusio/dtos"
+	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/util"
+	"net/http"
+)
+
+func (h *Handler) CreateEscalationPolicy(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if err != nil || user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	dto := &dtos.NewEscalationPolicy{}
+	err = dtos.Validate(w, r, dto)
+	if err != nil {
+		return
+	}
+
+	policy, err := dto.ToPolicy()
+	if err != nil {
+		JsonErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.outputChannelAccess(user.ID, policy) {
+		JsonErrorResponse(w, "Output channel not found", http.StatusBadRequest)
+		return
+	}
+	policy.OwnerId = user.ID
+
+	err = h.Store.Escalation.CreatePolicy(policy)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "escalation policy")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	JsonResponse(w, dtos.EscalationPolicyToDto(policy))
+}
+
+func (h *Handler) GetEscalationPolicies(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if err != nil || user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	policies, err := h.Store.Escalation.FindPoliciesByOwner(user.ID)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "escalation policy")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dto := make([]dtos.EscalationPolicy, len(*policies))
+	for i := range *policies {
+		dto[i] = *dtos.EscalationPolicyToDto(&(*policies)[i])
+	}
+	JsonResponse(w, dto)
+}
+
+// UpdateEscalationPolicy replaces policy steps. Running escalations continue from their current step
+func (h *Handler) UpdateEscalationPolicy(w http.ResponseWriter, r *http.Request) {
+	existing := h.getUserEscalationPolicy(w, r)
+	if existing == nil {
+		return
+	}
+
+	dto := &dtos.NewEscalationPolicy{}
+	err := dtos.Validate(w, r, dto)
+	if err != nil {
+		return
+	}
+
+	policy, err := dto.ToPolicy()
+	if err != nil {
+		JsonErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.outputChannelAccess(existing.OwnerId, policy) {
+		JsonErrorResponse(w, "Output channel not found", http.StatusBadRequest)
+		return
+	}
+	policy.ID = existing.ID
+	policy.OwnerId = existing.OwnerId
+	policy.CreatedAt = existing.CreatedAt
+
+	err = h.Store.Escalation.UpdatePolicy(policy)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "escalation policy")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	JsonResponse(w, dtos.EscalationPolicyToDto(policy))
+}
+
+// DeleteEscalationPolicy deletes policy and removes it from alarms
+func (h *Handler) DeleteEscalationPolicy(w http.ResponseWriter, r *http.Request) {
+	policy := h.getUserEscalationPolicy(w, r)
+	if policy == nil {
+		return
+	}
+
+	err := h.Store.Escalation.RemovePolicy(policy)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "escalation policy")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	JsonResponseDeleted(w)
+}
+
+func (h *Handler) getUserEscalationPolicy(w http.ResponseWriter, r *http.Request) *models.EscalationPolicy {
+	user, err := h.getUser(r)
+	if err != nil || user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return nil
+	}
+
+	id := mux.Vars(r)["id"]
+	if !util.IsUuid(id) {
+		JsonErrorResponse(w, ResponseInvalidId, http.StatusBadRequest)
+		return nil
+	}
+
+	policy, err := h.Store.Escalation.FindPolicyByOwnerAndId(user.ID, id)
+	if err != nil || policy.ID == "" {
+		JsonErrorResponse(w, ResponseNotFound, http.StatusNotFound)
+		return nil
+	}
+	return policy
+}
+
+// escalationAccess returns true if policy is empty or user owns it
+func (h *Handler) escalationAccess(userId uint, policyId string) bool {
+	if policyId == "" {
+		return true
+	}
+	policy, err := h.Store.Escalation.FindPolicyByOwnerAndId(userId, policyId)
+	return err == nil && policy.ID != ""
+}
+
+// outputChannelAccess returns true if user owns all output channels of policy
+func (h *Handler) outputChannelAccess(userId uint, policy *models.EscalationPolicy) bool {
+	for _, step := range policy.Steps {
+		for _, id := range step.OutputChannels {
+			channel, err := h.Store.OutputChannel.FindbyOwnerAndId(userId, id)
+			if err != nil || channel.ID == "" {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/tryffel/fusio/dtos"
+	"github.com/tryffel/fusio/err"
+	"github.com/tryffel/fusio/forecast"
+	"github.com/tryffel/fusio/storage/Influxdb"
+	"net/http"
+	"time"
+)
+
+// Forecast predicts measurements of device or group and optionally time when threshold is crossed
+func (h *Handler) Forecast(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "user")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	if user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	dto := &dtos.ForecastRequest{}
+	err = dtos.Validate(w, r, dto)
+	if err != nil {
+		return
+	}
+
+	if dto.Device == "" && dto.Group == "" {
+		JsonErrorResponse(w, "Either device or group is required", http.StatusBadRequest)
+		return
+	}
+	if dto.Device != "" && !h.hasAccess(user, dtos.GrafanaTargetDevice, dto.Device) {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+	if dto.Group != "" && !h.hasAccess(user, dtos.GrafanaTargetGroup, dto.Group) {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	duration, err := time.ParseDuration(dto.Range)
+	if err != nil {
+		JsonErrorResponse(w, fmt.Sprintf("Invalid range: %s", dto.Range), http.StatusBadRequest)
+		return
+	}
+	filters, err := Influxdb.FilterFromString(dto.Filter)
+	if err != nil {
+		JsonErrorResponse(w, fmt.Sprintf("Invalid filter: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	method, err := forecast.ParseMethod(dto.Method)
+	if err != nil {
+		JsonErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	n := dto.Points
+	if n == 0 {
+		n = 50
+	}
+	to := time.Now()
+	from := to.Add(-duration)
+	batch, err := h.Store.Measurement.Read(r.Context(), dto.Device, dto.Group, *filters, from, to, n, Influxdb.DefaultReadOpts())
+	if err != nil {
+		Err.Log(err)
+		JsonErrorResponse(w, ResponseInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	opts := forecast.Options{
+		Method:  method,
+		Horizon: dto.Horizon,
+		Season:  dto.Season,
+	}
+
+	result := make([]dtos.Forecast, 0, len(*filters))
+	for _, f := range *filters {
+		series := batch[f.StringSimplified()]
+		predictions, err := forecast.Forecast(series, opts)
+		if err != nil {
+			JsonErrorResponse(w, fmt.Sprintf("%s: %s", f.String(), err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		item := dtos.Forecast{
+			Filter: f.String(),
+			Points: make([]dtos.ForecastPoint, len(predictions)),
+		}
+		for i, v := range predictions {
+			item.Points[i] = dtos.ForecastPoint{Timestamp: v.Timestamp, Value: v.Value, Lower: v.Lower, Upper: v.Upper}
+		}
+		if dto.Direction != "" {
+			crossing, ok := forecast.Crossing(series[len(series)-1], predictions, dto.Threshold,
+				forecast.Direction(dto.Direction))
+			if ok {
+				item.Crossing = &crossing
+			}
+		}
+		result = append(result, item)
+	}
+	JsonResponse(w, result)
+}
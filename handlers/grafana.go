@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"github.com/tryffel/fusio/dtos"
+	"github.com/tryffel/fusio/err"
+	"github.com/tryffel/fusio/storage/Influxdb"
+	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/util"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Handlers for Grafana JSON datasource. Grafana is expected to authenticate as user with
+// 'Authorization: Bearer <token>' header, so every request follows the same ownership rules as rest of api.
+// Targets are formatted as '<device|group>/<id>/<filter>', e.g. 'device/<uuid>/mean(temperature)'.
+
+const (
+	// Default number of points if Grafana doesn't provide interval or max data points
+	grafanaDefaultPoints int64 = 100
+)
+
+// GrafanaTestConnection responds ok to Grafanas datasource test
+func (h *Handler) GrafanaTestConnection(w http.ResponseWriter, r *http.Request) {
+	if !h.UserAuthenticated(r) {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+	JsonResponseOk(w)
+}
+
+// GrafanaSearch lists all device and group measurements user has access to
+func (h *Handler) GrafanaSearch(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if err != nil || user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	dto := &dtos.GrafanaSearch{}
+	err = DtoFromRequest(r, dto)
+	if err != nil {
+		InvalidJsonResponse(w)
+		return
+	}
+
+	devices, err := h.Store.Device.GetByOwnerId(user.ID)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "devices")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+
+	groups, err := h.Store.Group.FindByOwner(int(user.ID))
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "groups")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+
+	search := strings.ToLower(dto.Target)
+	result := make([]dtos.GrafanaSearchResult, 0)
+
+	for _, v := range *devices {
+		keys, err := h.Store.Measurement.GetDeviceMeasurements(v.ID)
+		if err != nil {
+			Err.Log(err)
+			continue
+		}
+		result = append(result, grafanaSearchResults(dtos.GrafanaTargetDevice, v.ID, v.Name, keys, search)...)
+	}
+
+	for _, v := range *groups {
+		keys, err := h.Store.Measurement.GetGroupMeasurements(v.ID)
+		if err != nil {
+			Err.Log(err)
+			continue
+		}
+		result = append(result, grafanaSearchResults(dtos.GrafanaTargetGroup, v.ID, v.Name, keys, search)...)
+	}
+	JsonResponse(w, result)
+}
+
+// GrafanaQuery returns timeseries for each target
+func (h *Handler) GrafanaQuery(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if err != nil || user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	dto := &dtos.GrafanaQuery{}
+	err = DtoFromRequest(r, dto)
+	if err != nil {
+		InvalidJsonResponse(w)
+		return
+	}
+
+	from := dto.Range.From
+	to := dto.Range.To
+	if !from.Before(to) {
+		JsonErrorResponse(w, "Invalid time range", http.StatusBadRequest)
+		return
+	}
+
+	// Adhoc filters narrow queries to single device or group
+	adhocDevice := ""
+	adhocGroup := ""
+	for _, v := range dto.AdhocFilters {
+		if v.Operator != "=" {
+			JsonErrorResponse(w, fmt.Sprintf("Unsupported operator '%s'", v.Operator), http.StatusBadRequest)
+			return
+		}
+		switch v.Key {
+		case dtos.GrafanaTargetDevice:
+			adhocDevice = v.Value
+		case dtos.GrafanaTargetGroup:
+			adhocGroup = v.Value
+		}
+	}
+
+	if adhocDevice != "" && !h.hasAccess(user, dtos.GrafanaTargetDevice, adhocDevice) {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+	if adhocGroup != "" && !h.hasAccess(user, dtos.GrafanaTargetGroup, adhocGroup) {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	n := grafanaPoints(dto, from, to)
+	result := make([]dtos.GrafanaTimeSeries, 0)
+
+	for _, target := range dto.Targets {
+		if target.Target == "" {
+			continue
+		}
+		kind, id, filter, err := parseGrafanaTarget(target.Target)
+		if err != nil {
+			JsonErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if !h.hasAccess(user, kind, id) {
+			JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+			return
+		}
+
+		filters, err := Influxdb.FilterFromString(filter)
+		if err != nil {
+			JsonErrorResponse(w, fmt.Sprintf("Invalid filter '%s': %s", filter, err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		device := adhocDevice
+		group := adhocGroup
+		if kind == dtos.GrafanaTargetDevice {
+			device = id
+		} else {
+			group = id
+		}
+
+		// Fill with null so Grafana shows gaps in data
+		opts := &Influxdb.ReadOpts{Fill: Influxdb.FillNull}
+		batch, err := h.Store.Measurement.Read(r.Context(), device, group, *filters, from, to, n, opts)
+		if err != nil {
+			Err.Log(err)
+			JsonErrorResponse(w, ResponseInternalError, http.StatusInternalServerError)
+			return
+		}
+
+		for _, f := range *filters {
+			name := target.Target
+			if len(*filters) > 1 {
+				name = fmt.Sprintf("%s %s", target.Target, f.String())
+			}
+			result = append(result, dtos.GrafanaTimeSeries{
+				Target:     name,
+				Datapoints: grafanaDatapoints(batch[f.StringSimplified()]),
+			})
+		}
+	}
+	JsonResponse(w, result)
+}
+
+// GrafanaAnnotations returns alarm fire and clear events as annotations.
+// Annotation query can be either alarm or group id, or empty to include all alarms
+func (h *Handler) GrafanaAnnotations(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if err != nil || user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	dto := &dtos.GrafanaAnnotationRequest{}
+	err = DtoFromRequest(r, dto)
+	if err != nil {
+		InvalidJsonResponse(w)
+		return
+	}
+
+	query := strings.TrimSpace(dto.Annotation.Query)
+	if query != "" && !util.IsUuid(query) {
+		JsonErrorResponse(w, ResponseInvalidId, http.StatusBadRequest)
+		return
+	}
+
+	alarms, err := h.Store.Alarm.FindByOwner(int(user.ID))
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "alarms")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+
+	alarmMap := make(map[string]*models.Alarm)
+	ids := make([]string, 0)
+	for i, v := range *alarms {
+		if query == "" || query == v.ID || query == v.Group {
+			alarmMap[v.ID] = &(*alarms)[i]
+			ids = append(ids, v.ID)
+		}
+	}
+
+	result := make([]dtos.GrafanaAnnotation, 0)
+	if len(ids) == 0 {
+		JsonResponse(w, result)
+		return
+	}
+
+	history, err := h.Store.Alarm.GetHistory(ids, dto.Range.From, dto.Range.To)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "alarm history")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, v := range *history {
+		alarm := alarmMap[v.AlarmId]
+		if !v.FiredAt.Before(dto.Range.From) {
+			result = append(result, dtos.GrafanaAnnotation{
+				Annotation: dto.Annotation,
+				Time:       v.FiredAt.UnixNano() / int64(time.Millisecond),
+				Title:      fmt.Sprintf("%s fired", alarm.Name),
+				Tags:       []string{"fired", alarm.ID, alarm.Group},
+				Text:       fmt.Sprintf("%s, value: %s", alarm.Message, v.Value),
+			})
+		}
+		if v.Cleared && !v.ClearedAt.After(dto.Range.To) {
+			result = append(result, dtos.GrafanaAnnotation{
+				Annotation: dto.Annotation,
+				Time:       v.ClearedAt.UnixNano() / int64(time.Millisecond),
+				Title:      fmt.Sprintf("%s cleared", alarm.Name),
+				Tags:       []string{"cleared", alarm.ID, alarm.Group},
+				Text:       alarm.Message,
+			})
+		}
+	}
+	JsonResponse(w, result)
+}
+
+// GrafanaTagKeys returns keys usable as adhoc filters
+func (h *Handler) GrafanaTagKeys(w http.ResponseWriter, r *http.Request) {
+	if !h.UserAuthenticated(r) {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+	keys := []dtos.GrafanaTagKey{
+		{Type: "string", Text: dtos.GrafanaTargetDevice},
+		{Type: "string", Text: dtos.GrafanaTargetGroup},
+	}
+	JsonResponse(w, keys)
+}
+
+// GrafanaTagValues returns device or group ids user has access to
+func (h *Handler) GrafanaTagValues(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if err != nil || user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	dto := &dtos.GrafanaTagValueRequest{}
+	err = DtoFromRequest(r, dto)
+	if err != nil {
+		InvalidJsonResponse(w)
+		return
+	}
+
+	result := make([]dtos.GrafanaTagValue, 0)
+	switch dto.Key {
+	case dtos.GrafanaTargetDevice:
+		devices, err := h.Store.Device.GetByOwnerId(user.ID)
+		if err != nil {
+			friendly := h.Store.Errors.GetUserFriendlyError(err, "devices")
+			JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, v := range *devices {
+			result = append(result, dtos.GrafanaTagValue{Text: v.ID})
+		}
+	case dtos.GrafanaTargetGroup:
+		groups, err := h.Store.Group.FindByOwner(int(user.ID))
+		if err != nil {
+			friendly := h.Store.Errors.GetUserFriendlyError(err, "groups")
+			JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, v := range *groups {
+			result = append(result, dtos.GrafanaTagValue{Text: v.ID})
+		}
+	default:
+		JsonErrorResponse(w, fmt.Sprintf("Unknown tag key '%s'", dto.Key), http.StatusBadRequest)
+		return
+	}
+	JsonResponse(w, result)
+}
+
+// hasAccess checks user owns given device or group. Kind is dtos.GrafanaTargetDevice or dtos.GrafanaTargetGroup
+func (h *Handler) hasAccess(user *models.User, kind string, id string) bool {
+	var access bool
+	var err error
+	switch kind {
+	case dtos.GrafanaTargetDevice:
+		access, err = h.Store.Device.UserHasAccess(user.ID, []string{id})
+	case dtos.GrafanaTargetGroup:
+		access, err = h.Store.Group.UserHasAccess(user.ID, []string{id})
+	default:
+		return false
+	}
+	if err != nil {
+		logrus.Error(err)
+		return false
+	}
+	return access
+}
+
+// parseGrafanaTarget splits target 'device/<id>/mean(temperature)' into its parts
+func parseGrafanaTarget(target string) (string, string, string, error) {
+	parts := strings.SplitN(target, "/", 3)
+	if len(parts) != 3 {
+		return "", "", "", fmt.Errorf("invalid target '%s', expected '<device|group>/<id>/<filter>'", target)
+	}
+	if parts[0] != dtos.GrafanaTargetDevice && parts[0] != dtos.GrafanaTargetGroup {
+		return "", "", "", fmt.Errorf("invalid target type '%s'", parts[0])
+	}
+	if !util.IsUuid(parts[1]) {
+		return "", "", "", fmt.Errorf("invalid id '%s'", parts[1])
+	}
+	if parts[2] == "" {
+		return "", "", "", fmt.Errorf("missing filter in target '%s'", target)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+// grafanaSearchResults builds search results for measurement keys, matching search text if given
+func grafanaSearchResults(kind string, id string, name string, keys []string, search string) []dtos.GrafanaSearchResult {
+	result := make([]dtos.GrafanaSearchResult, 0, len(keys))
+	for _, key := range keys {
+		text := fmt.Sprintf("%s %s: %s", kind, name, key)
+		if search != "" && !strings.Contains(strings.ToLower(text), search) {
+			continue
+		}
+		result = append(result, dtos.GrafanaSearchResult{
+			Text:  text,
+			Value: fmt.Sprintf("%s/%s/mean(%s)", kind, id, key),
+		})
+	}
+	return result
+}
+
+// grafanaDatapoints converts points to Grafana's [value, unix ms] pairs. Missing points have null value
+func grafanaDatapoints(points []Influxdb.Point) [][2]interface{} {
+	datapoints := make([][2]interface{}, 0, len(points))
+	for _, p := range points {
+		var value interface{}
+		if !p.Missing {
+			value = p.Value
+		}
+		datapoints = append(datapoints, [2]interface{}{value, p.Timestamp.UnixNano() / int64(time.Millisecond)})
+	}
+	return datapoints
+}
+
+// grafanaPoints calculates number of points to query from requested interval and max data points
+func grafanaPoints(q *dtos.GrafanaQuery, from time.Time, to time.Time) int64 {
+	n := grafanaDefaultPoints
+	if q.IntervalMs > 0 {
+		n = int64(to.Sub(from)/time.Millisecond) / q.IntervalMs
+	}
+	if q.MaxDataPoints > 0 && n > q.MaxDataPoints {
+		n = q.MaxDataPoints
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"github.com/tryffel/fusio/dtos"
+	"github.com/tryffel/fusio/storage/Influxdb"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseGrafanaTarget(t *testing.T) {
+	id := "9e1b1d7e-4c7a-4bd8-9f4f-2f6f4c3c0a11"
+	tests := []struct {
+		name    string
+		target  string
+		kind    string
+		filter  string
+		wantErr bool
+	}{
+		{"device", "device/" + id + "/mean(temperature)", dtos.GrafanaTargetDevice, "mean(temperature)", false},
+		{"group", "group/" + id + "/max(humidity)", dtos.GrafanaTargetGroup, "max(humidity)", false},
+		{"filter with slash", "device/" + id + "/mean(temperature)/2", dtos.GrafanaTargetDevice,
+			"mean(temperature)/2", false},
+		{"unknown type", "alarm/" + id + "/mean(temperature)", "", "", true},
+		{"bad uuid", "device/1234/mean(temperature)", "", "", true},
+		{"missing filter", "device/" + id, "", "", true},
+		{"empty filter", "device/" + id + "/", "", "", true},
+		{"empty", "", "", "", true},
+	}
+
+	for _, v := range tests {
+		kind, gotId, filter, err := parseGrafanaTarget(v.target)
+		if (err != nil) != v.wantErr {
+			t.Errorf("%s: expected error %t, got %v", v.name, v.wantErr, err)
+			continue
+		}
+		if v.wantErr {
+			continue
+		}
+		if kind != v.kind || gotId != id || filter != v.filter {
+			t.Errorf("%s: got %s, %s, %s", v.name, kind, gotId, filter)
+		}
+	}
+}
+
+func TestGrafanaDatapoints(t *testing.T) {
+	ts := time.Unix(1500000000, 250*int64(time.Millisecond))
+	points := []Influxdb.Point{
+		{Value: 21.5, Timestamp: ts},
+		{Timestamp: ts.Add(time.Minute), Missing: true},
+		{Value: 0, Timestamp: ts.Add(2 * time.Minute)},
+	}
+	want := [][2]interface{}{
+		{float32(21.5), int64(1500000000250)},
+		{nil, int64(1500000060250)},
+		{float32(0), int64(1500000120250)},
+	}
+	got := grafanaDatapoints(points)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := grafanaDatapoints(nil); got == nil || len(got) != 0 {
+		t.Errorf("expected empty datapoints for no points, got %v", got)
+	}
+}
+
+func TestGrafanaPoints(t *testing.T) {
+	from := time.Now()
+	to := from.Add(time.Hour)
+	tests := []struct {
+		name  string
+		query dtos.GrafanaQuery
+		want  int64
+	}{
+		{"default", dtos.GrafanaQuery{}, grafanaDefaultPoints},
+		{"interval", dtos.GrafanaQuery{IntervalMs: 60000}, 60},
+		{"limited by max data points", dtos.GrafanaQuery{IntervalMs: 1000, MaxDataPoints: 100}, 100},
+		{"interval longer than range", dtos.GrafanaQuery{IntervalMs: 7200000}, 1},
+	}
+
+	for _, v := range tests {
+		if got := grafanaPoints(&v.query, from, to); got != v.want {
+			t.Errorf("%s: expected %d, got %d", v.name, v.want, got)
+		}
+	}
+}
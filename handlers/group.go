@@ -9,6 +9,7 @@ import (
 	"github.com/tryffel/fusio/storage/repository"
 	"github.com/tryffel/fusio/util"
 	"net/http"
+	"time"
 )
 
 // GroupDTO Group to expose on api
@@ -188,6 +189,49 @@ func (h *Handler) AddDeviceToGroup(w http.ResponseWriter, r *http.Request) {
 	JsonMessage(w, "Status", "Ok")
 }
 
+// RemoveDeviceFromGroup removes devices from group. Measurements of removed devices are no longer
+// included in group
+func (h *Handler) RemoveDeviceFromGroup(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "user")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	if user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	groupId := mux.Vars(r)["id"]
+	if !util.IsUuid(groupId) {
+		JsonErrorResponse(w, ResponseInvalidId, http.StatusBadRequest)
+		return
+	}
+
+	dto := dtos.IdList{}
+	err = dtos.Validate(w, r, &dto)
+	if err != nil {
+		return
+	}
+
+	group, err := h.Store.Group.FindByOwnerAndId(user.ID, groupId)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "group")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.Store.Group.RemoveDevices(group, dto.Ids)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "device")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+
+	JsonMessage(w, "Status", "Ok")
+}
+
 func (h *Handler) GetGroupMeasurements(w http.ResponseWriter, r *http.Request) {
 	user, err := h.getUser(r)
 	if user == nil {
@@ -265,7 +309,17 @@ func (h *Handler) GetGroupDevices(w http.ResponseWriter, r *http.Request) {
 	}
 
 	group := mux.Vars(r)["id"]
-	devices, err := h.Store.Group.GetDevices(user.ID, group)
+	var devices *[]string
+	if at := r.URL.Query().Get("at"); at != "" {
+		timestamp, e := time.Parse(time.RFC3339, at)
+		if e != nil {
+			JsonErrorResponse(w, "Invalid timestamp, must be RFC3339", http.StatusBadRequest)
+			return
+		}
+		devices, err = h.Store.Group.GetDevicesAt(user.ID, group, timestamp)
+	} else {
+		devices, err = h.Store.Group.GetDevices(user.ID, group)
+	}
 	if err != nil {
 		e := Err.Wrap(&err, "Failed to get group devices")
 		Err.Log(e)
@@ -275,3 +329,37 @@ func (h *Handler) GetGroupDevices(w http.ResponseWriter, r *http.Request) {
 	logrus.Infof("Found %d devices", len(*devices))
 	JsonResponse(w, dtos.IdList{Ids: *devices})
 }
+
+// GetGroupMeasurementCatalog sends last value, last timestamp, point count and unit of each measurement in group
+func (h *Handler) GetGroupMeasurementCatalog(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "group")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	access, err := h.Store.Group.UserHasAccess(user.ID, []string{id})
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "group")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	if !access {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	catalog, err := h.Store.Measurement.GetGroupCatalog(id)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "measurement")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	JsonResponse(w, dtos.MeasurementInfoToDto(catalog))
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/tryffel/fusio/err"
+	"github.com/tryffel/fusio/storage/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	historyDefaultLimit = 100
+	historyMaxLimit     = 1000
+)
+
+// HistoryItemDto is history item with its alarm and duration
+type HistoryItemDto struct {
+	Id        uint   `json:"id"`
+	Alarm     string `json:"alarm"`
+	AlarmName string `json:"alarm_name"`
+	State     string `json:"state"`
+	// Duration in seconds from fire to clear. Duration of fired item is counted until now
+	Duration float64 `json:"duration"`
+	AlarmHistoryDto
+}
+
+type HistoryPageDto struct {
+	Items []HistoryItemDto `json:"items"`
+	// NextCursor is passed as cursor to get next page. Empty on last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func historyState(h *models.AlarmHistory) string {
+	if h.Cleared {
+		return models.HistoryCleared
+	}
+	if h.Acknowledged {
+		return models.HistoryAcknowledged
+	}
+	return models.HistoryFired
+}
+
+func historyItemToDto(h *models.AlarmHistory, alarmName string, now time.Time) HistoryItemDto {
+	end := now
+	if h.Cleared {
+		end = h.ClearedAt
+	}
+	return HistoryItemDto{
+		Id:              h.ID,
+		Alarm:           h.AlarmId,
+		AlarmName:       alarmName,
+		State:           historyState(h),
+		Duration:        end.Sub(h.FiredAt).Seconds(),
+		AlarmHistoryDto: *AlarmHistoryToDto(h),
+	}
+}
+
+// parseHistoryQuery reads history filters from url parameters:
+// alarm, group, from, to (RFC3339), state, severity (comma separated), cursor and limit
+func parseHistoryQuery(r *http.Request, ownerId uint) (*models.AlarmHistoryQuery, error) {
+	params := r.URL.Query()
+	q := &models.AlarmHistoryQuery{
+		OwnerId: ownerId,
+		AlarmId: params.Get("alarm"),
+		GroupId: params.Get("group"),
+		State:   params.Get("state"),
+		Limit:   historyDefaultLimit,
+	}
+
+	var err error
+	if from := params.Get("from"); from != "" {
+		q.From, err = time.Parse(time.RFC3339, from)
+		if err != nil {
+			return q, fmt.Errorf("invalid from: %s", from)
+		}
+	}
+	if to := params.Get("to"); to != "" {
+		q.To, err = time.Parse(time.RFC3339, to)
+		if err != nil {
+			return q, fmt.Errorf("invalid to: %s", to)
+		}
+	}
+	switch q.State {
+	case "", models.HistoryFired, models.HistoryAcknowledged, models.HistoryCleared:
+	default:
+		return q, fmt.Errorf("state must be one of fired, acknowledged, cleared")
+	}
+	if severities := params.Get("severity"); severities != "" {
+		for _, v := range strings.Split(severities, ",") {
+			severity, err := models.ParseSeverity(strings.TrimSpace(v))
+			if err != nil {
+				return q, err
+			}
+			q.Severities = append(q.Severities, severity)
+		}
+	}
+	if cursor := params.Get("cursor"); cursor != "" {
+		c, err := strconv.ParseUint(cursor, 10, 32)
+		if err != nil {
+			return q, fmt.Errorf("invalid cursor: %s", cursor)
+		}
+		q.Cursor = uint(c)
+	}
+	if limit := params.Get("limit"); limit != "" {
+		q.Limit, err = strconv.Atoi(limit)
+		if err != nil || q.Limit < 1 || q.Limit > historyMaxLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", historyMaxLimit)
+		}
+	}
+	return q, nil
+}
+
+// GetAlarmHistory returns history of all users alarms, newest first. With format=csv all matching items are
+// exported as csv file, otherwise items are paginated with cursor
+func (h *Handler) GetAlarmHistory(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if err != nil || user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	query, err := parseHistoryQuery(r, user.ID)
+	if err != nil {
+		JsonErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	alarms, err := h.Store.Alarm.FindByOwner(int(user.ID))
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "alarm")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	names := make(map[string]string, len(*alarms))
+	for _, v := range *alarms {
+		names[v.ID] = v.Name
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		h.exportAlarmHistory(w, query, names)
+		return
+	}
+
+	// Read one extra item to know whether there's next page
+	limit := query.Limit
+	query.Limit += 1
+	history, err := h.Store.Alarm.QueryHistory(query)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "alarm history")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	page := HistoryPageDto{Items: make([]HistoryItemDto, 0, limit)}
+	for i, v := range *history {
+		if i == limit {
+			page.NextCursor = strconv.FormatUint(uint64(page.Items[i-1].Id), 10)
+			break
+		}
+		page.Items = append(page.Items, historyItemToDto(&v, names[v.AlarmId], now))
+	}
+	JsonResponse(w, page)
+}
+
+// exportAlarmHistory writes all history items matching query as csv
+func (h *Handler) exportAlarmHistory(w http.ResponseWriter, query *models.AlarmHistoryQuery, names map[string]string) {
+	query.Limit = historyMaxLimit
+	history, err := h.Store.Alarm.QueryHistory(query)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "alarm history")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"alarm-history.csv\"")
+	out := csv.NewWriter(w)
+	out.Write([]string{"id", "alarm_id", "alarm_name", "device_id", "severity", "state", "value", "fired_at",
+		"cleared_at", "duration_seconds", "acked_by", "acked_at", "ack_comment", "inhibited_by"})
+
+	now := time.Now()
+	formatTime := func(t *time.Time) string {
+		if t == nil || t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	for len(*history) > 0 {
+		for _, v := range *history {
+			item := historyItemToDto(&v, names[v.AlarmId], now)
+			acked := ""
+			if item.AckedBy > 0 {
+				acked = strconv.FormatUint(uint64(item.AckedBy), 10)
+			}
+			out.Write([]string{
+				strconv.FormatUint(uint64(item.Id), 10),
+				item.Alarm,
+				item.AlarmName,
+				item.Device,
+				item.Severity,
+				item.State,
+				item.Value,
+				formatTime(&item.FiredAt),
+				formatTime(&item.ClearedAt),
+				strconv.FormatFloat(item.Duration, 'f', 0, 64),
+				acked,
+				formatTime(item.AckedAt),
+				item.AckComment,
+				item.InhibitedBy,
+			})
+		}
+		if len(*history) < query.Limit {
+			break
+		}
+		query.Cursor = (*history)[len(*history)-1].ID
+		history, err = h.Store.Alarm.QueryHistory(query)
+		if err != nil {
+			// Headers are already sent
+			Err.Log(err)
+			break
+		}
+	}
+	out.Flush()
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/tryffel/fusio/dtos"
+	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/util"
+	"net/http"
+)
+
+// CreateInhibitRule creates dependency rule where fired source alarm inhibits outputs of child alarms
+func (h *Handler) CreateInhibitRule(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if err != nil || user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	dto := &dtos.NewInhibitRule{}
+	err = dtos.Validate(w, r, dto)
+	if err != nil {
+		return
+	}
+
+	rule, err := dto.ToInhibitRule()
+	if err != nil {
+		JsonErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rule.OwnerId = user.ID
+
+	for _, id := range []string{rule.SourceAlarmId, rule.TargetAlarmId} {
+		if id == "" {
+			continue
+		}
+		alarm, err := h.Store.Alarm.FindByOwnerAndId(id, int(user.ID))
+		if err != nil || alarm.ID == "" {
+			JsonErrorResponse(w, "Alarm not found", http.StatusBadRequest)
+			return
+		}
+	}
+	if !h.alarmTargetAccess(user.ID, &models.Alarm{Group: rule.TargetGroupId}) {
+		JsonErrorResponse(w, "Group not found", http.StatusBadRequest)
+		return
+	}
+
+	err = h.Store.Inhibit.Create(rule)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "inhibit rule")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	JsonResponse(w, dtos.InhibitRuleToDto(rule))
+}
+
+func (h *Handler) GetInhibitRules(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if err != nil || user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	rules, err := h.Store.Inhibit.FindByOwner(user.ID)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "inhibit rule")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dto := make([]dtos.InhibitRule, len(*rules))
+	for i := range *rules {
+		dto[i] = *dtos.InhibitRuleToDto(&(*rules)[i])
+	}
+	JsonResponse(w, dto)
+}
+
+func (h *Handler) DeleteInhibitRule(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if err != nil || user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	if !util.IsUuid(id) {
+		JsonErrorResponse(w, ResponseInvalidId, http.StatusBadRequest)
+		return
+	}
+
+	rule, err := h.Store.Inhibit.FindByOwnerAndId(user.ID, id)
+	if err != nil || rule.ID == "" {
+		JsonErrorResponse(w, ResponseNotFound, http.StatusNotFound)
+		return
+	}
+
+	err = h.Store.Inhibit.Remove(rule)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "inhibit rule")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	JsonResponseDeleted(w)
+}
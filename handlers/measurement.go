@@ -54,9 +54,21 @@ func (h *Handler) GetMeasurement(w http.ResponseWriter, r *http.Request) {
 		number = 1
 	}
 
+	opts, err := Influxdb.ParseFill(r.URL.Query().Get("fill"))
+	if err != nil {
+		JsonErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts.Window, opts.Location, err = Influxdb.ParseWindow(r.URL.Query().Get("window"), r.URL.Query().Get("tz"))
+	if err != nil {
+		JsonErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	filter, err := Influxdb.FilterFromString(fmt.Sprintf("%s(%s)", aggregation, measurementName))
 	if err != nil {
-		JsonErrorResponse(w, ResponseInvalidBody, http.StatusBadRequest)
+		JsonErrorResponse(w, fmt.Sprintf("Invalid aggregation: %s", err.Error()), http.StatusBadRequest)
 		return
 	}
 
@@ -66,7 +78,7 @@ func (h *Handler) GetMeasurement(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	m, err := h.Store.Measurement.Read(device.ID, "", *filter, time.Now().Add(-duration), time.Now(), number)
+	m, err := h.Store.Measurement.Read(r.Context(), device.ID, "", *filter, time.Now().Add(-duration), time.Now(), number, opts)
 	if err != nil {
 		JsonErrorResponse(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/tryffel/fusio/dtos"
+	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/util"
+	"net/http"
+	"time"
+)
+
+// CreateSilence creates silence that suppresses outputs of matching alarms
+func (h *Handler) CreateSilence(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if err != nil || user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	dto := &dtos.NewSilence{}
+	err = dtos.Validate(w, r, dto)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	silence, err := dto.ToSilence(now)
+	if err != nil {
+		JsonErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	silence.OwnerId = user.ID
+
+	if silence.AlarmId != "" {
+		alarm, err := h.Store.Alarm.FindByOwnerAndId(silence.AlarmId, int(user.ID))
+		if err != nil || alarm.ID == "" {
+			JsonErrorResponse(w, "Alarm not found", http.StatusBadRequest)
+			return
+		}
+	}
+	if !h.alarmTargetAccess(user.ID, &models.Alarm{Group: silence.GroupId, DeviceId: silence.DeviceId}) {
+		JsonErrorResponse(w, "Group or device not found", http.StatusBadRequest)
+		return
+	}
+
+	err = h.Store.Silence.Create(silence)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "silence")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	JsonResponse(w, dtos.SilenceToDto(silence, now))
+}
+
+// GetSilences returns active and upcoming silences. Optional query parameter 'state' filters by state
+func (h *Handler) GetSilences(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if err != nil || user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	state := r.URL.Query().Get("state")
+	switch state {
+	case "", models.SilenceActive, models.SilenceUpcoming:
+	default:
+		JsonErrorResponse(w, "state must be one of active, upcoming", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	silences, err := h.Store.Silence.FindByOwner(user.ID, now)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "silence")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dto := make([]dtos.Silence, 0, len(*silences))
+	for i := range *silences {
+		silence := dtos.SilenceToDto(&(*silences)[i], now)
+		if state == "" || silence.State == state {
+			dto = append(dto, *silence)
+		}
+	}
+	JsonResponse(w, dto)
+}
+
+// ExpireSilence ends silence immediately
+func (h *Handler) ExpireSilence(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if err != nil || user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	if !util.IsUuid(id) {
+		JsonErrorResponse(w, ResponseInvalidId, http.StatusBadRequest)
+		return
+	}
+
+	silence, err := h.Store.Silence.FindByOwnerAndId(user.ID, id)
+	if err != nil || silence.ID == "" {
+		JsonErrorResponse(w, ResponseNotFound, http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+	if silence.State(now) == models.SilenceExpired {
+		JsonErrorResponse(w, "Silence has already expired", http.StatusConflict)
+		return
+	}
+
+	err = h.Store.Silence.Expire(silence, now)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "silence")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	JsonResponseUpdated(w, nil)
+}
@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/tryffel/fusio/dtos"
+	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/storage/repository"
+	"github.com/tryffel/fusio/util"
+	"net/http"
+)
+
+// CreateAlarmTemplate creates template that alarms can be instantiated from
+func (h *Handler) CreateAlarmTemplate(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if err != nil || user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	dto := &dtos.NewAlarmTemplate{}
+	err = dtos.Validate(w, r, dto)
+	if err != nil {
+		return
+	}
+	template, err := dto.ToTemplate()
+	if err != nil {
+		JsonErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	template.OwnerId = user.ID
+	if !h.templateAccess(user.ID, template) {
+		JsonErrorResponse(w, "Escalation policy or output channel not found", http.StatusBadRequest)
+		return
+	}
+
+	err = h.Store.AlarmTemplate.Create(template)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "alarm template")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	JsonMessage(w, "template", template.ID)
+}
+
+// GetAlarmTemplates returns users templates with number of alarms created from them
+func (h *Handler) GetAlarmTemplates(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUser(r)
+	if err != nil || user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return
+	}
+
+	templates, err := h.Store.AlarmTemplate.FindByOwner(user.ID)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "alarm template")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dto := make([]*dtos.AlarmTemplate, len(*templates))
+	for i, v := range *templates {
+		alarms, err := h.Store.AlarmTemplate.GetAlarms(&v)
+		if err != nil {
+			friendly := h.Store.Errors.GetUserFriendlyError(err, "alarm")
+			JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+			return
+		}
+		dto[i] = dtos.AlarmTemplateToDto(&v, len(*alarms))
+	}
+	JsonResponse(w, dto)
+}
+
+// GetAlarmTemplate returns template with ids of alarms created from it
+func (h *Handler) GetAlarmTemplate(w http.ResponseWriter, r *http.Request) {
+	template := h.getUserAlarmTemplate(w, r)
+	if template == nil {
+		return
+	}
+
+	alarms, err := h.Store.AlarmTemplate.GetAlarms(template)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "alarm")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	ids := make([]string, len(*alarms))
+	for i, v := range *alarms {
+		ids[i] = v.ID
+	}
+	JsonResponse(w, map[string]interface{}{
+		"template": dtos.AlarmTemplateToDto(template, len(*alarms)),
+		"alarms":   ids,
+	})
+}
+
+// UpdateAlarmTemplate replaces template with request body. With propagate=true, alarms created from template
+// and their outputs are updated too. Name, group, device and enabled of each alarm are kept.
+// Scope can only be changed while template has no alarms.
+func (h *Handler) UpdateAlarmTemplate(w http.ResponseWriter, r *http.Request) {
+	existing := h.getUserAlarmTemplate(w, r)
+	if existing == nil {
+		return
+	}
+
+	dto := &dtos.NewAlarmTemplate{}
+	err := dtos.Validate(w, r, dto)
+	if err != nil {
+		return
+	}
+	template, err := dto.ToTemplate()
+	if err != nil {
+		JsonErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	template.ID = existing.ID
+	template.OwnerId = existing.OwnerId
+	template.CreatedAt = existing.CreatedAt
+	if !h.templateAccess(template.OwnerId, template) {
+		JsonErrorResponse(w, "Escalation policy or output channel not found", http.StatusBadRequest)
+		return
+	}
+
+	alarms, err := h.Store.AlarmTemplate.GetAlarms(template)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "alarm")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	// Alarms are bound to groups or devices of their scope
+	if template.Scope != existing.Scope && len(*alarms) > 0 {
+		JsonErrorResponse(w, "Scope of template with alarms cannot be changed", http.StatusBadRequest)
+		return
+	}
+
+	err = h.Store.AlarmTemplate.Update(template)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "alarm template")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.URL.Query().Get("propagate") != "true" {
+		JsonResponseUpdated(w, nil)
+		return
+	}
+
+	updated := make([]string, 0, len(*alarms))
+	errs := make(map[string]string)
+	for _, v := range *alarms {
+		err = h.applyTemplate(template, &v)
+		if err != nil {
+			errs[v.ID] = h.Store.Errors.GetUserFriendlyError(err, "alarm").Error()
+		} else {
+			updated = append(updated, v.ID)
+		}
+	}
+	JsonResponseUpdated(w, &ResponseBody{"alarms": updated, "errors": errs})
+}
+
+// DeleteAlarmTemplate deletes template. Alarms created from it are kept
+func (h *Handler) DeleteAlarmTemplate(w http.ResponseWriter, r *http.Request) {
+	template := h.getUserAlarmTemplate(w, r)
+	if template == nil {
+		return
+	}
+
+	err := h.Store.AlarmTemplate.Remove(template)
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "alarm template")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+	JsonResponseDeleted(w)
+}
+
+// InstantiateAlarmTemplate creates alarm with outputs from template for each group or device in request.
+// Returns ids of created alarms and errors by group or device
+func (h *Handler) InstantiateAlarmTemplate(w http.ResponseWriter, r *http.Request) {
+	template := h.getUserAlarmTemplate(w, r)
+	if template == nil {
+		return
+	}
+
+	dto := &dtos.TemplateTargets{}
+	err := dtos.Validate(w, r, dto)
+	if err != nil {
+		return
+	}
+	targets, err := dto.Targets(template.Scope)
+	if err != nil {
+		JsonErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created := make(map[string]string)
+	errs := make(map[string]string)
+	for _, target := range targets {
+		alarm, err := h.createTemplateAlarm(template, target)
+		if err != nil {
+			errs[target] = h.Store.Errors.GetUserFriendlyError(err, "alarm").Error()
+		} else {
+			created[target] = alarm.ID
+		}
+	}
+	JsonResponseCreated(w, &ResponseBody{"alarms": created, "errors": errs})
+}
+
+// GetAlarmTemplateDiff returns fields where alarm and its outputs differ from its template
+func (h *Handler) GetAlarmTemplateDiff(w http.ResponseWriter, r *http.Request) {
+	alarm := h.getUserAlarm(w, r)
+	if alarm == nil {
+		return
+	}
+	if alarm.TemplateId == "" {
+		JsonErrorResponse(w, "Alarm is not created from template", http.StatusBadRequest)
+		return
+	}
+
+	template, err := h.Store.AlarmTemplate.FindByOwnerAndId(alarm.OwnerId, alarm.TemplateId)
+	if err != nil || template.ID == "" {
+		JsonErrorResponse(w, ResponseNotFound, http.StatusNotFound)
+		return
+	}
+	outputs, err := h.Store.Output.FindByAlarm(alarm.ID, repository.OutputOpts{})
+	if err != nil {
+		friendly := h.Store.Errors.GetUserFriendlyError(err, "output")
+		JsonErrorResponse(w, friendly.Error(), http.StatusBadRequest)
+		return
+	}
+
+	diff, err := dtos.DiffAlarm(template, alarm, outputs)
+	if err != nil {
+		JsonErrorResponse(w, ResponseInternalError, http.StatusInternalServerError)
+		return
+	}
+	JsonResponse(w, map[string]interface{}{
+		"template": template.ID,
+		"diff":     diff,
+	})
+}
+
+func (h *Handler) getUserAlarmTemplate(w http.ResponseWriter, r *http.Request) *models.AlarmTemplate {
+	user, err := h.getUser(r)
+	if err != nil || user == nil {
+		JsonErrorResponse(w, ResponseUnauthorized, http.StatusForbidden)
+		return nil
+	}
+
+	id := mux.Vars(r)["id"]
+	if !util.IsUuid(id) {
+		JsonErrorResponse(w, ResponseInvalidId, http.StatusBadRequest)
+		return nil
+	}
+
+	template, err := h.Store.AlarmTemplate.FindByOwnerAndId(user.ID, id)
+	if err != nil || template.ID == "" {
+		JsonErrorResponse(w, ResponseNotFound, http.StatusNotFound)
+		return nil
+	}
+	return template
+}
+
+// templateAccess returns true if user owns escalation policy and output channels of template
+func (h *Handler) templateAccess(userId uint, template *models.AlarmTemplate) bool {
+	if !h.escalationAccess(userId, template.EscalationPolicyId) {
+		return false
+	}
+	for _, v := range template.Outputs {
+		channel, err := h.Store.OutputChannel.FindbyOwnerAndId(userId, v.OutputChannelId)
+		if err != nil || channel.ID == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// createTemplateAlarm creates alarm with outputs from template for group or device.
+// Alarms of device templates are named after their device to keep names unique
+func (h *Handler) createTemplateAlarm(template *models.AlarmTemplate, target string) (*models.Alarm, error) {
+	var alarm *models.Alarm
+	if template.Scope == models.ScopeDevice {
+		alarm = template.ToAlarm("", target)
+	} else {
+		alarm = template.ToAlarm(target, "")
+	}
+	if !h.alarmTargetAccess(template.OwnerId, alarm) {
+		return alarm, errors.New("group or device not found")
+	}
+	if template.Scope == models.ScopeDevice {
+		device, err := h.Store.Device.GetById(target)
+		if err != nil {
+			return alarm, err
+		}
+		alarm.Name += " - " + device.Name
+	}
+
+	err := h.Store.AlarmTemplate.CreateAlarm(template, alarm)
+	return alarm, err
+}
+
+// applyTemplate updates alarm and its outputs from template. Name, group, device and enabled of alarm are kept.
+// Outputs are matched by name, missing outputs are created and other outputs are left as they are
+func (h *Handler) applyTemplate(template *models.AlarmTemplate, existing *models.Alarm) error {
+	alarm := template.ToAlarm(existing.Group, existing.DeviceId)
+	alarm.Name = existing.Name
+	alarm.Enabled = existing.Enabled
+	err := h.updateAlarm(existing, alarm)
+	if err != nil {
+		return err
+	}
+
+	outputs, err := h.Store.Output.FindByAlarm(alarm.ID, repository.OutputOpts{})
+	if err != nil {
+		return err
+	}
+	for _, v := range template.Outputs {
+		output := v.ToOutput(alarm)
+		for _, e := range *outputs {
+			if e.Name == v.Name {
+				output.ID = e.ID
+				output.Enabled = e.Enabled
+				output.OnFire = e.OnFire
+				output.OnClear = e.OnClear
+				output.OnError = e.OnError
+				output.LastPushed = e.LastPushed
+				output.CreatedAt = e.CreatedAt
+				break
+			}
+		}
+		if output.ID == "" {
+			err = h.Store.Output.Create(output)
+		} else {
+			err = h.Store.Output.Update(output)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
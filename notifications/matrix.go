@@ -1,6 +1,7 @@
 package notifications
 
 import (
+	"context"
 	"fmt"
 	"github.com/tryffel/fusio/err"
 	"time"
@@ -13,7 +14,7 @@ type Matrix struct {
 }
 
 // Notify pushes data to matrix chat as text message
-func (m *Matrix) Notify(data string) error {
+func (m *Matrix) Notify(ctx context.Context, data string) error {
 	txid := time.Now().Nanosecond() % 1000
 	url := fmt.Sprintf("%s/_matrix/client/r0/rooms/%s/send/m.room.message/%d", m.Host, m.RoomId, txid)
 	auth := fmt.Sprintf("Bearer %s", m.Token)
@@ -27,7 +28,7 @@ func (m *Matrix) Notify(data string) error {
 	hook.Headers.ContentType = "application/json"
 
 	body := fmt.Sprintf(`{"msgtype": "m.text", "body": "%s"}`, data)
-	err := hook.Notify(body)
+	err := hook.Notify(ctx, body)
 	if err == nil {
 		return nil
 	}
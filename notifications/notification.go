@@ -1,14 +1,23 @@
 package notifications
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/sirupsen/logrus"
 	"github.com/tryffel/fusio/err"
+	"net/http"
+	"time"
 )
 
+// Timeout of single output request, so that unresponsive endpoint doesn't block alarm evaluation
+const RequestTimeout = time.Second * 10
+
+var httpClient = &http.Client{Timeout: RequestTimeout}
+
 type Notifier interface {
-	Notify(data string) error
+	// Notify pushes data to output. Request is cancelled once ctx is done
+	Notify(ctx context.Context, data string) error
 }
 
 // Parse type and return notifier
@@ -2,6 +2,7 @@ package notifications
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/tryffel/fusio/err"
@@ -15,19 +16,19 @@ type Telegram struct {
 	ChatId string `json:"chat_id"`
 }
 
-func (t *Telegram) Notify(data string) error {
+func (t *Telegram) Notify(ctx context.Context, data string) error {
 	body := bytes.NewBufferString(data)
-	req, err := http.NewRequest("post", fmt.Sprintf(urlFmt, t.BotKey), body)
+	req, err := http.NewRequestWithContext(ctx, "post", fmt.Sprintf(urlFmt, t.BotKey), body)
 	if err != nil {
 		return err
 	}
 
 	req.Header.Add("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return &Err.Error{Code: Err.Econflict, Err: errors.Wrap(err, "failed to create request for telegram message")}
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode == 200 {
 		return nil
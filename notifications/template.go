@@ -21,6 +21,15 @@ type Notification struct {
 	GroupId       string
 	GroupName     string
 	Error         string
+	// Severity alarm fired with: info, warning or critical
+	Severity string
+	// Device is set for device and per-device alarms
+	DeviceId   string
+	DeviceName string
+	// Occurrence is number of fire notification, 1 for first push and increasing on repeats
+	Occurrence int
+	// Elapsed is time since alarm fired, e.g. '1h30m0s'
+	Elapsed string
 }
 
 func (n *Notification) Parse(tmpl string) (string, error) {
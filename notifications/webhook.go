@@ -2,6 +2,7 @@ package notifications
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -24,12 +25,12 @@ type WebHook struct {
 	ExpectCode uint   `json:"expect_status_code"`
 }
 
-func (h *WebHook) Notify(data string) error {
+func (h *WebHook) Notify(ctx context.Context, data string) error {
 	body := bytes.NewBufferString(data)
 	uri, err := url.Parse(h.Url)
 
 	encoded := fmt.Sprintf("%s://%s%s", uri.Scheme, uri.Host, uri.EscapedPath())
-	req, err := http.NewRequest(strings.ToUpper(h.Method), encoded, body)
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(h.Method), encoded, body)
 	if err != nil {
 		return &Err.Error{Code: Err.Econflict, Err: errors.Wrap(err, "failed to build request")}
 	}
@@ -41,18 +42,17 @@ func (h *WebHook) Notify(data string) error {
 		req.Header.Add("Authorization", h.Headers.Authorization)
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-
-	if err == nil && uint(resp.StatusCode) == h.ExpectCode {
-		return nil
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return &Err.Error{Code: Err.Econflict, Err: errors.Wrap(err, "webhook failed")}
 	}
+	defer resp.Body.Close()
 
-	if err != nil {
-		return &Err.Error{Code: Err.Econflict, Err: errors.Wrapf(err, "webhook failed. Statuscode: %d,", resp.StatusCode)}
+	if uint(resp.StatusCode) == h.ExpectCode {
+		return nil
 	}
 
 	out, _ := ioutil.ReadAll(resp.Body)
 	logrus.Error(string(out))
-	return &Err.Error{Code: Err.Econflict, Err: errors.Wrapf(err, "webhook failed. Statuscode: %d, body:'%s'", resp.StatusCode, out)}
+	return &Err.Error{Code: Err.Econflict, Err: errors.Errorf("webhook failed. Statuscode: %d, body:'%s'", resp.StatusCode, out)}
 }
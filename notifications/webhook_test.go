@@ -1,6 +1,7 @@
 package notifications
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -44,7 +45,7 @@ func TestWebHook_NotifyPost(t *testing.T) {
 	hook.Headers.Authorization = "Bearer abcd1"
 	hook.Headers.ContentType = "application/json"
 
-	err := hook.Notify(data)
+	err := hook.Notify(context.Background(), data)
 	if err != nil {
 		t.Error(err)
 	}
@@ -37,19 +37,61 @@ func (s *Service) CreateRoutes() {
 	s.ApiRouter.HandleFunc("/groups/{id:[0-9a-zA-Z-]{36}}", s.Handler.GetGroupById).Methods("GET")
 	s.ApiRouter.HandleFunc("/groups", s.Handler.CreateGroup).Methods("POST")
 	s.ApiRouter.HandleFunc("/groups/{id}/devices", s.Handler.AddDeviceToGroup).Methods("POST")
+	s.ApiRouter.HandleFunc("/groups/{id}/devices", s.Handler.RemoveDeviceFromGroup).Methods("DELETE")
 	s.ApiRouter.HandleFunc("/groups/{id:[0-9a-zA-Z-]{36}}/devices", s.Handler.GetGroupDevices).Methods("GET")
 	s.ApiRouter.HandleFunc("/groups/{id}/measurements", s.Handler.GetGroupMeasurements).Methods("GET")
+	s.ApiRouter.HandleFunc("/groups/{id}/measurements/catalog", s.Handler.GetGroupMeasurementCatalog).Methods("GET")
 
 	/* DEVICES */
 	s.ApiRouter.HandleFunc("/devices", s.Handler.GetDevices).Methods("GET")
 	s.ApiRouter.HandleFunc("/devices/{id}", s.Handler.GetDeviceById).Methods("GET")
 	s.ApiRouter.HandleFunc("/devices", s.Handler.AddDevice).Methods("POST")
 	s.ApiRouter.HandleFunc("/devices/{id}/measurements", s.Handler.GetDeviceMeasurements).Methods("GET")
+	s.ApiRouter.HandleFunc("/devices/{id}/measurements/catalog", s.Handler.GetDeviceMeasurementCatalog).Methods("GET")
+	s.ApiRouter.HandleFunc("/devices/{id}/measurements/{key}/unit", s.Handler.SetMeasurementUnit).Methods("PUT")
 
 	/* ALARMS */
 	s.ApiRouter.HandleFunc("/alarms", s.Handler.CreateAlarm).Methods("POST")
 	s.ApiRouter.HandleFunc("/alarms", s.Handler.GetAlarms).Methods("GET")
+	s.ApiRouter.HandleFunc("/alarms/backtest", s.Handler.BacktestAlarm).Methods("POST")
+	s.ApiRouter.HandleFunc("/alarms/history", s.Handler.GetAlarmHistory).Methods("GET")
 	s.ApiRouter.HandleFunc("/alarms/alarm/{id}", s.Handler.GetAlarmById).Methods("GET")
+	s.ApiRouter.HandleFunc("/alarms/alarm/{id}", s.Handler.UpdateAlarm).Methods("PUT")
+	s.ApiRouter.HandleFunc("/alarms/alarm/{id}", s.Handler.PatchAlarm).Methods("PATCH")
+	s.ApiRouter.HandleFunc("/alarms/alarm/{id}", s.Handler.DeleteAlarm).Methods("DELETE")
+	s.ApiRouter.HandleFunc("/alarms/alarm/{id}/enable", s.Handler.EnableAlarm).Methods("POST")
+	s.ApiRouter.HandleFunc("/alarms/alarm/{id}/disable", s.Handler.DisableAlarm).Methods("POST")
+	s.ApiRouter.HandleFunc("/alarms/alarm/{id}/ack", s.Handler.AcknowledgeAlarm).Methods("POST")
+	s.ApiRouter.HandleFunc("/alarms/alarm/{id}/ack", s.Handler.UnacknowledgeAlarm).Methods("DELETE")
+	s.ApiRouter.HandleFunc("/alarms/alarm/{id}/diff", s.Handler.GetAlarmTemplateDiff).Methods("GET")
+	s.ApiRouter.HandleFunc("/alarms/alarm/{id}/transitions", s.Handler.GetAlarmTransitions).Methods("GET")
+
+	/* ALARM TEMPLATES */
+	s.ApiRouter.HandleFunc("/alarms/templates", s.Handler.CreateAlarmTemplate).Methods("POST")
+	s.ApiRouter.HandleFunc("/alarms/templates", s.Handler.GetAlarmTemplates).Methods("GET")
+	s.ApiRouter.HandleFunc("/alarms/templates/{id}", s.Handler.GetAlarmTemplate).Methods("GET")
+	s.ApiRouter.HandleFunc("/alarms/templates/{id}", s.Handler.UpdateAlarmTemplate).Methods("PUT")
+	s.ApiRouter.HandleFunc("/alarms/templates/{id}", s.Handler.DeleteAlarmTemplate).Methods("DELETE")
+	s.ApiRouter.HandleFunc("/alarms/templates/{id}/instances", s.Handler.InstantiateAlarmTemplate).Methods("POST")
+
+	/* ESCALATION POLICIES */
+	s.ApiRouter.HandleFunc("/alarms/escalations", s.Handler.CreateEscalationPolicy).Methods("POST")
+	s.ApiRouter.HandleFunc("/alarms/escalations", s.Handler.GetEscalationPolicies).Methods("GET")
+	s.ApiRouter.HandleFunc("/alarms/escalations/{id}", s.Handler.UpdateEscalationPolicy).Methods("PUT")
+	s.ApiRouter.HandleFunc("/alarms/escalations/{id}", s.Handler.DeleteEscalationPolicy).Methods("DELETE")
+
+	/* INHIBIT RULES */
+	s.ApiRouter.HandleFunc("/alarms/inhibitions", s.Handler.CreateInhibitRule).Methods("POST")
+	s.ApiRouter.HandleFunc("/alarms/inhibitions", s.Handler.GetInhibitRules).Methods("GET")
+	s.ApiRouter.HandleFunc("/alarms/inhibitions/{id}", s.Handler.DeleteInhibitRule).Methods("DELETE")
+
+	/* SILENCES */
+	s.ApiRouter.HandleFunc("/silences", s.Handler.CreateSilence).Methods("POST")
+	s.ApiRouter.HandleFunc("/silences", s.Handler.GetSilences).Methods("GET")
+	s.ApiRouter.HandleFunc("/silences/{id}/expire", s.Handler.ExpireSilence).Methods("POST")
+
+	/* FORECAST */
+	s.ApiRouter.HandleFunc("/forecast", s.Handler.Forecast).Methods("POST")
 
 	/* OUTPUTS */
 	s.ApiRouter.HandleFunc("/alarms/outputs", s.Handler.CreateOutput).Methods("POST")
@@ -58,6 +100,14 @@ func (s *Service) CreateRoutes() {
 	/* SEARCH */
 	s.ApiRouter.HandleFunc("/groups/search", s.Handler.SearchGroupByName).Methods("GET")
 
+	/* GRAFANA */
+	s.ApiRouter.HandleFunc("/grafana", s.Handler.GrafanaTestConnection).Methods("GET")
+	s.ApiRouter.HandleFunc("/grafana/search", s.Handler.GrafanaSearch).Methods("POST")
+	s.ApiRouter.HandleFunc("/grafana/query", s.Handler.GrafanaQuery).Methods("POST")
+	s.ApiRouter.HandleFunc("/grafana/annotations", s.Handler.GrafanaAnnotations).Methods("POST")
+	s.ApiRouter.HandleFunc("/grafana/tag-keys", s.Handler.GrafanaTagKeys).Methods("POST")
+	s.ApiRouter.HandleFunc("/grafana/tag-values", s.Handler.GrafanaTagValues).Methods("POST")
+
 }
 
 func (s *Service) NewApiRouter() *mux.Router {
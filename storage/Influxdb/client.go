@@ -1,12 +1,14 @@
 // Influxdb driver
 // All measurements are saved as follows
 // field value is always 'measurementValue' to ease continuous queries
-// tags are device=id, groups=groupB<separator>groupB<separator>..., 'measurementKey'=measurement_name
+// tags are device=id, 'measurementKey'=measurement_name
+// Group membership is not stored in influxdb, instead groups are queried with set of devices
 //
 
 package Influxdb
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -23,23 +25,26 @@ const (
 	measurementValue = "value"
 	measurementKey   = "key"
 	deviceName       = "device"
-	groupName        = "group"
-	groupSeparator   = ";"
 	// Maximum size to return measurements for
 	maxHistorySize = 300
 
 	metricsMeasurement = "metrics"
 	metricsName        = "name"
+
+	// Maximum duration of single query. Read that is cancelled leaves its query running until this timeout
+	queryTimeout = time.Minute * 2
 )
 
 // Public interface for influxdb client
 type Client interface {
-	// Write measurements for given device and groups
+	// Write measurements for given device
 	// Measurements is map of measurement name to measurement value.
-	Write(device string, groups []string, m Measurements) error
+	Write(device string, m Measurements) error
 	// Read measurement return array of measurements as defined in inputs array. Measurements are
-	// gathered between from and to timestamps and max length is of n
-	Read(device string, group string, filters []Filter, from time.Time, to time.Time, n int64) (Batch, error)
+	// gathered between from and to timestamps and max length is of n. If opts is nil, defaults are used
+	// Points are combined from all given devices, if devices is empty, all devices are included.
+	// Read returns ctx error once ctx is done.
+	Read(ctx context.Context, devices []DeviceRange, filters []Filter, from time.Time, to time.Time, n int64, opts *ReadOpts) (Batch, error)
 
 	// Write metrics for given name
 	WriteMetrics(name string, value float64) error
@@ -49,8 +54,14 @@ type Client interface {
 	// Get Measurements for device
 	GetDeviceMeasurements(device string) ([]string, error)
 
-	// Get measurements for group
-	GetGroupMeasurements(group string) ([]string, error)
+	// Get measurements for multiple devices
+	GetDevicesMeasurements(devices []string) ([]string, error)
+
+	// GetKeyStatus gets last value for each key of device along with hourly point counts since given time
+	GetKeyStatus(device string, since time.Time) ([]KeyStatus, error)
+	// GetLastSeen gets time of newest point of each key from any of devices since given time. Range is limited
+	// to longest retention. Query is abandoned once ctx is done
+	GetLastSeen(ctx context.Context, devices []string, since time.Time) (map[string]time.Time, error)
 }
 
 type client struct {
@@ -63,6 +74,27 @@ type client struct {
 	databaseManager
 }
 
+// queryContext runs query until it finishes or ctx is done. Influxdb client can't cancel requests,
+// so query that outlives ctx is abandoned and finishes in background, at most after queryTimeout
+func (c *client) queryContext(ctx context.Context, q influx_client.Query) (*influx_client.Response, error) {
+	type result struct {
+		res *influx_client.Response
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		res, err := c.client.Query(q)
+		done <- result{res: res, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.res, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 func (c *client) GetDeviceMeasurements(device string) ([]string, error) {
 	query := fmt.Sprintf(`SHOW TAG VALUES WITH key="%s" WHERE "%s"='%s'`, measurementKey, deviceName, device)
 	q := influx_client.NewQuery(query, c.db, "")
@@ -79,8 +111,16 @@ func (c *client) GetDeviceMeasurements(device string) ([]string, error) {
 	return keyValueToArray(&res.Results)
 }
 
-func (c *client) GetGroupMeasurements(group string) ([]string, error) {
-	query := fmt.Sprintf(`SHOW TAG VALUES WITH key="%s" WHERE "%s"=~/.*%s.*/`, measurementKey, groupName, group)
+func (c *client) GetDevicesMeasurements(devices []string) ([]string, error) {
+	if len(devices) == 0 {
+		return []string{}, nil
+	}
+	ranges := make([]DeviceRange, len(devices))
+	for i, v := range devices {
+		ranges[i].Device = v
+	}
+
+	query := fmt.Sprintf(`SHOW TAG VALUES WITH key="%s" WHERE %s`, measurementKey, getDevicesClause(ranges))
 	q := influx_client.NewQuery(query, c.db, "")
 
 	res, err := c.client.Query(q)
@@ -99,7 +139,125 @@ func (c *client) GetGroupMeasurements(group string) ([]string, error) {
 	return keyValueToArray(&res.Results)
 }
 
-func (c *client) Write(device string, groups []string, measurements Measurements) error {
+func (c *client) GetKeyStatus(device string, since time.Time) ([]KeyStatus, error) {
+	query := fmt.Sprintf(`SELECT last("%s") FROM "%s" WHERE "%s"='%s' GROUP BY "%s"; `+
+		`SELECT count("%s") FROM "%s" WHERE "%s"='%s' AND time >= %ds GROUP BY "%s", time(1h) fill(none)`,
+		measurementValue, measurementName, deviceName, device, measurementKey,
+		measurementValue, measurementName, deviceName, device, since.Unix(), measurementKey)
+	q := influx_client.NewQuery(query, c.db, "s")
+
+	res, err := c.client.Query(q)
+	if err != nil {
+		c.logQuery(query, err, nil)
+		return []KeyStatus{}, err
+	}
+	if res.Error() != nil {
+		c.logQuery(query, res.Error(), &res.Results[0])
+		return []KeyStatus{}, res.Error()
+	}
+	if len(res.Results) != 2 {
+		return []KeyStatus{}, errors.New("mismatch of queries and results")
+	}
+
+	keys := make(map[string]*KeyStatus)
+	getKey := func(name string) *KeyStatus {
+		if keys[name] == nil {
+			keys[name] = &KeyStatus{Key: name, Counts: make(map[time.Time]int64)}
+		}
+		return keys[name]
+	}
+
+	for _, series := range res.Results[0].Series {
+		columns := columnsAsMap(series)
+		if len(series.Values) == 0 {
+			continue
+		}
+		row := series.Values[0]
+		status := getKey(series.Tags[measurementKey])
+		ts, _ := row[columns["time"]].(json.Number).Int64()
+		status.LastSeen = time.Unix(ts, 0)
+		if row[columns["last"]] != nil {
+			val, _ := row[columns["last"]].(json.Number).Float64()
+			status.LastValue = float32(val)
+		}
+	}
+
+	for _, series := range res.Results[1].Series {
+		columns := columnsAsMap(series)
+		status := getKey(series.Tags[measurementKey])
+		for _, row := range series.Values {
+			ts, _ := row[columns["time"]].(json.Number).Int64()
+			count, _ := row[columns["count"]].(json.Number).Int64()
+			status.Counts[time.Unix(ts, 0)] = count
+		}
+	}
+
+	result := make([]KeyStatus, 0, len(keys))
+	for _, v := range keys {
+		result = append(result, *v)
+	}
+	return result, nil
+}
+
+func (c *client) GetLastSeen(ctx context.Context, devices []string, since time.Time) (map[string]time.Time, error) {
+	seen := make(map[string]time.Time)
+	if len(devices) == 0 {
+		return seen, nil
+	}
+	ranges := make([]DeviceRange, len(devices))
+	for i, v := range devices {
+		ranges[i] = DeviceRange{Device: v}
+	}
+
+	// Recent points are read from primary retention. Older points are only in downsampled retention,
+	// which lags behind, so it's queried in addition when range is longer than primary retention
+	retention, err := c.getRetentionPolicy(since, time.Now())
+	if err != nil {
+		retention = &c.retentions[len(c.retentions)-1]
+		since = time.Now().Add(-retention.duration)
+	}
+	policies := []string{c.retentions[0].name}
+	if retention.name != c.retentions[0].name {
+		policies = append(policies, retention.name)
+	}
+
+	query := ""
+	for _, v := range policies {
+		if query != "" {
+			query += "; "
+		}
+		query += fmt.Sprintf(`SELECT last("%s") FROM "%s"."%s" WHERE %s AND time >= %ds GROUP BY "%s"`,
+			measurementValue, v, measurementName, getDevicesClause(ranges), since.Unix(), measurementKey)
+	}
+	q := influx_client.NewQuery(query, c.db, "s")
+
+	res, err := c.queryContext(ctx, q)
+	if err != nil {
+		c.logQuery(query, err, nil)
+		return seen, err
+	}
+	if res.Error() != nil {
+		c.logQuery(query, res.Error(), &res.Results[0])
+		return seen, res.Error()
+	}
+
+	for _, result := range res.Results {
+		for _, series := range result.Series {
+			columns := columnsAsMap(series)
+			if len(series.Values) == 0 {
+				continue
+			}
+			ts, _ := series.Values[0][columns["time"]].(json.Number).Int64()
+			key := series.Tags[measurementKey]
+			if t := time.Unix(ts, 0); t.After(seen[key]) {
+				seen[key] = t
+			}
+		}
+	}
+	return seen, nil
+}
+
+func (c *client) Write(device string, measurements Measurements) error {
 	batch, err := influx_client.NewBatchPoints(influx_client.BatchPointsConfig{Database: c.db})
 	if err != nil {
 		return err
@@ -107,7 +265,6 @@ func (c *client) Write(device string, groups []string, measurements Measurements
 
 	for name, v := range measurements {
 		tags := map[string]string{
-			groupName:      strings.Join(groups, groupSeparator),
 			deviceName:     device,
 			measurementKey: name,
 		}
@@ -128,7 +285,7 @@ func (c *client) Write(device string, groups []string, measurements Measurements
 	return nil
 }
 
-func (c *client) Read(device string, group string, filters []Filter, from time.Time, to time.Time, n int64) (Batch, error) {
+func (c *client) Read(ctx context.Context, devices []DeviceRange, filters []Filter, from time.Time, to time.Time, n int64, opts *ReadOpts) (Batch, error) {
 
 	if from.Nanosecond() > to.Nanosecond() {
 		return Batch{}, errors.New("influxdb query time range has to be positive")
@@ -140,8 +297,12 @@ func (c *client) Read(device string, group string, filters []Filter, from time.T
 		return Batch{}, err
 	}
 
+	if opts != nil && opts.Window != WindowNone {
+		return c.readWindows(ctx, devices, filters, from, to, retention, opts)
+	}
+
 	// Construct separate query for each input based on base_query. Query them as batch and parse result into Batch
-	baseQuery := `SELECT %s AS %s FROM "%s"."%s" WHERE %s AND %s GROUP BY %s fill(none) limit %d`
+	baseQuery := `SELECT %s AS %s FROM "%s"."%s" WHERE %s AND %s GROUP BY %s %s limit %d`
 	fullQuery := ""
 	timeQuery := fmt.Sprintf("time <= %ds AND time >= %ds", to.Unix(), from.Unix())
 	groupQuery := fmt.Sprintf("time(%ds)", int64(getGroupByTime(from, to, n, *retention).Seconds()))
@@ -150,8 +311,7 @@ func (c *client) Read(device string, group string, filters []Filter, from time.T
 		limit = maxHistorySize
 	}
 
-	deviceGroup := getDeviceGroupClause(device, group)
-	whereClause := deviceGroup
+	whereClause := getDevicesClause(devices)
 	if whereClause != "" {
 		whereClause = fmt.Sprintf(" %s AND ", whereClause)
 	}
@@ -159,7 +319,8 @@ func (c *client) Read(device string, group string, filters []Filter, from time.T
 
 	for _, filter := range filters {
 		measurementQuery := fmt.Sprintf(`"%s"='%s'`, measurementKey, filter.Key)
-		query := fmt.Sprintf(baseQuery, filter.influxString(), filter.StringSimplified(), retention.name, measurementName, whereClause, measurementQuery, groupQuery, limit)
+		query := fmt.Sprintf(baseQuery, filter.influxString(), filter.StringSimplified(), retention.name, measurementName,
+			whereClause, measurementQuery, groupQuery, opts.fillString(), limit)
 		if fullQuery != "" {
 			fullQuery = fmt.Sprintf("%s; %s", fullQuery, query)
 		} else {
@@ -169,7 +330,10 @@ func (c *client) Read(device string, group string, filters []Filter, from time.T
 
 	q := influx_client.NewQuery(fullQuery, c.db, "s")
 
-	res, err := c.client.Query(q)
+	res, err := c.queryContext(ctx, q)
+	if ctx.Err() != nil {
+		return Batch{}, ctx.Err()
+	}
 
 	if res == nil {
 		logrus.Error("Influxdb query returned empty response")
@@ -191,6 +355,72 @@ func (c *client) Read(device string, group string, filters []Filter, from time.T
 
 }
 
+// readWindows reads filters aggregated over calendar windows. Influxdb only supports fixed-length intervals,
+// so each window is queried with separate statement.
+func (c *client) readWindows(ctx context.Context, devices []DeviceRange, filters []Filter, from time.Time, to time.Time,
+	retention *retention, opts *ReadOpts) (Batch, error) {
+	windows, err := calendarWindows(from, to, opts.Window, opts.Location)
+	if err != nil {
+		return Batch{}, err
+	}
+
+	baseQuery := `SELECT %s AS %s FROM "%s"."%s" WHERE %s"%s"='%s' AND time >= %ds AND time < %ds`
+	deviceClause := getDevicesClause(devices)
+	if deviceClause != "" {
+		deviceClause = fmt.Sprintf("%s AND ", deviceClause)
+	}
+
+	queries := make([]string, 0, len(filters)*len(windows))
+	for _, filter := range filters {
+		for _, window := range windows {
+			queries = append(queries, fmt.Sprintf(baseQuery, filter.influxString(), filter.StringSimplified(),
+				retention.name, measurementName, deviceClause, measurementKey, filter.Key,
+				window.Start.Unix(), window.End.Unix()))
+		}
+	}
+	fullQuery := strings.Join(queries, "; ")
+
+	q := influx_client.NewQuery(fullQuery, c.db, "s")
+	res, err := c.queryContext(ctx, q)
+	if err != nil {
+		c.logQuery(fullQuery, err, nil)
+		return Batch{}, err
+	}
+	if res.Error() != nil {
+		c.logQuery(fullQuery, res.Error(), &res.Results[0])
+		return Batch{}, res.Error()
+	}
+	c.logQuery(fullQuery, nil, &res.Results[0])
+
+	if len(res.Results) != len(queries) {
+		return Batch{}, errors.New("mismatch of queries and results")
+	}
+
+	result := Batch{}
+	for i, filter := range filters {
+		name := filter.StringSimplified()
+		points := make([]Point, len(windows))
+		for j, window := range windows {
+			points[j] = Point{Timestamp: window.Start, Missing: true}
+
+			measurement := res.Results[i*len(windows)+j]
+			if len(measurement.Series) == 0 || len(measurement.Series[0].Values) == 0 {
+				continue
+			}
+			columns := columnsAsMap(measurement.Series[0])
+			value := measurement.Series[0].Values[0][columns[name]]
+			if value == nil {
+				continue
+			}
+			val, _ := value.(json.Number).Float64()
+			points[j].Value = float32(val)
+			points[j].Missing = false
+		}
+		result[name] = fillWindows(points, opts)
+	}
+	return result, nil
+}
+
 // WriteMetrics writes metrics if enabled in config
 func (c *client) WriteMetrics(name string, value float64) error {
 	if !c.sendMetrics {
@@ -255,7 +485,8 @@ func NewClient(config *config.Influxdb, sendMetrics bool, logQueries bool, logge
 	c := &client{}
 
 	influx, err := influx_client.NewHTTPClient(influx_client.HTTPConfig{
-		Addr: fmt.Sprintf("http://%s:%d", config.Host, config.Port)})
+		Addr:    fmt.Sprintf("http://%s:%d", config.Host, config.Port),
+		Timeout: queryTimeout})
 	if err != nil {
 		return c, err
 	}
@@ -306,24 +537,24 @@ func (c *client) logQuery(q string, err error, series *influx_client.Result) {
 	}
 }
 
-// Construct device and group filters for influxdb query. If both are empty, empty query is returned
-func getDeviceGroupClause(deviceId string, groupId string) string {
-	if deviceId == "" && groupId == "" {
+// Construct device filter for influxdb query. If devices is empty, empty query is returned
+func getDevicesClause(devices []DeviceRange) string {
+	if len(devices) == 0 {
 		return ""
 	}
 
-	query := ""
-	if deviceId != "" {
-		query = fmt.Sprintf(`"%s"='%s'`, deviceName, deviceId)
-		if groupId != "" {
-			query = fmt.Sprintf("%s AND ", query)
+	clauses := make([]string, len(devices))
+	for i, v := range devices {
+		clause := fmt.Sprintf(`"%s"='%s'`, deviceName, v.Device)
+		if !v.From.IsZero() {
+			clause = fmt.Sprintf("%s AND time >= %ds", clause, v.From.Unix())
 		}
+		if !v.To.IsZero() {
+			clause = fmt.Sprintf("%s AND time <= %ds", clause, v.To.Unix())
+		}
+		clauses[i] = fmt.Sprintf("(%s)", clause)
 	}
-
-	if groupId != "" {
-		query = fmt.Sprintf(`%s "%s"=~/.*%s.*/`, query, groupName, groupId)
-	}
-	return query
+	return fmt.Sprintf("(%s)", strings.Join(clauses, " OR "))
 }
 
 // getGroupByTime constructs time interval for given times and retention policy
@@ -366,14 +597,17 @@ func seriesToMeasurements(measurements *[]influx_client.Result, filters []Filter
 			for index, point := range measurement.Series[0].Values {
 				num, _ := point[columns["time"]].(json.Number).Int64()
 				var value float32 = 0.0
+				missing := true
 				if point[columns[name]] != nil {
 					val, _ := point[columns[name]].(json.Number).Float64()
 					value = float32(val)
+					missing = false
 				}
 
 				p := Point{
 					Timestamp: time.Unix(num, 0),
 					Value:     value,
+					Missing:   missing,
 				}
 				series[index] = p
 			}
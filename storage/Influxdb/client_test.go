@@ -0,0 +1,30 @@
+package Influxdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetDevicesClause(t *testing.T) {
+	from := time.Unix(1000, 0)
+	to := time.Unix(2000, 0)
+
+	cases := []struct {
+		devices []DeviceRange
+		want    string
+	}{
+		{nil, ""},
+		{[]DeviceRange{{Device: "a"}}, `(("device"='a'))`},
+		{[]DeviceRange{{Device: "a"}, {Device: "b", From: from}},
+			`(("device"='a') OR ("device"='b' AND time >= 1000s))`},
+		{[]DeviceRange{{Device: "a", From: from, To: to}},
+			`(("device"='a' AND time >= 1000s AND time <= 2000s))`},
+	}
+
+	for _, c := range cases {
+		got := getDevicesClause(c.devices)
+		if got != c.want {
+			t.Errorf("expected %s, got %s", c.want, got)
+		}
+	}
+}
@@ -1,134 +1,160 @@
 package Influxdb
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
-	"regexp"
+	"github.com/tryffel/fusio/expression"
 	"strconv"
 	"strings"
 )
 
-// Match 'mean(measurement_test)'
-var regexSelector, _ = regexp.Compile(`^([a-zA-Z_]+)\(([a-zA-Z_]+)\)$`)
-
-// Matches moving_average(mean(usage_system),10)
-var regexSelectorAndTransformation, _ = regexp.Compile(`^(\w+)?\((\w+)\((\w+)\),?(\d+)?\)$`)
-
-var regexOperators, _ = regexp.Compile(`[-+=><*/]`)
-
-// Information about the contents of filter.
-const (
-	filterSimple               = 0
-	filterTransformed          = 1
-	filterTransformedParameter = 2
-)
+// Transformation is function applied to selected values, e.g. derivative
+type Transformation struct {
+	Function string `json:"function"`
+	// Param is optional parameter in expression form: unit of derivative and elapsed, e.g. '1m',
+	// or number of points for moving_average
+	Param string `json:"param,omitempty"`
+}
 
+// Filter is aggregation of measurement: selector(key), e.g. mean(temperature),
+// optionally wrapped in transformations: derivative(moving_average(mean(temperature),5),1m)
 type Filter struct {
-	Selector       string `json:"selector"`
-	Transformation string `json:"transformation"`
-	Key            string `json:"key"`
-	// Additional parameters for transformations
-	Param      int64 `json:"param"`
-	FilterType int   `json:"type"`
+	Selector string `json:"selector"`
+	Key      string `json:"key"`
+	// Transformations applied to selected values, innermost first
+	Transformations []Transformation `json:"transformations,omitempty"`
 }
 
-// String get filter as original string
-func (f *Filter) String() string {
-	if f.FilterType == filterSimple {
-		return fmt.Sprintf("%s(%s)", f.Selector, f.Key)
-	}
-	if f.FilterType == filterTransformed {
-		return fmt.Sprintf("%s(%s(%s))", f.Transformation, f.Selector, f.Key)
+// UnmarshalJSON reads filter, converting single transformation of filters stored before nesting was supported
+func (f *Filter) UnmarshalJSON(data []byte) error {
+	type filter Filter
+	v := struct {
+		filter
+		Transformation string `json:"transformation"`
+		Param          int64  `json:"param"`
+	}{}
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return err
 	}
-	if f.FilterType == filterTransformedParameter {
-		return fmt.Sprintf("%s(%s(%s),%d)", f.Transformation, f.Selector, f.Key, f.Param)
+	*f = Filter(v.filter)
+	if v.Transformation != "" && len(f.Transformations) == 0 {
+		t := Transformation{Function: v.Transformation}
+		if v.Param > 0 {
+			t.Param = strconv.FormatInt(v.Param, 10)
+		}
+		f.Transformations = []Transformation{t}
 	}
-	return "Unknown filter type"
+	return nil
+}
+
+// String get filter as original string
+func (f *Filter) String() string {
+	return f.format(f.Key, false)
 }
 
 // StringEscaped get filter as escaped string, for influx queries
 func (f *Filter) StringEscaped() string {
-	if f.FilterType == filterSimple {
-		return fmt.Sprintf("%s(\"%s\")", f.Selector, f.Key)
-	}
-	if f.FilterType == filterTransformed {
-		return fmt.Sprintf("%s(%s(\"%s\"))", f.Transformation, f.Selector, f.Key)
-	}
-	if f.FilterType == filterTransformedParameter {
-		return fmt.Sprintf("%s(%s(\"%s\"),%d)", f.Transformation, f.Selector, f.Key, f.Param)
-	}
-	return "Unknown filter type"
+	return f.format(fmt.Sprintf("\"%s\"", f.Key), false)
 }
 
 // influxString gets filter formatted as 'mean("value")', where value is hardcoded 'measurementValue*
 func (f *Filter) influxString() string {
-	if f.FilterType == filterSimple {
-		return fmt.Sprintf("%s(\"%s\")", f.Selector, measurementValue)
+	return f.format(fmt.Sprintf("\"%s\"", measurementValue), true)
+}
+
+// format formats filter with given field. Influx format converts parameters to influx syntax
+func (f *Filter) format(field string, influx bool) string {
+	s := fmt.Sprintf("%s(%s)", f.Selector, field)
+	for _, t := range f.Transformations {
+		if t.Param == "" {
+			s = fmt.Sprintf("%s(%s)", t.Function, s)
+			continue
+		}
+		param := t.Param
+		if influx {
+			param = influxParam(t)
+		}
+		s = fmt.Sprintf("%s(%s,%s)", t.Function, s, param)
 	}
-	if f.FilterType == filterTransformed {
-		return fmt.Sprintf("%s(%s(\"%s\"))", f.Transformation, f.Selector, measurementValue)
+	return s
+}
+
+// influxParam returns parameter in influx syntax. Influx requires unit to be duration,
+// plain number is in seconds. Microseconds are 'u' in influx
+func influxParam(t Transformation) string {
+	if t.Function == "moving_average" {
+		return t.Param
 	}
-	if f.FilterType == filterTransformedParameter {
-		return fmt.Sprintf("%s(%s(\"%s\"),%s)", f.Transformation, f.Selector, f.Key, measurementValue)
+	if _, err := strconv.ParseInt(t.Param, 10, 64); err == nil {
+		return t.Param + "s"
 	}
-	return "Unknown filter type"
+	if strings.HasSuffix(t.Param, "us") {
+		return strings.TrimSuffix(t.Param, "us") + "u"
+	}
+	return t.Param
 }
 
-// StringSimplified get string as a placeholder: mean_max_temperature
+// StringSimplified get string as a placeholder: derivative_1m_mean_temperature, see expression.Call.Key
 func (f *Filter) StringSimplified() string {
-	if f.FilterType == filterSimple {
-		return fmt.Sprintf("%s_%s", f.Selector, f.Key)
+	s := fmt.Sprintf("%s_%s", f.Selector, f.Key)
+	for _, t := range f.Transformations {
+		if t.Param != "" {
+			s = fmt.Sprintf("%s_%s_%s", t.Function, t.Param, s)
+			continue
+		}
+		s = fmt.Sprintf("%s_%s", t.Function, s)
 	}
-	if f.FilterType == filterTransformed || f.FilterType == filterTransformedParameter {
-		return fmt.Sprintf("%s_%s_%s", f.Transformation, f.Selector, f.Key)
+	return s
+}
+
+// FilterFromCall returns filter from aggregation of parsed expression, see expression.Call.IsAggregation
+func FilterFromCall(call *expression.Call) (Filter, error) {
+	f := Filter{}
+	transformations := make([]Transformation, 0)
+	for {
+		if !call.IsAggregation() || len(call.Args) == 0 {
+			return f, fmt.Errorf("'%s' is not aggregation", call)
+		}
+		switch arg := call.Args[0].(type) {
+		case *expression.Ident:
+			f.Selector = call.Name
+			f.Key = arg.Name
+			// Collected outermost first
+			for i := len(transformations) - 1; i >= 0; i-- {
+				f.Transformations = append(f.Transformations, transformations[i])
+			}
+			return f, nil
+		case *expression.Call:
+			t := Transformation{Function: call.Name}
+			if len(call.Args) > 1 {
+				t.Param = call.Args[1].String()
+			}
+			transformations = append(transformations, t)
+			call = arg
+		default:
+			return f, fmt.Errorf("'%s' is not aggregation", call)
+		}
 	}
-	return "Unknown filter type"
 }
 
 // FilterFromString Attempt to validate filter in string and return parsed filters or error with message description
-// Valid string is: mean(temperature) - derivative(mean(temperature),10) > 10
+// Valid string is: mean(temperature) - derivative(mean(temperature),10s) > 10
 // Invalid string is: max mean(temperature) is 0
 func FilterFromString(s string) (*[]Filter, error) {
-	var err error
-	s = strings.Replace(s, " ", "", -1)
-	sub := regexOperators.Split(s, -1)
-
 	filter := make([]Filter, 0)
+	e, err := expression.Parse(s)
+	if err != nil {
+		return &filter, err
+	}
 
-	for _, v := range sub {
-		match := regexSelectorAndTransformation.FindStringSubmatch(v)
-
-		// Match simple filter 'mean(measurement)'
-		if match != nil {
-			f := Filter{
-				Selector:       match[2],
-				Key:            match[3],
-				Transformation: match[1],
-				Param:          -1,
-				FilterType:     filterTransformed,
-			}
-
-			// Match possible integer parameter
-			if len(match[4]) > 0 {
-				f.Param, err = strconv.ParseInt(match[4], 10, 64)
-				f.FilterType = filterTransformedParameter
-				if err != nil {
-					return &filter, errors.New(fmt.Sprintf("'%s' not integer", match[4]))
-				}
-			}
-			filter = append(filter, f)
-		} else {
-			match = regexSelector.FindStringSubmatch(v)
-			// Match filter 'derivative(mean(measurement),10)
-			if match != nil {
-				f := Filter{
-					Selector:   match[1],
-					Key:        match[2],
-					FilterType: filterSimple,
-				}
-				filter = append(filter, f)
-			}
+	for _, v := range e.Aggregations() {
+		f, err := FilterFromCall(v)
+		if err != nil {
+			return &filter, err
 		}
+		filter = append(filter, f)
 	}
 	if len(filter) == 0 {
 		return &filter, errors.New("Filters can't be empty")
@@ -1,6 +1,7 @@
 package Influxdb
 
 import (
+	"encoding/json"
 	"testing"
 )
 
@@ -12,13 +13,18 @@ func TestParseSingleInfluxFilter(t *testing.T) {
 		placeholder string
 	}{
 		{"mean(temperature) > 10", "mean(temperature)", "mean(\"temperature\")", "mean_temperature"},
-		{"max(input) = -5", "max(input)", "max(\"input\")", "max_input"},
-		{"diff(mean(temp),10) > 10", "diff(mean(temp),10)", "diff(mean(\"temp\"),10)", "diff_mean_temp"},
+		{"max(input) == -5", "max(input)", "max(\"input\")", "max_input"},
+		{"derivative(mean(temp),10) > 10", "derivative(mean(temp),10)", "derivative(mean(\"temp\"),10)",
+			"derivative_10_mean_temp"},
+		{"derivative(moving_average(mean(temp),5),1m) > 0", "derivative(moving_average(mean(temp),5),1m)",
+			"derivative(moving_average(mean(\"temp\"),5),1m)", "derivative_1m_moving_average_5_mean_temp"},
 	}
 
 	invalidFilters := []string{
 		" a - diff(aabc > 0",
 		"b=2 == max a",
+		"diff(mean(temp),10) > 10",
+		"moving_average(mean(temp)) > 10",
 	}
 
 	for _, c := range validFilters {
@@ -49,21 +55,21 @@ func TestParseSingleInfluxFilter(t *testing.T) {
 }
 
 func TestParseMultipleInfluxFilters(t *testing.T) {
-	input := "mean(temp) - max(temp) > diff(mean(max),10)"
+	input := "mean(temp) - max(temp) > derivative(mean(max),10)"
 	strings := [3]string{}
 	strings[0] = "mean(temp)"
 	strings[1] = "max(temp)"
-	strings[2] = "diff(mean(max),10)"
+	strings[2] = "derivative(mean(max),10)"
 
 	escaped := [3]string{}
 	escaped[0] = "mean(\"temp\")"
 	escaped[1] = "max(\"temp\")"
-	escaped[2] = "diff(mean(\"max\"),10)"
+	escaped[2] = "derivative(mean(\"max\"),10)"
 
 	simplified := [3]string{}
 	simplified[0] = "mean_temp"
 	simplified[1] = "max_temp"
-	simplified[2] = "diff_mean_max"
+	simplified[2] = "derivative_10_mean_max"
 
 	filters, err := FilterFromString(input)
 	if err != nil {
@@ -84,6 +90,56 @@ func TestParseMultipleInfluxFilters(t *testing.T) {
 	}
 }
 
+func TestFilterInfluxString(t *testing.T) {
+	filters := []struct {
+		in     string
+		influx string
+	}{
+		{"mean(temperature)", "mean(\"value\")"},
+		{"derivative(mean(temperature),10)", "derivative(mean(\"value\"),10s)"},
+		{"non_negative_derivative(max(counter),500us)", "non_negative_derivative(max(\"value\"),500u)"},
+		{"derivative(moving_average(mean(temperature),5),1h)", "derivative(moving_average(mean(\"value\"),5),1h)"},
+		{"cumulative_sum(difference(last(counter)))", "cumulative_sum(difference(last(\"value\")))"},
+		{"elapsed(count(door))", "elapsed(count(\"value\"))"},
+	}
+
+	for _, c := range filters {
+		got, err := FilterFromString(c.in)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if s := (*got)[0].influxString(); s != c.influx {
+			t.Errorf("Influx string doesn't match: %s, got %s", c.influx, s)
+		}
+	}
+}
+
+func TestFilterLegacyJson(t *testing.T) {
+	data := `{"selector":"mean","transformation":"derivative","key":"temperature","param":10,"type":2}`
+	f := Filter{}
+	err := json.Unmarshal([]byte(data), &f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.String() != "derivative(mean(temperature),10)" {
+		t.Errorf("Legacy filter not converted: %s", f.String())
+	}
+
+	out, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := Filter{}
+	err = json.Unmarshal(out, &restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.String() != f.String() {
+		t.Errorf("Filter doesn't match after json: %s, got %s", f.String(), restored.String())
+	}
+}
+
 func BenchmarkSingleInfluxFilter(b *testing.B) {
 	filter := "mean(temperature) > 10 "
 
@@ -6,6 +6,8 @@ import "time"
 type Point struct {
 	Value     float32
 	Timestamp time.Time
+	// Missing is true when interval had no data and query was filled with null
+	Missing bool
 }
 
 // Series of points
@@ -20,9 +22,19 @@ type Batch map[string][]Point
 // Measurements: key: measurement name
 type Measurements map[string]Point
 
-// Metadata to store for measurements
-type metadata struct {
-	device      string
-	groups      []string
-	measurement string
+// DeviceRange limits query to device and optionally to time range device is included in.
+// Zero From or To leaves range unbounded
+type DeviceRange struct {
+	Device string
+	From   time.Time
+	To     time.Time
+}
+
+// KeyStatus latest state of single measurement key
+type KeyStatus struct {
+	Key       string
+	LastValue float32
+	LastSeen  time.Time
+	// Counts number of points per hour, key is start of hour
+	Counts map[time.Time]int64
 }
@@ -0,0 +1,69 @@
+package Influxdb
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Fill defines how empty intervals are filled in queries
+type Fill string
+
+const (
+	// FillNone omits empty intervals
+	FillNone Fill = "none"
+	// FillNull returns empty intervals as missing points
+	FillNull Fill = "null"
+	// FillPrevious returns value from previous interval
+	FillPrevious Fill = "previous"
+	// FillLinear interpolates linearly between intervals
+	FillLinear Fill = "linear"
+	// FillValue fills empty intervals with ReadOpts.FillValue
+	FillValue Fill = "value"
+)
+
+// ReadOpts optional parameters for reading measurements
+type ReadOpts struct {
+	Fill      Fill
+	FillValue float32
+	// Window aligns intervals to calendar units in Location instead of splitting range equally.
+	// With window set, number of points is defined by window and time range
+	Window   Window
+	Location *time.Location
+}
+
+// DefaultReadOpts returns options that omit empty intervals
+func DefaultReadOpts() *ReadOpts {
+	return &ReadOpts{Fill: FillNone}
+}
+
+// ParseFill parses fill option: none|null|previous|linear or any number to fill with
+func ParseFill(s string) (*ReadOpts, error) {
+	opts := DefaultReadOpts()
+	switch Fill(s) {
+	case "", FillNone:
+		return opts, nil
+	case FillNull, FillPrevious, FillLinear:
+		opts.Fill = Fill(s)
+		return opts, nil
+	}
+
+	value, err := strconv.ParseFloat(s, 32)
+	if err != nil {
+		return opts, fmt.Errorf("invalid fill '%s', expected none, null, previous, linear or number", s)
+	}
+	opts.Fill = FillValue
+	opts.FillValue = float32(value)
+	return opts, nil
+}
+
+// fillString gets fill clause for influx query
+func (o *ReadOpts) fillString() string {
+	if o == nil || o.Fill == "" {
+		return fmt.Sprintf("fill(%s)", FillNone)
+	}
+	if o.Fill == FillValue {
+		return fmt.Sprintf("fill(%s)", strconv.FormatFloat(float64(o.FillValue), 'f', -1, 32))
+	}
+	return fmt.Sprintf("fill(%s)", o.Fill)
+}
@@ -0,0 +1,37 @@
+package Influxdb
+
+import "testing"
+
+func TestParseFill(t *testing.T) {
+	valid := []struct {
+		in     string
+		clause string
+	}{
+		{"", "fill(none)"},
+		{"none", "fill(none)"},
+		{"null", "fill(null)"},
+		{"previous", "fill(previous)"},
+		{"linear", "fill(linear)"},
+		{"0", "fill(0)"},
+		{"-2.5", "fill(-2.5)"},
+	}
+
+	for _, c := range valid {
+		opts, err := ParseFill(c.in)
+		if err != nil {
+			t.Errorf("Failed to parse fill '%s': %s", c.in, err)
+			continue
+		}
+		if opts.fillString() != c.clause {
+			t.Errorf("Fill clause doesn't match: expected %s, got %s", c.clause, opts.fillString())
+		}
+	}
+
+	invalid := []string{"nul", "fill(0)", "1,5"}
+	for _, c := range invalid {
+		_, err := ParseFill(c)
+		if err == nil {
+			t.Errorf("No error on invalid fill '%s'", c)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package Influxdb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Window is calendar unit to aggregate measurements with
+type Window string
+
+const (
+	// WindowNone splits time range into equal intervals
+	WindowNone Window = ""
+	WindowHour Window = "hour"
+	WindowDay  Window = "day"
+	// WindowWeek is ISO week starting on monday
+	WindowWeek  Window = "week"
+	WindowMonth Window = "month"
+)
+
+// timeWindow is single half-open interval [Start, End)
+type timeWindow struct {
+	Start time.Time
+	End   time.Time
+}
+
+// ParseWindow parses window hour|day|week|month and IANA time zone, e.g. Europe/Helsinki.
+// Empty zone defaults to UTC
+func ParseWindow(window string, zone string) (Window, *time.Location, error) {
+	w := Window(window)
+	switch w {
+	case WindowNone, WindowHour, WindowDay, WindowWeek, WindowMonth:
+	default:
+		return WindowNone, time.UTC, fmt.Errorf("invalid window '%s', expected hour, day, week or month", window)
+	}
+
+	if zone == "" {
+		return w, time.UTC, nil
+	}
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		return w, time.UTC, fmt.Errorf("invalid time zone '%s'", zone)
+	}
+	return w, location, nil
+}
+
+// windowStart returns start of window that t is in
+func windowStart(t time.Time, window Window, location *time.Location) time.Time {
+	t = t.In(location)
+	year, month, day := t.Date()
+	switch window {
+	case WindowHour:
+		// Hours are not truncated with time.Date, since it is ambiguous when clocks are turned back
+		return t.Add(-time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second -
+			time.Duration(t.Nanosecond()))
+	case WindowDay:
+		return time.Date(year, month, day, 0, 0, 0, 0, location)
+	case WindowWeek:
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, location)
+	case WindowMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, location)
+	}
+	return t
+}
+
+// nextWindow returns start of window following window starting at t
+func nextWindow(t time.Time, window Window) time.Time {
+	switch window {
+	case WindowHour:
+		return t.Add(time.Hour)
+	case WindowDay:
+		return t.AddDate(0, 0, 1)
+	case WindowWeek:
+		return t.AddDate(0, 0, 7)
+	case WindowMonth:
+		return t.AddDate(0, 1, 0)
+	}
+	return t
+}
+
+// calendarWindows returns full calendar windows that overlap time range from - to.
+// Windows are in given location, so days and weeks have correct length on daylight saving transitions.
+func calendarWindows(from time.Time, to time.Time, window Window, location *time.Location) ([]timeWindow, error) {
+	if window == WindowNone {
+		return []timeWindow{}, errors.New("no window defined")
+	}
+	if location == nil {
+		location = time.UTC
+	}
+
+	windows := []timeWindow{}
+	for start := windowStart(from, window, location); start.Before(to); {
+		if len(windows) == maxHistorySize {
+			return windows, fmt.Errorf("too many windows, maximum is %d", maxHistorySize)
+		}
+		end := nextWindow(start, window)
+		windows = append(windows, timeWindow{Start: start, End: end})
+		start = end
+	}
+	return windows, nil
+}
+
+// fillWindows fills missing points of windowed series the same way influxdb fills intervals
+func fillWindows(points []Point, opts *ReadOpts) []Point {
+	fill := FillNone
+	if opts != nil && opts.Fill != "" {
+		fill = opts.Fill
+	}
+
+	switch fill {
+	case FillNull:
+		return points
+	case FillValue:
+		for i := range points {
+			if points[i].Missing {
+				points[i].Value = opts.FillValue
+				points[i].Missing = false
+			}
+		}
+		return points
+	case FillPrevious:
+		for i := 1; i < len(points); i++ {
+			if points[i].Missing && !points[i-1].Missing {
+				points[i].Value = points[i-1].Value
+				points[i].Missing = false
+			}
+		}
+	case FillLinear:
+		last := -1
+		for i := range points {
+			if points[i].Missing {
+				continue
+			}
+			if last >= 0 && i-last > 1 {
+				step := (points[i].Value - points[last].Value) / float32(i-last)
+				for j := last + 1; j < i; j++ {
+					points[j].Value = points[last].Value + step*float32(j-last)
+					points[j].Missing = false
+				}
+			}
+			last = i
+		}
+	}
+
+	filled := make([]Point, 0, len(points))
+	for _, v := range points {
+		if !v.Missing {
+			filled = append(filled, v)
+		}
+	}
+	return filled
+}
@@ -0,0 +1,111 @@
+package Influxdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalendarWindows(t *testing.T) {
+	helsinki, err := time.LoadLocation("Europe/Helsinki")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	cases := []struct {
+		name     string
+		from     time.Time
+		to       time.Time
+		window   Window
+		starts   []string
+		duration []time.Duration
+	}{
+		{
+			// Daylight saving starts 2019-03-31 03:00
+			name:     "dst start",
+			from:     time.Date(2019, 3, 30, 12, 0, 0, 0, helsinki),
+			to:       time.Date(2019, 4, 1, 12, 0, 0, 0, helsinki),
+			window:   WindowDay,
+			starts:   []string{"2019-03-30T00:00:00+02:00", "2019-03-31T00:00:00+02:00", "2019-04-01T00:00:00+03:00"},
+			duration: []time.Duration{24 * time.Hour, 23 * time.Hour, 24 * time.Hour},
+		},
+		{
+			// Daylight saving ends 2019-10-27 04:00, hour 03-04 is repeated
+			name:     "dst end",
+			from:     time.Date(2019, 10, 27, 2, 30, 0, 0, helsinki),
+			to:       time.Date(2019, 10, 27, 5, 0, 0, 0, helsinki),
+			window:   WindowHour,
+			starts:   []string{"2019-10-27T02:00:00+03:00", "2019-10-27T03:00:00+03:00", "2019-10-27T03:00:00+02:00", "2019-10-27T04:00:00+02:00"},
+			duration: []time.Duration{time.Hour, time.Hour, time.Hour, time.Hour},
+		},
+		{
+			name:     "iso week",
+			from:     time.Date(2019, 10, 27, 12, 0, 0, 0, helsinki),
+			to:       time.Date(2019, 10, 29, 0, 0, 0, 0, helsinki),
+			window:   WindowWeek,
+			starts:   []string{"2019-10-21T00:00:00+03:00", "2019-10-28T00:00:00+02:00"},
+			duration: []time.Duration{7*24*time.Hour + time.Hour, 7 * 24 * time.Hour},
+		},
+		{
+			name:     "month",
+			from:     time.Date(2019, 1, 31, 0, 0, 0, 0, time.UTC),
+			to:       time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC),
+			window:   WindowMonth,
+			starts:   []string{"2019-01-01T00:00:00Z", "2019-02-01T00:00:00Z"},
+			duration: []time.Duration{31 * 24 * time.Hour, 28 * 24 * time.Hour},
+		},
+	}
+
+	for _, c := range cases {
+		location := c.from.Location()
+		windows, err := calendarWindows(c.from, c.to, c.window, location)
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+		if len(windows) != len(c.starts) {
+			t.Errorf("%s: expected %d windows, got %d", c.name, len(c.starts), len(windows))
+			continue
+		}
+		for i, v := range windows {
+			if v.Start.Format(time.RFC3339) != c.starts[i] {
+				t.Errorf("%s: window %d start: expected %s, got %s", c.name, i, c.starts[i], v.Start.Format(time.RFC3339))
+			}
+			if v.End.Sub(v.Start) != c.duration[i] {
+				t.Errorf("%s: window %d length: expected %s, got %s", c.name, i, c.duration[i], v.End.Sub(v.Start))
+			}
+		}
+	}
+}
+
+func TestFillWindows(t *testing.T) {
+	points := func() []Point {
+		return []Point{{Value: 1}, {Missing: true}, {Missing: true}, {Value: 4}, {Missing: true}}
+	}
+
+	cases := []struct {
+		opts *ReadOpts
+		want []float32
+	}{
+		{nil, []float32{1, 4}},
+		{&ReadOpts{Fill: FillPrevious}, []float32{1, 1, 1, 4, 4}},
+		{&ReadOpts{Fill: FillLinear}, []float32{1, 2, 3, 4}},
+		{&ReadOpts{Fill: FillValue, FillValue: 0}, []float32{1, 0, 0, 4, 0}},
+	}
+
+	for _, c := range cases {
+		got := fillWindows(points(), c.opts)
+		if len(got) != len(c.want) {
+			t.Errorf("expected %d points, got %d", len(c.want), len(got))
+			continue
+		}
+		for i := range got {
+			if got[i].Value != c.want[i] {
+				t.Errorf("point %d: expected %f, got %f", i, c.want[i], got[i].Value)
+			}
+		}
+	}
+
+	if got := fillWindows(points(), &ReadOpts{Fill: FillNull}); len(got) != 5 || !got[1].Missing {
+		t.Error("null fill should keep missing points")
+	}
+}
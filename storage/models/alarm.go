@@ -12,11 +12,132 @@ import (
 	"time"
 )
 
+// GapPolicy defines how intervals without data are handled when evaluating alarm
+type GapPolicy string
+
+const (
+	// GapNone ignores empty intervals altogether, evaluating only intervals that have data
+	GapNone GapPolicy = ""
+	// GapFail treats empty interval as negative evaluation
+	GapFail GapPolicy = "fail"
+	// GapSkip skips empty interval
+	GapSkip GapPolicy = "skip"
+	// GapPrevious evaluates empty interval with previous known value
+	GapPrevious GapPolicy = "previous"
+)
+
+// AlarmType defines how alarm condition is evaluated
+type AlarmType string
+
+const (
+	// AlarmThreshold evaluates expression with measurements. Empty type is threshold
+	AlarmThreshold AlarmType = "threshold"
+	// AlarmAnomaly compares measurements to baseline learned from history
+	AlarmAnomaly AlarmType = "anomaly"
+	// AlarmForecast fires when measurements are predicted to cross threshold
+	AlarmForecast AlarmType = "forecast"
+	// AlarmNoData fires when devices stop reporting measurements
+	AlarmNoData AlarmType = "nodata"
+)
+
+// AlarmScope defines which devices alarm evaluates
+type AlarmScope string
+
+const (
+	// ScopeGroup evaluates aggregate of all devices in group. Empty scope is group
+	ScopeGroup AlarmScope = "group"
+	// ScopeDevice evaluates single device
+	ScopeDevice AlarmScope = "device"
+	// ScopePerDevice evaluates each device in group separately. Each device is fired and cleared separately
+	ScopePerDevice AlarmScope = "per_device"
+)
+
 type AlarmFilter struct {
+	Type    AlarmType         `json:"type"`
 	Filters []Influxdb.Filter `json:"filters"`
 	//Trigger float32 `json:"trigger"`
-	Expression string `json:"expression"`
-	Limit      int64  `json:"limit"`
+	Expression string    `json:"expression"`
+	Limit      int64     `json:"limit"`
+	Gaps       GapPolicy `json:"gaps"`
+	// Anomaly is set for anomaly alarms
+	Anomaly *AnomalyConfig `json:"anomaly,omitempty"`
+	// Forecast is set for forecast alarms
+	Forecast *ForecastConfig `json:"forecast,omitempty"`
+	// NoData is set for no-data alarms
+	NoData *NoDataConfig `json:"nodata,omitempty"`
+	// Thresholds are additional expressions for threshold alarm. Most severe matching threshold wins
+	Thresholds []Threshold `json:"thresholds,omitempty"`
+	// ClearExpression clears fired alarm. If empty, alarm clears when Expression is no longer true
+	ClearExpression string `json:"clear_expression,omitempty"`
+	// Deadband is margin value has to pass back over thresholds of Expression before alarm clears
+	Deadband float64 `json:"deadband,omitempty"`
+	// ClearLimit is number of consecutive intervals clear condition has to hold before clearing
+	ClearLimit int64 `json:"clear_limit,omitempty"`
+}
+
+// ForecastConfig configures forecast alarm
+type ForecastConfig struct {
+	// Method is linear or holt-winters
+	Method    string  `json:"method"`
+	Threshold float64 `json:"threshold"`
+	// Direction is above or below
+	Direction string `json:"direction"`
+	// Horizon alarm fires if threshold is predicted to be crossed within horizon
+	Horizon time.Duration `json:"horizon"`
+	// History is time range to fit forecast with
+	History time.Duration `json:"history"`
+	// Points is number of points in history
+	Points int64 `json:"points"`
+	// Season is length of season in points for holt-winters
+	Season int `json:"season"`
+}
+
+// MaxForecastHorizon is maximum number of points forecast alarm predicts
+const MaxForecastHorizon = 300
+
+// HistoryPoints returns number of points forecast is fitted with, defaulting to 50
+func (f *ForecastConfig) HistoryPoints() int64 {
+	if f.Points < 3 {
+		return 50
+	}
+	return f.Points
+}
+
+// Step returns interval of history points, which is also interval of predicted points
+func (f *ForecastConfig) Step() time.Duration {
+	return f.History / time.Duration(f.HistoryPoints())
+}
+
+// HorizonPoints returns number of points needed to predict whole horizon
+func (f *ForecastConfig) HorizonPoints() int {
+	step := f.Step()
+	if step <= 0 {
+		return 0
+	}
+	return int((f.Horizon + step - 1) / step)
+}
+
+// NoDataConfig configures no-data alarm
+type NoDataConfig struct {
+	// Timeout alarm fires if newest point is older than timeout
+	Timeout time.Duration `json:"timeout"`
+	// Keys limits alarm to measurement keys, each key is checked separately. Empty checks any key
+	Keys []string `json:"keys,omitempty"`
+}
+
+// Equal returns true if filters evaluate same condition
+func (f *AlarmFilter) Equal(other *AlarmFilter) bool {
+	a, errA := json.Marshal(f)
+	b, errB := json.Marshal(other)
+	return errA == nil && errB == nil && string(a) == string(b)
+}
+
+// GetType returns alarm type, defaulting to threshold
+func (f *AlarmFilter) GetType() AlarmType {
+	if f.Type == "" {
+		return AlarmThreshold
+	}
+	return f.Type
 }
 
 // Format used for govaluate: mean(temp) -> mean_temp
@@ -34,6 +155,32 @@ type Alarm struct {
 	Group     string `gorm:"not null"`
 	Fired     bool   `gorm:"not null"`
 	Enabled   bool   `gorm:"not null, default:'true'"`
+	// State of alarm, see GetState. For per-device alarm state is most active state of its devices
+	State AlarmState
+	// PendingSince is time alarm became pending
+	PendingSince time.Time
+	// ForDuration is wall-clock time condition must hold before pending alarm fires
+	ForDuration time.Duration `gorm:"not null"`
+	// Flapping is set when alarm has fired and resolved at least FlapThreshold times within FlapWindow.
+	// Outputs of flapping alarm are suppressed until it has changed less than half of threshold times within window
+	Flapping      bool          `gorm:"not null"`
+	FlapWindow    time.Duration `gorm:"not null"`
+	FlapThreshold int           `gorm:"not null"`
+	// Severity of alarm expression. Thresholds may define other severities
+	Severity Severity
+	// FiredSeverity is severity alarm is currently fired with
+	FiredSeverity Severity
+	// Acknowledged is set when fired alarm is acknowledged. Cleared along with alarm
+	Acknowledged bool `gorm:"not null"`
+	// Scope defines devices alarm is evaluated for. DeviceId is set for device scope
+	Scope    AlarmScope
+	DeviceId string
+	// Labels can be used to match alarm in silences
+	Labels Labels `gorm:"type:text"`
+	// EscalationPolicyId is policy to escalate fired alarm with until it is acknowledged
+	EscalationPolicyId string
+	// TemplateId is set for alarms created from template
+	TemplateId string
 	//Query       AlarmQuery `json:"query"`
 	Filter      AlarmFilter `gorm:"type:text" json:"filter"`
 	History     []AlarmHistory
@@ -50,9 +197,26 @@ type AlarmQuery struct {
 	Filters []Influxdb.Filter `json:"inputs"`
 	//Range    time.Duration     `json:"range"`
 	Interval time.Duration `json:"interval"`
-	// Expression is govaluate-valid expression: 'mean(temperature)>10'
-	Expression string `json:"expression"`
-	Limit      int64  `json:"limit"`
+	// Expression is simplified condition, see expression package: 'mean_temperature>10'
+	Expression string    `json:"expression"`
+	Limit      int64     `json:"limit"`
+	Gaps       GapPolicy `json:"gaps"`
+	// Severity of Expression
+	Severity   Severity    `json:"severity"`
+	Thresholds []Threshold `json:"thresholds"`
+	// Clear conditions, see AlarmFilter
+	ClearExpression string  `json:"clear_expression"`
+	Deadband        float64 `json:"deadband"`
+	ClearLimit      int64   `json:"clear_limit"`
+	// Fired is current alarm state. Clear conditions are only evaluated for fired alarm
+	Fired bool `json:"fired"`
+	// Device limits query to single device
+	Device string `json:"device"`
+}
+
+// Hysteresis returns true if alarm has separate conditions for clearing
+func (q *AlarmQuery) Hysteresis() bool {
+	return q.ClearExpression != "" || q.Deadband != 0 || q.ClearLimit > 0
 }
 
 /*
@@ -93,24 +257,37 @@ func (f AlarmFilter) Value() (driver.Value, error) {
 	return j, err
 }
 
+// BeforeCreate hook that gets called when creating new instance
 func (a *Alarm) BeforeCreate() error {
+	if a.ID == "" {
+		a.ID = util.NewUuid()
+	}
 	a.LastRun = time.Now()
+	a.CreatedAt = time.Now()
 	return nil
 }
 
-// BeforeCreate hook that gets called when creating new instance
+// BeforeSave hook that gets called on both create and update
 func (a *Alarm) BeforeSave() (err error) {
-	a.ID = util.NewUuid()
 	a.LowerName = strings.ToLower(a.Name)
-	a.CreatedAt = time.Now()
 	a.UpdatedAt = time.Now()
 	return
 }
 
-// BeforeUpdate hook that updates timestamp
-func (a *Alarm) BeforeUpdate() (err error) {
-	a.UpdatedAt = time.Now()
-	return
+// GetScope returns alarm scope, defaulting to group
+func (a *Alarm) GetScope() AlarmScope {
+	if a.Scope == "" {
+		return ScopeGroup
+	}
+	return a.Scope
+}
+
+// GetSeverity returns alarm severity, defaulting to warning
+func (a *Alarm) GetSeverity() Severity {
+	if a.Severity == "" {
+		return SeverityWarning
+	}
+	return a.Severity
 }
 
 func (a *Alarm) ToAlarmQuery() *AlarmQuery {
@@ -120,6 +297,17 @@ func (a *Alarm) ToAlarmQuery() *AlarmQuery {
 		Limit:      a.Filter.Limit,
 		Expression: a.Filter.Expression,
 		Interval:   a.RunInterval,
+		Gaps:       a.Filter.Gaps,
+		Severity:   a.GetSeverity(),
+		Thresholds: a.Filter.Thresholds,
+
+		ClearExpression: a.Filter.ClearExpression,
+		Deadband:        a.Filter.Deadband,
+		ClearLimit:      a.Filter.ClearLimit,
+		Fired:           a.Fired,
+	}
+	if a.GetScope() == ScopeDevice {
+		q.Device = a.DeviceId
 	}
 	return q
 }
@@ -142,15 +330,20 @@ func GetAlarmsToValuate(db *gorm.DB, interval time.Duration) *[]Alarm {
 // If alarm is already fired, don't create new event
 // Only one fired event can be uncleared at time. That is, one needs to first clear old fire when firing alarm again
 // Timestamp: time when alarm fired
-func (a *Alarm) Fire(db *gorm.DB, value float32, timestamp time.Time) error {
+func (a *Alarm) Fire(db *gorm.DB, value float32, severity Severity, timestamp time.Time) error {
 	if a.Fired {
 		return nil
 	}
 	h := &AlarmHistory{
-		AlarmId: a.ID,
-		Value:   fmt.Sprintf("%f", value),
-		Cleared: false,
-		FiredAt: timestamp,
+		AlarmId:  a.ID,
+		Value:    fmt.Sprintf("%f", value),
+		Severity: severity,
+		Cleared:  false,
+		FiredAt:  timestamp,
+	}
+	// Device alarm records its device, so that history can be matched by device like per-device alarms
+	if a.GetScope() == ScopeDevice {
+		h.DeviceId = a.DeviceId
 	}
 	db.Where("alarm_id = ? AND clear = False").First(&h)
 	if h.ID > 0 {
@@ -158,14 +351,35 @@ func (a *Alarm) Fire(db *gorm.DB, value float32, timestamp time.Time) error {
 	}
 	db.Create(h)
 
+	err := a.transition(db, nil, StateFiring, severity, timestamp)
+	if err != nil {
+		return err
+	}
 	a.Fired = true
-	res := db.Model(*a).Update("fired", true)
+	a.FiredSeverity = severity
+	a.Acknowledged = false
+	res := db.Model(*a).Updates(map[string]interface{}{"fired": true, "fired_severity": severity,
+		"acknowledged": false, "state": a.State, "pending_since": a.PendingSince})
 	if res.Error != nil {
 		return res.Error
 	}
 	return nil
 }
 
+// SetSeverity changes severity of fired alarm
+func (a *Alarm) SetSeverity(db *gorm.DB, severity Severity) error {
+	if !a.Fired || a.FiredSeverity == severity {
+		return nil
+	}
+	err := db.Model(&AlarmHistory{}).Where("alarm_id = ? AND cleared = False", a.ID).
+		Update("severity", severity).Error
+	if err != nil {
+		return err
+	}
+	a.FiredSeverity = severity
+	return db.Model(*a).Update("fired_severity", severity).Error
+}
+
 // Clear alarm. If alarm.fired = false, no action is taken
 func (a *Alarm) Clear(db *gorm.DB, timestamp time.Time) error {
 	if a.Fired == false {
@@ -185,11 +399,86 @@ func (a *Alarm) Clear(db *gorm.DB, timestamp time.Time) error {
 		return res.Error
 	}
 
+	err := a.transition(db, nil, StateResolved, a.FiredSeverity, timestamp)
+	if err != nil {
+		return err
+	}
 	a.Fired = false
-	res = db.Model(*a).Update("fired", false)
+	a.FiredSeverity = ""
+	a.Acknowledged = false
+	res = db.Model(*a).Updates(map[string]interface{}{"fired": false, "fired_severity": "", "acknowledged": false,
+		"state": a.State})
 	return res.Error
 }
 
+// ResetState clears fired alarm and learned baselines so alarm is evaluated from scratch on next run.
+// All open history items and device states are cleared regardless of scope, as scope may have changed
+// since alarm fired. Alarm is set inactive and stable
+func (a *Alarm) ResetState(db *gorm.DB, timestamp time.Time) error {
+	var err error
+	if a.Fired {
+		err = a.transition(db, nil, StateResolved, a.FiredSeverity, timestamp)
+	}
+	if err == nil {
+		err = a.clearDevices(db, timestamp)
+	}
+	if err == nil {
+		err = a.transition(db, nil, StateInactive, "", timestamp)
+	}
+	if err != nil {
+		return err
+	}
+	a.Flapping = false
+	err = db.Model(*a).Updates(map[string]interface{}{"state": a.State, "pending_since": a.PendingSince,
+		"flapping": false}).Error
+	if err != nil {
+		return err
+	}
+	err = ClearAlarmBaselines(db, a.ID)
+	if err != nil {
+		return err
+	}
+	return a.UpdateRunTs(db, timestamp.Add(-a.RunInterval))
+}
+
+// DeleteAlarm deletes alarm along with its history, baselines, outputs, inhibit rules, silences and escalations
+func DeleteAlarm(db *gorm.DB, id string) error {
+	tx := db.Begin()
+	err := tx.Exec("DELETE FROM output_histories WHERE output_id IN (SELECT id FROM outputs WHERE alarm_id = ?)", id).Error
+	if err == nil {
+		err = tx.Where("alarm_id = ?", id).Delete(&Output{}).Error
+	}
+	if err == nil {
+		err = tx.Unscoped().Where("alarm_id = ?", id).Delete(&AlarmHistory{}).Error
+	}
+	if err == nil {
+		err = ClearAlarmBaselines(tx, id)
+	}
+	if err == nil {
+		err = ClearAlarmDeviceStates(tx, id)
+	}
+	if err == nil {
+		err = tx.Where("alarm_id = ?", id).Delete(&AlarmTransition{}).Error
+	}
+	if err == nil {
+		err = tx.Where("source_alarm_id = ? OR target_alarm_id = ?", id, id).Delete(&InhibitRule{}).Error
+	}
+	if err == nil {
+		err = tx.Where("alarm_id = ?", id).Delete(&Silence{}).Error
+	}
+	if err == nil {
+		err = StopEscalation(tx, id, "")
+	}
+	if err == nil {
+		err = tx.Where("id = ?", id).Delete(&Alarm{}).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
 func (a *Alarm) UpdateRunTs(db *gorm.DB, timestamp time.Time) error {
 	a.LastRun = timestamp
 	return db.Model(*a).Update("last_run", a.LastRun).Error
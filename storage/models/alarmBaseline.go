@@ -0,0 +1,93 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// BaselineMethod defines how anomaly baseline is learned
+type BaselineMethod string
+
+const (
+	// BaselineRolling uses mean and standard deviation of last Window intervals
+	BaselineRolling BaselineMethod = "rolling"
+	// BaselineEwma uses exponentially weighted mean and variance
+	BaselineEwma BaselineMethod = "ewma"
+	// BaselineSeasonal uses exponentially weighted mean and variance for each hour of day
+	BaselineSeasonal BaselineMethod = "seasonal"
+)
+
+// AnomalyConfig configures anomaly alarm. Zero values are replaced with defaults
+type AnomalyConfig struct {
+	Method BaselineMethod `json:"method"`
+	// Window is number of intervals in rolling baseline
+	Window int64 `json:"window"`
+	// Alpha is smoothing factor (0-1) for ewma and seasonal baselines. Larger alpha adapts faster
+	Alpha float64 `json:"alpha"`
+	// Threshold is absolute z-score that has to be exceeded
+	Threshold float64 `json:"threshold"`
+	// MinSamples is number of points baseline needs before it is used. For seasonal baseline it is per hour
+	MinSamples int64 `json:"min_samples"`
+	// Zone is IANA time zone for hours of seasonal baseline. Defaults to UTC
+	Zone string `json:"zone"`
+}
+
+// WithDefaults returns copy of config with missing values set to defaults
+func (c AnomalyConfig) WithDefaults() AnomalyConfig {
+	if c.Method == "" {
+		c.Method = BaselineRolling
+	}
+	if c.Window <= 0 {
+		c.Window = 30
+	}
+	if c.Alpha <= 0 || c.Alpha > 1 {
+		c.Alpha = 0.1
+	}
+	if c.Threshold <= 0 {
+		c.Threshold = 3
+	}
+	if c.MinSamples <= 0 {
+		c.MinSamples = 10
+	}
+	return c
+}
+
+// String returns config as json
+func (c AnomalyConfig) String() string {
+	j, _ := json.Marshal(c)
+	return string(j)
+}
+
+// AlarmBaseline is learned state of anomaly alarm for single device and measurement
+type AlarmBaseline struct {
+	ID       uint   `gorm:"primary_key"`
+	AlarmId  string `gorm:"not null"`
+	DeviceId string `gorm:"not null"`
+	Key      string `gorm:"not null"`
+	// Config baseline was built with. If alarm config changes, baseline is rebuilt
+	Config string `gorm:"type:text"`
+	// State is serialized baseline
+	State string `gorm:"type:text"`
+	// Streak is number of consecutive anomalous points
+	Streak int64
+	// LastZ is z-score of last point
+	LastZ float64
+	// LastValue is value of last point
+	LastValue float64
+	// LastTimestamp is timestamp of last point included in baseline
+	LastTimestamp time.Time
+	UpdatedAt     time.Time
+}
+
+// GetAlarmBaselines returns all baselines of alarm
+func GetAlarmBaselines(db *gorm.DB, alarmId string) (*[]AlarmBaseline, error) {
+	baselines := &[]AlarmBaseline{}
+	res := db.Where("alarm_id = ?", alarmId).Find(baselines)
+	return baselines, res.Error
+}
+
+// ClearAlarmBaselines removes all baselines of alarm
+func ClearAlarmBaselines(db *gorm.DB, alarmId string) error {
+	return db.Where("alarm_id = ?", alarmId).Delete(&AlarmBaseline{}).Error
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// AlarmDeviceState is fire state of single device in per-device alarm
+type AlarmDeviceState struct {
+	ID            uint   `gorm:"primary_key"`
+	AlarmId       string `gorm:"not null"`
+	DeviceId      string `gorm:"not null"`
+	Fired         bool   `gorm:"not null"`
+	FiredSeverity Severity
+	// State of device, see GetState
+	State        AlarmState
+	PendingSince time.Time
+	Flapping     bool `gorm:"not null"`
+	UpdatedAt    time.Time
+}
+
+// GetAlarmDeviceStates returns device states of per-device alarm
+func GetAlarmDeviceStates(db *gorm.DB, alarmId string) (*[]AlarmDeviceState, error) {
+	states := &[]AlarmDeviceState{}
+	res := db.Where("alarm_id = ?", alarmId).Find(states)
+	return states, res.Error
+}
+
+// ClearAlarmDeviceStates removes device states of alarm
+func ClearAlarmDeviceStates(db *gorm.DB, alarmId string) error {
+	return db.Where("alarm_id = ?", alarmId).Delete(&AlarmDeviceState{}).Error
+}
+
+// FireDevice fires single device of per-device alarm. Alarm is fired if any of its devices is fired
+func (a *Alarm) FireDevice(db *gorm.DB, state *AlarmDeviceState, value float32, severity Severity,
+	timestamp time.Time) error {
+	if state.Fired {
+		return nil
+	}
+	h := &AlarmHistory{
+		AlarmId:  a.ID,
+		DeviceId: state.DeviceId,
+		Value:    fmt.Sprintf("%f", value),
+		Severity: severity,
+		Cleared:  false,
+		FiredAt:  timestamp,
+	}
+	err := db.Create(h).Error
+	if err != nil {
+		return err
+	}
+	err = a.transition(db, state, StateFiring, severity, timestamp)
+	if err != nil {
+		return err
+	}
+
+	state.AlarmId = a.ID
+	state.Fired = true
+	state.FiredSeverity = severity
+	err = db.Save(state).Error
+	if err != nil {
+		return err
+	}
+	return a.updateFromDevices(db)
+}
+
+// SetDeviceSeverity changes severity of fired device in per-device alarm
+func (a *Alarm) SetDeviceSeverity(db *gorm.DB, state *AlarmDeviceState, severity Severity) error {
+	if !state.Fired || state.FiredSeverity == severity {
+		return nil
+	}
+	err := db.Model(&AlarmHistory{}).Where("alarm_id = ? AND device_id = ? AND cleared = False", a.ID, state.DeviceId).
+		Update("severity", severity).Error
+	if err != nil {
+		return err
+	}
+	state.FiredSeverity = severity
+	err = db.Save(state).Error
+	if err != nil {
+		return err
+	}
+	return a.updateFromDevices(db)
+}
+
+// ClearDevice clears single device of per-device alarm
+func (a *Alarm) ClearDevice(db *gorm.DB, state *AlarmDeviceState, timestamp time.Time) error {
+	if !state.Fired {
+		return nil
+	}
+	res := db.Model(&AlarmHistory{}).Where("alarm_id = ? AND device_id = ? AND cleared = False", a.ID, state.DeviceId).
+		Updates(map[string]interface{}{"cleared": true, "cleared_at": timestamp})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New(fmt.Sprintf("No alarm_history found for alarm %s, device %s", a.ID, state.DeviceId))
+	}
+	err := a.transition(db, state, StateResolved, state.FiredSeverity, timestamp)
+	if err != nil {
+		return err
+	}
+
+	state.Fired = false
+	state.FiredSeverity = ""
+	err = db.Save(state).Error
+	if err != nil {
+		return err
+	}
+	return a.updateFromDevices(db)
+}
+
+// clearDevices clears all devices of per-device alarm
+func (a *Alarm) clearDevices(db *gorm.DB, timestamp time.Time) error {
+	err := db.Model(&AlarmHistory{}).Where("alarm_id = ? AND cleared = False", a.ID).
+		Updates(map[string]interface{}{"cleared": true, "cleared_at": timestamp}).Error
+	if err != nil {
+		return err
+	}
+	err = ClearAlarmDeviceStates(db, a.ID)
+	if err != nil {
+		return err
+	}
+	return a.updateFromDevices(db)
+}
+
+// updateFromDevices sets alarm fired if any of its devices is fired, with most severe device severity.
+// Acknowledgement is removed once all devices are cleared. Alarm state is firing if any device is firing,
+// pending if any device is pending, and resolved once firing alarm has no firing devices
+func (a *Alarm) updateFromDevices(db *gorm.DB) error {
+	states, err := GetAlarmDeviceStates(db, a.ID)
+	if err != nil {
+		return err
+	}
+	fired := false
+	pending := false
+	var severity Severity
+	for _, v := range *states {
+		if v.GetState() == StatePending {
+			pending = true
+		}
+		if !v.Fired {
+			continue
+		}
+		fired = true
+		if v.FiredSeverity.Level() > severity.Level() {
+			severity = v.FiredSeverity
+		}
+	}
+	switch {
+	case fired:
+		a.State = StateFiring
+	case pending:
+		a.State = StatePending
+	case a.GetState() == StateFiring:
+		a.State = StateResolved
+	case a.GetState() == StatePending:
+		a.State = StateInactive
+	}
+	a.Fired = fired
+	a.FiredSeverity = severity
+	if !fired {
+		a.Acknowledged = false
+	}
+	return db.Model(*a).Updates(map[string]interface{}{"fired": a.Fired, "fired_severity": a.FiredSeverity,
+		"acknowledged": a.Acknowledged, "state": a.GetState()}).Error
+}
@@ -1,17 +1,63 @@
 package models
 
 import (
+	"errors"
+	"fmt"
 	"github.com/jinzhu/gorm"
+	"github.com/tryffel/fusio/err"
 	"time"
 )
 
 type AlarmHistory struct {
 	gorm.Model
 	AlarmId   string `gorm:"not null"`
+	DeviceId  string
 	Value     string `gorm:"not null"`
-	Cleared   bool   `gorm:"not null"`
+	Severity  Severity
+	Cleared   bool `gorm:"not null"`
 	FiredAt   time.Time
 	ClearedAt time.Time
+	// Acknowledged is set when user has taken responsibility of fired alarm
+	Acknowledged bool `gorm:"not null"`
+	AckedBy      uint
+	AckedAt      time.Time
+	AckComment   string
+	// InhibitedBy is id of parent alarm that suppressed outputs of this item
+	InhibitedBy string
+}
+
+// Acknowledge marks fired alarm as handled by user. Acknowledgement is recorded to open history item
+// and lasts until alarm is cleared
+func (a *Alarm) Acknowledge(db *gorm.DB, userId uint, comment string, timestamp time.Time) error {
+	if !a.Fired {
+		return &Err.Error{Code: Err.Econflict, Err: errors.New("alarm is not fired")}
+	}
+	res := db.Model(&AlarmHistory{}).Where("alarm_id = ? AND cleared = False", a.ID).
+		Updates(map[string]interface{}{"acknowledged": true, "acked_by": userId, "acked_at": timestamp,
+			"ack_comment": comment})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return &Err.Error{Code: Err.Enotfound, Err: fmt.Errorf("no alarm_history found for alarm %s", a.ID)}
+	}
+	a.Acknowledged = true
+	return db.Model(*a).Update("acknowledged", true).Error
+}
+
+// Unacknowledge removes acknowledgement from fired alarm
+func (a *Alarm) Unacknowledge(db *gorm.DB) error {
+	if !a.Acknowledged {
+		return nil
+	}
+	err := db.Model(&AlarmHistory{}).Where("alarm_id = ? AND cleared = False", a.ID).
+		Updates(map[string]interface{}{"acknowledged": false, "acked_by": 0, "acked_at": time.Time{},
+			"ack_comment": ""}).Error
+	if err != nil {
+		return err
+	}
+	a.Acknowledged = false
+	return db.Model(*a).Update("acknowledged", false).Error
 }
 
 // LoadHistory loads first 20 history items
@@ -27,3 +73,74 @@ func (a *Alarm) GetHistorySize(db *gorm.DB) (int, error) {
 	res := db.Where("alarm_id = ?", a.ID).Find(&[]AlarmHistory{}).Count(&c)
 	return c, res.Error
 }
+
+// GetAlarmHistory returns history items for given alarms that were active between from and to
+func GetAlarmHistory(db *gorm.DB, alarmIds []string, from time.Time, to time.Time) (*[]AlarmHistory, error) {
+	h := &[]AlarmHistory{}
+	res := db.Where("alarm_id IN (?) AND fired_at <= ? AND (cleared = False OR cleared_at >= ?)", alarmIds, to, from).
+		Order("fired_at asc").Find(h)
+	return h, res.Error
+}
+
+// History states
+const (
+	HistoryFired        = "fired"
+	HistoryAcknowledged = "acknowledged"
+	HistoryCleared      = "cleared"
+)
+
+// AlarmHistoryQuery filters history of owners alarms. Empty fields are not filtered.
+// Items are returned newest first, starting after cursor
+type AlarmHistoryQuery struct {
+	OwnerId uint
+	AlarmId string
+	GroupId string
+	// From and To select items that were active at any time within range, i.e. fired before To and
+	// still fired or cleared after From
+	From       time.Time
+	To         time.Time
+	State      string
+	Severities []Severity
+	// Cursor is id of last item of previous page
+	Cursor uint
+	Limit  int
+}
+
+// QueryAlarmHistory returns history items matching query
+func QueryAlarmHistory(db *gorm.DB, q *AlarmHistoryQuery) (*[]AlarmHistory, error) {
+	alarms := db.Table("alarms").Select("id").Where("owner_id = ?", q.OwnerId)
+	if q.GroupId != "" {
+		alarms = alarms.Where("\"group\" = ?", q.GroupId)
+	}
+	query := db.Where("alarm_id IN (?)", alarms.QueryExpr())
+	if q.AlarmId != "" {
+		query = query.Where("alarm_id = ?", q.AlarmId)
+	}
+	if !q.From.IsZero() {
+		query = query.Where("(cleared = False OR cleared_at >= ?)", q.From)
+	}
+	if !q.To.IsZero() {
+		query = query.Where("fired_at <= ?", q.To)
+	}
+	switch q.State {
+	case HistoryFired:
+		query = query.Where("cleared = False AND acknowledged = False")
+	case HistoryAcknowledged:
+		query = query.Where("cleared = False AND acknowledged = True")
+	case HistoryCleared:
+		query = query.Where("cleared = True")
+	}
+	if len(q.Severities) > 0 {
+		query = query.Where("severity IN (?)", q.Severities)
+	}
+	if q.Cursor > 0 {
+		query = query.Where("id < ?", q.Cursor)
+	}
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+
+	h := &[]AlarmHistory{}
+	res := query.Order("id desc").Find(h)
+	return h, res.Error
+}
@@ -0,0 +1,159 @@
+package models
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// AlarmState is state of alarm, or of single device in per-device alarm
+type AlarmState string
+
+const (
+	// StateInactive alarm condition is not met
+	StateInactive AlarmState = "inactive"
+	// StatePending alarm condition is met, but has not held for alarms for-duration yet
+	StatePending AlarmState = "pending"
+	// StateFiring alarm is fired
+	StateFiring AlarmState = "firing"
+	// StateResolved fired alarm has cleared
+	StateResolved AlarmState = "resolved"
+)
+
+// ParseAlarmState validates state. Empty string returns empty state
+func ParseAlarmState(s string) (AlarmState, error) {
+	state := AlarmState(s)
+	switch state {
+	case "", StateInactive, StatePending, StateFiring, StateResolved:
+		return state, nil
+	}
+	return state, fmt.Errorf("invalid state '%s', expected inactive, pending, firing or resolved", s)
+}
+
+// AlarmTransition records change of alarm state. DeviceId is set for device of per-device alarm
+type AlarmTransition struct {
+	ID        uint   `gorm:"primary_key"`
+	AlarmId   string `gorm:"not null"`
+	DeviceId  string
+	FromState AlarmState `gorm:"not null"`
+	ToState   AlarmState `gorm:"not null"`
+	// Severity alarm fired with, set for firing and resolved transitions
+	Severity Severity
+	// Flapping is set if target was flapping when transition happened
+	Flapping  bool      `gorm:"not null"`
+	Timestamp time.Time `gorm:"not null"`
+}
+
+// GetState returns state of alarm. Alarms evaluated before states were recorded are either firing or inactive
+func (a *Alarm) GetState() AlarmState {
+	if a.State != "" {
+		return a.State
+	}
+	if a.Fired {
+		return StateFiring
+	}
+	return StateInactive
+}
+
+// GetState returns state of device, see Alarm.GetState
+func (s *AlarmDeviceState) GetState() AlarmState {
+	if s.State != "" {
+		return s.State
+	}
+	if s.Fired {
+		return StateFiring
+	}
+	return StateInactive
+}
+
+// transition records transition of alarm, or device of per-device alarm if state is set, and sets new state
+// and pending time on it. Caller saves alarm or device state
+func (a *Alarm) transition(db *gorm.DB, state *AlarmDeviceState, to AlarmState, severity Severity,
+	timestamp time.Time) error {
+	t := &AlarmTransition{
+		AlarmId:   a.ID,
+		ToState:   to,
+		Severity:  severity,
+		Flapping:  a.Flapping,
+		Timestamp: timestamp,
+	}
+	if state != nil {
+		t.DeviceId = state.DeviceId
+		t.FromState = state.GetState()
+		t.Flapping = state.Flapping
+	} else {
+		t.FromState = a.GetState()
+	}
+	if t.FromState == to {
+		return nil
+	}
+	err := db.Create(t).Error
+	if err != nil {
+		return err
+	}
+
+	var pendingSince time.Time
+	if to == StatePending {
+		pendingSince = timestamp
+	}
+	if state != nil {
+		state.State = to
+		state.PendingSince = pendingSince
+	} else {
+		a.State = to
+		a.PendingSince = pendingSince
+	}
+	return nil
+}
+
+// SetState sets alarm, or device of per-device alarm if state is set, pending or inactive.
+// Firing and resolved states are set when alarm is fired and cleared
+func (a *Alarm) SetState(db *gorm.DB, state *AlarmDeviceState, to AlarmState, timestamp time.Time) error {
+	err := a.transition(db, state, to, "", timestamp)
+	if err != nil {
+		return err
+	}
+	if state != nil {
+		state.AlarmId = a.ID
+		err = db.Save(state).Error
+		if err != nil {
+			return err
+		}
+		return a.updateFromDevices(db)
+	}
+	return db.Model(*a).Updates(map[string]interface{}{"state": a.State, "pending_since": a.PendingSince}).Error
+}
+
+// SetFlapping marks alarm, or device of per-device alarm if state is set, flapping or stable
+func (a *Alarm) SetFlapping(db *gorm.DB, state *AlarmDeviceState, flapping bool) error {
+	if state != nil {
+		state.AlarmId = a.ID
+		state.Flapping = flapping
+		return db.Save(state).Error
+	}
+	a.Flapping = flapping
+	return db.Model(*a).Update("flapping", flapping).Error
+}
+
+// CountTransitions returns number of times alarm, or device of per-device alarm, has fired or resolved since time
+func (a *Alarm) CountTransitions(db *gorm.DB, state *AlarmDeviceState, since time.Time) (int, error) {
+	device := ""
+	if state != nil {
+		device = state.DeviceId
+	}
+	var count int
+	err := db.Model(&AlarmTransition{}).Where("alarm_id = ? AND device_id = ? AND timestamp >= ? AND to_state IN (?)",
+		a.ID, device, since, []AlarmState{StateFiring, StateResolved}).Count(&count).Error
+	return count, err
+}
+
+// GetAlarmTransitions returns newest transitions of alarm. Empty device returns transitions of all devices
+func GetAlarmTransitions(db *gorm.DB, alarmId string, device string, limit int) (*[]AlarmTransition, error) {
+	transitions := &[]AlarmTransition{}
+	query := db.Where("alarm_id = ?", alarmId)
+	if device != "" {
+		query = query.Where("device_id = ?", device)
+	}
+	err := query.Order("timestamp desc, id desc").Limit(limit).Find(transitions).Error
+	return transitions, err
+}
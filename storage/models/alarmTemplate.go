@@ -0,0 +1,147 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/tryffel/fusio/util"
+	"time"
+)
+
+// AlarmTemplate holds alarm definition and outputs that can be instantiated for many groups or devices.
+// Alarms created from template are linked to it with Alarm.TemplateId
+type AlarmTemplate struct {
+	ID      string `gorm:"primary_key"`
+	OwnerId uint   `gorm:"not null"`
+	// Name is name of template and its alarms
+	Name    string `gorm:"not null"`
+	Info    string
+	Message string
+	Enabled bool `gorm:"not null"`
+	// Scope of instances. Group and per-device templates are instantiated for groups, device templates for devices
+	Scope              AlarmScope
+	Severity           Severity
+	Labels             Labels `gorm:"type:text"`
+	EscalationPolicyId string
+	Filter             AlarmFilter     `gorm:"type:text"`
+	RunInterval        time.Duration   `gorm:"not null"`
+	Outputs            TemplateOutputs `gorm:"type:text"`
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+// TemplateOutput is output created for each alarm of template
+type TemplateOutput struct {
+	Name            string        `json:"name"`
+	OutputChannelId string        `json:"output_channel_id"`
+	FireTemplate    string        `json:"fire_template"`
+	ClearTemplate   string        `json:"clear_template"`
+	ErrorTemplate   string        `json:"error_template"`
+	Repeat          time.Duration `json:"repeat"`
+	MaxRepeat       int           `json:"max_repeat"`
+	MinSeverity     Severity      `json:"min_severity"`
+}
+
+type TemplateOutputs []TemplateOutput
+
+func (t *TemplateOutputs) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return errors.New("TemplateOutputs is not string in db (alarm_templates.outputs)")
+	}
+	return json.Unmarshal(b, t)
+}
+
+func (t TemplateOutputs) Value() (driver.Value, error) {
+	j, err := json.Marshal(t)
+	return string(j), err
+}
+
+func (t *AlarmTemplate) BeforeCreate() error {
+	if t.ID == "" {
+		t.ID = util.NewUuid()
+	}
+	return nil
+}
+
+// ToAlarm returns alarm of template for group or device. Alarm is not saved
+func (t *AlarmTemplate) ToAlarm(group string, device string) *Alarm {
+	return &Alarm{
+		Name:               t.Name,
+		Info:               t.Info,
+		Message:            t.Message,
+		OwnerId:            t.OwnerId,
+		Group:              group,
+		DeviceId:           device,
+		Enabled:            t.Enabled,
+		Scope:              t.Scope,
+		Severity:           t.Severity,
+		Labels:             t.Labels,
+		EscalationPolicyId: t.EscalationPolicyId,
+		Filter:             t.Filter,
+		RunInterval:        t.RunInterval,
+		TemplateId:         t.ID,
+	}
+}
+
+// ToOutput returns output for alarm. Output is not saved
+func (o *TemplateOutput) ToOutput(alarm *Alarm) *Output {
+	return &Output{
+		OwnerId:         alarm.OwnerId,
+		AlarmId:         alarm.ID,
+		Name:            o.Name,
+		OutputChannelId: o.OutputChannelId,
+		FireTemplate:    o.FireTemplate,
+		ClearTemplate:   o.ClearTemplate,
+		ErrorTemplate:   o.ErrorTemplate,
+		Repeat:          o.Repeat,
+		MaxRepeat:       o.MaxRepeat,
+		MinSeverity:     o.MinSeverity,
+		Enabled:         true,
+		OnFire:          true,
+		OnClear:         true,
+		OnError:         true,
+	}
+}
+
+// GetTemplateAlarms returns alarms linked to template
+func GetTemplateAlarms(db *gorm.DB, templateId string) (*[]Alarm, error) {
+	alarms := &[]Alarm{}
+	res := db.Where("template_id = ?", templateId).Order("name asc").Find(alarms)
+	return alarms, res.Error
+}
+
+// CreateTemplateAlarm creates alarm of template along with outputs of template. Alarm is created only if all
+// of its outputs are
+func CreateTemplateAlarm(db *gorm.DB, template *AlarmTemplate, alarm *Alarm) error {
+	tx := db.Begin()
+	err := tx.Create(alarm).Error
+	for i := 0; err == nil && i < len(template.Outputs); i++ {
+		err = tx.Create(template.Outputs[i].ToOutput(alarm)).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// DeleteAlarmTemplate deletes template. Its alarms are kept, but unlinked from template
+func DeleteAlarmTemplate(db *gorm.DB, template *AlarmTemplate) error {
+	tx := db.Begin()
+	err := tx.Model(&Alarm{}).Where("template_id = ?", template.ID).Update("template_id", "").Error
+	if err == nil {
+		err = tx.Delete(template).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/tryffel/fusio/util"
+	"time"
+)
+
+// EscalationPolicy notifies output channels step by step until fired alarm is acknowledged or cleared
+type EscalationPolicy struct {
+	ID      string          `gorm:"primary_key"`
+	OwnerId uint            `gorm:"not null"`
+	Name    string          `gorm:"not null"`
+	Steps   EscalationSteps `gorm:"type:text"`
+	// Repeat starts again from first step after last step, otherwise escalation stops after last step
+	Repeat    bool `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// EscalationStep notifies output channels and waits delay before next step
+type EscalationStep struct {
+	OutputChannels []string `json:"output_channels"`
+	// Template for notification, defaults to DefaultEscalationTemplate
+	Template string        `json:"template,omitempty"`
+	Delay    time.Duration `json:"delay"`
+}
+
+type EscalationSteps []EscalationStep
+
+const DefaultEscalationTemplate = "{{.Severity}}: alarm {{.AlarmName}} {{.DeviceName}} is not acknowledged. {{.AlarmMsg}}"
+
+func (s *EscalationSteps) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return errors.New("EscalationSteps is not string in db (escalation_policies.steps)")
+	}
+	return json.Unmarshal(b, s)
+}
+
+func (s EscalationSteps) Value() (driver.Value, error) {
+	j, err := json.Marshal(s)
+	return string(j), err
+}
+
+func (e *EscalationPolicy) BeforeCreate() error {
+	if e.ID == "" {
+		e.ID = util.NewUuid()
+	}
+	return nil
+}
+
+// Escalation is running escalation of fired alarm or device of per-device alarm. Escalations are persisted,
+// so they continue after restart
+type Escalation struct {
+	ID       uint   `gorm:"primary_key"`
+	AlarmId  string `gorm:"not null"`
+	DeviceId string
+	PolicyId string `gorm:"not null"`
+	// Step is index of next step to run
+	Step int `gorm:"not null"`
+	// NextAt is time next step is due
+	NextAt    time.Time `gorm:"not null"`
+	StartedAt time.Time `gorm:"not null"`
+}
+
+// StartEscalation starts escalation from first step. Running escalation of alarm and device is restarted
+func StartEscalation(db *gorm.DB, alarm *Alarm, device string, timestamp time.Time) error {
+	err := StopEscalation(db, alarm.ID, device)
+	if err != nil {
+		return err
+	}
+	e := &Escalation{
+		AlarmId:   alarm.ID,
+		DeviceId:  device,
+		PolicyId:  alarm.EscalationPolicyId,
+		Step:      0,
+		NextAt:    timestamp,
+		StartedAt: timestamp,
+	}
+	return db.Create(e).Error
+}
+
+// StopEscalation stops escalation of alarm and device. Empty device stops all escalations of alarm
+func StopEscalation(db *gorm.DB, alarmId string, device string) error {
+	query := db.Where("alarm_id = ?", alarmId)
+	if device != "" {
+		query = query.Where("device_id = ?", device)
+	}
+	return query.Delete(&Escalation{}).Error
+}
+
+// GetDueEscalations returns escalations whose next step is due at given time
+func GetDueEscalations(db *gorm.DB, timestamp time.Time) (*[]Escalation, error) {
+	escalations := &[]Escalation{}
+	res := db.Where("next_at <= ?", timestamp).Order("next_at asc").Find(escalations)
+	return escalations, res.Error
+}
+
+// DeleteEscalationPolicy removes policy from alarms and alarm templates, stops its escalations and deletes it
+func DeleteEscalationPolicy(db *gorm.DB, policy *EscalationPolicy) error {
+	tx := db.Begin()
+	err := tx.Model(&Alarm{}).Where("escalation_policy_id = ?", policy.ID).Update("escalation_policy_id", "").Error
+	if err == nil {
+		err = tx.Model(&AlarmTemplate{}).Where("escalation_policy_id = ?", policy.ID).
+			Update("escalation_policy_id", "").Error
+	}
+	if err == nil {
+		err = tx.Where("policy_id = ?", policy.ID).Delete(&Escalation{}).Error
+	}
+	if err == nil {
+		err = tx.Delete(policy).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// GroupMembership records time range device has been member of group. LeftAt is nil while device is still
+// in group. Memberships are only recorded if membership history is enabled.
+type GroupMembership struct {
+	ID       uint      `gorm:"primary_key"`
+	GroupId  string    `gorm:"not null"`
+	DeviceId string    `gorm:"not null"`
+	JoinedAt time.Time `gorm:"not null"`
+	LeftAt   *time.Time
+}
+
+// GetGroupDeviceIds returns ids of devices currently in group
+func GetGroupDeviceIds(db *gorm.DB, group string) ([]string, error) {
+	devices := []string{}
+	err := db.Table("groups_devices").Where("group_id = ?", group).Pluck("device_id", &devices).Error
+	return devices, err
+}
+
+// GetGroupMemberships returns memberships of group that overlap with time range from - to
+func GetGroupMemberships(db *gorm.DB, group string, from time.Time, to time.Time) (*[]GroupMembership, error) {
+	memberships := &[]GroupMembership{}
+	res := db.Where("group_id = ? AND joined_at <= ? AND (left_at IS NULL OR left_at >= ?)", group, to, from).
+		Order("joined_at asc").Find(memberships)
+	return memberships, res.Error
+}
+
+// GetGroupMembers returns memberships of group that overlap with time range from - to. Devices that are
+// in group but have no recorded membership, i.e. were added before history was enabled, are returned
+// with zero JoinedAt, as members for all time
+func GetGroupMembers(db *gorm.DB, group string, from time.Time, to time.Time) (*[]GroupMembership, error) {
+	memberships, err := GetGroupMemberships(db, group, from, to)
+	if err != nil {
+		return memberships, err
+	}
+	current, err := GetGroupDeviceIds(db, group)
+	if err != nil || len(current) == 0 {
+		return memberships, err
+	}
+	recorded := []string{}
+	err = db.Model(&GroupMembership{}).Where("group_id = ? AND device_id IN (?)", group, current).
+		Pluck("DISTINCT device_id", &recorded).Error
+	if err != nil {
+		return memberships, err
+	}
+	tracked := make(map[string]bool, len(recorded))
+	for _, v := range recorded {
+		tracked[v] = true
+	}
+	for _, v := range current {
+		if !tracked[v] {
+			*memberships = append(*memberships, GroupMembership{GroupId: group, DeviceId: v})
+		}
+	}
+	return memberships, nil
+}
+
+// JoinGroup opens membership for devices
+func JoinGroup(db *gorm.DB, group string, devices []string, timestamp time.Time) error {
+	for _, v := range devices {
+		open := 0
+		err := db.Model(&GroupMembership{}).Where("group_id = ? AND device_id = ? AND left_at IS NULL", group, v).
+			Count(&open).Error
+		if err != nil {
+			return err
+		}
+		if open > 0 {
+			continue
+		}
+		err = db.Create(&GroupMembership{GroupId: group, DeviceId: v, JoinedAt: timestamp}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LeaveGroup closes open memberships for devices
+func LeaveGroup(db *gorm.DB, group string, devices []string, timestamp time.Time) error {
+	return db.Model(&GroupMembership{}).Where("group_id = ? AND device_id IN (?) AND left_at IS NULL", group, devices).
+		Update("left_at", timestamp).Error
+}
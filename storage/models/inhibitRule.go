@@ -0,0 +1,88 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/tryffel/fusio/util"
+	"time"
+)
+
+// InhibitRule suppresses outputs of child alarms while parent alarm is fired, e.g. sensors behind offline
+// gateway. Children are matched either explicitly by alarm or by group.
+type InhibitRule struct {
+	ID      string `gorm:"primary_key"`
+	OwnerId uint   `gorm:"not null"`
+	Comment string
+	// SourceAlarmId is parent alarm that inhibits children when fired
+	SourceAlarmId string `gorm:"not null"`
+	TargetAlarmId string
+	TargetGroupId string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Matches returns true if alarm is child of rule. Parent never inhibits itself
+func (i *InhibitRule) Matches(alarm *Alarm) bool {
+	if alarm.ID == i.SourceAlarmId {
+		return false
+	}
+	if i.TargetAlarmId != "" {
+		return i.TargetAlarmId == alarm.ID
+	}
+	return i.TargetGroupId != "" && i.TargetGroupId == alarm.Group
+}
+
+func (i *InhibitRule) BeforeCreate() error {
+	if i.ID == "" {
+		i.ID = util.NewUuid()
+	}
+	return nil
+}
+
+// GetInhibitingAlarm returns fired parent alarm that inhibits given alarm, or nil if there's none
+func GetInhibitingAlarm(db *gorm.DB, alarm *Alarm) (*Alarm, error) {
+	rules := &[]InhibitRule{}
+	err := db.Where("owner_id = ? AND source_alarm_id <> ? AND (target_alarm_id = ? OR target_group_id = ?)",
+		alarm.OwnerId, alarm.ID, alarm.ID, alarm.Group).Order("created_at asc").Find(rules).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range *rules {
+		if !v.Matches(alarm) {
+			continue
+		}
+		parent := &Alarm{}
+		res := db.Where("id = ? AND fired = True", v.SourceAlarmId).Limit(1).Find(parent)
+		if res.RecordNotFound() {
+			continue
+		}
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		return parent, nil
+	}
+	return nil, nil
+}
+
+// SetInhibited records to open history item that outputs were suppressed by parent alarm
+func (a *Alarm) SetInhibited(db *gorm.DB, device string, parent *Alarm) error {
+	query := db.Model(&AlarmHistory{}).Where("alarm_id = ? AND cleared = False", a.ID)
+	if device != "" {
+		query = query.Where("device_id = ?", device)
+	}
+	return query.Update("inhibited_by", parent.ID).Error
+}
+
+// IsInhibited returns true if latest history item of alarm was inhibited. Inhibition lasts until alarm clears,
+// even if parent clears first
+func (a *Alarm) IsInhibited(db *gorm.DB, device string) (bool, error) {
+	h := &AlarmHistory{}
+	query := db.Where("alarm_id = ?", a.ID)
+	if device != "" {
+		query = query.Where("device_id = ?", device)
+	}
+	res := query.Order("fired_at desc").Limit(1).Find(h)
+	if res.RecordNotFound() {
+		return false, nil
+	}
+	return h.InhibitedBy != "", res.Error
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+// Labels are user defined key-value pairs, e.g. site=helsinki
+type Labels map[string]string
+
+// Matches returns true if all of given labels are found with same values
+func (l Labels) Matches(other Labels) bool {
+	for k, v := range other {
+		if l[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *Labels) Scan(value interface{}) error {
+	if value == nil {
+		*l = Labels{}
+		return nil
+	}
+	var b []byte
+	switch v := value.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return errors.New("Labels is not string in db")
+	}
+	if len(b) == 0 {
+		*l = Labels{}
+		return nil
+	}
+	return json.Unmarshal(b, l)
+}
+
+func (l Labels) Value() (driver.Value, error) {
+	if l == nil {
+		return "{}", nil
+	}
+	j, err := json.Marshal(l)
+	return string(j), err
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// Lease is held by single instance at a time. Holder must renew lease before it expires,
+// otherwise any instance can take it over
+type Lease struct {
+	Name      string    `gorm:"primary_key"`
+	Holder    string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+// LeaseAlarms is lease of instance that evaluates alarms and escalations
+const LeaseAlarms = "alarms"
+
+// AcquireLease takes or renews lease for holder for ttl. Returns false if lease is held by other instance
+// and has not expired. Expiry is compared to database time, so that clock skew between instances
+// doesn't let two instances hold lease at the same time
+func AcquireLease(db *gorm.DB, name string, holder string, ttl time.Duration) (bool, error) {
+	// Upsert is atomic, so only one instance can create lease or take over expired lease
+	res := db.Exec("INSERT INTO leases (name, holder, expires_at, updated_at) "+
+		"VALUES (?, ?, now() + interval '1s' * ?, now()) "+
+		"ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at, "+
+		"updated_at = excluded.updated_at WHERE leases.holder = excluded.holder OR leases.expires_at < now()",
+		name, holder, ttl.Seconds())
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// ReleaseLease releases lease if it's held by holder, so that other instance can take it immediately
+func ReleaseLease(db *gorm.DB, name string, holder string) error {
+	return db.Where("name = ? AND holder = ?", name, holder).Delete(&Lease{}).Error
+}
@@ -5,9 +5,7 @@ import (
 	"time"
 )
 
-// TODO: obsolete
-
-// Measurement single measurement for given device with either boolean, string or float32 value
+// Measurement metadata for single measurement key of device. Actual values are stored in influxdb
 type Measurement struct {
 	gorm.Model
 	DeviceId        string `gorm:"not null"`
@@ -16,3 +14,28 @@ type Measurement struct {
 	Unit            string
 	LastMeasurement time.Time
 }
+
+// GetMeasurementUnits returns map of measurement name -> unit for given devices
+func GetMeasurementUnits(db *gorm.DB, devices []string) (map[string]map[string]string, error) {
+	measurements := &[]Measurement{}
+	res := db.Where("device_id IN (?)", devices).Find(measurements)
+	units := make(map[string]map[string]string)
+	for _, v := range *measurements {
+		if units[v.DeviceId] == nil {
+			units[v.DeviceId] = make(map[string]string)
+		}
+		units[v.DeviceId][v.Name] = v.Unit
+	}
+	return units, res.Error
+}
+
+// SetMeasurementUnit sets unit for devices measurement, creating metadata if needed
+func SetMeasurementUnit(db *gorm.DB, device string, name string, unit string) error {
+	m := &Measurement{}
+	res := db.Where(Measurement{DeviceId: device, Name: name}).FirstOrInit(m)
+	if res.Error != nil {
+		return res.Error
+	}
+	m.Unit = unit
+	return db.Save(m).Error
+}
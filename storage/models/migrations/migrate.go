@@ -42,6 +42,20 @@ func (m migration) Run(db *gorm.DB) error {
 
 var Migrations = []Migration{
 	migration{level: 1, name: "initial schema", f: initialSchema},
+	migration{level: 2, name: "measurement metadata", f: measurementMetadata},
+	migration{level: 3, name: "group membership history", f: groupMemberships},
+	migration{level: 4, name: "alarm baselines", f: alarmBaselines},
+	migration{level: 5, name: "alarm severities", f: alarmSeverities},
+	migration{level: 6, name: "alarm acknowledgements", f: alarmAcknowledgements},
+	migration{level: 7, name: "alarm scopes", f: alarmScopes},
+	migration{level: 8, name: "silences", f: silences},
+	migration{level: 9, name: "inhibit rules", f: inhibitRules},
+	migration{level: 10, name: "escalation policies", f: escalationPolicies},
+	migration{level: 11, name: "output repeats", f: outputRepeats},
+	migration{level: 12, name: "alarm templates", f: alarmTemplates},
+	migration{level: 13, name: "leases", f: leases},
+	migration{level: 14, name: "alarm states", f: alarmStates},
+	migration{level: 15, name: "aggregation keys", f: aggregationKeys},
 }
 
 // Run migrations, if target = -1, run all migrations, otherwise migrate to given level
@@ -60,7 +74,7 @@ func RunMigrations(db *gorm.DB, target int) error {
 	if len(*failed) > 0 {
 		var levels []string
 		for _, v := range *failed {
-			levels = append(levels, string(v.Level))
+			levels = append(levels, fmt.Sprint(v.Level))
 		}
 		text := strings.Join(levels, ", ")
 		return &Err.Error{Code: Err.Einternal, Err: errors.New(
@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+func escalationPolicies(tx *gorm.DB) error {
+
+	sql := `
+CREATE TABLE escalation_policies
+(
+  id         TEXT    NOT NULL,
+  owner_id   INTEGER NOT NULL,
+  name       TEXT    NOT NULL,
+  steps      TEXT,
+  repeat     BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMP WITH TIME ZONE,
+  updated_at TIMESTAMP WITH TIME ZONE,
+
+  CONSTRAINT escalation_policies_pkey
+    PRIMARY KEY (id),
+  CONSTRAINT escalation_policies_owner_id_fkey
+    FOREIGN KEY (owner_id) REFERENCES users (id)
+      ON DELETE CASCADE
+);
+
+ALTER TABLE alarms
+  ADD COLUMN escalation_policy_id TEXT;
+
+CREATE TABLE escalations
+(
+  id         SERIAL                   NOT NULL,
+  alarm_id   TEXT                     NOT NULL,
+  device_id  TEXT,
+  policy_id  TEXT                     NOT NULL,
+  step       INTEGER                  NOT NULL,
+  next_at    TIMESTAMP WITH TIME ZONE NOT NULL,
+  started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+  CONSTRAINT escalations_pkey
+    PRIMARY KEY (id),
+  CONSTRAINT escalations_alarm_id_fkey
+    FOREIGN KEY (alarm_id) REFERENCES alarms (id)
+      ON DELETE CASCADE,
+  CONSTRAINT escalations_policy_id_fkey
+    FOREIGN KEY (policy_id) REFERENCES escalation_policies (id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX escalations_next_at ON escalations (next_at);
+`
+	return tx.Exec(sql).Error
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+func outputRepeats(tx *gorm.DB) error {
+
+	sql := `
+ALTER TABLE outputs
+  ADD COLUMN max_repeat INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE output_repeats
+(
+  id          SERIAL  NOT NULL,
+  output_id   TEXT    NOT NULL,
+  device_id   TEXT    NOT NULL DEFAULT '',
+  count       INTEGER NOT NULL DEFAULT 0,
+  last_pushed TIMESTAMP WITH TIME ZONE,
+
+  CONSTRAINT output_repeats_pkey
+    PRIMARY KEY (id),
+  CONSTRAINT output_repeats_output_id_fkey
+    FOREIGN KEY (output_id) REFERENCES outputs (id)
+      ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX output_repeats_output_device ON output_repeats (output_id, device_id);
+`
+	return tx.Exec(sql).Error
+}
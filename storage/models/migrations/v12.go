@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+func alarmTemplates(tx *gorm.DB) error {
+
+	sql := `
+CREATE TABLE alarm_templates
+(
+  id                   TEXT    NOT NULL,
+  owner_id             INTEGER NOT NULL,
+  name                 TEXT    NOT NULL,
+  info                 TEXT,
+  message              TEXT,
+  enabled              BOOLEAN NOT NULL DEFAULT TRUE,
+  scope                TEXT,
+  severity             TEXT,
+  labels               TEXT,
+  escalation_policy_id TEXT,
+  filter               TEXT,
+  run_interval         BIGINT  NOT NULL,
+  outputs              TEXT,
+  created_at           TIMESTAMP WITH TIME ZONE,
+  updated_at           TIMESTAMP WITH TIME ZONE,
+
+  CONSTRAINT alarm_templates_pkey
+    PRIMARY KEY (id),
+  CONSTRAINT alarm_templates_owner_id_fkey
+    FOREIGN KEY (owner_id) REFERENCES users (id)
+      ON DELETE CASCADE
+);
+
+ALTER TABLE alarms
+  ADD COLUMN template_id TEXT;
+`
+	return tx.Exec(sql).Error
+}
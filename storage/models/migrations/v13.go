@@ -0,0 +1,22 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+func leases(tx *gorm.DB) error {
+
+	sql := `
+CREATE TABLE leases
+(
+  name       TEXT NOT NULL,
+  holder     TEXT NOT NULL,
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  updated_at TIMESTAMP WITH TIME ZONE,
+
+  CONSTRAINT leases_pkey
+    PRIMARY KEY (name)
+);
+`
+	return tx.Exec(sql).Error
+}
@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+func alarmStates(tx *gorm.DB) error {
+
+	sql := `
+ALTER TABLE alarms
+  ADD COLUMN state          TEXT,
+  ADD COLUMN pending_since  TIMESTAMP WITH TIME ZONE,
+  ADD COLUMN for_duration   BIGINT  NOT NULL DEFAULT 0,
+  ADD COLUMN flapping       BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD COLUMN flap_window    BIGINT  NOT NULL DEFAULT 0,
+  ADD COLUMN flap_threshold INTEGER NOT NULL DEFAULT 0;
+
+UPDATE alarms
+SET state = CASE WHEN fired THEN 'firing' ELSE 'inactive' END;
+
+ALTER TABLE alarm_device_states
+  ADD COLUMN state         TEXT,
+  ADD COLUMN pending_since TIMESTAMP WITH TIME ZONE,
+  ADD COLUMN flapping      BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE alarm_device_states
+SET state = CASE WHEN fired THEN 'firing' ELSE 'inactive' END;
+
+CREATE TABLE alarm_transitions
+(
+  id         SERIAL                   NOT NULL,
+  alarm_id   TEXT                     NOT NULL,
+  device_id  TEXT                     NOT NULL DEFAULT '',
+  from_state TEXT                     NOT NULL,
+  to_state   TEXT                     NOT NULL,
+  severity   TEXT,
+  flapping   BOOLEAN                  NOT NULL DEFAULT FALSE,
+  timestamp  TIMESTAMP WITH TIME ZONE NOT NULL,
+
+  CONSTRAINT alarm_transitions_pkey
+    PRIMARY KEY (id),
+  CONSTRAINT alarm_transitions_alarm_id_fkey
+    FOREIGN KEY (alarm_id) REFERENCES alarms (id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX alarm_transitions_timestamp ON alarm_transitions (alarm_id, device_id, timestamp);
+`
+	return tx.Exec(sql).Error
+}
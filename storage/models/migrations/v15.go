@@ -0,0 +1,119 @@
+package migrations
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/tryffel/fusio/expression"
+	"github.com/tryffel/fusio/storage/models"
+	"strings"
+)
+
+// aggregationKeys renames keys of filters with transformation parameters in stored expressions of alarms and
+// templates. Keys stored before parameters were part of them lack parameters:
+// derivative_mean_temperature -> derivative_1m_mean_temperature
+func aggregationKeys(tx *gorm.DB) error {
+	for _, table := range []string{"alarms", "alarm_templates"} {
+		err := upgradeFilterKeys(tx, table)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func upgradeFilterKeys(tx *gorm.DB, table string) error {
+	rows, err := tx.Raw(fmt.Sprintf("SELECT id, filter FROM %s", table)).Rows()
+	if err != nil {
+		return err
+	}
+	filters := make(map[string]string)
+	for rows.Next() {
+		var id, filter string
+		err = rows.Scan(&id, &filter)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		filters[id] = filter
+	}
+	rows.Close()
+
+	for id, stored := range filters {
+		filter := &models.AlarmFilter{}
+		err = json.Unmarshal([]byte(stored), filter)
+		if err != nil {
+			return fmt.Errorf("invalid filter in %s %s: %v", table, id, err)
+		}
+		if !upgradeKeys(filter) {
+			continue
+		}
+		b, err := json.Marshal(filter)
+		if err != nil {
+			return err
+		}
+		err = tx.Exec(fmt.Sprintf("UPDATE %s SET filter = ? WHERE id = ?", table), string(b), id).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upgradeKeys renames legacy keys in expressions of filter. Returns true if any of them was renamed
+func upgradeKeys(f *models.AlarmFilter) bool {
+	current := make(map[string]bool, len(f.Filters))
+	for _, v := range f.Filters {
+		current[v.StringSimplified()] = true
+	}
+	keys := make(map[string]string)
+	for _, v := range f.Filters {
+		legacy := fmt.Sprintf("%s_%s", v.Selector, v.Key)
+		for _, t := range v.Transformations {
+			legacy = fmt.Sprintf("%s_%s", t.Function, legacy)
+		}
+		if !current[legacy] {
+			keys[legacy] = v.StringSimplified()
+		}
+	}
+	if len(keys) == 0 {
+		return false
+	}
+
+	renamed := false
+	rename := func(source string) string {
+		upgraded := renameKeys(source, keys)
+		renamed = renamed || upgraded != source
+		return upgraded
+	}
+	f.Expression = rename(f.Expression)
+	f.ClearExpression = rename(f.ClearExpression)
+	for i := range f.Thresholds {
+		f.Thresholds[i].Expression = rename(f.Thresholds[i].Expression)
+	}
+	return renamed
+}
+
+// renameKeys renames identifiers of simplified expression. Invalid expression is returned as is
+func renameKeys(source string, keys map[string]string) string {
+	if source == "" {
+		return source
+	}
+	e, err := expression.Parse(source)
+	if err != nil {
+		return source
+	}
+	renamed := false
+	root := expression.Rewrite(e.Root, func(n expression.Node) expression.Node {
+		if v, ok := n.(*expression.Ident); ok && keys[v.Name] != "" {
+			renamed = true
+			return &expression.Ident{Name: keys[v.Name]}
+		}
+		return n
+	})
+	if !renamed {
+		return source
+	}
+	// Stored expressions are kept without whitespace
+	return strings.Replace(root.String(), " ", "", -1)
+}
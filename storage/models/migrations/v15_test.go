@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"encoding/json"
+	"github.com/tryffel/fusio/storage/models"
+	"testing"
+)
+
+func TestUpgradeKeys(t *testing.T) {
+	// Stored before transformation parameters were part of keys
+	stored := `{"filters":[{"selector":"mean","key":"temperature","transformation":"derivative","param":10},` +
+		`{"selector":"mean","key":"temperature"}],"expression":"derivative_mean_temperature>1&&mean_temperature>5",` +
+		`"clear_expression":"derivative_mean_temperature<0"}`
+	filter := &models.AlarmFilter{}
+	err := json.Unmarshal([]byte(stored), filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !upgradeKeys(filter) {
+		t.Fatal("expected legacy keys to be renamed")
+	}
+	if filter.Expression != "derivative_10_mean_temperature>1&&mean_temperature>5" {
+		t.Errorf("unexpected expression: %s", filter.Expression)
+	}
+	if filter.ClearExpression != "derivative_10_mean_temperature<0" {
+		t.Errorf("unexpected clear expression: %s", filter.ClearExpression)
+	}
+
+	// Upgraded filter is left as is
+	if upgradeKeys(filter) {
+		t.Error("expected upgraded filter not to be renamed again")
+	}
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+func measurementMetadata(tx *gorm.DB) error {
+
+	sql := `
+CREATE TABLE measurements
+(
+  id               SERIAL                   NOT NULL,
+  created_at       TIMESTAMP WITH TIME ZONE,
+  updated_at       TIMESTAMP WITH TIME ZONE,
+  deleted_at       TIMESTAMP WITH TIME ZONE,
+  device_id        TEXT                     NOT NULL,
+  group_id         TEXT,
+  name             TEXT                     NOT NULL,
+  unit             TEXT,
+  last_measurement TIMESTAMP WITH TIME ZONE,
+
+  CONSTRAINT measurements_pkey
+    PRIMARY KEY (id),
+  CONSTRAINT device_measurement_unique UNIQUE (device_id, name)
+);
+
+CREATE INDEX idx_measurements_deleted_at
+  ON measurements (deleted_at);
+`
+	return tx.Exec(sql).Error
+}
@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+func groupMemberships(tx *gorm.DB) error {
+
+	sql := `
+CREATE TABLE group_memberships
+(
+  id        SERIAL                   NOT NULL,
+  group_id  TEXT                     NOT NULL,
+  device_id TEXT                     NOT NULL,
+  joined_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  left_at   TIMESTAMP WITH TIME ZONE,
+
+  CONSTRAINT group_memberships_pkey
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX idx_group_memberships_group
+  ON group_memberships (group_id, joined_at);
+`
+	return tx.Exec(sql).Error
+}
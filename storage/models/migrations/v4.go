@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+func alarmBaselines(tx *gorm.DB) error {
+
+	sql := `
+CREATE TABLE alarm_baselines
+(
+  id             SERIAL                   NOT NULL,
+  alarm_id       TEXT                     NOT NULL,
+  device_id      TEXT                     NOT NULL,
+  key            TEXT                     NOT NULL,
+  config         TEXT,
+  state          TEXT,
+  streak         BIGINT,
+  last_z         DOUBLE PRECISION,
+  last_value     DOUBLE PRECISION,
+  last_timestamp TIMESTAMP WITH TIME ZONE,
+  updated_at     TIMESTAMP WITH TIME ZONE,
+
+  CONSTRAINT alarm_baselines_pkey
+    PRIMARY KEY (id),
+  CONSTRAINT alarm_baselines_alarm_id_fkey
+    FOREIGN KEY (alarm_id) REFERENCES alarms (id)
+      ON DELETE CASCADE,
+  CONSTRAINT alarm_baseline_unique UNIQUE (alarm_id, device_id, key)
+);
+`
+	return tx.Exec(sql).Error
+}
@@ -0,0 +1,21 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+func alarmSeverities(tx *gorm.DB) error {
+
+	sql := `
+ALTER TABLE alarms
+  ADD COLUMN severity       TEXT DEFAULT 'warning',
+  ADD COLUMN fired_severity TEXT;
+
+ALTER TABLE alarm_histories
+  ADD COLUMN severity TEXT;
+
+ALTER TABLE outputs
+  ADD COLUMN min_severity TEXT;
+`
+	return tx.Exec(sql).Error
+}
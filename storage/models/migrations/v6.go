@@ -0,0 +1,20 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+func alarmAcknowledgements(tx *gorm.DB) error {
+
+	sql := `
+ALTER TABLE alarms
+  ADD COLUMN acknowledged BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE alarm_histories
+  ADD COLUMN acknowledged BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD COLUMN acked_by     INTEGER,
+  ADD COLUMN acked_at     TIMESTAMP WITH TIME ZONE,
+  ADD COLUMN ack_comment  TEXT;
+`
+	return tx.Exec(sql).Error
+}
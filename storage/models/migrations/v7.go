@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+func alarmScopes(tx *gorm.DB) error {
+
+	sql := `
+ALTER TABLE alarms
+  ADD COLUMN scope     TEXT DEFAULT 'group',
+  ADD COLUMN device_id TEXT;
+
+ALTER TABLE alarm_histories
+  ADD COLUMN device_id TEXT;
+
+CREATE TABLE alarm_device_states
+(
+  id             SERIAL                   NOT NULL,
+  alarm_id       TEXT                     NOT NULL,
+  device_id      TEXT                     NOT NULL,
+  fired          BOOLEAN                  NOT NULL DEFAULT FALSE,
+  fired_severity TEXT,
+  updated_at     TIMESTAMP WITH TIME ZONE,
+
+  CONSTRAINT alarm_device_states_pkey
+    PRIMARY KEY (id),
+  CONSTRAINT alarm_device_states_alarm_id_fkey
+    FOREIGN KEY (alarm_id) REFERENCES alarms (id)
+      ON DELETE CASCADE,
+  CONSTRAINT alarm_device_state_unique UNIQUE (alarm_id, device_id)
+);
+`
+	return tx.Exec(sql).Error
+}
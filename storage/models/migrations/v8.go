@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+func silences(tx *gorm.DB) error {
+
+	sql := `
+ALTER TABLE alarms
+  ADD COLUMN labels TEXT;
+
+CREATE TABLE silences
+(
+  id         TEXT                     NOT NULL,
+  owner_id   INTEGER                  NOT NULL,
+  comment    TEXT,
+  alarm_id   TEXT,
+  group_id   TEXT,
+  device_id  TEXT,
+  labels     TEXT,
+  starts_at  TIMESTAMP WITH TIME ZONE NOT NULL,
+  ends_at    TIMESTAMP WITH TIME ZONE NOT NULL,
+  schedule   TEXT,
+  created_at TIMESTAMP WITH TIME ZONE,
+  updated_at TIMESTAMP WITH TIME ZONE,
+
+  CONSTRAINT silences_pkey
+    PRIMARY KEY (id),
+  CONSTRAINT silences_owner_id_fkey
+    FOREIGN KEY (owner_id) REFERENCES users (id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX silences_owner_ends_at ON silences (owner_id, ends_at);
+`
+	return tx.Exec(sql).Error
+}
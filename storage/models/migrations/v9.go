@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+func inhibitRules(tx *gorm.DB) error {
+
+	sql := `
+ALTER TABLE alarm_histories
+  ADD COLUMN inhibited_by TEXT;
+
+CREATE TABLE inhibit_rules
+(
+  id              TEXT    NOT NULL,
+  owner_id        INTEGER NOT NULL,
+  comment         TEXT,
+  source_alarm_id TEXT    NOT NULL,
+  target_alarm_id TEXT,
+  target_group_id TEXT,
+  created_at      TIMESTAMP WITH TIME ZONE,
+  updated_at      TIMESTAMP WITH TIME ZONE,
+
+  CONSTRAINT inhibit_rules_pkey
+    PRIMARY KEY (id),
+  CONSTRAINT inhibit_rules_owner_id_fkey
+    FOREIGN KEY (owner_id) REFERENCES users (id)
+      ON DELETE CASCADE,
+  CONSTRAINT inhibit_rules_source_alarm_id_fkey
+    FOREIGN KEY (source_alarm_id) REFERENCES alarms (id)
+      ON DELETE CASCADE
+);
+
+CREATE INDEX inhibit_rules_owner_id ON inhibit_rules (owner_id);
+`
+	return tx.Exec(sql).Error
+}
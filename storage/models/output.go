@@ -17,14 +17,20 @@ type Output struct {
 	ErrorTemplate   string
 	OutputChannel   OutputChannel
 	OutputChannelId string
-	Repeat          time.Duration
-	LastPushed      time.Time
-	Enabled         bool      `gorm:"not null; default:'true'"`
-	OnFire          bool      `gorm:"not null; default:'true'"`
-	OnClear         bool      `gorm:"not null; default:'true'"`
-	OnError         bool      `gorm:"not null; default:'true'"`
-	CreatedAt       time.Time `gorm:"not null"`
-	UpdatedAt       time.Time `gorm:"not null"`
+	// Repeat is interval to push fire output again while alarm stays fired and unacknowledged. 0 disables repeats
+	Repeat time.Duration
+	// MaxRepeat is maximum number of repeats per fire, 0 repeats until alarm is cleared or acknowledged.
+	// Repeats are counted separately for each device, see OutputRepeat
+	MaxRepeat int `gorm:"not null"`
+	// MinSeverity is lowest alarm severity output is pushed for. Empty pushes all severities
+	MinSeverity Severity
+	LastPushed  time.Time
+	Enabled     bool      `gorm:"not null; default:'true'"`
+	OnFire      bool      `gorm:"not null; default:'true'"`
+	OnClear     bool      `gorm:"not null; default:'true'"`
+	OnError     bool      `gorm:"not null; default:'true'"`
+	CreatedAt   time.Time `gorm:"not null"`
+	UpdatedAt   time.Time `gorm:"not null"`
 }
 
 func (o *Output) BeforeCreate() error {
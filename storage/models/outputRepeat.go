@@ -0,0 +1,43 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// OutputRepeat tracks repeated pushes of output for fired alarm, or for single device of per-device alarm.
+// Repeats start over each time alarm or device fires
+type OutputRepeat struct {
+	ID       uint   `gorm:"primary_key"`
+	OutputId string `gorm:"not null"`
+	// DeviceId is device of device and per-device alarms, empty for group alarm
+	DeviceId string
+	// Count is number of repeats pushed since alarm or device fired
+	Count int `gorm:"not null"`
+	// LastPushed is time repeat was last queued. Next repeat is due one repeat interval after it
+	LastPushed time.Time
+}
+
+// GetOutputRepeat returns repeats of output for device. Output that hasn't been repeated has no repeats
+func GetOutputRepeat(db *gorm.DB, outputId string, device string) (*OutputRepeat, error) {
+	repeat := &OutputRepeat{}
+	res := db.Where("output_id = ? AND device_id = ?", outputId, device).First(repeat)
+	if res.RecordNotFound() {
+		return &OutputRepeat{OutputId: outputId, DeviceId: device}, nil
+	}
+	return repeat, res.Error
+}
+
+// SaveOutputRepeat creates or updates repeats of output
+func SaveOutputRepeat(db *gorm.DB, repeat *OutputRepeat) error {
+	if repeat.ID == 0 {
+		return db.Create(repeat).Error
+	}
+	return db.Save(repeat).Error
+}
+
+// ResetOutputRepeats starts repeats of alarms outputs over for device
+func ResetOutputRepeats(db *gorm.DB, alarmId string, device string) error {
+	return db.Where("device_id = ? AND output_id IN (SELECT id FROM outputs WHERE alarm_id = ?)", device, alarmId).
+		Delete(&OutputRepeat{}).Error
+}
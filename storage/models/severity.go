@@ -0,0 +1,41 @@
+package models
+
+import "fmt"
+
+// Severity of alarm
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// Level returns severity as comparable number, higher is more severe. Empty severity is 0
+func (s Severity) Level() int {
+	switch s {
+	case SeverityInfo:
+		return 1
+	case SeverityWarning:
+		return 2
+	case SeverityCritical:
+		return 3
+	}
+	return 0
+}
+
+// ParseSeverity validates severity. Empty string returns empty severity
+func ParseSeverity(s string) (Severity, error) {
+	severity := Severity(s)
+	if s != "" && severity.Level() == 0 {
+		return severity, fmt.Errorf("invalid severity '%s', expected info, warning or critical", s)
+	}
+	return severity, nil
+}
+
+// Threshold is additional alarm condition with its own severity
+type Threshold struct {
+	Severity Severity `json:"severity"`
+	// Expression in simplified form, like AlarmFilter.Expression
+	Expression string `json:"expression"`
+}
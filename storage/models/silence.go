@@ -0,0 +1,180 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/tryffel/fusio/util"
+	"strings"
+	"time"
+)
+
+// Silence suppresses outputs of matching alarms. Alarms are still evaluated and history is recorded.
+// Alarm matches if all of set matchers match.
+type Silence struct {
+	ID      string `gorm:"primary_key"`
+	OwnerId uint   `gorm:"not null"`
+	Comment string
+	// Matchers
+	AlarmId  string
+	GroupId  string
+	DeviceId string
+	Labels   Labels `gorm:"type:text"`
+	// Silence is effective between StartsAt and EndsAt. With schedule, only during scheduled occurrences
+	StartsAt  time.Time        `gorm:"not null"`
+	EndsAt    time.Time        `gorm:"not null"`
+	Schedule  *SilenceSchedule `gorm:"type:text"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// SilenceSchedule is recurring daily window, e.g. 22:00 for 2h on mon,tue
+type SilenceSchedule struct {
+	// Weekdays when window starts: mon, tue, wed, thu, fri, sat, sun. Empty is every day
+	Weekdays []string `json:"weekdays,omitempty"`
+	// Start is local time of day, 'HH:MM'
+	Start    string        `json:"start"`
+	Duration time.Duration `json:"duration"`
+	// Zone is IANA time zone of start, defaults to UTC
+	Zone string `json:"zone,omitempty"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Validate schedule and return location and start of day
+func (s *SilenceSchedule) parse() (*time.Location, time.Duration, error) {
+	var hour, minute int
+	_, err := fmt.Sscanf(s.Start, "%d:%d", &hour, &minute)
+	if err != nil || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return nil, 0, fmt.Errorf("invalid schedule start '%s', expected HH:MM", s.Start)
+	}
+	if s.Duration <= 0 {
+		return nil, 0, errors.New("schedule duration must be positive")
+	}
+	for _, v := range s.Weekdays {
+		if _, ok := weekdays[strings.ToLower(v)]; !ok {
+			return nil, 0, fmt.Errorf("invalid weekday '%s'", v)
+		}
+	}
+	location := time.UTC
+	if s.Zone != "" {
+		location, err = time.LoadLocation(s.Zone)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid time zone '%s'", s.Zone)
+		}
+	}
+	return location, time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, nil
+}
+
+// Validate returns error if schedule is invalid
+func (s *SilenceSchedule) Validate() error {
+	_, _, err := s.parse()
+	return err
+}
+
+func (s *SilenceSchedule) onWeekday(day time.Weekday) bool {
+	if len(s.Weekdays) == 0 {
+		return true
+	}
+	for _, v := range s.Weekdays {
+		if weekdays[strings.ToLower(v)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveAt returns true if t is within scheduled window. Window may continue over midnight
+func (s *SilenceSchedule) ActiveAt(t time.Time) bool {
+	location, start, err := s.parse()
+	if err != nil {
+		return false
+	}
+	local := t.In(location)
+	// Check windows that started on earlier days and may still be active
+	days := int(s.Duration/(24*time.Hour)) + 1
+	for i := 0; i <= days; i++ {
+		day := local.AddDate(0, 0, -i)
+		midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, location)
+		windowStart := midnight.Add(start)
+		if !s.onWeekday(windowStart.Weekday()) {
+			continue
+		}
+		if !t.Before(windowStart) && t.Before(windowStart.Add(s.Duration)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *SilenceSchedule) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return errors.New("SilenceSchedule is not string in db (silences.schedule)")
+	}
+	return json.Unmarshal(b, s)
+}
+
+func (s SilenceSchedule) Value() (driver.Value, error) {
+	j, err := json.Marshal(s)
+	return string(j), err
+}
+
+// Silence states
+const (
+	SilenceActive   = "active"
+	SilenceUpcoming = "upcoming"
+	SilenceExpired  = "expired"
+)
+
+// State returns silence state at given time. Scheduled silence is upcoming between its windows
+func (s *Silence) State(t time.Time) string {
+	if !t.Before(s.EndsAt) {
+		return SilenceExpired
+	}
+	if t.Before(s.StartsAt) {
+		return SilenceUpcoming
+	}
+	if s.Schedule != nil && !s.Schedule.ActiveAt(t) {
+		return SilenceUpcoming
+	}
+	return SilenceActive
+}
+
+// Matches returns true if silence matches alarm. Device is device alarm was fired for, if any
+func (s *Silence) Matches(alarm *Alarm, device string) bool {
+	if s.AlarmId != "" && s.AlarmId != alarm.ID {
+		return false
+	}
+	if s.GroupId != "" && s.GroupId != alarm.Group {
+		return false
+	}
+	if s.DeviceId != "" && s.DeviceId != device {
+		return false
+	}
+	return alarm.Labels.Matches(s.Labels)
+}
+
+func (s *Silence) BeforeCreate() error {
+	if s.ID == "" {
+		s.ID = util.NewUuid()
+	}
+	return nil
+}
+
+// GetSilences returns silences of owner that end after given time
+func GetSilences(db *gorm.DB, ownerId uint, after time.Time) (*[]Silence, error) {
+	silences := &[]Silence{}
+	res := db.Where("owner_id = ? AND ends_at > ?", ownerId, after).Order("starts_at asc").Find(silences)
+	return silences, res.Error
+}
@@ -9,14 +9,41 @@ import (
 type Alarm interface {
 	Create(alarm *models.Alarm) error
 	Update(alarm *models.Alarm) error
+	// Remove alarm along with its history and outputs
 	Remove(alarm *models.Alarm) error
 	FindById(id string) (*models.Alarm, error)
 	FindByOwner(id int) (*[]models.Alarm, error)
 	FindByOwnerAndId(id string, owner int) (*models.Alarm, error)
-	// Fire alarm
-	Fire(alarm *models.Alarm, value float32, timestamp time.Time) error
+	// Fire alarm with given severity
+	Fire(alarm *models.Alarm, value float32, severity models.Severity, timestamp time.Time) error
+	// SetSeverity changes severity of fired alarm
+	SetSeverity(alarm *models.Alarm, severity models.Severity) error
 	// Clear firing alarm
 	Clear(alarm *models.Alarm, timestamp time.Time) error
+	// GetDeviceStates gets device states of per-device alarm
+	GetDeviceStates(alarm *models.Alarm) (*[]models.AlarmDeviceState, error)
+	// FireDevice fires single device of per-device alarm
+	FireDevice(alarm *models.Alarm, state *models.AlarmDeviceState, value float32, severity models.Severity,
+		timestamp time.Time) error
+	// SetDeviceSeverity changes severity of fired device in per-device alarm
+	SetDeviceSeverity(alarm *models.Alarm, state *models.AlarmDeviceState, severity models.Severity) error
+	// ClearDevice clears single device of per-device alarm
+	ClearDevice(alarm *models.Alarm, state *models.AlarmDeviceState, timestamp time.Time) error
+	// SetState sets alarm, or device of per-device alarm if state is set, pending or inactive and records transition
+	SetState(alarm *models.Alarm, state *models.AlarmDeviceState, to models.AlarmState, timestamp time.Time) error
+	// SetFlapping marks alarm, or device of per-device alarm if state is set, flapping or stable
+	SetFlapping(alarm *models.Alarm, state *models.AlarmDeviceState, flapping bool) error
+	// CountTransitions counts how many times alarm, or device of per-device alarm, has fired or resolved since time
+	CountTransitions(alarm *models.Alarm, state *models.AlarmDeviceState, since time.Time) (int, error)
+	// GetTransitions gets newest state transitions of alarm. Empty device gets transitions of all devices
+	GetTransitions(alarm *models.Alarm, device string, limit int) (*[]models.AlarmTransition, error)
+	// Acknowledge fired alarm by user. Acknowledgement is removed when alarm clears
+	Acknowledge(alarm *models.Alarm, userId uint, comment string, timestamp time.Time) error
+	// Unacknowledge removes acknowledgement of fired alarm
+	Unacknowledge(alarm *models.Alarm) error
+	// ResetState clears alarm and its learned state so it is evaluated from scratch.
+	// This is needed whenever alarm condition changes
+	ResetState(alarm *models.Alarm) error
 	// GetAlarmsToValuate gets all alarms that should be evaluated withing defined interval
 	GetAlarmsToValuate(interval time.Duration) (*[]models.Alarm, error)
 
@@ -26,5 +53,18 @@ type Alarm interface {
 	// GetHistorySize gets number of historical events for alarm
 	GetHistorySize(alarm *models.Alarm) (int, error)
 
+	// GetHistory gets history items for given alarms that were active between from and to
+	GetHistory(alarmIds []string, from time.Time, to time.Time) (*[]models.AlarmHistory, error)
+
+	// QueryHistory gets history items of owners alarms matching query, newest first
+	QueryHistory(query *models.AlarmHistoryQuery) (*[]models.AlarmHistory, error)
+
 	UpdateRunTimestamp(alarm *models.Alarm, timestamp time.Time) error
+
+	// GetBaselines gets learned baselines of anomaly alarm
+	GetBaselines(alarm *models.Alarm) (*[]models.AlarmBaseline, error)
+	// SaveBaseline creates or updates baseline
+	SaveBaseline(baseline *models.AlarmBaseline) error
+	// ClearBaselines removes baselines of alarm, so they are rebuilt from history
+	ClearBaselines(alarm *models.Alarm) error
 }
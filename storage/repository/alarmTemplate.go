@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"github.com/tryffel/fusio/storage/models"
+)
+
+// AlarmTemplate manages templates that alarms can be created from
+type AlarmTemplate interface {
+	Create(template *models.AlarmTemplate) error
+	Update(template *models.AlarmTemplate) error
+	// Remove template. Alarms created from template are kept
+	Remove(template *models.AlarmTemplate) error
+	FindByOwnerAndId(ownerId uint, id string) (*models.AlarmTemplate, error)
+	FindByOwner(ownerId uint) (*[]models.AlarmTemplate, error)
+	// GetAlarms gets alarms linked to template
+	GetAlarms(template *models.AlarmTemplate) (*[]models.Alarm, error)
+	// CreateAlarm creates alarm of template with outputs of template. Nothing is created if any of them fails
+	CreateAlarm(template *models.AlarmTemplate, alarm *models.Alarm) error
+}
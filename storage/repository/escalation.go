@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"github.com/tryffel/fusio/storage/models"
+	"time"
+)
+
+// Escalation manages escalation policies and running escalations of fired alarms
+type Escalation interface {
+	CreatePolicy(policy *models.EscalationPolicy) error
+	UpdatePolicy(policy *models.EscalationPolicy) error
+	// RemovePolicy removes policy from alarms and stops its escalations
+	RemovePolicy(policy *models.EscalationPolicy) error
+	FindPolicyById(id string) (*models.EscalationPolicy, error)
+	FindPolicyByOwnerAndId(ownerId uint, id string) (*models.EscalationPolicy, error)
+	FindPoliciesByOwner(ownerId uint) (*[]models.EscalationPolicy, error)
+
+	// Start escalation of alarm and device from first step
+	Start(alarm *models.Alarm, device string, timestamp time.Time) error
+	// Stop escalation of alarm and device. Empty device stops all escalations of alarm
+	Stop(alarmId string, device string) error
+	// GetDue gets escalations that have step due at given time
+	GetDue(timestamp time.Time) (*[]models.Escalation, error)
+	// Update escalation after running step
+	Update(escalation *models.Escalation) error
+}
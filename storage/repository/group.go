@@ -1,6 +1,9 @@
 package repository
 
-import "github.com/tryffel/fusio/storage/models"
+import (
+	"github.com/tryffel/fusio/storage/models"
+	"time"
+)
 
 type SearchGroupsOpts struct {
 	OwnerId     uint
@@ -23,9 +26,14 @@ type Group interface {
 
 	// AddDevices adds given devices to group. This doesn't validate devices
 	AddDevices(group *models.Group, ids []string) error
+	// RemoveDevices removes given devices from group
+	RemoveDevices(group *models.Group, ids []string) error
 	// Search groups by given options.
 	SearchGroups(opts *SearchGroupsOpts) (*[]models.Group, error)
 
 	//GetDevices returns devices assigned to group
 	GetDevices(owner uint, group string) (*[]string, error)
+	// GetDevicesAt returns devices that were assigned to group at given time.
+	// This requires membership history to be enabled
+	GetDevicesAt(owner uint, group string, at time.Time) (*[]string, error)
 }
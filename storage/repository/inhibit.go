@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"github.com/tryffel/fusio/storage/models"
+)
+
+// Inhibit rules suppress outputs of child alarms while parent alarm is fired
+type Inhibit interface {
+	Create(rule *models.InhibitRule) error
+	FindByOwner(ownerId uint) (*[]models.InhibitRule, error)
+	FindByOwnerAndId(ownerId uint, id string) (*models.InhibitRule, error)
+	Remove(rule *models.InhibitRule) error
+	// GetInhibitingAlarm gets fired parent alarm that inhibits alarm, or nil if alarm is not inhibited
+	GetInhibitingAlarm(alarm *models.Alarm) (*models.Alarm, error)
+	// SetInhibited records parent alarm to open history item of alarm and device
+	SetInhibited(alarm *models.Alarm, device string, parent *models.Alarm) error
+	// IsInhibited returns true if latest history item of alarm and device was inhibited
+	IsInhibited(alarm *models.Alarm, device string) (bool, error)
+}
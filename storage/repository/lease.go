@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"time"
+)
+
+// Lease coordinates instances that share database, so that work is done by one instance at a time
+type Lease interface {
+	// Acquire takes or renews lease for holder for ttl. Returns false if other instance holds lease
+	Acquire(name string, holder string, ttl time.Duration) (bool, error)
+	// Release releases lease held by holder
+	Release(name string, holder string) error
+}
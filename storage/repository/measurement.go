@@ -1,17 +1,41 @@
 package repository
 
 import (
+	"context"
 	"github.com/tryffel/fusio/storage/Influxdb"
 	"github.com/tryffel/fusio/storage/models"
 	"time"
 )
 
+// MeasurementInfo summary of single measurement key
+type MeasurementInfo struct {
+	// Device that last reported key
+	Device    string
+	Key       string
+	Unit      string
+	LastValue float32
+	LastSeen  time.Time
+	// Number of points over last 24h
+	Count int64
+}
+
 // Interface for managing measurements on both relational and time-series database
 type Measurement interface {
 	Write(device *models.Device, measurements Influxdb.Measurements) error
-	Read(device string, group string, filters []Influxdb.Filter, from time.Time, to time.Time, n int64) (Influxdb.Batch, error)
+	// Read reads filters of device or group. Read is abandoned once ctx is done
+	Read(ctx context.Context, device string, group string, filters []Influxdb.Filter, from time.Time, to time.Time, n int64, opts *Influxdb.ReadOpts) (Influxdb.Batch, error)
 	WriteMetrics(name string, value float64) error
 	WriteMetricsBatch(batch *map[string]float64) error
 	GetDeviceMeasurements(device string) ([]string, error)
 	GetGroupMeasurements(group string) ([]string, error)
+
+	// GetDeviceCatalog gets summary of each measurement key for device
+	GetDeviceCatalog(device string) ([]MeasurementInfo, error)
+	// GetGroupCatalog gets summary of each measurement key for all devices in group
+	GetGroupCatalog(group string) ([]MeasurementInfo, error)
+	// GetLastSeen gets time each key was last reported by any of devices since given time. Unlike catalog,
+	// it isn't limited to last 24h. Read is abandoned once ctx is done
+	GetLastSeen(ctx context.Context, devices []string, since time.Time) (map[string]time.Time, error)
+	// SetUnit sets unit for devices measurement key
+	SetUnit(device string, key string, unit string) error
 }
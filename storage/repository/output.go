@@ -21,6 +21,12 @@ type Output interface {
 	// Mark Output as used. Updates outputs lastPushed timestamp as well as creates
 	// OutputHistory with provided data
 	MarkPushed(output *models.Output, success bool, errMsg string) error
+
+	// GetRepeat returns repeats of output for device. Empty device is alarm itself
+	GetRepeat(output *models.Output, device string) (*models.OutputRepeat, error)
+	UpdateRepeat(repeat *models.OutputRepeat) error
+	// ResetRepeats starts repeats of alarms outputs over when alarm or its device fires
+	ResetRepeats(alarmId string, device string) error
 }
 
 type OutputChannel interface {
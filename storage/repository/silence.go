@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"github.com/tryffel/fusio/storage/models"
+	"time"
+)
+
+// Silence suppresses outputs of matching alarms
+type Silence interface {
+	Create(silence *models.Silence) error
+	Update(silence *models.Silence) error
+	FindByOwnerAndId(ownerId uint, id string) (*models.Silence, error)
+	// FindByOwner gets silences of owner that have not ended before given time
+	FindByOwner(ownerId uint, after time.Time) (*[]models.Silence, error)
+	// Expire ends silence at given time
+	Expire(silence *models.Silence, timestamp time.Time) error
+	// IsSilenced returns true if any active silence of alarm owner matches alarm and device
+	IsSilenced(alarm *models.Alarm, device string, timestamp time.Time) (bool, error)
+}
@@ -1,9 +1,7 @@
 package repository_impl
 
 import (
-	"fmt"
 	"github.com/jinzhu/gorm"
-	"github.com/tryffel/fusio/err"
 	"github.com/tryffel/fusio/storage/models"
 	"github.com/tryffel/fusio/storage/repository"
 	"time"
@@ -25,29 +23,7 @@ func NewAlarmRepository(db *gorm.DB) repository.Alarm {
 
 func (r *AlarmRepository) Clear(alarm *models.Alarm, timestamp time.Time) error {
 	// Clear alarm and update alarm history
-	if !alarm.Fired {
-		return nil
-	}
-
-	h := &models.AlarmHistory{}
-	res := r.db.Where("alarm_id = ? AND cleared = False", alarm.ID).First(h)
-	err := getDatabaseError(res.Error)
-	if err == nil && h.ID > 0 {
-
-		h.Cleared = true
-		h.ClearedAt = timestamp
-		res := r.db.Save(&h)
-		if res.Error != nil {
-			return getDatabaseError(res.Error)
-		}
-
-		alarm.Fired = false
-		res = r.db.Model(*alarm).Update("fired", false)
-		return getDatabaseError(res.Error)
-
-	} else {
-		return Err.Wrap(&err, fmt.Sprintf("no alarm history found for alarm %s", alarm.ID))
-	}
+	return getDatabaseError(alarm.Clear(r.db, timestamp))
 }
 
 func (r *AlarmRepository) GetAlarmsToValuate(interval time.Duration) (*[]models.Alarm, error) {
@@ -60,12 +36,15 @@ func (r *AlarmRepository) Create(alarm *models.Alarm) error {
 }
 
 func (r *AlarmRepository) Update(alarm *models.Alarm) error {
-	return r.db.Update(*alarm).Error
+	return getDatabaseError(r.db.Save(alarm).Error)
 }
 
 func (r *AlarmRepository) Remove(alarm *models.Alarm) error {
-	// Need to handle deleting alarm history
-	panic("implement me")
+	return getDatabaseError(models.DeleteAlarm(r.db, alarm.ID))
+}
+
+func (r *AlarmRepository) ResetState(alarm *models.Alarm) error {
+	return getDatabaseError(alarm.ResetState(r.db, time.Now()))
 }
 
 func (r *AlarmRepository) FindById(id string) (*models.Alarm, error) {
@@ -84,8 +63,59 @@ func (r *AlarmRepository) FindByOwnerAndId(id string, owner int) (*models.Alarm,
 	return alarm, res.Error
 }
 
-func (r *AlarmRepository) Fire(alarm *models.Alarm, value float32, timestamp time.Time) error {
-	return alarm.Fire(r.db, value, timestamp)
+func (r *AlarmRepository) Fire(alarm *models.Alarm, value float32, severity models.Severity, timestamp time.Time) error {
+	return alarm.Fire(r.db, value, severity, timestamp)
+}
+
+func (r *AlarmRepository) SetSeverity(alarm *models.Alarm, severity models.Severity) error {
+	return getDatabaseError(alarm.SetSeverity(r.db, severity))
+}
+
+func (r *AlarmRepository) GetDeviceStates(alarm *models.Alarm) (*[]models.AlarmDeviceState, error) {
+	states, err := models.GetAlarmDeviceStates(r.db, alarm.ID)
+	return states, getDatabaseError(err)
+}
+
+func (r *AlarmRepository) FireDevice(alarm *models.Alarm, state *models.AlarmDeviceState, value float32,
+	severity models.Severity, timestamp time.Time) error {
+	return getDatabaseError(alarm.FireDevice(r.db, state, value, severity, timestamp))
+}
+
+func (r *AlarmRepository) SetDeviceSeverity(alarm *models.Alarm, state *models.AlarmDeviceState,
+	severity models.Severity) error {
+	return getDatabaseError(alarm.SetDeviceSeverity(r.db, state, severity))
+}
+
+func (r *AlarmRepository) ClearDevice(alarm *models.Alarm, state *models.AlarmDeviceState, timestamp time.Time) error {
+	return getDatabaseError(alarm.ClearDevice(r.db, state, timestamp))
+}
+
+func (r *AlarmRepository) SetState(alarm *models.Alarm, state *models.AlarmDeviceState, to models.AlarmState,
+	timestamp time.Time) error {
+	return getDatabaseError(alarm.SetState(r.db, state, to, timestamp))
+}
+
+func (r *AlarmRepository) SetFlapping(alarm *models.Alarm, state *models.AlarmDeviceState, flapping bool) error {
+	return getDatabaseError(alarm.SetFlapping(r.db, state, flapping))
+}
+
+func (r *AlarmRepository) CountTransitions(alarm *models.Alarm, state *models.AlarmDeviceState,
+	since time.Time) (int, error) {
+	count, err := alarm.CountTransitions(r.db, state, since)
+	return count, getDatabaseError(err)
+}
+
+func (r *AlarmRepository) GetTransitions(alarm *models.Alarm, device string, limit int) (*[]models.AlarmTransition, error) {
+	transitions, err := models.GetAlarmTransitions(r.db, alarm.ID, device, limit)
+	return transitions, getDatabaseError(err)
+}
+
+func (r *AlarmRepository) Acknowledge(alarm *models.Alarm, userId uint, comment string, timestamp time.Time) error {
+	return getDatabaseError(alarm.Acknowledge(r.db, userId, comment, timestamp))
+}
+
+func (r *AlarmRepository) Unacknowledge(alarm *models.Alarm) error {
+	return getDatabaseError(alarm.Unacknowledge(r.db))
 }
 
 func (r *AlarmRepository) GetHistorySize(alarm *models.Alarm) (int, error) {
@@ -95,3 +125,26 @@ func (r *AlarmRepository) GetHistorySize(alarm *models.Alarm) (int, error) {
 func (r *AlarmRepository) LoadHistory(alarm *models.Alarm) error {
 	return alarm.LoadHistory(r.db)
 }
+
+func (r *AlarmRepository) GetHistory(alarmIds []string, from time.Time, to time.Time) (*[]models.AlarmHistory, error) {
+	history, err := models.GetAlarmHistory(r.db, alarmIds, from, to)
+	return history, getDatabaseError(err)
+}
+
+func (r *AlarmRepository) QueryHistory(query *models.AlarmHistoryQuery) (*[]models.AlarmHistory, error) {
+	history, err := models.QueryAlarmHistory(r.db, query)
+	return history, getDatabaseError(err)
+}
+
+func (r *AlarmRepository) GetBaselines(alarm *models.Alarm) (*[]models.AlarmBaseline, error) {
+	baselines, err := models.GetAlarmBaselines(r.db, alarm.ID)
+	return baselines, getDatabaseError(err)
+}
+
+func (r *AlarmRepository) SaveBaseline(baseline *models.AlarmBaseline) error {
+	return getDatabaseError(r.db.Save(baseline).Error)
+}
+
+func (r *AlarmRepository) ClearBaselines(alarm *models.Alarm) error {
+	return getDatabaseError(models.ClearAlarmBaselines(r.db, alarm.ID))
+}
@@ -0,0 +1,48 @@
+package repository_impl
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/storage/repository"
+)
+
+type AlarmTemplateRepository struct {
+	db *gorm.DB
+}
+
+func NewAlarmTemplateRepository(db *gorm.DB) repository.AlarmTemplate {
+	return &AlarmTemplateRepository{db: db}
+}
+
+func (a *AlarmTemplateRepository) Create(template *models.AlarmTemplate) error {
+	return getDatabaseError(a.db.Create(template).Error)
+}
+
+func (a *AlarmTemplateRepository) Update(template *models.AlarmTemplate) error {
+	return getDatabaseError(a.db.Save(template).Error)
+}
+
+func (a *AlarmTemplateRepository) Remove(template *models.AlarmTemplate) error {
+	return getDatabaseError(models.DeleteAlarmTemplate(a.db, template))
+}
+
+func (a *AlarmTemplateRepository) FindByOwnerAndId(ownerId uint, id string) (*models.AlarmTemplate, error) {
+	template := &models.AlarmTemplate{}
+	res := a.db.Where("owner_id = ? AND id = ?", ownerId, id).First(template)
+	return template, getDatabaseError(res.Error)
+}
+
+func (a *AlarmTemplateRepository) FindByOwner(ownerId uint) (*[]models.AlarmTemplate, error) {
+	templates := &[]models.AlarmTemplate{}
+	res := a.db.Where("owner_id = ?", ownerId).Order("name asc").Find(templates)
+	return templates, getDatabaseError(res.Error)
+}
+
+func (a *AlarmTemplateRepository) GetAlarms(template *models.AlarmTemplate) (*[]models.Alarm, error) {
+	alarms, err := models.GetTemplateAlarms(a.db, template.ID)
+	return alarms, getDatabaseError(err)
+}
+
+func (a *AlarmTemplateRepository) CreateAlarm(template *models.AlarmTemplate, alarm *models.Alarm) error {
+	return getDatabaseError(models.CreateTemplateAlarm(a.db, template, alarm))
+}
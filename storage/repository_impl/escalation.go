@@ -0,0 +1,63 @@
+package repository_impl
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/storage/repository"
+	"time"
+)
+
+type EscalationRepository struct {
+	db *gorm.DB
+}
+
+func NewEscalationRepository(db *gorm.DB) repository.Escalation {
+	return &EscalationRepository{db: db}
+}
+
+func (e *EscalationRepository) CreatePolicy(policy *models.EscalationPolicy) error {
+	return getDatabaseError(e.db.Create(policy).Error)
+}
+
+func (e *EscalationRepository) UpdatePolicy(policy *models.EscalationPolicy) error {
+	return getDatabaseError(e.db.Save(policy).Error)
+}
+
+func (e *EscalationRepository) RemovePolicy(policy *models.EscalationPolicy) error {
+	return getDatabaseError(models.DeleteEscalationPolicy(e.db, policy))
+}
+
+func (e *EscalationRepository) FindPolicyById(id string) (*models.EscalationPolicy, error) {
+	policy := &models.EscalationPolicy{}
+	res := e.db.Where("id = ?", id).First(policy)
+	return policy, getDatabaseError(res.Error)
+}
+
+func (e *EscalationRepository) FindPolicyByOwnerAndId(ownerId uint, id string) (*models.EscalationPolicy, error) {
+	policy := &models.EscalationPolicy{}
+	res := e.db.Where("owner_id = ? AND id = ?", ownerId, id).First(policy)
+	return policy, getDatabaseError(res.Error)
+}
+
+func (e *EscalationRepository) FindPoliciesByOwner(ownerId uint) (*[]models.EscalationPolicy, error) {
+	policies := &[]models.EscalationPolicy{}
+	res := e.db.Where("owner_id = ?", ownerId).Order("name asc").Find(policies)
+	return policies, getDatabaseError(res.Error)
+}
+
+func (e *EscalationRepository) Start(alarm *models.Alarm, device string, timestamp time.Time) error {
+	return getDatabaseError(models.StartEscalation(e.db, alarm, device, timestamp))
+}
+
+func (e *EscalationRepository) Stop(alarmId string, device string) error {
+	return getDatabaseError(models.StopEscalation(e.db, alarmId, device))
+}
+
+func (e *EscalationRepository) GetDue(timestamp time.Time) (*[]models.Escalation, error) {
+	escalations, err := models.GetDueEscalations(e.db, timestamp)
+	return escalations, getDatabaseError(err)
+}
+
+func (e *EscalationRepository) Update(escalation *models.Escalation) error {
+	return getDatabaseError(e.db.Save(escalation).Error)
+}
@@ -7,10 +7,12 @@ import (
 	"github.com/tryffel/fusio/storage/models"
 	"github.com/tryffel/fusio/storage/repository"
 	"strings"
+	"time"
 )
 
 type GroupRepository struct {
-	db *gorm.DB
+	db                *gorm.DB
+	membershipHistory bool
 }
 
 func (g *GroupRepository) AddDevices(group *models.Group, ids []string) error {
@@ -31,8 +33,72 @@ func (g *GroupRepository) AddDevices(group *models.Group, ids []string) error {
 		devices[i].ID = v
 	}
 
-	err := g.db.Model(&group).Association("Devices").Append(&devices).Error
-	return getDatabaseError(err)
+	tx := g.db.Begin()
+	err := tx.Model(&group).Association("Devices").Append(&devices).Error
+	if err == nil && g.membershipHistory {
+		err = models.JoinGroup(tx, group.ID, ids, time.Now())
+	}
+	if err != nil {
+		tx.Rollback()
+		return getDatabaseError(err)
+	}
+	return getDatabaseError(tx.Commit().Error)
+}
+
+func (g *GroupRepository) RemoveDevices(group *models.Group, ids []string) error {
+	// Check that devices are owners devices in group
+	count := 0
+	err := g.db.Table("groups_devices").Joins("JOIN devices ON devices.id = groups_devices.device_id").
+		Where("groups_devices.group_id = ? AND devices.owner_id = ? AND devices.id IN (?)", group.ID, group.OwnerId, ids).
+		Count(&count).Error
+	if err != nil {
+		return getDatabaseError(err)
+	}
+	if count != len(ids) {
+		return &Err.Error{Code: Err.Einvalid, Err: errors.New("some devices are not in group")}
+	}
+
+	devices := make([]models.Device, len(ids))
+	for i, v := range ids {
+		devices[i].ID = v
+	}
+
+	tx := g.db.Begin()
+	err = tx.Model(&group).Association("Devices").Delete(&devices).Error
+	if err == nil && g.membershipHistory {
+		err = models.LeaveGroup(tx, group.ID, ids, time.Now())
+	}
+	if err != nil {
+		tx.Rollback()
+		return getDatabaseError(err)
+	}
+	return getDatabaseError(tx.Commit().Error)
+}
+
+func (g *GroupRepository) GetDevicesAt(owner uint, id string, at time.Time) (*[]string, error) {
+	if !g.membershipHistory {
+		return &[]string{}, &Err.Error{Code: Err.Einvalid, Err: errors.New("group membership history is not enabled")}
+	}
+
+	_, err := g.FindByOwnerAndId(owner, id)
+	if err != nil {
+		return &[]string{}, err
+	}
+
+	// Same memberships that measurements of group are read with
+	memberships, err := models.GetGroupMembers(g.db, id, at, at)
+	if err != nil {
+		return &[]string{}, getDatabaseError(err)
+	}
+	devices := &[]string{}
+	found := make(map[string]bool)
+	for _, v := range *memberships {
+		if !found[v.DeviceId] {
+			found[v.DeviceId] = true
+			*devices = append(*devices, v.DeviceId)
+		}
+	}
+	return devices, nil
 }
 
 func (g *GroupRepository) UserHasAccess(userId uint, groupId []string) (bool, error) {
@@ -142,9 +208,10 @@ func (g *GroupRepository) GetDevices(owner uint, id string) (*[]string, error) {
 	return output, getDatabaseError(e)
 }
 
-func NewGroupRepository(db *gorm.DB) *GroupRepository {
+func NewGroupRepository(db *gorm.DB, membershipHistory bool) *GroupRepository {
 	repo := &GroupRepository{
-		db: db,
+		db:                db,
+		membershipHistory: membershipHistory,
 	}
 	return repo
 }
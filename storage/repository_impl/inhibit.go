@@ -0,0 +1,49 @@
+package repository_impl
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/storage/repository"
+)
+
+type InhibitRepository struct {
+	db *gorm.DB
+}
+
+func NewInhibitRepository(db *gorm.DB) repository.Inhibit {
+	return &InhibitRepository{db: db}
+}
+
+func (i *InhibitRepository) Create(rule *models.InhibitRule) error {
+	return getDatabaseError(i.db.Create(rule).Error)
+}
+
+func (i *InhibitRepository) FindByOwner(ownerId uint) (*[]models.InhibitRule, error) {
+	rules := &[]models.InhibitRule{}
+	res := i.db.Where("owner_id = ?", ownerId).Order("created_at asc").Find(rules)
+	return rules, getDatabaseError(res.Error)
+}
+
+func (i *InhibitRepository) FindByOwnerAndId(ownerId uint, id string) (*models.InhibitRule, error) {
+	rule := &models.InhibitRule{}
+	res := i.db.Where("owner_id = ? AND id = ?", ownerId, id).First(rule)
+	return rule, getDatabaseError(res.Error)
+}
+
+func (i *InhibitRepository) Remove(rule *models.InhibitRule) error {
+	return getDatabaseError(i.db.Delete(rule).Error)
+}
+
+func (i *InhibitRepository) GetInhibitingAlarm(alarm *models.Alarm) (*models.Alarm, error) {
+	parent, err := models.GetInhibitingAlarm(i.db, alarm)
+	return parent, getDatabaseError(err)
+}
+
+func (i *InhibitRepository) SetInhibited(alarm *models.Alarm, device string, parent *models.Alarm) error {
+	return getDatabaseError(alarm.SetInhibited(i.db, device, parent))
+}
+
+func (i *InhibitRepository) IsInhibited(alarm *models.Alarm, device string) (bool, error) {
+	inhibited, err := alarm.IsInhibited(i.db, device)
+	return inhibited, getDatabaseError(err)
+}
@@ -0,0 +1,25 @@
+package repository_impl
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/storage/repository"
+	"time"
+)
+
+type LeaseRepository struct {
+	db *gorm.DB
+}
+
+func NewLeaseRepository(db *gorm.DB) repository.Lease {
+	return &LeaseRepository{db: db}
+}
+
+func (l *LeaseRepository) Acquire(name string, holder string, ttl time.Duration) (bool, error) {
+	acquired, err := models.AcquireLease(l.db, name, holder, ttl)
+	return acquired, getDatabaseError(err)
+}
+
+func (l *LeaseRepository) Release(name string, holder string) error {
+	return getDatabaseError(models.ReleaseLease(l.db, name, holder))
+}
@@ -1,16 +1,21 @@
 package repository_impl
 
 import (
+	"context"
 	"github.com/jinzhu/gorm"
 	"github.com/tryffel/fusio/storage/Influxdb"
 	"github.com/tryffel/fusio/storage/models"
 	"github.com/tryffel/fusio/storage/repository"
+	"sort"
 	"time"
 )
 
 type MeasurementRepository struct {
-	db     *gorm.DB
-	influx Influxdb.Client
+	db      *gorm.DB
+	influx  Influxdb.Client
+	catalog *measurementCatalog
+	// use group membership history instead of current members
+	membershipHistory bool
 }
 
 func (m *MeasurementRepository) GetDeviceMeasurements(device string) ([]string, error) {
@@ -18,21 +23,80 @@ func (m *MeasurementRepository) GetDeviceMeasurements(device string) ([]string,
 }
 
 func (m *MeasurementRepository) GetGroupMeasurements(group string) ([]string, error) {
-	return m.influx.GetGroupMeasurements(group)
+	devices, err := models.GetGroupDeviceIds(m.db, group)
+	if err != nil {
+		return []string{}, getDatabaseError(err)
+	}
+	return m.influx.GetDevicesMeasurements(devices)
 }
 
 func (m *MeasurementRepository) Write(device *models.Device, measurements Influxdb.Measurements) error {
-	if len(device.Groups) == 0 {
-		device.LoadGroups(m.db)
+	err := m.influx.Write(device.ID, measurements)
+	if err == nil {
+		m.catalog.update(device.ID, measurements)
 	}
-	if len(device.Groups) == 0 {
-		m.influx.Write(device.ID, []string{}, measurements)
+	return err
+}
+
+func (m *MeasurementRepository) Read(ctx context.Context, device string, group string, filters []Influxdb.Filter, from time.Time, to time.Time, n int64, opts *Influxdb.ReadOpts) (Influxdb.Batch, error) {
+	if group == "" {
+		var devices []Influxdb.DeviceRange
+		if device != "" {
+			devices = []Influxdb.DeviceRange{{Device: device}}
+		}
+		return m.influx.Read(ctx, devices, filters, from, to, n, opts)
+	}
+
+	devices, err := m.getGroupRanges(group, from, to)
+	if err != nil {
+		return Influxdb.Batch{}, err
 	}
-	return m.influx.Write(device.ID, device.GroupIdList(), measurements)
+	if device != "" {
+		filtered := []Influxdb.DeviceRange{}
+		for _, v := range devices {
+			if v.Device == device {
+				filtered = append(filtered, v)
+			}
+		}
+		devices = filtered
+	}
+	// Empty group has no measurements. Returning here prevents reading all devices
+	if len(devices) == 0 {
+		return Influxdb.Batch{}, nil
+	}
+	return m.influx.Read(ctx, devices, filters, from, to, n, opts)
 }
 
-func (m *MeasurementRepository) Read(device string, group string, filters []Influxdb.Filter, from time.Time, to time.Time, n int64) (Influxdb.Batch, error) {
-	return m.influx.Read(device, group, filters, from, to, n)
+// getGroupRanges returns devices in group. If membership history is enabled, each device is limited to
+// time it has been member of group. Devices that are in group but have no recorded membership
+// (added before history was enabled) are included without limits.
+func (m *MeasurementRepository) getGroupRanges(group string, from time.Time, to time.Time) ([]Influxdb.DeviceRange, error) {
+	if !m.membershipHistory {
+		current, err := models.GetGroupDeviceIds(m.db, group)
+		if err != nil {
+			return []Influxdb.DeviceRange{}, getDatabaseError(err)
+		}
+		devices := make([]Influxdb.DeviceRange, len(current))
+		for i, v := range current {
+			devices[i].Device = v
+		}
+		return devices, nil
+	}
+
+	memberships, err := models.GetGroupMembers(m.db, group, from, to)
+	if err != nil {
+		return []Influxdb.DeviceRange{}, getDatabaseError(err)
+	}
+
+	devices := make([]Influxdb.DeviceRange, 0, len(*memberships))
+	for _, v := range *memberships {
+		r := Influxdb.DeviceRange{Device: v.DeviceId, From: v.JoinedAt}
+		if v.LeftAt != nil {
+			r.To = *v.LeftAt
+		}
+		devices = append(devices, r)
+	}
+	return devices, nil
 }
 
 func (m *MeasurementRepository) WriteMetrics(name string, value float64) error {
@@ -43,9 +107,91 @@ func (m *MeasurementRepository) WriteMetricsBatch(batch *map[string]float64) err
 	return m.influx.WriteMetricsBatch(batch)
 }
 
-func NewMeasurementRepository(db *gorm.DB, influx Influxdb.Client) repository.Measurement {
+func (m *MeasurementRepository) GetDeviceCatalog(device string) ([]repository.MeasurementInfo, error) {
+	info, err := m.catalog.get(device)
+	if err != nil {
+		return info, err
+	}
+
+	units, err := models.GetMeasurementUnits(m.db, []string{device})
+	if err != nil {
+		return info, getDatabaseError(err)
+	}
+	for i, v := range info {
+		info[i].Unit = units[device][v.Key]
+	}
+	sortMeasurementInfo(info)
+	return info, nil
+}
+
+func (m *MeasurementRepository) GetGroupCatalog(group string) ([]repository.MeasurementInfo, error) {
+	devices, err := models.GetGroupDeviceIds(m.db, group)
+	if err != nil {
+		return []repository.MeasurementInfo{}, getDatabaseError(err)
+	}
+	if len(devices) == 0 {
+		return []repository.MeasurementInfo{}, nil
+	}
+
+	units, err := models.GetMeasurementUnits(m.db, devices)
+	if err != nil {
+		return []repository.MeasurementInfo{}, getDatabaseError(err)
+	}
+
+	// Combine keys from all devices. Last value is taken from device that reported latest.
+	keys := make(map[string]*repository.MeasurementInfo)
+	for _, device := range devices {
+		info, err := m.catalog.get(device)
+		if err != nil {
+			return []repository.MeasurementInfo{}, err
+		}
+		for _, v := range info {
+			v.Unit = units[device][v.Key]
+			k := keys[v.Key]
+			if k == nil {
+				item := v
+				keys[v.Key] = &item
+				continue
+			}
+			k.Count += v.Count
+			if v.LastSeen.After(k.LastSeen) {
+				k.Device = v.Device
+				k.LastValue = v.LastValue
+				k.LastSeen = v.LastSeen
+			}
+			if k.Unit == "" {
+				k.Unit = v.Unit
+			}
+		}
+	}
+
+	info := make([]repository.MeasurementInfo, 0, len(keys))
+	for _, v := range keys {
+		info = append(info, *v)
+	}
+	sortMeasurementInfo(info)
+	return info, nil
+}
+
+func (m *MeasurementRepository) GetLastSeen(ctx context.Context, devices []string, since time.Time) (map[string]time.Time, error) {
+	return m.influx.GetLastSeen(ctx, devices, since)
+}
+
+func (m *MeasurementRepository) SetUnit(device string, key string, unit string) error {
+	return getDatabaseError(models.SetMeasurementUnit(m.db, device, key, unit))
+}
+
+func sortMeasurementInfo(info []repository.MeasurementInfo) {
+	sort.Slice(info, func(i, j int) bool {
+		return info[i].Key < info[j].Key
+	})
+}
+
+func NewMeasurementRepository(db *gorm.DB, influx Influxdb.Client, membershipHistory bool) repository.Measurement {
 	return &MeasurementRepository{
-		db:     db,
-		influx: influx,
+		db:                db,
+		influx:            influx,
+		catalog:           newMeasurementCatalog(influx),
+		membershipHistory: membershipHistory,
 	}
 }
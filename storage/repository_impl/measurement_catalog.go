@@ -0,0 +1,152 @@
+package repository_impl
+
+import (
+	"github.com/tryffel/fusio/storage/Influxdb"
+	"github.com/tryffel/fusio/storage/repository"
+	"sync"
+	"time"
+)
+
+const (
+	// Time window to count points for
+	catalogWindow = time.Hour * 24
+	// How often device catalog is reloaded from influxdb, in case some writes were missed
+	catalogRefresh = time.Hour
+)
+
+type catalogKey struct {
+	lastValue float32
+	lastSeen  time.Time
+	// Point counts per hour, key is hours since epoch
+	counts map[int64]int64
+}
+
+type deviceCatalog struct {
+	loaded time.Time
+	keys   map[string]*catalogKey
+}
+
+// measurementCatalog is in-memory cache of each devices measurement keys. Device is loaded from influxdb on first
+// access and after that kept up to date with writes. Point counts are accurate to an hour.
+type measurementCatalog struct {
+	lock    sync.RWMutex
+	devices map[string]*deviceCatalog
+	influx  Influxdb.Client
+}
+
+func newMeasurementCatalog(influx Influxdb.Client) *measurementCatalog {
+	return &measurementCatalog{
+		devices: make(map[string]*deviceCatalog),
+		influx:  influx,
+	}
+}
+
+func catalogHour(t time.Time) int64 {
+	return t.Unix() / 3600
+}
+
+// update cache with new measurements. Devices not yet loaded are skipped, since they are read from influxdb
+// when accessed first time
+func (c *measurementCatalog) update(device string, measurements Influxdb.Measurements) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	d := c.devices[device]
+	if d == nil {
+		return
+	}
+
+	for name, p := range measurements {
+		k := d.keys[name]
+		if k == nil {
+			k = &catalogKey{counts: make(map[int64]int64)}
+			d.keys[name] = k
+		}
+		if !p.Timestamp.Before(k.lastSeen) {
+			k.lastValue = p.Value
+			k.lastSeen = p.Timestamp
+		}
+		k.counts[catalogHour(p.Timestamp)]++
+	}
+}
+
+// load device catalog from influxdb. Writes may happen while influxdb is queried, so result is merged into
+// existing catalog instead of replacing it: newer last value wins and hourly counts keep the higher count.
+// Catalog is created before querying, so that writes during first load are counted as well.
+func (c *measurementCatalog) load(device string) error {
+	c.lock.Lock()
+	if c.devices[device] == nil {
+		c.devices[device] = &deviceCatalog{keys: make(map[string]*catalogKey)}
+	}
+	c.lock.Unlock()
+
+	now := time.Now()
+	status, err := c.influx.GetKeyStatus(device, now.Add(-catalogWindow).Truncate(time.Hour))
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	d := c.devices[device]
+	for _, v := range status {
+		k := d.keys[v.Key]
+		if k == nil {
+			k = &catalogKey{counts: make(map[int64]int64, len(v.Counts))}
+			d.keys[v.Key] = k
+		}
+		if !v.LastSeen.Before(k.lastSeen) {
+			k.lastValue = v.LastValue
+			k.lastSeen = v.LastSeen
+		}
+		for ts, count := range v.Counts {
+			hour := catalogHour(ts)
+			if count > k.counts[hour] {
+				k.counts[hour] = count
+			}
+		}
+	}
+	d.loaded = now
+	return nil
+}
+
+// get summary of devices measurement keys. Unit is not filled
+func (c *measurementCatalog) get(device string) ([]repository.MeasurementInfo, error) {
+	c.lock.RLock()
+	d := c.devices[device]
+	fresh := d != nil && time.Since(d.loaded) < catalogRefresh
+	c.lock.RUnlock()
+
+	if !fresh {
+		err := c.load(device)
+		if err != nil {
+			return []repository.MeasurementInfo{}, err
+		}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	d = c.devices[device]
+
+	oldest := catalogHour(time.Now().Add(-catalogWindow))
+	info := make([]repository.MeasurementInfo, 0, len(d.keys))
+	for name, k := range d.keys {
+		var count int64
+		for hour, n := range k.counts {
+			if hour < oldest {
+				delete(k.counts, hour)
+				continue
+			}
+			count += n
+		}
+		info = append(info, repository.MeasurementInfo{
+			Device:    device,
+			Key:       name,
+			LastValue: k.lastValue,
+			LastSeen:  k.lastSeen,
+			Count:     count,
+		})
+	}
+	return info, nil
+}
@@ -0,0 +1,76 @@
+package repository_impl
+
+import (
+	"github.com/tryffel/fusio/storage/Influxdb"
+	"testing"
+	"time"
+)
+
+// catalogInflux returns fixed key status. Hook is called during query to simulate concurrent writes
+type catalogInflux struct {
+	Influxdb.Client
+	status []Influxdb.KeyStatus
+	hook   func()
+}
+
+func (c *catalogInflux) GetKeyStatus(device string, since time.Time) ([]Influxdb.KeyStatus, error) {
+	if c.hook != nil {
+		c.hook()
+	}
+	return c.status, nil
+}
+
+func catalogCount(t *testing.T, c *measurementCatalog, device string) map[string]int64 {
+	info, err := c.get(device)
+	if err != nil {
+		t.Fatalf("get catalog: %v", err)
+	}
+	counts := make(map[string]int64, len(info))
+	for _, v := range info {
+		counts[v.Key] = v.Count
+	}
+	return counts
+}
+
+func TestMeasurementCatalogLoad(t *testing.T) {
+	now := time.Now()
+	hour := now.Truncate(time.Hour)
+	influx := &catalogInflux{
+		status: []Influxdb.KeyStatus{
+			{Key: "temperature", LastValue: 20, LastSeen: now.Add(-time.Minute),
+				Counts: map[time.Time]int64{hour: 5, hour.Add(-time.Hour): 3}},
+		},
+	}
+	c := newMeasurementCatalog(influx)
+
+	// Writes during first load are counted
+	influx.hook = func() {
+		c.update("device", Influxdb.Measurements{"humidity": {Value: 40, Timestamp: now}})
+	}
+	counts := catalogCount(t, c, "device")
+	if counts["temperature"] != 8 || counts["humidity"] != 1 {
+		t.Errorf("first load: got counts %v", counts)
+	}
+
+	c.update("device", Influxdb.Measurements{"temperature": {Value: 21, Timestamp: now}})
+
+	// Reload doesn't lose writes that influxdb doesn't have yet, or writes during reload
+	influx.hook = func() {
+		c.update("device", Influxdb.Measurements{"temperature": {Value: 22, Timestamp: now.Add(time.Second)}})
+	}
+	err := c.load("device")
+	if err != nil {
+		t.Fatalf("load catalog: %v", err)
+	}
+	counts = catalogCount(t, c, "device")
+	if counts["temperature"] != 10 || counts["humidity"] != 1 {
+		t.Errorf("reload: got counts %v", counts)
+	}
+
+	info, _ := c.get("device")
+	for _, v := range info {
+		if v.Key == "temperature" && v.LastValue != 22 {
+			t.Errorf("reload: got last value %f, want 22", v.LastValue)
+		}
+	}
+}
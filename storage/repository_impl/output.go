@@ -68,10 +68,11 @@ func (o *output) FindByAlarm(alarmId string, opts repository.OutputOpts) (*[]mod
 }
 
 func (o *output) MarkPushed(output *models.Output, success bool, message string) error {
+	// Output may have been edited while it was being pushed, only push time is updated
 	output.LastPushed = time.Now()
-	err := o.Update(output)
+	err := o.db.Model(output).Update("last_pushed", output.LastPushed).Error
 	if err != nil {
-		return err
+		return getDatabaseError(err)
 	}
 
 	history := models.OutputHistory{
@@ -83,6 +84,19 @@ func (o *output) MarkPushed(output *models.Output, success bool, message string)
 	return getDatabaseError(res.Error)
 }
 
+func (o *output) GetRepeat(output *models.Output, device string) (*models.OutputRepeat, error) {
+	repeat, err := models.GetOutputRepeat(o.db, output.ID, device)
+	return repeat, getDatabaseError(err)
+}
+
+func (o *output) UpdateRepeat(repeat *models.OutputRepeat) error {
+	return getDatabaseError(models.SaveOutputRepeat(o.db, repeat))
+}
+
+func (o *output) ResetRepeats(alarmId string, device string) error {
+	return getDatabaseError(models.ResetOutputRepeats(o.db, alarmId, device))
+}
+
 func NewOutputRepository(db *gorm.DB) repository.Output {
 	return &output{
 		db: db,
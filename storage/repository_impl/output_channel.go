@@ -16,20 +16,20 @@ func (c *outputChannel) Create(channel *models.OutputChannel) error {
 
 func (c *outputChannel) FindByOwner(id uint) (*[]models.OutputChannel, error) {
 	out := &[]models.OutputChannel{}
-	res := c.db.Where("owner_id = ?", id)
-	return out, res.Error
+	res := c.db.Where("owner_id = ?", id).Find(out)
+	return out, getDatabaseError(res.Error)
 }
 
 func (c *outputChannel) FindbyId(id string) (*models.OutputChannel, error) {
 	out := &models.OutputChannel{}
-	res := c.db.Where("id = ?", id)
-	return out, res.Error
+	res := c.db.Where("id = ?", id).First(out)
+	return out, getDatabaseError(res.Error)
 }
 
 func (c *outputChannel) FindbyOwnerAndId(ownerId uint, id string) (*models.OutputChannel, error) {
 	out := &models.OutputChannel{}
-	res := c.db.Where("owner_id = ? and id = ?", ownerId, id)
-	return out, res.Error
+	res := c.db.Where("owner_id = ? and id = ?", ownerId, id).First(out)
+	return out, getDatabaseError(res.Error)
 }
 
 func (c *outputChannel) Remove(channel *models.OutputChannel) error {
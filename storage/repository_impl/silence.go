@@ -0,0 +1,56 @@
+package repository_impl
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/storage/repository"
+	"time"
+)
+
+type SilenceRepository struct {
+	db *gorm.DB
+}
+
+func NewSilenceRepository(db *gorm.DB) repository.Silence {
+	return &SilenceRepository{db: db}
+}
+
+func (s *SilenceRepository) Create(silence *models.Silence) error {
+	return getDatabaseError(s.db.Create(silence).Error)
+}
+
+func (s *SilenceRepository) Update(silence *models.Silence) error {
+	return getDatabaseError(s.db.Save(silence).Error)
+}
+
+func (s *SilenceRepository) FindByOwnerAndId(ownerId uint, id string) (*models.Silence, error) {
+	silence := &models.Silence{}
+	res := s.db.Where("owner_id = ? AND id = ?", ownerId, id).First(silence)
+	return silence, getDatabaseError(res.Error)
+}
+
+func (s *SilenceRepository) FindByOwner(ownerId uint, after time.Time) (*[]models.Silence, error) {
+	silences, err := models.GetSilences(s.db, ownerId, after)
+	return silences, getDatabaseError(err)
+}
+
+func (s *SilenceRepository) Expire(silence *models.Silence, timestamp time.Time) error {
+	if !timestamp.Before(silence.EndsAt) {
+		return nil
+	}
+	silence.EndsAt = timestamp
+	return getDatabaseError(s.db.Model(silence).Update("ends_at", timestamp).Error)
+}
+
+func (s *SilenceRepository) IsSilenced(alarm *models.Alarm, device string, timestamp time.Time) (bool, error) {
+	silences, err := models.GetSilences(s.db, alarm.OwnerId, timestamp)
+	if err != nil {
+		return false, getDatabaseError(err)
+	}
+	for _, v := range *silences {
+		if v.State(timestamp) == models.SilenceActive && v.Matches(alarm, device) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -1,6 +1,7 @@
 package repository_mock
 
 import (
+	"fmt"
 	"github.com/tryffel/fusio/storage/models"
 	"github.com/tryffel/fusio/util"
 	"time"
@@ -8,6 +9,32 @@ import (
 
 type MockAlarmRepository struct {
 	storage []models.Alarm
+	// Transitions are recorded state changes of alarms, device states are not supported
+	Transitions []models.AlarmTransition
+	// History holds history items of fired alarms. Items of devices can be added directly
+	History []models.AlarmHistory
+}
+
+// transition records transition of alarm like models.Alarm.SetState does
+func (r *MockAlarmRepository) transition(alarm *models.Alarm, to models.AlarmState, severity models.Severity,
+	timestamp time.Time) {
+	if alarm.GetState() == to {
+		return
+	}
+	r.Transitions = append(r.Transitions, models.AlarmTransition{
+		ID:        uint(len(r.Transitions) + 1),
+		AlarmId:   alarm.ID,
+		FromState: alarm.GetState(),
+		ToState:   to,
+		Severity:  severity,
+		Flapping:  alarm.Flapping,
+		Timestamp: timestamp,
+	})
+	alarm.State = to
+	alarm.PendingSince = time.Time{}
+	if to == models.StatePending {
+		alarm.PendingSince = timestamp
+	}
 }
 
 func (r *MockAlarmRepository) UpdateRunTimestamp(alarm *models.Alarm, timestamp time.Time) error {
@@ -22,6 +49,50 @@ func (r *MockAlarmRepository) GetHistorySize(alarm *models.Alarm) (int, error) {
 	panic("implement me")
 }
 
+func (r *MockAlarmRepository) GetHistory(alarmIds []string, from time.Time, to time.Time) (*[]models.AlarmHistory, error) {
+	history := make([]models.AlarmHistory, 0)
+	for _, v := range r.History {
+		if v.FiredAt.After(to) || (v.Cleared && v.ClearedAt.Before(from)) {
+			continue
+		}
+		for _, id := range alarmIds {
+			if v.AlarmId == id {
+				history = append(history, v)
+			}
+		}
+	}
+	return &history, nil
+}
+
+// updateHistory updates open history items of alarm
+func (r *MockAlarmRepository) updateHistory(alarm *models.Alarm, update func(h *models.AlarmHistory)) {
+	for i := range r.History {
+		if r.History[i].AlarmId == alarm.ID && !r.History[i].Cleared {
+			update(&r.History[i])
+		}
+	}
+}
+
+func (r *MockAlarmRepository) QueryHistory(query *models.AlarmHistoryQuery) (*[]models.AlarmHistory, error) {
+	panic("implement me")
+}
+
+func (r *MockAlarmRepository) GetBaselines(alarm *models.Alarm) (*[]models.AlarmBaseline, error) {
+	panic("implement me")
+}
+
+func (r *MockAlarmRepository) SaveBaseline(baseline *models.AlarmBaseline) error {
+	panic("implement me")
+}
+
+func (r *MockAlarmRepository) ClearBaselines(alarm *models.Alarm) error {
+	panic("implement me")
+}
+
+func (r *MockAlarmRepository) ResetState(alarm *models.Alarm) error {
+	panic("implement me")
+}
+
 func (r *MockAlarmRepository) Create(alarm *models.Alarm) error {
 	if alarm.ID == "" {
 		alarm.ID = util.NewUuid()
@@ -66,13 +137,108 @@ func (r *MockAlarmRepository) FindByOwnerAndId(id string, owner int) (*models.Al
 	return &models.Alarm{}, nil
 }
 
-func (r *MockAlarmRepository) Fire(alarm *models.Alarm, value float32, timestamp time.Time) error {
+func (r *MockAlarmRepository) Fire(alarm *models.Alarm, value float32, severity models.Severity, timestamp time.Time) error {
+	r.transition(alarm, models.StateFiring, severity, timestamp)
+	if !alarm.Fired {
+		h := models.AlarmHistory{AlarmId: alarm.ID, Value: fmt.Sprintf("%f", value), Severity: severity,
+			FiredAt: timestamp}
+		if alarm.GetScope() == models.ScopeDevice {
+			h.DeviceId = alarm.DeviceId
+		}
+		r.History = append(r.History, h)
+	}
 	alarm.Fired = true
+	alarm.FiredSeverity = severity
+	return nil
+}
+
+func (r *MockAlarmRepository) SetSeverity(alarm *models.Alarm, severity models.Severity) error {
+	r.updateHistory(alarm, func(h *models.AlarmHistory) { h.Severity = severity })
+	alarm.FiredSeverity = severity
 	return nil
 }
 
 func (r *MockAlarmRepository) Clear(alarm *models.Alarm, timestamp time.Time) error {
+	r.transition(alarm, models.StateResolved, alarm.FiredSeverity, timestamp)
+	r.updateHistory(alarm, func(h *models.AlarmHistory) {
+		h.Cleared = true
+		h.ClearedAt = timestamp
+	})
 	alarm.Fired = false
+	alarm.FiredSeverity = ""
+	alarm.Acknowledged = false
+	return nil
+}
+
+func (r *MockAlarmRepository) GetDeviceStates(alarm *models.Alarm) (*[]models.AlarmDeviceState, error) {
+	panic("implement me")
+}
+
+func (r *MockAlarmRepository) FireDevice(alarm *models.Alarm, state *models.AlarmDeviceState, value float32,
+	severity models.Severity, timestamp time.Time) error {
+	panic("implement me")
+}
+
+func (r *MockAlarmRepository) SetDeviceSeverity(alarm *models.Alarm, state *models.AlarmDeviceState,
+	severity models.Severity) error {
+	panic("implement me")
+}
+
+func (r *MockAlarmRepository) ClearDevice(alarm *models.Alarm, state *models.AlarmDeviceState, timestamp time.Time) error {
+	panic("implement me")
+}
+
+func (r *MockAlarmRepository) SetState(alarm *models.Alarm, state *models.AlarmDeviceState, to models.AlarmState,
+	timestamp time.Time) error {
+	if state != nil {
+		panic("implement me")
+	}
+	r.transition(alarm, to, "", timestamp)
+	return nil
+}
+
+func (r *MockAlarmRepository) SetFlapping(alarm *models.Alarm, state *models.AlarmDeviceState, flapping bool) error {
+	if state != nil {
+		panic("implement me")
+	}
+	alarm.Flapping = flapping
+	return nil
+}
+
+func (r *MockAlarmRepository) CountTransitions(alarm *models.Alarm, state *models.AlarmDeviceState,
+	since time.Time) (int, error) {
+	if state != nil {
+		panic("implement me")
+	}
+	count := 0
+	for _, v := range r.Transitions {
+		if v.AlarmId == alarm.ID && !v.Timestamp.Before(since) &&
+			(v.ToState == models.StateFiring || v.ToState == models.StateResolved) {
+			count += 1
+		}
+	}
+	return count, nil
+}
+
+func (r *MockAlarmRepository) GetTransitions(alarm *models.Alarm, device string, limit int) (*[]models.AlarmTransition, error) {
+	transitions := make([]models.AlarmTransition, 0)
+	for i := len(r.Transitions) - 1; i >= 0 && len(transitions) < limit; i-- {
+		if r.Transitions[i].AlarmId == alarm.ID {
+			transitions = append(transitions, r.Transitions[i])
+		}
+	}
+	return &transitions, nil
+}
+
+func (r *MockAlarmRepository) Acknowledge(alarm *models.Alarm, userId uint, comment string, timestamp time.Time) error {
+	r.updateHistory(alarm, func(h *models.AlarmHistory) { h.Acknowledged = true })
+	alarm.Acknowledged = true
+	return nil
+}
+
+func (r *MockAlarmRepository) Unacknowledge(alarm *models.Alarm) error {
+	r.updateHistory(alarm, func(h *models.AlarmHistory) { h.Acknowledged = false })
+	alarm.Acknowledged = false
 	return nil
 }
 
@@ -0,0 +1,46 @@
+package repository_mock
+
+import (
+	"errors"
+	"github.com/tryffel/fusio/err"
+	"github.com/tryffel/fusio/storage/models"
+)
+
+// MockDeviceRepository keeps devices in memory
+type MockDeviceRepository struct {
+	Devices []models.Device
+}
+
+func (r *MockDeviceRepository) Create(device *models.Device) error {
+	r.Devices = append(r.Devices, *device)
+	return nil
+}
+
+func (r *MockDeviceRepository) Update(device *models.Device) error {
+	panic("implement me")
+}
+
+func (r *MockDeviceRepository) Delete(device *models.Device) error {
+	panic("implement me")
+}
+
+func (r *MockDeviceRepository) GetById(id string) (*models.Device, error) {
+	for i, v := range r.Devices {
+		if v.ID == id {
+			return &r.Devices[i], nil
+		}
+	}
+	return &models.Device{}, &Err.Error{Code: Err.Enotfound, Err: errors.New("device not found")}
+}
+
+func (r *MockDeviceRepository) GetByOwnerId(id uint) (*[]models.Device, error) {
+	panic("implement me")
+}
+
+func (r *MockDeviceRepository) LoadGroups(device *models.Device) error {
+	panic("implement me")
+}
+
+func (r *MockDeviceRepository) UserHasAccess(userId uint, deviceIds []string) (bool, error) {
+	panic("implement me")
+}
@@ -0,0 +1,89 @@
+package repository_mock
+
+import (
+	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/util"
+	"time"
+)
+
+// MockEscalationRepository keeps policies and escalations in memory
+type MockEscalationRepository struct {
+	Policies    []models.EscalationPolicy
+	Escalations []models.Escalation
+}
+
+func (r *MockEscalationRepository) CreatePolicy(policy *models.EscalationPolicy) error {
+	if policy.ID == "" {
+		policy.ID = util.NewUuid()
+	}
+	r.Policies = append(r.Policies, *policy)
+	return nil
+}
+
+func (r *MockEscalationRepository) UpdatePolicy(policy *models.EscalationPolicy) error {
+	panic("implement me")
+}
+
+func (r *MockEscalationRepository) RemovePolicy(policy *models.EscalationPolicy) error {
+	panic("implement me")
+}
+
+func (r *MockEscalationRepository) FindPolicyById(id string) (*models.EscalationPolicy, error) {
+	for i, v := range r.Policies {
+		if v.ID == id {
+			return &r.Policies[i], nil
+		}
+	}
+	return &models.EscalationPolicy{}, nil
+}
+
+func (r *MockEscalationRepository) FindPolicyByOwnerAndId(ownerId uint, id string) (*models.EscalationPolicy, error) {
+	panic("implement me")
+}
+
+func (r *MockEscalationRepository) FindPoliciesByOwner(ownerId uint) (*[]models.EscalationPolicy, error) {
+	panic("implement me")
+}
+
+func (r *MockEscalationRepository) Start(alarm *models.Alarm, device string, timestamp time.Time) error {
+	r.Stop(alarm.ID, device)
+	r.Escalations = append(r.Escalations, models.Escalation{
+		ID:        uint(len(r.Escalations) + 1),
+		AlarmId:   alarm.ID,
+		DeviceId:  device,
+		PolicyId:  alarm.EscalationPolicyId,
+		NextAt:    timestamp,
+		StartedAt: timestamp,
+	})
+	return nil
+}
+
+func (r *MockEscalationRepository) Stop(alarmId string, device string) error {
+	escalations := make([]models.Escalation, 0, len(r.Escalations))
+	for _, v := range r.Escalations {
+		if v.AlarmId != alarmId || (device != "" && v.DeviceId != device) {
+			escalations = append(escalations, v)
+		}
+	}
+	r.Escalations = escalations
+	return nil
+}
+
+func (r *MockEscalationRepository) GetDue(timestamp time.Time) (*[]models.Escalation, error) {
+	due := make([]models.Escalation, 0)
+	for _, v := range r.Escalations {
+		if !v.NextAt.After(timestamp) {
+			due = append(due, v)
+		}
+	}
+	return &due, nil
+}
+
+func (r *MockEscalationRepository) Update(escalation *models.Escalation) error {
+	for i, v := range r.Escalations {
+		if v.ID == escalation.ID {
+			r.Escalations[i] = *escalation
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package repository_mock
+
+import (
+	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/storage/repository"
+	"github.com/tryffel/fusio/util"
+)
+
+// MockInhibitRepository keeps inhibit rules in memory. Parent alarms are looked up from Alarms
+type MockInhibitRepository struct {
+	Alarms repository.Alarm
+	Rules  []models.InhibitRule
+	// Inhibited holds parent alarm that inhibited alarm or its device, keyed by alarm and device id.
+	// Unlike history, it is not reset when alarm fires again
+	Inhibited map[string]string
+}
+
+func (r *MockInhibitRepository) Create(rule *models.InhibitRule) error {
+	if rule.ID == "" {
+		rule.ID = util.NewUuid()
+	}
+	r.Rules = append(r.Rules, *rule)
+	return nil
+}
+
+func (r *MockInhibitRepository) FindByOwner(ownerId uint) (*[]models.InhibitRule, error) {
+	panic("implement me")
+}
+
+func (r *MockInhibitRepository) FindByOwnerAndId(ownerId uint, id string) (*models.InhibitRule, error) {
+	panic("implement me")
+}
+
+func (r *MockInhibitRepository) Remove(rule *models.InhibitRule) error {
+	panic("implement me")
+}
+
+func (r *MockInhibitRepository) GetInhibitingAlarm(alarm *models.Alarm) (*models.Alarm, error) {
+	for _, v := range r.Rules {
+		if v.OwnerId != alarm.OwnerId || !v.Matches(alarm) {
+			continue
+		}
+		parent, err := r.Alarms.FindById(v.SourceAlarmId)
+		if err != nil {
+			return nil, err
+		}
+		if parent.Fired {
+			return parent, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *MockInhibitRepository) SetInhibited(alarm *models.Alarm, device string, parent *models.Alarm) error {
+	if r.Inhibited == nil {
+		r.Inhibited = map[string]string{}
+	}
+	r.Inhibited[alarm.ID+device] = parent.ID
+	return nil
+}
+
+func (r *MockInhibitRepository) IsInhibited(alarm *models.Alarm, device string) (bool, error) {
+	return r.Inhibited[alarm.ID+device] != "", nil
+}
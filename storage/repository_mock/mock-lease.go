@@ -0,0 +1,37 @@
+package repository_mock
+
+import (
+	"github.com/tryffel/fusio/storage/models"
+	"sync"
+	"time"
+)
+
+// MockLeaseRepository keeps leases in memory
+type MockLeaseRepository struct {
+	lock   sync.Mutex
+	leases map[string]models.Lease
+}
+
+func (r *MockLeaseRepository) Acquire(name string, holder string, ttl time.Duration) (bool, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.leases == nil {
+		r.leases = map[string]models.Lease{}
+	}
+	now := time.Now()
+	lease, ok := r.leases[name]
+	if ok && lease.Holder != holder && lease.ExpiresAt.After(now) {
+		return false, nil
+	}
+	r.leases[name] = models.Lease{Name: name, Holder: holder, ExpiresAt: now.Add(ttl), UpdatedAt: now}
+	return true, nil
+}
+
+func (r *MockLeaseRepository) Release(name string, holder string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.leases[name].Holder == holder {
+		delete(r.leases, name)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package repository_mock
+
+import (
+	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/storage/repository"
+	"github.com/tryffel/fusio/util"
+	"sync"
+	"time"
+)
+
+// MockOutputRepository keeps outputs and their repeats in memory. Outputs are pushed from background queue,
+// so repository is safe for concurrent use
+type MockOutputRepository struct {
+	lock    sync.Mutex
+	Outputs []models.Output
+	Repeats []models.OutputRepeat
+	// History holds pushes marked with MarkPushed
+	History []models.OutputHistory
+}
+
+func (r *MockOutputRepository) Create(output *models.Output) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if output.ID == "" {
+		output.ID = util.NewUuid()
+	}
+	r.Outputs = append(r.Outputs, *output)
+	return nil
+}
+
+func (r *MockOutputRepository) Update(output *models.Output) error {
+	panic("implement me")
+}
+
+func (r *MockOutputRepository) Remove(output *models.Output) error {
+	panic("implement me")
+}
+
+func (r *MockOutputRepository) FindbyId(id string) (*models.Output, error) {
+	panic("implement me")
+}
+
+func (r *MockOutputRepository) FindbyOwnerAndId(ownerId uint, id string) (*models.Output, error) {
+	panic("implement me")
+}
+
+func (r *MockOutputRepository) FindByOwner(id uint) (*[]models.Output, error) {
+	panic("implement me")
+}
+
+func (r *MockOutputRepository) FindByAlarm(alarmId string, opts repository.OutputOpts) (*[]models.Output, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	outputs := make([]models.Output, 0)
+	for _, v := range r.Outputs {
+		if v.AlarmId != alarmId || (opts.OnlyEnabled && !v.Enabled) || (opts.OnFire && !v.OnFire) ||
+			(opts.OnClear && !v.OnClear) || (opts.OnError && !v.OnError) {
+			continue
+		}
+		outputs = append(outputs, v)
+	}
+	return &outputs, nil
+}
+
+func (r *MockOutputRepository) MarkPushed(output *models.Output, success bool, errMsg string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	output.LastPushed = time.Now()
+	r.History = append(r.History, models.OutputHistory{OutputId: output.ID, Success: success, Message: errMsg})
+	return nil
+}
+
+func (r *MockOutputRepository) GetRepeat(output *models.Output, device string) (*models.OutputRepeat, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, v := range r.Repeats {
+		if v.OutputId == output.ID && v.DeviceId == device {
+			repeat := v
+			return &repeat, nil
+		}
+	}
+	return &models.OutputRepeat{OutputId: output.ID, DeviceId: device}, nil
+}
+
+func (r *MockOutputRepository) UpdateRepeat(repeat *models.OutputRepeat) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if repeat.ID == 0 {
+		repeat.ID = uint(len(r.Repeats) + 1)
+		r.Repeats = append(r.Repeats, *repeat)
+		return nil
+	}
+	for i, v := range r.Repeats {
+		if v.ID == repeat.ID {
+			r.Repeats[i] = *repeat
+		}
+	}
+	return nil
+}
+
+func (r *MockOutputRepository) ResetRepeats(alarmId string, device string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	outputs := make(map[string]bool)
+	for _, v := range r.Outputs {
+		if v.AlarmId == alarmId {
+			outputs[v.ID] = true
+		}
+	}
+	repeats := make([]models.OutputRepeat, 0, len(r.Repeats))
+	for _, v := range r.Repeats {
+		if !outputs[v.OutputId] || v.DeviceId != device {
+			repeats = append(repeats, v)
+		}
+	}
+	r.Repeats = repeats
+	return nil
+}
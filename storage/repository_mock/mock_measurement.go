@@ -1,8 +1,10 @@
 package repository_mock
 
 import (
+	"context"
 	"github.com/tryffel/fusio/storage/Influxdb"
 	"github.com/tryffel/fusio/storage/models"
+	"github.com/tryffel/fusio/storage/repository"
 	"time"
 )
 
@@ -13,12 +15,15 @@ type MockMeasurementRepository struct {
 	Measurements map[string]float64
 	Metrics      map[string]float64
 	StoreResults bool
+	// Catalog is returned by GetDeviceCatalog and used for GetLastSeen, key is device id
+	Catalog map[string][]repository.MeasurementInfo
 }
 
 func NewMockMeasurementRepository() *MockMeasurementRepository {
 	return &MockMeasurementRepository{
 		Measurements: make(map[string]float64),
 		Metrics:      make(map[string]float64),
+		Catalog:      make(map[string][]repository.MeasurementInfo),
 	}
 }
 
@@ -29,7 +34,7 @@ func (m *MockMeasurementRepository) Write(device *models.Device, measurements In
 	return nil
 }
 
-func (m *MockMeasurementRepository) Read(device string, group string, filters []Influxdb.Filter, from time.Time, to time.Time, n int64) (Influxdb.Batch, error) {
+func (m *MockMeasurementRepository) Read(ctx context.Context, device string, group string, filters []Influxdb.Filter, from time.Time, to time.Time, n int64, opts *Influxdb.ReadOpts) (Influxdb.Batch, error) {
 	panic("implement me")
 }
 
@@ -54,3 +59,27 @@ func (m *MockMeasurementRepository) GetDeviceMeasurements(device string) ([]stri
 func (m *MockMeasurementRepository) GetGroupMeasurements(group string) ([]string, error) {
 	panic("implement me")
 }
+
+func (m *MockMeasurementRepository) GetDeviceCatalog(device string) ([]repository.MeasurementInfo, error) {
+	return m.Catalog[device], nil
+}
+
+func (m *MockMeasurementRepository) GetGroupCatalog(group string) ([]repository.MeasurementInfo, error) {
+	panic("implement me")
+}
+
+func (m *MockMeasurementRepository) GetLastSeen(ctx context.Context, devices []string, since time.Time) (map[string]time.Time, error) {
+	seen := make(map[string]time.Time)
+	for _, device := range devices {
+		for _, v := range m.Catalog[device] {
+			if !v.LastSeen.Before(since) && v.LastSeen.After(seen[v.Key]) {
+				seen[v.Key] = v.LastSeen
+			}
+		}
+	}
+	return seen, nil
+}
+
+func (m *MockMeasurementRepository) SetUnit(device string, key string, unit string) error {
+	panic("implement me")
+}
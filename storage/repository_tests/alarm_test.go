@@ -3,6 +3,7 @@ package repository_tests
 import (
 	"github.com/tryffel/fusio/storage/models"
 	"testing"
+	"time"
 )
 
 func TestCreateAlarm(t *testing.T) {
@@ -24,3 +25,377 @@ func TestCreateAlarm(t *testing.T) {
 	db.Alarm.Create(alarm)
 
 }
+
+func TestUpdateRemoveAlarm(t *testing.T) {
+	db := getDatabaseFromArgs()
+	if db == nil {
+		t.Error("Failed to open test database")
+		return
+	}
+
+	alarm := &models.Alarm{
+		Name:    "test_alarm_update",
+		Message: "test alarm",
+		OwnerId: 1,
+	}
+	err := db.Alarm.Create(alarm)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	id := alarm.ID
+
+	alarm.Name = "Updated_Alarm"
+	err = db.Alarm.Update(alarm)
+	if err != nil {
+		t.Error(err)
+	}
+	if alarm.ID != id {
+		t.Errorf("Alarm id changed on update: %s -> %s", id, alarm.ID)
+	}
+
+	updated, err := db.Alarm.FindById(id)
+	if err != nil {
+		t.Error(err)
+	} else if updated.LowerName != "updated_alarm" {
+		t.Errorf("Alarm not updated, got name %s", updated.LowerName)
+	}
+
+	silence := &models.Silence{OwnerId: 1, AlarmId: id, StartsAt: time.Now(), EndsAt: time.Now().Add(time.Hour)}
+	err = db.Silence.Create(silence)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Alarm.Remove(alarm)
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = db.Alarm.FindById(id)
+	if err == nil {
+		t.Error("Alarm found after removing it")
+	}
+	silence, err = db.Silence.FindByOwnerAndId(1, silence.ID)
+	if err == nil && silence.ID != "" {
+		t.Error("Silence of alarm found after removing alarm")
+	}
+}
+
+func TestAcknowledgeAlarm(t *testing.T) {
+	db := getDatabaseFromArgs()
+	if db == nil {
+		t.Error("Failed to open test database")
+		return
+	}
+
+	alarm := &models.Alarm{
+		Name:    "test_alarm_ack",
+		Message: "test alarm",
+		OwnerId: 1,
+	}
+	err := db.Alarm.Create(alarm)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer db.Alarm.Remove(alarm)
+
+	err = db.Alarm.Fire(alarm, 10, models.SeverityWarning, time.Now())
+	if err != nil {
+		t.Error(err)
+	}
+	err = db.Alarm.Acknowledge(alarm, 1, "on it", time.Now())
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = db.Alarm.LoadHistory(alarm)
+	if err != nil {
+		t.Error(err)
+	} else if len(alarm.History) != 1 || !alarm.History[0].Acknowledged || alarm.History[0].AckComment != "on it" {
+		t.Error("Acknowledgement not stored to alarm history")
+	}
+
+	err = db.Alarm.Clear(alarm, time.Now())
+	if err != nil {
+		t.Error(err)
+	}
+	if alarm.Acknowledged {
+		t.Error("Acknowledgement not removed when alarm cleared")
+	}
+}
+
+func TestPerDeviceAlarmState(t *testing.T) {
+	db := getDatabaseFromArgs()
+	if db == nil {
+		t.Error("Failed to open test database")
+		return
+	}
+
+	alarm := &models.Alarm{
+		Name:    "test_alarm_per_device",
+		Message: "test alarm",
+		OwnerId: 1,
+		Scope:   models.ScopePerDevice,
+	}
+	err := db.Alarm.Create(alarm)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer db.Alarm.Remove(alarm)
+
+	first := &models.AlarmDeviceState{AlarmId: alarm.ID, DeviceId: "device-1"}
+	second := &models.AlarmDeviceState{AlarmId: alarm.ID, DeviceId: "device-2"}
+	err = db.Alarm.FireDevice(alarm, first, 10, models.SeverityWarning, time.Now())
+	if err != nil {
+		t.Error(err)
+	}
+	err = db.Alarm.FireDevice(alarm, second, 20, models.SeverityCritical, time.Now())
+	if err != nil {
+		t.Error(err)
+	}
+	if !alarm.Fired || alarm.FiredSeverity != models.SeverityCritical {
+		t.Errorf("Alarm not fired with most severe device, got %t, %s", alarm.Fired, alarm.FiredSeverity)
+	}
+
+	err = db.Alarm.ClearDevice(alarm, second, time.Now())
+	if err != nil {
+		t.Error(err)
+	}
+	if !alarm.Fired || alarm.FiredSeverity != models.SeverityWarning {
+		t.Errorf("Alarm cleared with device still fired, got %t, %s", alarm.Fired, alarm.FiredSeverity)
+	}
+
+	err = db.Alarm.ClearDevice(alarm, first, time.Now())
+	if err != nil {
+		t.Error(err)
+	}
+	if alarm.Fired {
+		t.Error("Alarm fired after clearing all devices")
+	}
+
+	// Changing scope resets devices fired with previous scope
+	err = db.Alarm.FireDevice(alarm, first, 10, models.SeverityWarning, time.Now())
+	if err != nil {
+		t.Error(err)
+	}
+	alarm.Scope = models.ScopeGroup
+	err = db.Alarm.ResetState(alarm)
+	if err != nil {
+		t.Error(err)
+	}
+	states, err := db.Alarm.GetDeviceStates(alarm)
+	if err != nil {
+		t.Error(err)
+	} else if len(*states) != 0 {
+		t.Errorf("Device states not cleared on reset, got %d", len(*states))
+	}
+	history, err := db.Alarm.GetHistory([]string{alarm.ID}, time.Now(), time.Now())
+	if err != nil {
+		t.Error(err)
+	}
+	for _, v := range *history {
+		if !v.Cleared {
+			t.Error("History not cleared on reset")
+		}
+	}
+	if alarm.Fired || alarm.GetState() != models.StateInactive {
+		t.Errorf("Alarm not reset, got %t, %s", alarm.Fired, alarm.GetState())
+	}
+}
+
+func TestInhibitRule(t *testing.T) {
+	db := getDatabaseFromArgs()
+	if db == nil {
+		t.Error("Failed to open test database")
+		return
+	}
+
+	parent := &models.Alarm{Name: "test_alarm_gateway", Message: "gateway offline", OwnerId: 1}
+	child := &models.Alarm{Name: "test_alarm_sensor", Message: "sensor offline", OwnerId: 1, Group: "sensors"}
+	for _, v := range []*models.Alarm{parent, child} {
+		err := db.Alarm.Create(v)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer db.Alarm.Remove(v)
+	}
+
+	rule := &models.InhibitRule{OwnerId: 1, SourceAlarmId: parent.ID, TargetGroupId: "sensors"}
+	err := db.Inhibit.Create(rule)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	inhibitor, err := db.Inhibit.GetInhibitingAlarm(child)
+	if err != nil {
+		t.Error(err)
+	} else if inhibitor != nil {
+		t.Error("Alarm inhibited by parent that is not fired")
+	}
+
+	err = db.Alarm.Fire(parent, 1, models.SeverityCritical, time.Now())
+	if err != nil {
+		t.Error(err)
+	}
+	inhibitor, err = db.Inhibit.GetInhibitingAlarm(child)
+	if err != nil {
+		t.Error(err)
+	} else if inhibitor == nil || inhibitor.ID != parent.ID {
+		t.Error("Alarm not inhibited by fired parent")
+	}
+
+	err = db.Alarm.Fire(child, 1, models.SeverityWarning, time.Now())
+	if err != nil {
+		t.Error(err)
+	}
+	err = db.Inhibit.SetInhibited(child, "", parent)
+	if err != nil {
+		t.Error(err)
+	}
+	err = db.Alarm.Clear(parent, time.Now())
+	if err != nil {
+		t.Error(err)
+	}
+	inhibited, err := db.Inhibit.IsInhibited(child, "")
+	if err != nil {
+		t.Error(err)
+	} else if !inhibited {
+		t.Error("Inhibition not kept until child clears")
+	}
+
+	// Device alarm is inhibited with its device
+	device := &models.Alarm{Name: "test_alarm_device", Message: "device offline", OwnerId: 1, Group: "sensors",
+		Scope: models.ScopeDevice, DeviceId: "sensor-1"}
+	err = db.Alarm.Create(device)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer db.Alarm.Remove(device)
+	err = db.Alarm.Fire(device, 1, models.SeverityWarning, time.Now())
+	if err != nil {
+		t.Error(err)
+	}
+	err = db.Inhibit.SetInhibited(device, device.DeviceId, parent)
+	if err != nil {
+		t.Error(err)
+	}
+	inhibited, err = db.Inhibit.IsInhibited(device, device.DeviceId)
+	if err != nil {
+		t.Error(err)
+	} else if !inhibited {
+		t.Error("Device alarm not inhibited")
+	}
+}
+
+func TestQueryAlarmHistory(t *testing.T) {
+	db := getDatabaseFromArgs()
+	if db == nil {
+		t.Error("Failed to open test database")
+		return
+	}
+
+	alarm := &models.Alarm{Name: "test_alarm_history", Message: "test alarm", OwnerId: 1}
+	err := db.Alarm.Create(alarm)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer db.Alarm.Remove(alarm)
+
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 3; i++ {
+		severity := models.SeverityWarning
+		if i == 1 {
+			severity = models.SeverityCritical
+		}
+		db.Alarm.Fire(alarm, float32(i), severity, start.Add(time.Duration(i)*10*time.Minute))
+		db.Alarm.Clear(alarm, start.Add(time.Duration(i)*10*time.Minute+time.Minute))
+	}
+
+	query := &models.AlarmHistoryQuery{OwnerId: 1, AlarmId: alarm.ID, Limit: 2}
+	history, err := db.Alarm.QueryHistory(query)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(*history) != 2 || (*history)[0].ID < (*history)[1].ID {
+		t.Errorf("Expected 2 newest items first, got %v", *history)
+		return
+	}
+
+	query.Cursor = (*history)[1].ID
+	history, err = db.Alarm.QueryHistory(query)
+	if err != nil {
+		t.Error(err)
+	} else if len(*history) != 1 || (*history)[0].Value != "0.000000" {
+		t.Errorf("Next page should have oldest item, got %v", *history)
+	}
+
+	query = &models.AlarmHistoryQuery{OwnerId: 1, AlarmId: alarm.ID, Severities: []models.Severity{models.SeverityCritical}}
+	history, err = db.Alarm.QueryHistory(query)
+	if err != nil {
+		t.Error(err)
+	} else if len(*history) != 1 {
+		t.Errorf("Expected 1 critical item, got %d", len(*history))
+	}
+
+	query = &models.AlarmHistoryQuery{OwnerId: 2, AlarmId: alarm.ID}
+	history, err = db.Alarm.QueryHistory(query)
+	if err != nil {
+		t.Error(err)
+	} else if len(*history) != 0 {
+		t.Error("History of other users alarm returned")
+	}
+}
+
+func TestAlarmLease(t *testing.T) {
+	db := getDatabaseFromArgs()
+	if db == nil {
+		t.Error("Failed to open test database")
+		return
+	}
+	name := "test_lease"
+	ttl := time.Second
+	defer db.Lease.Release(name, "b")
+
+	tests := []struct {
+		holder   string
+		wait     time.Duration
+		acquired bool
+	}{
+		{"a", 0, true},
+		{"b", 0, false},
+		// Holder renews lease
+		{"a", time.Millisecond * 500, true},
+		{"b", time.Millisecond * 700, false},
+		// Lease expired, other instance takes over
+		{"b", time.Millisecond * 500, true},
+		{"a", 0, false},
+	}
+	for i, v := range tests {
+		time.Sleep(v.wait)
+		acquired, err := db.Lease.Acquire(name, v.holder, ttl)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if acquired != v.acquired {
+			t.Errorf("lease %d for %s: expected %t, got %t", i, v.holder, v.acquired, acquired)
+		}
+	}
+
+	err := db.Lease.Release(name, "b")
+	if err != nil {
+		t.Error(err)
+	}
+	acquired, err := db.Lease.Acquire(name, "a", ttl)
+	if err != nil || !acquired {
+		t.Error("released lease should be free", err)
+	}
+	db.Lease.Release(name, "a")
+}
@@ -21,6 +21,9 @@ type Database struct {
 	ApiKey        repository.ApiKey
 	Output        repository.Output
 	OutputChannel repository.OutputChannel
+	Inhibit       repository.Inhibit
+	Silence       repository.Silence
+	Lease         repository.Lease
 	Errors        repository.Errors
 }
 
@@ -73,24 +76,38 @@ func getDatabaseFromArgs() *Database {
 	}
 
 	db.Alarm = repository_impl.NewAlarmRepository(db.db)
-	db.Group = repository_impl.NewGroupRepository(db.db)
+	db.Group = repository_impl.NewGroupRepository(db.db, true)
 	//db.Measurement = repository_impl.meas
 	db.User = repository_impl.NewUserRepository(db.db)
 	db.Device = repository_impl.NewDeviceRepository(db.db)
 	db.ApiKey = repository_impl.NewApiKeyRepository(db.db)
 	db.Output = repository_impl.NewOutputRepository(db.db)
 	db.OutputChannel = repository_impl.NewOutputChannelRepository(db.db)
+	db.Inhibit = repository_impl.NewInhibitRepository(db.db)
+	db.Silence = repository_impl.NewSilenceRepository(db.db)
+	db.Lease = repository_impl.NewLeaseRepository(db.db)
 	db.Errors = repository_impl.NewErrors(dbType)
 
 	db.db.AutoMigrate(&models.User{})
 	db.db.AutoMigrate(&models.Device{})
 	db.db.AutoMigrate(&models.Measurement{})
 	db.db.AutoMigrate(&models.Group{})
+	db.db.AutoMigrate(&models.GroupMembership{})
 	db.db.AutoMigrate(&models.Alarm{})
 	db.db.AutoMigrate(&models.AlarmHistory{})
+	db.db.AutoMigrate(&models.AlarmBaseline{})
+	db.db.AutoMigrate(&models.AlarmDeviceState{})
+	db.db.AutoMigrate(&models.AlarmTransition{})
+	db.db.AutoMigrate(&models.Silence{})
+	db.db.AutoMigrate(&models.InhibitRule{})
+	db.db.AutoMigrate(&models.EscalationPolicy{})
+	db.db.AutoMigrate(&models.Escalation{})
+	db.db.AutoMigrate(&models.AlarmTemplate{})
+	db.db.AutoMigrate(&models.Lease{})
 	db.db.AutoMigrate(&models.ApiKey{})
 	db.db.AutoMigrate(&models.OutputChannel{})
 	db.db.AutoMigrate(&models.Output{})
+	db.db.AutoMigrate(&models.OutputRepeat{})
 	db.db.AutoMigrate(&models.OutputHistory{})
 
 	return db
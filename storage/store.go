@@ -24,6 +24,11 @@ type Store struct {
 	ApiKey        repository.ApiKey
 	Output        repository.Output
 	OutputChannel repository.OutputChannel
+	Silence       repository.Silence
+	Inhibit       repository.Inhibit
+	Escalation    repository.Escalation
+	AlarmTemplate repository.AlarmTemplate
+	Lease         repository.Lease
 	Errors        repository.Errors
 }
 
@@ -44,13 +49,18 @@ func NewStore(confDb *config.Database, confInflux *config.Influxdb, logging *con
 	store.influxdb = influx
 
 	store.Alarm = repository_impl.NewAlarmRepository(store.database.GetEngine())
-	store.Group = repository_impl.NewGroupRepository(store.database.GetEngine())
-	store.Measurement = repository_impl.NewMeasurementRepository(store.database.GetEngine(), store.influxdb)
+	store.Group = repository_impl.NewGroupRepository(store.database.GetEngine(), confDb.MembershipHistory)
+	store.Measurement = repository_impl.NewMeasurementRepository(store.database.GetEngine(), store.influxdb, confDb.MembershipHistory)
 	store.User = repository_impl.NewUserRepository(store.database.GetEngine())
 	store.Device = repository_impl.NewDeviceRepository(store.database.GetEngine())
 	store.ApiKey = repository_impl.NewApiKeyRepository(store.database.GetEngine())
 	store.Output = repository_impl.NewOutputRepository(store.database.GetEngine())
 	store.OutputChannel = repository_impl.NewOutputChannelRepository(store.database.GetEngine())
+	store.Silence = repository_impl.NewSilenceRepository(store.database.GetEngine())
+	store.Inhibit = repository_impl.NewInhibitRepository(store.database.GetEngine())
+	store.Escalation = repository_impl.NewEscalationRepository(store.database.GetEngine())
+	store.AlarmTemplate = repository_impl.NewAlarmTemplateRepository(store.database.GetEngine())
+	store.Lease = repository_impl.NewLeaseRepository(store.database.GetEngine())
 	store.Errors = repository_impl.NewErrors(store.engine)
 	return store, nil
 }
@@ -66,6 +76,12 @@ func (s *Store) GetDb() *gorm.DB {
 func NewMockStore() (*Store, error) {
 	store := &Store{}
 	store.Alarm = &repository_mock.MockAlarmRepository{}
+	store.Device = &repository_mock.MockDeviceRepository{}
 	store.Measurement = repository_mock.NewMockMeasurementRepository()
+	store.Escalation = &repository_mock.MockEscalationRepository{}
+	store.Output = &repository_mock.MockOutputRepository{}
+	store.Silence = &repository_mock.MockSilenceRepository{}
+	store.Inhibit = &repository_mock.MockInhibitRepository{Alarms: store.Alarm}
+	store.Lease = &repository_mock.MockLeaseRepository{}
 	return store, nil
 }